@@ -2,15 +2,14 @@
 package api
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
-	"os"
 	"reflect"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
@@ -35,10 +34,10 @@ func interfaceIsEmpty(i interface{}) bool {
 	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
 }
 
-func sortedKeys(paths map[string]*conf.Path) []string {
-	ret := make([]string, len(paths))
+func sortedKeys[T any](m map[string]T) []string {
+	ret := make([]string, len(m))
 	i := 0
-	for name := range paths {
+	for name := range m {
 		ret[i] = name
 		i++
 	}
@@ -57,6 +56,7 @@ func paramName(ctx *gin.Context) (string, bool) {
 }
 
 func recordingsOfPath(
+	index *recordstore.Index,
 	pathConf *conf.Path,
 	pathName string,
 ) *defs.APIRecording {
@@ -64,7 +64,7 @@ func recordingsOfPath(
 		Name: pathName,
 	}
 
-	segments, _ := recordstore.FindSegments(pathConf, pathName)
+	segments, _ := index.FindSegments(pathConf, pathName)
 
 	ret.Segments = make([]*defs.APIRecordingSegment, len(segments))
 
@@ -147,6 +147,7 @@ type API struct {
 	HLSServer      HLSServer
 	WebRTCServer   WebRTCServer
 	SRTServer      SRTServer
+	RecordIndex    *recordstore.Index
 	Parent         apiParent
 
 	httpServer *httpp.WrappedServer
@@ -174,6 +175,13 @@ func (a *API) Initialize() error {
 	group.POST("/v3/config/paths/replace/*name", a.onConfigPathsReplace)
 	group.DELETE("/v3/config/paths/delete/*name", a.onConfigPathsDelete)
 
+	group.GET("/v3/config/cameras/list", a.onConfigCamerasList)
+	group.GET("/v3/config/cameras/get/*name", a.onConfigCamerasGet)
+	group.POST("/v3/config/cameras/add/*name", a.onConfigCamerasAdd)
+	group.PATCH("/v3/config/cameras/patch/*name", a.onConfigCamerasPatch)
+	group.POST("/v3/config/cameras/replace/*name", a.onConfigCamerasReplace)
+	group.DELETE("/v3/config/cameras/delete/*name", a.onConfigCamerasDelete)
+
 	group.GET("/v3/paths/list", a.onPathsList)
 	group.GET("/v3/paths/get/*name", a.onPathsGet)
 
@@ -225,6 +233,10 @@ func (a *API) Initialize() error {
 	group.GET("/v3/recordings/list", a.onRecordingsList)
 	group.GET("/v3/recordings/get/*name", a.onRecordingsGet)
 	group.DELETE("/v3/recordings/deletesegment", a.onRecordingDeleteSegment)
+	group.POST("/v3/recordings/index/rebuild", a.onRecordingsIndexRebuild)
+	group.GET("/v3/recordings/index/verify", a.onRecordingsIndexVerify)
+	group.POST("/v3/recordings/markers/add/*name", a.onRecordingsMarkersAdd)
+	group.GET("/v3/recordings/manifests/verify/*name", a.onRecordingsManifestsVerify)
 
 	network, address := restrictnetwork.Restrict("tcp", a.Address)
 
@@ -578,6 +590,203 @@ func (a *API) onConfigPathsDelete(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *API) onConfigCamerasList(ctx *gin.Context) {
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	data := &defs.APICameraConfList{
+		Items: make([]*conf.Camera, len(c.Cameras)),
+	}
+
+	for i, key := range sortedKeys(c.Cameras) {
+		data.Items[i] = c.Cameras[key]
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onConfigCamerasGet(ctx *gin.Context) {
+	confName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	p, ok := c.Cameras[confName]
+	if !ok {
+		a.writeError(ctx, http.StatusNotFound, fmt.Errorf("camera configuration not found"))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+func (a *API) onConfigCamerasAdd(ctx *gin.Context) { //nolint:dupl
+	confName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	var p conf.OptionalCamera
+	err := json.NewDecoder(ctx.Request.Body).Decode(&p)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	newConf := a.Conf.Clone()
+
+	err = newConf.AddCamera(confName, &p)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = newConf.Validate()
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.Conf = newConf
+	a.Parent.APIConfigSet(newConf)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onConfigCamerasPatch(ctx *gin.Context) { //nolint:dupl
+	confName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	var p conf.OptionalCamera
+	err := json.NewDecoder(ctx.Request.Body).Decode(&p)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	newConf := a.Conf.Clone()
+
+	err = newConf.PatchCamera(confName, &p)
+	if err != nil {
+		if errors.Is(err, conf.ErrCameraNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	err = newConf.Validate()
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.Conf = newConf
+	a.Parent.APIConfigSet(newConf)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onConfigCamerasReplace(ctx *gin.Context) { //nolint:dupl
+	confName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	var p conf.OptionalCamera
+	err := json.NewDecoder(ctx.Request.Body).Decode(&p)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	newConf := a.Conf.Clone()
+
+	err = newConf.ReplaceCamera(confName, &p)
+	if err != nil {
+		if errors.Is(err, conf.ErrCameraNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	err = newConf.Validate()
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.Conf = newConf
+	a.Parent.APIConfigSet(newConf)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onConfigCamerasDelete(ctx *gin.Context) {
+	confName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	newConf := a.Conf.Clone()
+
+	err := newConf.RemoveCamera(confName)
+	if err != nil {
+		if errors.Is(err, conf.ErrCameraNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	err = newConf.Validate()
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.Conf = newConf
+	a.Parent.APIConfigSet(newConf)
+
+	ctx.Status(http.StatusOK)
+}
+
 func (a *API) onPathsList(ctx *gin.Context) {
 	data, err := a.PathManager.APIPathsList()
 	if err != nil {
@@ -1083,7 +1292,7 @@ func (a *API) onRecordingsList(ctx *gin.Context) {
 	c := a.Conf
 	a.mutex.RUnlock()
 
-	pathNames := recordstore.FindAllPathsWithSegments(c.Paths)
+	pathNames := a.RecordIndex.FindAllPathsWithSegments(c.Paths)
 
 	data := defs.APIRecordingList{}
 
@@ -1099,7 +1308,7 @@ func (a *API) onRecordingsList(ctx *gin.Context) {
 
 	for i, pathName := range pathNames {
 		pathConf, _, _ := conf.FindPathConf(c.Paths, pathName)
-		data.Items[i] = recordingsOfPath(pathConf, pathName)
+		data.Items[i] = recordingsOfPath(a.RecordIndex, pathConf, pathName)
 	}
 
 	ctx.JSON(http.StatusOK, data)
@@ -1122,7 +1331,7 @@ func (a *API) onRecordingsGet(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, recordingsOfPath(pathConf, pathName))
+	ctx.JSON(http.StatusOK, recordingsOfPath(a.RecordIndex, pathConf, pathName))
 }
 
 func (a *API) onRecordingDeleteSegment(ctx *gin.Context) {
@@ -1144,27 +1353,181 @@ func (a *API) onRecordingDeleteSegment(ctx *gin.Context) {
 		return
 	}
 
-	pathFormat := recordstore.PathAddExtension(
-		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
-		pathConf.RecordFormat,
-	)
-
-	segmentPath := recordstore.Path{
-		Start: start,
-	}.Encode(pathFormat)
+	segmentPath, err := recordstore.FindSegmentPath(pathConf, pathName, start)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
 
-	err = os.Remove(segmentPath)
+	// the removal is still reported by the verification of the manifest chain
+	err = recordstore.RemoveSegment(pathConf, segmentPath)
 	if err != nil {
 		a.writeError(ctx, http.StatusBadRequest, err)
 		return
 	}
 
+	err = a.RecordIndex.Delete(segmentPath)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
 	ctx.Status(http.StatusOK)
 }
 
+func (a *API) onRecordingsIndexRebuild(ctx *gin.Context) {
+	if a.RecordIndex == nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("record index is disabled"))
+		return
+	}
+
+	err := a.RecordIndex.Rebuild()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onRecordingsIndexVerify(ctx *gin.Context) {
+	if a.RecordIndex == nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("record index is disabled"))
+		return
+	}
+
+	res, err := a.RecordIndex.Verify()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, &defs.APIRecordIndexVerify{
+		Segments:     res.Segments,
+		Missing:      res.Missing,
+		Unindexed:    res.Unindexed,
+		SizeMismatch: res.SizeMismatch,
+		Truncated:    res.Truncated,
+	})
+}
+
+func (a *API) onRecordingsManifestsVerify(ctx *gin.Context) {
+	pathName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	pathConf, _, err := conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var key ed25519.PublicKey
+
+	if pathConf.RecordSigningKey != "" {
+		key, err = recordstore.LoadVerificationKey(pathConf.RecordSigningKey)
+		if err != nil {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	segments, err := a.RecordIndex.FindSegments(pathConf, pathName)
+	if err != nil {
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	res := recordstore.VerifyManifests(pathConf, segments, key)
+
+	out := &defs.APIRecordingManifestVerify{
+		Segments: res.Segments,
+		Signed:   key != nil,
+		Valid:    len(res.Issues) == 0,
+		Issues:   make([]*defs.APIRecordingManifestIssue, len(res.Issues)),
+	}
+
+	for i, issue := range res.Issues {
+		out.Issues[i] = &defs.APIRecordingManifestIssue{
+			Segment: issue.Segment,
+			Type:    issue.Type,
+			Reason:  issue.Reason,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
+
 // ReloadConf is called by core.
 func (a *API) ReloadConf(conf *conf.Conf) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 	a.Conf = conf
 }
+
+func (a *API) onRecordingsMarkersAdd(ctx *gin.Context) {
+	pathName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	if a.RecordIndex == nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("record index is disabled"))
+		return
+	}
+
+	var in defs.APIRecordingMarker
+	err := json.NewDecoder(ctx.Request.Body).Decode(&in)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	// recording start markers are added by the recorder only.
+	// motion events of cameras are not subscribed, they must be posted here.
+	switch recordstore.MarkerType(in.Type) {
+	case recordstore.MarkerTypeMotion, recordstore.MarkerTypeBookmark:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid marker type: '%s'", in.Type))
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	_, _, err = conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	t := time.Now()
+	if in.Time != nil {
+		t = *in.Time
+	}
+
+	err = a.RecordIndex.AddMarker(&recordstore.Marker{
+		PathName: pathName,
+		Time:     t,
+		Type:     recordstore.MarkerType(in.Type),
+		Label:    in.Label,
+	})
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,344 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ctenhank/mediamtx/internal/conf/env"
+)
+
+var (
+	reCameraResolution     = regexp.MustCompile(`^(\d+)x(\d+)$`)
+	reCameraPathNameVar    = regexp.MustCompile(`%[a-z]+`)
+	reInvalidPathNameChars = regexp.MustCompile(`[^0-9a-zA-Z_\-\.]+`)
+)
+
+var cameraURIRewriteVars = map[string]struct{}{
+	"%camera":  {},
+	"%profile": {},
+	"%token":   {},
+	"%index":   {},
+	"%path":    {},
+	"%query":   {},
+}
+
+var cameraPathNameVars = map[string]struct{}{
+	"%camera":     {},
+	"%profile":    {},
+	"%token":      {},
+	"%index":      {},
+	"%resolution": {},
+}
+
+// CameraProfiles selects the ONVIF profiles that become paths.
+// Each entry is "main", "all", a profile token or a resolution like "1920x1080".
+type CameraProfiles []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *CameraProfiles) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = CameraProfiles{s}
+		return nil
+	}
+
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*p = nil
+	return json.Unmarshal(b, (*[]string)(p))
+}
+
+// CameraProfile describes an ONVIF profile of a camera.
+type CameraProfile struct {
+	Index  int
+	Token  string
+	Name   string
+	Width  int
+	Height int
+}
+
+// Matches checks whether the profile is selected.
+func (p CameraProfiles) Matches(profile CameraProfile) bool {
+	for _, sel := range p {
+		switch sel {
+		case "all":
+			return true
+
+		case "main":
+			if profile.Index == 0 {
+				return true
+			}
+
+		default:
+			if m := reCameraResolution.FindStringSubmatch(sel); m != nil {
+				w, _ := strconv.Atoi(m[1])
+				h, _ := strconv.Atoi(m[2])
+				if profile.Width == w && profile.Height == h {
+					return true
+				}
+			} else if profile.Token == sel {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Camera is an ONVIF camera configuration.
+type Camera struct {
+	Name           string               `json:"name"` // filled by Validate()
+	Profiles       CameraProfiles       `json:"profiles"`
+	PathName       string               `json:"pathName"`
+	StreamProtocol CameraStreamProtocol `json:"streamProtocol"`
+	IngestMode     CameraIngestMode     `json:"ingestMode"`
+
+	// upstream RTSP sessions of the paths of the camera.
+	MaxSessions   int  `json:"maxSessions"`
+	ShareSessions bool `json:"shareSessions"`
+
+	// use the other profiles as alternate sources of each path.
+	AlternateProfiles bool `json:"alternateProfiles"`
+
+	// rewriting of the URIs reported by the camera.
+	URIRewriteHost        string        `json:"uriRewriteHost"`
+	URIRewritePorts       CameraPortMap `json:"uriRewritePorts"`
+	URIRewriteScheme      string        `json:"uriRewriteScheme"`
+	URIRewritePath        string        `json:"uriRewritePath"`
+	URIRewriteQuery       string        `json:"uriRewriteQuery"`
+	URIRewriteCredentials bool          `json:"uriRewriteCredentials"`
+
+	// settings of the camera, inherited by the paths of its profiles.
+	// Source is the address of the ONVIF service.
+	Path *Path `json:"-"` // filled by Validate()
+}
+
+// MarshalJSON implements json.Marshaler.
+// Path settings are inlined, as they are in the configuration file.
+func (c Camera) MarshalJSON() ([]byte, error) {
+	var path Path
+	if c.Path != nil {
+		path = *c.Path
+	}
+
+	enc, err := json.Marshal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	err = json.Unmarshal(enc, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	m["name"] = c.Name
+	m["profiles"] = c.Profiles
+	m["pathName"] = c.PathName
+	m["streamProtocol"] = c.StreamProtocol
+	m["ingestMode"] = c.IngestMode
+	m["maxSessions"] = c.MaxSessions
+	m["shareSessions"] = c.ShareSessions
+	m["alternateProfiles"] = c.AlternateProfiles
+	m["uriRewriteHost"] = c.URIRewriteHost
+	m["uriRewritePorts"] = c.URIRewritePorts
+	m["uriRewriteScheme"] = c.URIRewriteScheme
+	m["uriRewritePath"] = c.URIRewritePath
+	m["uriRewriteQuery"] = c.URIRewriteQuery
+	m["uriRewriteCredentials"] = c.URIRewriteCredentials
+
+	return json.Marshal(m)
+}
+
+// ProfilePathName returns the name of the path of a profile.
+func (c *Camera) ProfilePathName(profile CameraProfile) string {
+	// legacy naming: <camera> for the first profile, <camera>_<index> for the others
+	if c.PathName == "" {
+		if profile.Index == 0 {
+			return c.Name
+		}
+		return c.Name + "_" + strconv.Itoa(profile.Index)
+	}
+
+	return reCameraPathNameVar.ReplaceAllStringFunc(c.PathName, func(v string) string {
+		switch v {
+		case "%camera":
+			return c.Name
+		case "%profile":
+			return reInvalidPathNameChars.ReplaceAllString(profile.Name, "_")
+		case "%token":
+			return reInvalidPathNameChars.ReplaceAllString(profile.Token, "_")
+		case "%index":
+			return strconv.Itoa(profile.Index)
+		case "%resolution":
+			return strconv.Itoa(profile.Width) + "x" + strconv.Itoa(profile.Height)
+		}
+		return v
+	})
+}
+
+func (c *Camera) validate(conf *Conf, name string, deprecatedCredentialsMode bool) error {
+	c.Name = name
+
+	if name != "" && name[0] == '~' {
+		return fmt.Errorf("invalid camera name '%s': regular expressions are not supported", name)
+	}
+
+	err := c.Path.validate(conf, name, deprecatedCredentialsMode)
+	if err != nil {
+		return fmt.Errorf("camera '%s': %w", name, err)
+	}
+
+	if !strings.HasPrefix(c.Path.Source, "http://") && !strings.HasPrefix(c.Path.Source, "https://") {
+		return fmt.Errorf("camera '%s': 'source' must be the HTTP address of the ONVIF service", name)
+	}
+
+	if len(c.Profiles) == 0 {
+		return fmt.Errorf("camera '%s': 'profiles' cannot be empty", name)
+	}
+	for _, sel := range c.Profiles {
+		if sel == "" {
+			return fmt.Errorf("camera '%s': invalid profile selector ''", name)
+		}
+	}
+
+	for _, v := range reCameraPathNameVar.FindAllString(c.PathName, -1) {
+		if _, ok := cameraPathNameVars[v]; !ok {
+			return fmt.Errorf("camera '%s': unknown variable '%s' in 'pathName'", name, v)
+		}
+	}
+
+	if c.PathName != "" {
+		sample := c.ProfilePathName(CameraProfile{Token: "token", Name: "profile", Width: 1, Height: 1})
+		err = isValidPathName(sample)
+		if err != nil {
+			return fmt.Errorf("camera '%s': invalid 'pathName': %w", name, err)
+		}
+	}
+
+	if c.MaxSessions < 0 {
+		return fmt.Errorf("camera '%s': 'maxSessions' cannot be negative", name)
+	}
+
+	if strings.ContainsAny(c.URIRewriteHost, "/?#@") {
+		return fmt.Errorf("camera '%s': invalid 'uriRewriteHost'", name)
+	}
+
+	switch c.URIRewriteScheme {
+	case "", "rtsp", "rtsps":
+	default:
+		return fmt.Errorf("camera '%s': 'uriRewriteScheme' must be 'rtsp' or 'rtsps'", name)
+	}
+
+	for _, tpl := range []string{c.URIRewritePath, c.URIRewriteQuery} {
+		for _, v := range reCameraPathNameVar.FindAllString(tpl, -1) {
+			if _, ok := cameraURIRewriteVars[v]; !ok {
+				return fmt.Errorf("camera '%s': unknown variable '%s' in URI rewrite template", name, v)
+			}
+		}
+	}
+
+	if c.URIRewritePath != "" && !strings.HasPrefix(c.URIRewritePath, "/") &&
+		!strings.HasPrefix(c.URIRewritePath, "%path") {
+		return fmt.Errorf("camera '%s': 'uriRewritePath' must start with a slash", name)
+	}
+
+	return nil
+}
+
+// cameraValues contains the camera settings that are not path settings.
+type cameraValues struct {
+	Profiles       CameraProfiles       `json:"profiles"`
+	PathName       string               `json:"pathName"`
+	StreamProtocol CameraStreamProtocol `json:"streamProtocol"`
+	IngestMode     CameraIngestMode     `json:"ingestMode"`
+
+	MaxSessions   int  `json:"maxSessions"`
+	ShareSessions bool `json:"shareSessions"`
+
+	AlternateProfiles bool `json:"alternateProfiles"`
+
+	URIRewriteHost        string        `json:"uriRewriteHost"`
+	URIRewritePorts       CameraPortMap `json:"uriRewritePorts"`
+	URIRewriteScheme      string        `json:"uriRewriteScheme"`
+	URIRewritePath        string        `json:"uriRewritePath"`
+	URIRewriteQuery       string        `json:"uriRewriteQuery"`
+	URIRewriteCredentials bool          `json:"uriRewriteCredentials"`
+}
+
+var optionalCameraValuesType = func() reflect.Type {
+	var fields []reflect.StructField
+
+	for _, rt := range []reflect.Type{reflect.TypeOf(cameraValues{}), reflect.TypeOf(Path{})} {
+		nf := rt.NumField()
+
+		for i := 0; i < nf; i++ {
+			f := rt.Field(i)
+			j := f.Tag.Get("json")
+
+			if j != "-" {
+				if !strings.Contains(j, ",omitempty") {
+					j += ",omitempty"
+				}
+
+				typ := f.Type
+				if typ.Kind() != reflect.Pointer {
+					typ = reflect.PtrTo(typ)
+				}
+
+				fields = append(fields, reflect.StructField{
+					Name: f.Name,
+					Type: typ,
+					Tag:  reflect.StructTag(`json:"` + j + `"`),
+				})
+			}
+		}
+	}
+
+	return reflect.StructOf(fields)
+}()
+
+func newOptionalCameraValues() interface{} {
+	return reflect.New(optionalCameraValuesType).Interface()
+}
+
+// OptionalCamera is a Camera whose values can all be optional.
+type OptionalCamera struct {
+	Values interface{}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *OptionalCamera) UnmarshalJSON(b []byte) error {
+	p.Values = newOptionalCameraValues()
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return d.Decode(p.Values)
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (p *OptionalCamera) UnmarshalEnv(prefix string, _ string) error {
+	if p.Values == nil {
+		p.Values = newOptionalCameraValues()
+	}
+	return env.Load(prefix, p.Values)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p *OptionalCamera) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Values)
+}
+
+func newCamera(defaults *Path, partial *OptionalCamera) *Camera {
+	c := &Camera{
+		Profiles: CameraProfiles{"all"},
+		Path:     &Path{},
+	}
+	copyStructFields(c, partial.Values)
+	copyStructFields(c.Path, defaults)
+	copyStructFields(c.Path, partial.Values)
+	return c
+}
@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CameraIngestMode is the ingestMode parameter of cameras.
+type CameraIngestMode int
+
+// supported values.
+const (
+	CameraIngestModeUnicast CameraIngestMode = iota
+	CameraIngestModeMulticast
+)
+
+// MarshalJSON implements json.Marshaler.
+func (d CameraIngestMode) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case CameraIngestModeMulticast:
+		out = "multicast"
+
+	default:
+		out = "unicast"
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *CameraIngestMode) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "unicast":
+		*d = CameraIngestModeUnicast
+
+	case "multicast":
+		*d = CameraIngestModeMulticast
+
+	default:
+		return fmt.Errorf("invalid ingest mode '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *CameraIngestMode) UnmarshalEnv(_ string, v string) error {
+	return d.UnmarshalJSON([]byte(`"` + v + `"`))
+}
@@ -0,0 +1,95 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CameraPortMap maps ports reported by a camera to ports that must be used instead.
+type CameraPortMap map[int]int
+
+func validatePort(port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid port %d", port)
+	}
+	return nil
+}
+
+func parsePortMapping(entry string) (int, int, error) {
+	parts := strings.Split(entry, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port mapping '%s'", entry)
+	}
+
+	from, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port mapping '%s'", entry)
+	}
+	to, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port mapping '%s'", entry)
+	}
+
+	if err := validatePort(from); err != nil {
+		return 0, 0, err
+	}
+	if err := validatePort(to); err != nil {
+		return 0, 0, err
+	}
+
+	return from, to, nil
+}
+
+func (m *CameraPortMap) load(entries []string) error {
+	out := CameraPortMap{}
+
+	for _, entry := range entries {
+		from, to, err := parsePortMapping(entry)
+		if err != nil {
+			return err
+		}
+		out[from] = to
+	}
+
+	*m = out
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m CameraPortMap) MarshalJSON() ([]byte, error) {
+	froms := make([]int, 0, len(m))
+	for from := range m {
+		froms = append(froms, from)
+	}
+	sort.Ints(froms)
+
+	out := make([]string, len(froms))
+	for i, from := range froms {
+		out[i] = strconv.Itoa(from) + ":" + strconv.Itoa(m[from])
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// The value is a list of "from:to" entries.
+func (m *CameraPortMap) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	return m.load(in)
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+// The value is a comma-separated list of "from:to" entries.
+func (m *CameraPortMap) UnmarshalEnv(_ string, v string) error {
+	if v == "" {
+		return m.load(nil)
+	}
+	return m.load(strings.Split(v, ","))
+}
@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CameraStreamProtocol is the streamProtocol parameter of cameras.
+type CameraStreamProtocol int
+
+// supported values.
+const (
+	CameraStreamProtocolRTSPUnicast CameraStreamProtocol = iota
+	CameraStreamProtocolRTSPMulticast
+	CameraStreamProtocolRTSPOverHTTP
+)
+
+// MarshalJSON implements json.Marshaler.
+func (d CameraStreamProtocol) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case CameraStreamProtocolRTSPMulticast:
+		out = "rtspMulticast"
+
+	case CameraStreamProtocolRTSPOverHTTP:
+		out = "rtspOverHTTP"
+
+	default:
+		out = "rtspUnicast"
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *CameraStreamProtocol) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "rtspUnicast":
+		*d = CameraStreamProtocolRTSPUnicast
+
+	case "rtspMulticast":
+		*d = CameraStreamProtocolRTSPMulticast
+
+	case "rtspOverHTTP":
+		*d = CameraStreamProtocolRTSPOverHTTP
+
+	default:
+		return fmt.Errorf("invalid stream protocol '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *CameraStreamProtocol) UnmarshalEnv(_ string, v string) error {
+	return d.UnmarshalJSON([]byte(`"` + v + `"`))
+}
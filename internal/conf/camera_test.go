@@ -0,0 +1,236 @@
+package conf
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf/decrypt"
+)
+
+func TestCameraProfilesMatches(t *testing.T) {
+	main := CameraProfile{Index: 0, Token: "Profile_1", Width: 1920, Height: 1080}
+	sub := CameraProfile{Index: 1, Token: "Profile_2", Width: 640, Height: 360}
+
+	for _, ca := range []struct {
+		name     string
+		profiles CameraProfiles
+		main     bool
+		sub      bool
+	}{
+		{"all", CameraProfiles{"all"}, true, true},
+		{"main", CameraProfiles{"main"}, true, false},
+		{"resolution", CameraProfiles{"640x360"}, false, true},
+		{"token", CameraProfiles{"Profile_2"}, false, true},
+		{"multiple", CameraProfiles{"main", "640x360"}, true, true},
+		{"none", CameraProfiles{"1280x720"}, false, false},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.main, ca.profiles.Matches(main))
+			require.Equal(t, ca.sub, ca.profiles.Matches(sub))
+		})
+	}
+}
+
+func TestCameraProfilePathName(t *testing.T) {
+	profile := CameraProfile{Index: 1, Token: "Profile 2", Name: "sub", Width: 640, Height: 360}
+
+	c := &Camera{Name: "cam1"}
+	require.Equal(t, "cam1", c.ProfilePathName(CameraProfile{Index: 0}))
+	require.Equal(t, "cam1_1", c.ProfilePathName(profile))
+
+	c.PathName = "%camera/%resolution"
+	require.Equal(t, "cam1/640x360", c.ProfilePathName(profile))
+
+	c.PathName = "%camera/%token_%index_%profile"
+	require.Equal(t, "cam1/Profile_2_1_sub", c.ProfilePathName(profile))
+}
+
+func TestConfCameras(t *testing.T) {
+	tmpf, err := createTempFile([]byte("pathDefaults:\n" +
+		"  record: yes\n" +
+		"cameras:\n" +
+		"  cam1:\n" +
+		"    source: http://192.168.1.64\n" +
+		"    profiles: main\n" +
+		"    pathName: '%camera/%resolution'\n" +
+		"    streamProtocol: rtspMulticast\n" +
+		"    ingestMode: multicast\n" +
+		"    maxSessions: 2\n" +
+		"    shareSessions: yes\n" +
+		"    alternateProfiles: yes\n" +
+		"    uriRewriteHost: cam1.example.com\n" +
+		"    uriRewritePorts: ['554:10554']\n" +
+		"    recordDeleteAfter: 1h\n" +
+		"paths:\n" +
+		"  cam2:\n" +
+		"    source: http://192.168.1.65\n"))
+	require.NoError(t, err)
+	defer os.Remove(tmpf)
+
+	conf, _, err := Load(tmpf, nil)
+	require.NoError(t, err)
+
+	cam1, ok := conf.Cameras["cam1"]
+	require.Equal(t, true, ok)
+	require.Equal(t, CameraProfiles{"main"}, cam1.Profiles)
+	require.Equal(t, "%camera/%resolution", cam1.PathName)
+	require.Equal(t, CameraStreamProtocolRTSPMulticast, cam1.StreamProtocol)
+	require.Equal(t, CameraIngestModeMulticast, cam1.IngestMode)
+	require.Equal(t, 2, cam1.MaxSessions)
+	require.Equal(t, true, cam1.ShareSessions)
+	require.Equal(t, true, cam1.AlternateProfiles)
+	require.Equal(t, "cam1.example.com", cam1.URIRewriteHost)
+	require.Equal(t, CameraPortMap{554: 10554}, cam1.URIRewritePorts)
+	require.Equal(t, "http://192.168.1.64", cam1.Path.Source)
+	require.Equal(t, true, cam1.Path.Record)
+	require.Equal(t, StringDuration(3600000000000), cam1.Path.RecordDeleteAfter)
+
+	// legacy paths with an ONVIF source are migrated to cameras
+	cam2, ok := conf.Cameras["cam2"]
+	require.Equal(t, true, ok)
+	require.Equal(t, CameraProfiles{"all"}, cam2.Profiles)
+	require.Equal(t, CameraStreamProtocolRTSPUnicast, cam2.StreamProtocol)
+	require.Equal(t, CameraIngestModeUnicast, cam2.IngestMode)
+	require.Equal(t, "http://192.168.1.65", cam2.Path.Source)
+	require.Same(t, conf.Paths["cam2"], cam2.Path)
+}
+
+func TestConfCameraErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		conf string
+		err  string
+	}{
+		{
+			"invalid source",
+			"cameras:\n" +
+				"  cam1:\n" +
+				"    source: rtsp://192.168.1.64\n",
+			"camera 'cam1': 'source' must be the HTTP address of the ONVIF service",
+		},
+		{
+			"unknown variable",
+			"cameras:\n" +
+				"  cam1:\n" +
+				"    source: http://192.168.1.64\n" +
+				"    pathName: '%camera/%foo'\n",
+			"camera 'cam1': unknown variable '%foo' in 'pathName'",
+		},
+		{
+			"invalid rewrite scheme",
+			"cameras:\n" +
+				"  cam1:\n" +
+				"    source: http://192.168.1.64\n" +
+				"    uriRewriteScheme: http\n",
+			"camera 'cam1': 'uriRewriteScheme' must be 'rtsp' or 'rtsps'",
+		},
+		{
+			"negative max sessions",
+			"cameras:\n" +
+				"  cam1:\n" +
+				"    source: http://192.168.1.64\n" +
+				"    maxSessions: -1\n",
+			"camera 'cam1': 'maxSessions' cannot be negative",
+		},
+		{
+			"duplicate name",
+			"cameras:\n" +
+				"  cam1:\n" +
+				"    source: http://192.168.1.64\n" +
+				"paths:\n" +
+				"  cam1:\n" +
+				"    source: http://192.168.1.65\n",
+			"'cam1' is defined both as a path and as a camera",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			tmpf, err := createTempFile([]byte(ca.conf))
+			require.NoError(t, err)
+			defer os.Remove(tmpf)
+
+			_, _, err = Load(tmpf, nil)
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
+
+func TestSaveCameras(t *testing.T) {
+	tmpf, err := createTempFile([]byte("# cameras of the site\n" +
+		"cameras:\n" +
+		"  cam1:\n" +
+		"    source: http://192.168.1.64 # entrance\n" +
+		"    username: admin\n" +
+		"    password: old\n" +
+		"paths:\n" +
+		"  cam2:\n" +
+		"    source: http://192.168.1.65\n"))
+	require.NoError(t, err)
+	defer os.Remove(tmpf)
+
+	conf, _, err := Load(tmpf, nil)
+	require.NoError(t, err)
+
+	patches := map[string]*OptionalCamera{}
+	for name, values := range map[string]string{
+		"cam1": `{"username":"nvr","password":"123"}`,
+		"cam2": `{"username":"nvr","password":"new","source":"http://10.0.0.5"}`,
+	} {
+		var p OptionalCamera
+		require.NoError(t, p.UnmarshalJSON([]byte(values)))
+		patches[name] = &p
+
+		require.NoError(t, conf.PatchCameraValues(name, &p))
+	}
+	require.NoError(t, conf.Validate())
+	require.True(t, SavesPlaintextSecrets(patches))
+
+	err = SaveCameras(tmpf, patches)
+	require.NoError(t, err)
+
+	byts, err := os.ReadFile(tmpf)
+	require.NoError(t, err)
+	require.Contains(t, string(byts), "# cameras of the site")
+	require.Contains(t, string(byts), "# entrance")
+
+	conf2, _, err := Load(tmpf, nil)
+	require.NoError(t, err)
+	require.Equal(t, conf.Cameras, conf2.Cameras)
+	require.Equal(t, "123", conf2.Cameras["cam1"].Path.Password)
+	require.Equal(t, "http://10.0.0.5", conf2.Cameras["cam2"].Path.Source)
+
+	err = SaveCameras(tmpf, map[string]*OptionalCamera{"cam3": patches["cam1"]})
+	require.EqualError(t, err, "camera 'cam3' is not defined in the configuration file")
+
+	var p OptionalCamera
+	require.NoError(t, p.UnmarshalJSON([]byte(`{"maxSessions":2}`)))
+	require.False(t, SavesPlaintextSecrets(map[string]*OptionalCamera{"cam2": &p}))
+	require.Error(t, conf.PatchCameraValues("cam2", &p))
+	require.ErrorIs(t, conf.PatchCameraValues("cam3", &p), ErrCameraNotFound)
+}
+
+func TestSaveCamerasEncrypted(t *testing.T) {
+	key := "testing123testin"
+	t.Setenv("MTX_CONFKEY", key)
+
+	enc, err := decrypt.Encrypt(key, []byte("cameras:\n"+
+		"  cam1:\n"+
+		"    source: http://192.168.1.64\n"))
+	require.NoError(t, err)
+
+	tmpf, err := createTempFile(enc)
+	require.NoError(t, err)
+	defer os.Remove(tmpf)
+
+	var p OptionalCamera
+	require.NoError(t, p.UnmarshalJSON([]byte(`{"password":"new"}`)))
+	require.False(t, SavesPlaintextSecrets(map[string]*OptionalCamera{"cam1": &p}))
+
+	err = SaveCameras(tmpf, map[string]*OptionalCamera{"cam1": &p})
+	require.NoError(t, err)
+
+	conf, _, err := Load(tmpf, nil)
+	require.NoError(t, err)
+	require.Equal(t, "new", conf.Cameras["cam1"].Path.Password)
+}
@@ -26,10 +26,13 @@ import (
 // ErrPathNotFound is returned when a path is not found.
 var ErrPathNotFound = errors.New("path not found")
 
-func sortedKeys(paths map[string]*OptionalPath) []string {
-	ret := make([]string, len(paths))
+// ErrCameraNotFound is returned when a camera is not found.
+var ErrCameraNotFound = errors.New("camera not found")
+
+func sortedKeys[T any](m map[string]T) []string {
+	ret := make([]string, len(m))
 	i := 0
-	for name := range paths {
+	for name := range m {
 		ret[i] = name
 		i++
 	}
@@ -181,13 +184,19 @@ type Conf struct {
 	AuthJWTClaimKey           string                      `json:"authJWTClaimKey"`
 
 	// CCTV-specific API
-	Control               bool       `json:"control"`
-	ControlAddress        string     `json:"controlAddress"`
-	ControlEncryption     bool       `json:"controlEncryption"`
-	ControlServerKey      string     `json:"controlServerKey"`
-	ControlServerCert     string     `json:"controlServerCert"`
-	ControlAllowOrigin    string     `json:"controlAllowOrigin"`
-	ControlTrustedProxies IPNetworks `json:"controlTrustedProxies"`
+	Control                  bool           `json:"control"`
+	ControlAddress           string         `json:"controlAddress"`
+	ControlEncryption        bool           `json:"controlEncryption"`
+	ControlServerKey         string         `json:"controlServerKey"`
+	ControlServerCert        string         `json:"controlServerCert"`
+	ControlAllowOrigin       string         `json:"controlAllowOrigin"`
+	ControlTrustedProxies    IPNetworks     `json:"controlTrustedProxies"`
+	ControlIOPollPeriod      StringDuration `json:"controlIOPollPeriod"`
+	ControlIORules           ControlIORules `json:"controlIORules"`
+	ControlOSDSite           string         `json:"controlOSDSite"`
+	ControlOSDTemplate       string         `json:"controlOSDTemplate"`
+	ControlOSDCheckPeriod    StringDuration `json:"controlOSDCheckPeriod"`
+	ControlFirmwareDirectory string         `json:"controlFirmwareDirectory"`
 
 	// Control API
 	API               bool       `json:"api"`
@@ -217,13 +226,22 @@ type Conf struct {
 	PPROFTrustedProxies IPNetworks `json:"pprofTrustedProxies"`
 
 	// Playback
-	Playback               bool       `json:"playback"`
-	PlaybackAddress        string     `json:"playbackAddress"`
-	PlaybackEncryption     bool       `json:"playbackEncryption"`
-	PlaybackServerKey      string     `json:"playbackServerKey"`
-	PlaybackServerCert     string     `json:"playbackServerCert"`
-	PlaybackAllowOrigin    string     `json:"playbackAllowOrigin"`
-	PlaybackTrustedProxies IPNetworks `json:"playbackTrustedProxies"`
+	Playback                bool           `json:"playback"`
+	PlaybackAddress         string         `json:"playbackAddress"`
+	PlaybackEncryption      bool           `json:"playbackEncryption"`
+	PlaybackServerKey       string         `json:"playbackServerKey"`
+	PlaybackServerCert      string         `json:"playbackServerCert"`
+	PlaybackAllowOrigin     string         `json:"playbackAllowOrigin"`
+	PlaybackTrustedProxies  IPNetworks     `json:"playbackTrustedProxies"`
+	PlaybackExportPath      string         `json:"playbackExportPath"`
+	PlaybackExportRetention StringDuration `json:"playbackExportRetention"`
+
+	// Record retention
+	RecordMaxDiskUsage StringSize `json:"recordMaxDiskUsage"`
+	RecordMinFreeSpace StringSize `json:"recordMinFreeSpace"`
+
+	// Record index
+	RecordIndexPath string `json:"recordIndexPath"`
 
 	// RTSP server
 	RTSP              bool             `json:"rtsp"`
@@ -303,7 +321,9 @@ type Conf struct {
 	RecordSegmentDuration *StringDuration `json:"recordSegmentDuration,omitempty"` // deprecated
 	RecordDeleteAfter     *StringDuration `json:"recordDeleteAfter,omitempty"`     // deprecated
 
-	// IPCameras
+	// Cameras
+	OptionalCameras map[string]*OptionalCamera `json:"cameras"`
+	Cameras         map[string]*Camera         `json:"-"` // filled by Check()
 
 	// Path defaults
 	PathDefaults Path `json:"pathDefaults"`
@@ -345,6 +365,7 @@ func (conf *Conf) setDefaults() {
 	conf.ControlServerKey = "server.key"
 	conf.ControlServerCert = "server.crt"
 	conf.ControlAllowOrigin = "*"
+	conf.ControlIOPollPeriod = 1 * StringDuration(time.Second)
 
 	// Control API
 	conf.APIAddress = ":9997"
@@ -369,6 +390,11 @@ func (conf *Conf) setDefaults() {
 	conf.PlaybackServerKey = "server.key"
 	conf.PlaybackServerCert = "server.crt"
 	conf.PlaybackAllowOrigin = "*"
+	conf.PlaybackExportPath = "./exports"
+	conf.PlaybackExportRetention = 24 * 3600 * StringDuration(time.Second)
+
+	// Record index
+	conf.RecordIndexPath = "./recordings/index.jsonl"
 
 	// RTSP server
 	conf.RTSP = true
@@ -531,6 +557,26 @@ func (conf *Conf) Validate() error {
 		return fmt.Errorf("'udpMaxPayloadSize' must be less than 1472")
 	}
 
+	// CCTV-specific Control API
+
+	if conf.ControlIOPollPeriod <= 0 {
+		return fmt.Errorf("'controlIOPollPeriod' must be greater than zero")
+	}
+	for i := range conf.ControlIORules {
+		err := conf.ControlIORules[i].Validate()
+		if err != nil {
+			return fmt.Errorf("invalid 'controlIORules': %w", err)
+		}
+	}
+	if conf.ControlOSDCheckPeriod < 0 {
+		return fmt.Errorf("'controlOSDCheckPeriod' must be zero or greater")
+	}
+	for _, v := range reCameraPathNameVar.FindAllString(conf.ControlOSDTemplate, -1) {
+		if v != "%site" && v != "%camera" {
+			return fmt.Errorf("unknown variable '%s' in 'controlOSDTemplate'", v)
+		}
+	}
+
 	// Authentication
 
 	if conf.ExternalAuthenticationURL != nil {
@@ -735,6 +781,47 @@ func (conf *Conf) Validate() error {
 		}
 	}
 
+	// Cameras
+
+	conf.Cameras = make(map[string]*Camera)
+
+	for _, name := range sortedKeys(conf.OptionalCameras) {
+		optional := conf.OptionalCameras[name]
+		if optional == nil {
+			optional = &OptionalCamera{
+				Values: newOptionalCameraValues(),
+			}
+			conf.OptionalCameras[name] = optional
+		}
+
+		cam := newCamera(&conf.PathDefaults, optional)
+		conf.Cameras[name] = cam
+
+		err := cam.validate(conf, name, deprecatedCredentialsMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// legacy: paths whose source is an ONVIF address are cameras
+	for _, name := range sortedKeys(conf.Paths) {
+		pconf := conf.Paths[name]
+		if pconf.Regexp != nil ||
+			(!strings.HasPrefix(pconf.Source, "http://") && !strings.HasPrefix(pconf.Source, "https://")) {
+			continue
+		}
+
+		if _, ok := conf.Cameras[name]; ok {
+			return fmt.Errorf("'%s' is defined both as a path and as a camera", name)
+		}
+
+		conf.Cameras[name] = &Camera{
+			Name:     name,
+			Profiles: CameraProfiles{"all"},
+			Path:     pconf,
+		}
+	}
+
 	return nil
 }
 
@@ -811,3 +898,74 @@ func (conf *Conf) RemovePath(name string) error {
 	delete(conf.OptionalPaths, name)
 	return nil
 }
+
+// AddCamera adds a camera.
+func (conf *Conf) AddCamera(name string, c *OptionalCamera) error {
+	if _, ok := conf.OptionalCameras[name]; ok {
+		return fmt.Errorf("camera already exists")
+	}
+
+	if conf.OptionalCameras == nil {
+		conf.OptionalCameras = make(map[string]*OptionalCamera)
+	}
+
+	conf.OptionalCameras[name] = c
+	return nil
+}
+
+// PatchCamera patches a camera.
+func (conf *Conf) PatchCamera(name string, optional2 *OptionalCamera) error {
+	optional, ok := conf.OptionalCameras[name]
+	if !ok {
+		return ErrCameraNotFound
+	}
+
+	copyStructFields(optional.Values, optional2.Values)
+	return nil
+}
+
+// PatchCameraValues patches a camera defined in the cameras section or,
+// with the legacy format, in the paths section.
+func (conf *Conf) PatchCameraValues(name string, optional2 *OptionalCamera) error {
+	if _, ok := conf.OptionalCameras[name]; ok {
+		return conf.PatchCamera(name, optional2)
+	}
+
+	if _, ok := conf.OptionalPaths[name]; ok {
+		enc, err := json.Marshal(optional2.Values)
+		if err != nil {
+			return err
+		}
+
+		// fails if values that are not path settings are set
+		var p OptionalPath
+		err = json.Unmarshal(enc, &p)
+		if err != nil {
+			return err
+		}
+
+		return conf.PatchPath(name, &p)
+	}
+
+	return ErrCameraNotFound
+}
+
+// ReplaceCamera replaces a camera.
+func (conf *Conf) ReplaceCamera(name string, optional2 *OptionalCamera) error {
+	if conf.OptionalCameras == nil {
+		conf.OptionalCameras = make(map[string]*OptionalCamera)
+	}
+
+	conf.OptionalCameras[name] = optional2
+	return nil
+}
+
+// RemoveCamera removes a camera.
+func (conf *Conf) RemoveCamera(name string) error {
+	if _, ok := conf.OptionalCameras[name]; !ok {
+		return ErrCameraNotFound
+	}
+
+	delete(conf.OptionalCameras, name)
+	return nil
+}
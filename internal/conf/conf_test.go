@@ -52,11 +52,14 @@ func TestConfFromFile(t *testing.T) {
 			Source:                     "publisher",
 			SourceOnDemandStartTimeout: 10 * StringDuration(time.Second),
 			SourceOnDemandCloseAfter:   10 * StringDuration(time.Second),
+			SourceRetryPause:           5 * StringDuration(time.Second),
+			SourceRetryMaxPause:        5 * StringDuration(time.Second),
 			RecordPath:                 "./recordings/%path/%Y-%m-%d_%H-%M-%S-%f",
 			RecordFormat:               RecordFormatFMP4,
 			RecordPartDuration:         StringDuration(1 * time.Second),
 			RecordSegmentDuration:      3600000000000,
 			RecordDeleteAfter:          86400000000000,
+			RecordThumbnailInterval:    10 * StringDuration(time.Second),
 			OverridePublisher:          true,
 			RunOnDemandStartTimeout:    5 * StringDuration(time.Second),
 			RunOnDemandCloseAfter:      10 * StringDuration(time.Second),
@@ -316,6 +319,23 @@ func TestConfErrors(t *testing.T) {
 				"    srtReadPassphrase: a\n",
 			`invalid 'readRTPassphrase': must be between 10 and 79 characters`,
 		},
+		{
+			"invalid source retry max pause",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    source: rtsp://localhost:8554/mystream\n" +
+				"    sourceRetryPause: 10s\n" +
+				"    sourceRetryMaxPause: 5s\n",
+			`'sourceRetryMaxPause' cannot be lower than 'sourceRetryPause'`,
+		},
+		{
+			"invalid source alternate",
+			"paths:\n" +
+				"  mypath:\n" +
+				"    source: rtsp://localhost:8554/mystream\n" +
+				"    sourceAlternates: [rtmp://localhost/mystream]\n",
+			`'rtmp://localhost/mystream' is not a valid RTSP URL`,
+		},
 		{
 			"all_others aliases",
 			"paths:\n" +
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ControlIORule triggers a camera relay output when a digital input changes.
+type ControlIORule struct {
+	Name         string         `json:"name"`
+	Camera       string         `json:"camera"`
+	Input        string         `json:"input"`
+	InputState   string         `json:"inputState"`
+	OutputCamera string         `json:"outputCamera"`
+	Output       string         `json:"output"`
+	OutputState  string         `json:"outputState"`
+	Duration     StringDuration `json:"duration"`
+}
+
+func isIOState(s string) bool {
+	return s == "active" || s == "inactive"
+}
+
+// Validate checks the rule for errors and fills in default values.
+func (r *ControlIORule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("'name' is required")
+	}
+	if r.Camera == "" || r.Input == "" || r.Output == "" {
+		return fmt.Errorf("rule '%s': 'camera', 'input' and 'output' are required", r.Name)
+	}
+
+	if r.InputState == "" {
+		r.InputState = "active"
+	}
+	if !isIOState(r.InputState) {
+		return fmt.Errorf("rule '%s': invalid 'inputState': %s", r.Name, r.InputState)
+	}
+
+	if r.OutputCamera == "" {
+		r.OutputCamera = r.Camera
+	}
+
+	if r.OutputState == "" {
+		r.OutputState = "active"
+	}
+	if !isIOState(r.OutputState) {
+		return fmt.Errorf("rule '%s': invalid 'outputState': %s", r.Name, r.OutputState)
+	}
+
+	if r.Duration < 0 {
+		return fmt.Errorf("rule '%s': 'duration' must be positive", r.Name)
+	}
+
+	return nil
+}
+
+// ControlIORules is a list of ControlIORule.
+type ControlIORules []ControlIORule
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *ControlIORules) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return json.Unmarshal(b, (*[]ControlIORule)(s))
+}
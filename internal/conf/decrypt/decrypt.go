@@ -2,6 +2,7 @@
 package decrypt
 
 import (
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 
@@ -27,3 +28,19 @@ func Decrypt(key string, byts []byte) ([]byte, error) {
 
 	return decrypted, nil
 }
+
+// Encrypt encrypts the configuration with the given key, in the format read by Decrypt.
+func Encrypt(key string, byts []byte) ([]byte, error) {
+	var secretKey [32]byte
+	copy(secretKey[:], key)
+
+	var nonce [24]byte
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+
+	enc := secretbox.Seal(nonce[:], byts, &nonce, &secretKey)
+
+	return []byte(base64.StdEncoding.EncodeToString(enc)), nil
+}
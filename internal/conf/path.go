@@ -80,26 +80,6 @@ func FindPathConf(pathConfs map[string]*Path, name string) (*Path, []string, err
 	return nil, nil, fmt.Errorf("path '%s' is not configured", name)
 }
 
-type IPCamera struct {
-	// Camera ID (unique)
-	Id       string `json:"id"`
-	Host     string `json:"host"`
-	Port     string `json:"port"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	// Camera가 다중 프로필 지원 여부에 따라서 다중 소스 스트림을 사용할지 여부
-	// 보통 IPCam은 두 개 이상의 Encoder를 제공한다. Encoder에 따라서 Camera Source 영상 품질이 결정된다.
-	// 흔히, Main Encoder, Sub, Third 등으로 나뉘어져 있다. 이런 경우, 다중 소스 스트림을 사용할 수 있다.
-	// 다중 소스 스트림을 사용하면, 각각의 Encoder에 대한 RTSP URL을 사용할 수 있다.
-	// 다중 소스 스트림을 사용하지 않으면, Main Encoder에 대한 RTSP URL만 사용할 수 있다(가장 높은 화질 또는 첫 번째 Encoder).
-	EnableMultiEncoder bool `json:"enableMultiEncoder"`
-
-	// CCTV Endpoint Port
-	PTZSupport bool   `json:"ptzSupport"` // Deprecated
-	Brand      string `json:"brand"`      // Deprecated
-	// Id         string `json:"id"`
-}
-
 // Path is a path configuration.
 // WARNING: Avoid using slices directly due to https://github.com/golang/go/issues/21092
 type Path struct {
@@ -107,16 +87,21 @@ type Path struct {
 	Name   string         `json:"name"` // filled by Check()
 
 	// General
-	Source                     string         `json:"source"`
-	SourceFingerprint          string         `json:"sourceFingerprint"`
-	SourceOnDemand             bool           `json:"sourceOnDemand"`
-	SourceOnDemandStartTimeout StringDuration `json:"sourceOnDemandStartTimeout"`
-	SourceOnDemandCloseAfter   StringDuration `json:"sourceOnDemandCloseAfter"`
-	MaxReaders                 int            `json:"maxReaders"`
-	SRTReadPassphrase          string         `json:"srtReadPassphrase"`
-	Fallback                   string         `json:"fallback"`
-	Username                   string         `json:"username"`
-	Password                   string         `json:"password"`
+	Source                     string           `json:"source"`
+	SourceFingerprint          string           `json:"sourceFingerprint"`
+	SourceOnDemand             bool             `json:"sourceOnDemand"`
+	SourceOnDemandStartTimeout StringDuration   `json:"sourceOnDemandStartTimeout"`
+	SourceOnDemandCloseAfter   StringDuration   `json:"sourceOnDemandCloseAfter"`
+	SourceRetryPause           StringDuration   `json:"sourceRetryPause"`
+	SourceRetryMaxPause        StringDuration   `json:"sourceRetryMaxPause"`
+	SourceRetryJitter          float64          `json:"sourceRetryJitter"`
+	SourceRetryBudget          int              `json:"sourceRetryBudget"`
+	SourceAlternates           SourceAlternates `json:"sourceAlternates"`
+	MaxReaders                 int              `json:"maxReaders"`
+	SRTReadPassphrase          string           `json:"srtReadPassphrase"`
+	Fallback                   string           `json:"fallback"`
+	Username                   string           `json:"username"`
+	Password                   string           `json:"password"`
 
 	// CCTV Endpoint Port
 	RemoteDevice bool    `json:"remoteDevice"` // Is Remote Device?
@@ -128,13 +113,21 @@ type Path struct {
 	PTZZoomSpeed float64 `json:"ptzZoomSpeed"`
 
 	// Record
-	Record                bool           `json:"record"`
-	Playback              *bool          `json:"playback,omitempty"` // deprecated
-	RecordPath            string         `json:"recordPath"`
-	RecordFormat          RecordFormat   `json:"recordFormat"`
-	RecordPartDuration    StringDuration `json:"recordPartDuration"`
-	RecordSegmentDuration StringDuration `json:"recordSegmentDuration"`
-	RecordDeleteAfter     StringDuration `json:"recordDeleteAfter"`
+	Record                  bool             `json:"record"`
+	Playback                *bool            `json:"playback,omitempty"` // deprecated
+	RecordPath              string           `json:"recordPath"`
+	RecordFormat            RecordFormat     `json:"recordFormat"`
+	RecordPartDuration      StringDuration   `json:"recordPartDuration"`
+	RecordSegmentDuration   StringDuration   `json:"recordSegmentDuration"`
+	RecordDeleteAfter       StringDuration   `json:"recordDeleteAfter"`
+	RecordMaxSize           StringSize       `json:"recordMaxSize"`
+	RecordPriority          int              `json:"recordPriority"`
+	RecordThumbnailInterval StringDuration   `json:"recordThumbnailInterval"`
+	RecordManifest          bool             `json:"recordManifest"`
+	RecordSigningKey        string           `json:"recordSigningKey"`
+	RecordEncryption        RecordEncryption `json:"recordEncryption"`
+	RecordEncryptionKey     string           `json:"recordEncryptionKey"`
+	RecordTiers             RecordTiers      `json:"recordTiers"`
 
 	// Authentication (deprecated)
 	PublishUser *Credential `json:"publishUser,omitempty"` // deprecated
@@ -150,12 +143,14 @@ type Path struct {
 	SRTPublishPassphrase     string `json:"srtPublishPassphrase"`
 
 	// RTSP source
-	RTSPTransport       RTSPTransport  `json:"rtspTransport"`
-	RTSPAnyPort         bool           `json:"rtspAnyPort"`
-	SourceProtocol      *RTSPTransport `json:"sourceProtocol,omitempty"`      // deprecated
-	SourceAnyPortEnable *bool          `json:"sourceAnyPortEnable,omitempty"` // deprecated
-	RTSPRangeType       RTSPRangeType  `json:"rtspRangeType"`
-	RTSPRangeStart      string         `json:"rtspRangeStart"`
+	RTSPTransport         RTSPTransport  `json:"rtspTransport"`
+	RTSPAnyPort           bool           `json:"rtspAnyPort"`
+	SourceProtocol        *RTSPTransport `json:"sourceProtocol,omitempty"`      // deprecated
+	SourceAnyPortEnable   *bool          `json:"sourceAnyPortEnable,omitempty"` // deprecated
+	RTSPRangeType         RTSPRangeType  `json:"rtspRangeType"`
+	RTSPRangeStart        string         `json:"rtspRangeStart"`
+	RTSPBackChannel       bool           `json:"rtspBackChannel"`
+	RTSPMulticastFallback string         `json:"rtspMulticastFallback"`
 
 	// Redirect source
 	SourceRedirect string `json:"sourceRedirect"`
@@ -185,6 +180,8 @@ func (pconf *Path) setDefaults() {
 	pconf.Source = "publisher"
 	pconf.SourceOnDemandStartTimeout = 10 * StringDuration(time.Second)
 	pconf.SourceOnDemandCloseAfter = 10 * StringDuration(time.Second)
+	pconf.SourceRetryPause = 5 * StringDuration(time.Second)
+	pconf.SourceRetryMaxPause = 5 * StringDuration(time.Second)
 
 	// Record
 	pconf.RecordPath = "./recordings/%path/%Y-%m-%d_%H-%M-%S-%f"
@@ -192,6 +189,7 @@ func (pconf *Path) setDefaults() {
 	pconf.RecordPartDuration = StringDuration(1 * time.Second)
 	pconf.RecordSegmentDuration = 3600 * StringDuration(time.Second)
 	pconf.RecordDeleteAfter = 24 * 3600 * StringDuration(time.Second)
+	pconf.RecordThumbnailInterval = 10 * StringDuration(time.Second)
 
 	// Publisher source
 	pconf.OverridePublisher = true
@@ -342,6 +340,33 @@ func (pconf *Path) validate(
 			return fmt.Errorf("'sourceOnDemand' is useless when source is 'publisher'")
 		}
 	}
+	if pconf.SourceRetryPause <= 0 {
+		return fmt.Errorf("'sourceRetryPause' must be greater than zero")
+	}
+	if pconf.SourceRetryMaxPause < pconf.SourceRetryPause {
+		return fmt.Errorf("'sourceRetryMaxPause' cannot be lower than 'sourceRetryPause'")
+	}
+	if pconf.SourceRetryJitter < 0 || pconf.SourceRetryJitter > 1 {
+		return fmt.Errorf("'sourceRetryJitter' must be between 0 and 1")
+	}
+	if pconf.SourceRetryBudget < 0 {
+		return fmt.Errorf("'sourceRetryBudget' cannot be negative")
+	}
+	if len(pconf.SourceAlternates) != 0 {
+		if !strings.HasPrefix(pconf.Source, "rtsp://") && !strings.HasPrefix(pconf.Source, "rtsps://") &&
+			!strings.HasPrefix(pconf.Source, "http://") && !strings.HasPrefix(pconf.Source, "https://") {
+			return fmt.Errorf("'sourceAlternates' can be used with RTSP sources only")
+		}
+		for _, alt := range pconf.SourceAlternates {
+			if !strings.HasPrefix(alt, "rtsp://") && !strings.HasPrefix(alt, "rtsps://") {
+				return fmt.Errorf("'%s' is not a valid RTSP URL", alt)
+			}
+			_, err := base.ParseURL(alt)
+			if err != nil {
+				return fmt.Errorf("'%s' is not a valid RTSP URL", alt)
+			}
+		}
+	}
 	if pconf.SRTReadPassphrase != "" {
 		err := srtCheckPassphrase(pconf.SRTReadPassphrase)
 		if err != nil {
@@ -378,6 +403,15 @@ func (pconf *Path) validate(
 		}
 	}
 
+	if pconf.RecordEncryption != RecordEncryptionNone && pconf.RecordEncryptionKey == "" {
+		return fmt.Errorf("'recordEncryptionKey' must be set when 'recordEncryption' is enabled")
+	}
+
+	err := pconf.RecordTiers.validate()
+	if err != nil {
+		return err
+	}
+
 	// Authentication (deprecated)
 
 	if deprecatedCredentialsMode {
@@ -470,6 +504,12 @@ func (pconf *Path) validate(
 	if pconf.SourceAnyPortEnable != nil {
 		pconf.RTSPAnyPort = *pconf.SourceAnyPortEnable
 	}
+	if pconf.RTSPMulticastFallback != "" {
+		_, err := base.ParseURL(pconf.RTSPMulticastFallback)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid RTSP URL", pconf.RTSPMulticastFallback)
+		}
+	}
 
 	// Redirect source
 
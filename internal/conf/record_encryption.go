@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RecordEncryption is the recordEncryption parameter.
+type RecordEncryption int
+
+// supported values.
+const (
+	RecordEncryptionNone RecordEncryption = iota
+	RecordEncryptionAESGCM
+)
+
+// MarshalJSON implements json.Marshaler.
+func (d RecordEncryption) MarshalJSON() ([]byte, error) {
+	var out string
+
+	switch d {
+	case RecordEncryptionAESGCM:
+		out = "aes-gcm"
+
+	default:
+		out = "none"
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *RecordEncryption) UnmarshalJSON(b []byte) error {
+	var in string
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	switch in {
+	case "aes-gcm":
+		*d = RecordEncryptionAESGCM
+
+	case "none":
+		*d = RecordEncryptionNone
+
+	default:
+		return fmt.Errorf("invalid record encryption '%s'", in)
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *RecordEncryption) UnmarshalEnv(_ string, v string) error {
+	return d.UnmarshalJSON([]byte(`"` + v + `"`))
+}
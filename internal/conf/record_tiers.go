@@ -0,0 +1,66 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RecordTier is a storage tier where segments are moved after they reach a certain age.
+type RecordTier struct {
+	After             StringDuration `json:"after"`
+	Path              string         `json:"path"`
+	S3Endpoint        string         `json:"s3Endpoint"`
+	S3Region          string         `json:"s3Region"`
+	S3AccessKeyID     string         `json:"s3AccessKeyID"`
+	S3SecretAccessKey string         `json:"s3SecretAccessKey"`
+}
+
+// IsS3 checks whether the tier is stored into a S3-compatible object storage.
+func (t RecordTier) IsS3() bool {
+	return strings.HasPrefix(t.Path, "s3://")
+}
+
+// RecordTiers is the recordTiers parameter.
+type RecordTiers []RecordTier
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *RecordTiers) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return json.Unmarshal(b, (*[]RecordTier)(s))
+}
+
+func (s RecordTiers) validate() error {
+	var prev StringDuration
+
+	for i, tier := range s {
+		if tier.After <= prev {
+			return fmt.Errorf("'after' of record tier %d must be greater than the one of the previous tier", i+1)
+		}
+		prev = tier.After
+
+		if !strings.Contains(tier.Path, "%Y") ||
+			!strings.Contains(tier.Path, "%m") ||
+			!strings.Contains(tier.Path, "%d") ||
+			!strings.Contains(tier.Path, "%H") ||
+			!strings.Contains(tier.Path, "%M") ||
+			!strings.Contains(tier.Path, "%S") ||
+			!strings.Contains(tier.Path, "%f") {
+			return fmt.Errorf("path of record tier %d is missing one of the mandatory elements:"+
+				" %%Y %%m %%d %%H %%M %%S %%f", i+1)
+		}
+
+		if tier.IsS3() {
+			bucket, _, _ := strings.Cut(strings.TrimPrefix(tier.Path, "s3://"), "/")
+			if bucket == "" || strings.Contains(bucket, "%") {
+				return fmt.Errorf("path of record tier %d has an invalid bucket", i+1)
+			}
+		} else if tier.S3Endpoint != "" {
+			return fmt.Errorf("'s3Endpoint' is set but path of record tier %d doesn't start with s3://", i+1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/ctenhank/mediamtx/internal/conf/decrypt"
+	"github.com/ctenhank/mediamtx/internal/conf/yaml"
+)
+
+func yamlMapValue(m *yamlv3.Node, key string) *yamlv3.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func yamlSetMapValue(m *yamlv3.Node, key string, value *yamlv3.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			// keep comments attached to the previous value
+			value.HeadComment = m.Content[i+1].HeadComment
+			value.LineComment = m.Content[i+1].LineComment
+			m.Content[i+1] = value
+			return
+		}
+	}
+
+	m.Content = append(m.Content,
+		&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key},
+		value)
+}
+
+// yamlCameraNode returns the node of a camera,
+// defined in the cameras section or, with the legacy format, in the paths section.
+func yamlCameraNode(root *yamlv3.Node, name string) *yamlv3.Node {
+	for _, section := range []string{"cameras", "paths"} {
+		s := yamlMapValue(root, section)
+		if s == nil || s.Kind != yamlv3.MappingNode {
+			continue
+		}
+
+		n := yamlMapValue(s, name)
+		if n == nil {
+			continue
+		}
+
+		// a camera with no settings
+		if n.Kind == yamlv3.ScalarNode && n.Tag == "!!null" {
+			*n = yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map", LineComment: n.LineComment}
+		}
+
+		if n.Kind == yamlv3.MappingNode {
+			return n
+		}
+	}
+	return nil
+}
+
+// SavesPlaintextSecrets returns whether SaveCameras writes passwords in plain text,
+// since the configuration file is not encrypted.
+func SavesPlaintextSecrets(cameras map[string]*OptionalCamera) bool {
+	for _, name := range []string{"RTSP_CONFKEY", "MTX_CONFKEY"} {
+		if _, ok := os.LookupEnv(name); ok {
+			return false
+		}
+	}
+
+	for _, camera := range cameras {
+		enc, err := json.Marshal(camera.Values)
+		if err != nil {
+			continue
+		}
+
+		var values map[string]interface{}
+		err = json.Unmarshal(enc, &values)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := values["password"]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SaveCameras writes camera settings into the configuration file.
+// Only the given settings are changed, the rest of the file is kept, comments included.
+// Either all cameras are written or none.
+func SaveCameras(fpath string, cameras map[string]*OptionalCamera) error {
+	if fpath == "" {
+		return fmt.Errorf("configuration file not found")
+	}
+
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return err
+	}
+
+	// keys are applied in the same order as loadFromFile()
+	var keys []string
+	for _, name := range []string{"RTSP_CONFKEY", "MTX_CONFKEY"} {
+		if key, ok := os.LookupEnv(name); ok {
+			byts, err = decrypt.Decrypt(key, byts)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	var doc yamlv3.Node
+	err = yamlv3.Unmarshal(byts, &doc)
+	if err != nil {
+		return err
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return fmt.Errorf("configuration file is not a map")
+	}
+	root := doc.Content[0]
+
+	for _, name := range sortedKeys(cameras) {
+		n := yamlCameraNode(root, name)
+		if n == nil {
+			return fmt.Errorf("camera '%s' is not defined in the configuration file", name)
+		}
+
+		enc, err := json.Marshal(cameras[name].Values)
+		if err != nil {
+			return err
+		}
+
+		var values map[string]interface{}
+		err = json.Unmarshal(enc, &values)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range sortedKeys(values) {
+			var v yamlv3.Node
+			err = v.Encode(values[key])
+			if err != nil {
+				return err
+			}
+			yamlSetMapValue(n, key, &v)
+		}
+	}
+
+	var buf bytes.Buffer
+	e := yamlv3.NewEncoder(&buf)
+	e.SetIndent(2)
+	err = e.Encode(&doc)
+	if err != nil {
+		return err
+	}
+	e.Close()
+
+	// check that the result can still be loaded
+	var check Conf
+	err = yaml.Load(buf.Bytes(), &check)
+	if err != nil {
+		return fmt.Errorf("invalid configuration after change: %w", err)
+	}
+
+	byts = buf.Bytes()
+	for i := len(keys) - 1; i >= 0; i-- {
+		byts, err = decrypt.Encrypt(keys[i], byts)
+		if err != nil {
+			return err
+		}
+	}
+
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+
+	// write a temporary file and rename it, so that the configuration is never partially written
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(byts)
+	if err == nil {
+		err = tmp.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fpath)
+}
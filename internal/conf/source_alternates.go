@@ -0,0 +1,29 @@
+package conf
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// SourceAlternates is the sourceAlternates parameter.
+// It contains sources that are tried in order when the source fails.
+type SourceAlternates []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *SourceAlternates) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*a = nil
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (a *SourceAlternates) UnmarshalEnv(_ string, v string) error {
+	*a = nil
+	for _, s := range strings.Split(v, ",") {
+		if s != "" {
+			*a = append(*a, s)
+		}
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"time"
 
@@ -16,22 +15,11 @@ import (
 func (c *Control) getIPCameras(ctx *gin.Context) {
 	cams := make([]defs.IPCamera, 0)
 	for _, dev := range c.OnvifDevices {
-		ch := make([]defs.Channel, 0)
-		for _, profile := range *dev.Profiles {
-			ch = append(ch, defs.Channel{
-				Name: profile.PathName,
-				Resolution: defs.Resolution{
-					Width:  int(*profile.VideoEncoderConfiguration.Resolution.Width),
-					Height: int(*profile.VideoEncoderConfiguration.Resolution.Height),
-				},
-			})
-
-		}
 		cams = append(cams, defs.IPCamera{
 			Id:        dev.Conf.Id,
 			Name:      dev.Conf.Name,
 			PtzSupprt: dev.isEnabledPTZ(),
-			Channels:  ch,
+			Channels:  dev.channels(),
 		})
 	}
 
@@ -55,7 +43,7 @@ func (c *Control) getIPCamera(ctx *gin.Context) {
 	var cam *onvifDevice
 	for _, dev := range c.OnvifDevices {
 		if dev.Conf.Name == name {
-			cam = &dev
+			cam = dev
 		}
 	}
 
@@ -83,7 +71,7 @@ func (c *Control) getChannels(ctx *gin.Context) {
 	var cam *onvifDevice
 	for _, dev := range c.OnvifDevices {
 		if dev.Conf.Name == name {
-			cam = &dev
+			cam = dev
 		}
 	}
 
@@ -94,19 +82,8 @@ func (c *Control) getChannels(ctx *gin.Context) {
 		return
 	}
 
-	ch := make([]defs.Channel, 0)
-	for _, profile := range *cam.Profiles {
-		ch = append(ch, defs.Channel{
-			Name: profile.PathName,
-			Resolution: defs.Resolution{
-				Width:  int(*profile.VideoEncoderConfiguration.Resolution.Width),
-				Height: int(*profile.VideoEncoderConfiguration.Resolution.Height),
-			},
-		})
-	}
-
 	ctx.JSON(http.StatusOK, gin.H{
-		"channels": ch,
+		"channels": cam.channels(),
 	})
 }
 
@@ -124,7 +101,7 @@ func (c *Control) getSnapshot(ctx *gin.Context) {
 	var cam *onvifDevice
 	for _, dev := range c.OnvifDevices {
 		if dev.Conf.Name == name {
-			cam = &dev
+			cam = dev
 		}
 	}
 
@@ -165,7 +142,7 @@ func (c *Control) getSnapshot(ctx *gin.Context) {
 	}
 
 
-	snapshotUrl, err := url.Parse(string(cam.SnapshotUri.Uri))
+	snapshotUrl, err := cam.rewriteAPIURI(string(cam.SnapshotUri.Uri))
 
 	if err != nil {
 		c.writeError(ctx, http.StatusInternalServerError, errors.New("Error parsing snapshot URL: "+err.Error()))
@@ -173,9 +150,7 @@ func (c *Control) getSnapshot(ctx *gin.Context) {
 		return
 	}
 
-	snapshotUrl.Host = cam.Url.Host
-
-	resp, err := cam.client.Get(snapshotUrl.String())
+	resp, err := cam.client.Get(snapshotUrl)
 	if err != nil {
 		c.writeError(ctx, http.StatusInternalServerError, errors.New("Error getting snapshot: "+err.Error()))
 
@@ -195,7 +170,7 @@ func (c *Control) getSnapshot(ctx *gin.Context) {
 		return
 	}
 
-	c.Log(logger.Info, "Snapshot taken from "+name+"; "+resp.Status+", "+snapshotUrl.String()+"\n"+resp.Header.Get("Content-Type"))
+	c.Log(logger.Info, "Snapshot taken from "+name+"; "+resp.Status+", "+snapshotUrl+"\n"+resp.Header.Get("Content-Type"))
   
 	os.MkdirAll(directory, os.ModePerm)
 	err = os.WriteFile(directory+"/"+filename, b, 0644)
@@ -1,10 +1,13 @@
 package control
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
@@ -17,6 +20,9 @@ import (
 
 type apiParent interface {
 	logger.Writer
+	ControlCamerasPatch(cameras map[string]*conf.OptionalCamera) error
+	ControlPathReady(name string) bool
+	ControlCameraSessions(name string) (*defs.ControlCameraSessions, bool)
 }
 
 type Control struct {
@@ -31,8 +37,21 @@ type Control struct {
 
 	Parent       apiParent
 	httpServer   *httpp.WrappedServer
-	OnvifDevices []onvifDevice
+	OnvifDevices []*onvifDevice
 	ptzRoom      []PTZRoom
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	ioMutex   sync.Mutex
+	ioAudit   []defs.ControlIOAuditEntry
+	ioPulses  map[ioOutputKey]*ioPulse
+	ioOutputs map[ioOutputKey]string
+
+	// 유지보수 작업. 없으면 Control이 직접 만들고 닫는다.
+	MaintenanceJobs    *MaintenanceJobs
+	ownMaintenanceJobs bool
 }
 
 func convertPathConfToUrl(path conf.Path) (*url.URL, error) {
@@ -63,11 +82,43 @@ func (c *Control) Initialize() error {
 	// path.GET("/:name")
 	ipcam := group.Group("/ipcam")
 	ipcam.GET("/", c.getIPCameras)
+	ipcam.POST("/credentials/rotate", c.rotateCredentials)
+	ipcam.GET("/io/audit", c.getIOAudit)
+	ipcam.POST("/osd/apply", c.applyOSD)
+	ipcam.GET("/osd/drift", c.getOSDDrift)
+	ipcam.GET("/maintenance", c.getMaintenanceJobs)
+	ipcam.POST("/maintenance", c.createMaintenanceJob)
+	ipcam.GET("/maintenance/:id", c.getMaintenanceJob)
+	ipcam.DELETE("/maintenance/:id", c.cancelMaintenanceJob)
 	ipcam.GET("/:name", c.getIPCamera)
 	ipcam.GET("/:name/channel", c.getChannels)
 
 	ipcam.GET("/:name/snapshot", c.getSnapshot)
 
+	ipcam.GET("/:name/motion", c.getMotionDetection)
+	ipcam.PUT("/:name/motion", c.setMotionDetection)
+	ipcam.GET("/:name/smart/line", c.getLineDetection)
+	ipcam.PUT("/:name/smart/line", c.setLineDetection)
+	ipcam.GET("/:name/smart/field", c.getFieldDetection)
+	ipcam.PUT("/:name/smart/field", c.setFieldDetection)
+
+	ipcam.GET("/:name/io", c.getIO)
+	ipcam.PUT("/:name/io/outputs/:token", c.setIOOutput)
+
+	ipcam.GET("/:name/osd", c.getOSDs)
+	ipcam.POST("/:name/osd", c.createOSD)
+	ipcam.PUT("/:name/osd/:token", c.setOSD)
+	ipcam.DELETE("/:name/osd/:token", c.deleteOSD)
+
+	ipcam.GET("/:name/masks", c.getPrivacyMasks)
+	ipcam.POST("/:name/masks", c.createPrivacyMask)
+	ipcam.DELETE("/:name/masks/:token", c.deletePrivacyMask)
+
+	ipcam.GET("/:name/network", c.getNetwork)
+	ipcam.PATCH("/:name/network", c.setNetwork)
+
+	ipcam.GET("/:name/sessions", c.getSessions)
+
 	group.GET("/ptz/:name", c.getPTZ)
 
 	network, address := restrictnetwork.Restrict("tcp", c.Address)
@@ -87,11 +138,18 @@ func (c *Control) Initialize() error {
 		return err
 	}
 
-	paths := c.Conf.Paths
-	for _, path := range paths {
+	names := make([]string, 0, len(c.Conf.Cameras))
+	for name := range c.Conf.Cameras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cam := c.Conf.Cameras[name]
 
 		dev := &onvifDevice{
-			Conf:   path,
+			Conf:   cam.Path,
+			Camera: cam,
 			parent: c,
 		}
 		err := dev.initialize()
@@ -100,7 +158,25 @@ func (c *Control) Initialize() error {
 			continue
 		}
 
-		c.OnvifDevices = append(c.OnvifDevices, *dev)
+		c.OnvifDevices = append(c.OnvifDevices, dev)
+	}
+
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+
+	if c.MaintenanceJobs == nil {
+		c.MaintenanceJobs = &MaintenanceJobs{}
+		c.MaintenanceJobs.Initialize()
+		c.ownMaintenanceJobs = true
+	}
+
+	if len(c.Conf.ControlIORules) != 0 {
+		c.wg.Add(1)
+		go c.runIORules()
+	}
+
+	if c.Conf.ControlOSDTemplate != "" && c.Conf.ControlOSDCheckPeriod > 0 {
+		c.wg.Add(1)
+		go c.runOSDDriftCheck()
 	}
 
 	c.Log(logger.Info, "listener opened on "+address)
@@ -114,6 +190,14 @@ func (c *Control) Log(level logger.Level, format string, args ...interface{}) {
 
 func (c *Control) Close() {
 	c.Log(logger.Info, "listener is closing")
+	if c.ctxCancel != nil {
+		c.ctxCancel()
+		c.flushIOPulses()
+		c.wg.Wait()
+	}
+	if c.ownMaintenanceJobs {
+		c.MaintenanceJobs.Close()
+	}
 	c.httpServer.Close()
 
 }
@@ -127,17 +211,50 @@ func (c *Control) getPtzRoom(name string) *PTZRoom {
 	return nil
 }
 
+// getOnvifDevice는 카메라 이름 또는 프로파일 경로 이름으로 디바이스를 찾는다.
 func (c *Control) getOnvifDevice(name string) *onvifDevice {
 	for _, dev := range c.OnvifDevices {
+		if dev.Conf.Name == name {
+			return dev
+		}
+	}
+
+	for _, dev := range c.OnvifDevices {
+		if dev.Profiles == nil {
+			continue
+		}
 		for _, profiles := range *dev.Profiles {
 			if profiles.PathName == name {
-				return &dev
+				return dev
 			}
 		}
 	}
 	return nil
 }
 
+// uniqueDevices sorts devices by name and removes duplicates,
+// so that their locks are always taken in the same order.
+func uniqueDevices(devs []*onvifDevice) []*onvifDevice {
+	ret := make([]*onvifDevice, 0, len(devs))
+	for _, dev := range devs {
+		found := false
+		for _, d := range ret {
+			if d == dev {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ret = append(ret, dev)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Conf.Name < ret[j].Conf.Name
+	})
+	return ret
+}
+
 func (c *Control) writeError(ctx *gin.Context, status int, err error) {
 	c.Log(logger.Error, err.Error())
 
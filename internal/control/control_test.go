@@ -7,6 +7,7 @@ import (
 
 	"github.com/ctenhank/mediamtx/internal/conf"
 	"github.com/ctenhank/mediamtx/internal/control"
+	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/ctenhank/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
@@ -16,6 +17,14 @@ type testParent struct{}
 
 func (t *testParent) Log(level logger.Level, format string, args ...interface{}) {}
 
+func (t *testParent) ControlCamerasPatch(map[string]*conf.OptionalCamera) error { return nil }
+
+func (t *testParent) ControlPathReady(string) bool { return false }
+
+func (t *testParent) ControlCameraSessions(string) (*defs.ControlCameraSessions, bool) {
+	return nil, false
+}
+
 const tempConfStr = `
 control: true
 paths:
@@ -0,0 +1,552 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	goonvif "github.com/IOTechSystems/onvif"
+	media "github.com/IOTechSystems/onvif/media"
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/gin-gonic/gin"
+	"github.com/icholy/digest"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/conf/decrypt"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+type credentialRotationReq struct {
+	// 대상 카메라 이름. 비어 있으면 모든 카메라
+	Cameras  []string            `json:"cameras"`
+	Username string              `json:"username"`
+	Password string              `json:"password"`
+	UserType isapi.OnvifUserType `json:"userType"`
+
+	// Password가 MTX_CONFKEY로 암호화된 값인지 여부 (conf/decrypt 형식)
+	Encrypted bool `json:"encrypted"`
+
+	// ISAPI 사용자 관리에 사용할 관리자 계정. 비어 있으면 현재 Path 계정을 사용한다.
+	AdminUsername string `json:"adminUsername"`
+	AdminPassword string `json:"adminPassword"`
+
+	// 하나라도 실패하면 모든 카메라를 롤백할지 여부
+	Atomic bool `json:"atomic"`
+}
+
+// credentialRotation은 카메라 한 대의 계정 교체 상태를 나타낸다.
+type credentialRotation struct {
+	dev   *onvifDevice
+	admin isapi.HostParams
+
+	// 새로 만든 ONVIF 사용자와 장치(RTSP) 사용자의 id. 만들지 않았으면 0
+	newId       int
+	newDeviceId int
+
+	result defs.CredentialRotationResult
+}
+
+func (r *credentialRotation) step(format string, args ...interface{}) {
+	r.result.Steps = append(r.result.Steps, fmt.Sprintf(format, args...))
+}
+
+func (r *credentialRotation) fail(err error) {
+	r.result.Status = defs.CredentialRotationFailed
+	r.result.Error = err.Error()
+}
+
+func confKey() (string, bool) {
+	if key, ok := os.LookupEnv("MTX_CONFKEY"); ok {
+		return key, true
+	}
+	return os.LookupEnv("RTSP_CONFKEY") // legacy format
+}
+
+func findOnvifUser(users *isapi.UserList, name string) *isapi.User {
+	for i := range users.User {
+		if users.User[i].UserName == name {
+			return &users.User[i]
+		}
+	}
+	return nil
+}
+
+func nextOnvifUserId(users *isapi.UserList) int {
+	id := 0
+	for _, u := range users.User {
+		if u.Id > id {
+			id = u.Id
+		}
+	}
+	return id + 1
+}
+
+func findDeviceUser(users *isapi.DeviceUserList, name string) *isapi.DeviceUser {
+	for i := range users.User {
+		if users.User[i].UserName == name {
+			return &users.User[i]
+		}
+	}
+	return nil
+}
+
+func nextDeviceUserId(users *isapi.DeviceUserList) int {
+	id := 0
+	for _, u := range users.User {
+		if u.Id > id {
+			id = u.Id
+		}
+	}
+	return id + 1
+}
+
+func checkResponseStatus(status *isapi.ResponseStatus) error {
+	// ISAPI statusCode 1 = OK
+	if status != nil && status.StatusCode != 1 {
+		return fmt.Errorf("%s (%s)", status.StatusString, status.SubStatusCode)
+	}
+	return nil
+}
+
+// verifyOnvifCredentials는 인증이 필요한 GetProfiles를 호출해 ONVIF 계정을 확인한다.
+func verifyOnvifCredentials(host string, username string, password string, timeout time.Duration) error {
+	dev, err := goonvif.NewDevice(goonvif.DeviceParams{
+		Xaddr:    host,
+		Username: username,
+		Password: password,
+		HttpClient: &http.Client{
+			Timeout: timeout,
+			Transport: &digest.Transport{
+				Username: username,
+				Password: password,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := dev.CallMethod(media.GetProfiles{})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if (resp.StatusCode / 100) != 2 {
+		return fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// verifyRTSPCredentials는 DESCRIBE 요청으로 RTSP 계정을 확인한다.
+func verifyRTSPCredentials(source string, username string, password string, timeout time.Duration) error {
+	u, err := base.ParseURL(source)
+	if err != nil {
+		return err
+	}
+	u.User = url.UserPassword(username, password)
+
+	c := &gortsplib.Client{
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+
+	err = c.Start(u.Scheme, u.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, _, err = c.Describe(u)
+	return err
+}
+
+// prepareCredentialRotation은 새 사용자를 만들고 ONVIF, RTSP 접속을 확인한다. 카메라 설정은 바꾸지 않는다.
+func (c *Control) prepareCredentialRotation(r *credentialRotation, req *credentialRotationReq, password string) error {
+	timeout := time.Duration(c.ReadTimeout)
+
+	users, err := isapi.GetOnvifUserList(r.admin)
+	if err != nil {
+		return fmt.Errorf("failed to get ONVIF users: %w", err)
+	}
+
+	if findOnvifUser(users, req.Username) != nil {
+		return fmt.Errorf("ONVIF user '%s' already exists", req.Username)
+	}
+
+	r.newId = nextOnvifUserId(users)
+	status, err := isapi.CreateOnvifUser(isapi.UserCreateParams{
+		HostParams: r.admin,
+		UserForm: isapi.UserForm{
+			User: isapi.User{
+				Id:       r.newId,
+				UserName: req.Username,
+				UserType: req.UserType,
+			},
+			Password: password,
+		},
+	})
+	if err == nil {
+		err = checkResponseStatus(status)
+	}
+	if err != nil {
+		r.newId = 0
+		return fmt.Errorf("failed to create ONVIF user: %w", err)
+	}
+	r.step("created ONVIF user %s (id %d)", req.Username, r.newId)
+
+	// RTSP 접속은 ONVIF 사용자가 아닌 장치 사용자로 인증된다
+	deviceUsers, err := isapi.GetDeviceUserList(r.admin)
+	if err != nil {
+		return fmt.Errorf("failed to get device users: %w", err)
+	}
+
+	if findDeviceUser(deviceUsers, req.Username) != nil {
+		return fmt.Errorf("device user '%s' already exists", req.Username)
+	}
+
+	r.newDeviceId = nextDeviceUserId(deviceUsers)
+	status, err = isapi.CreateDeviceUser(r.admin, isapi.DeviceUserForm{
+		DeviceUser: isapi.DeviceUser{
+			Id:        r.newDeviceId,
+			UserName:  req.Username,
+			UserLevel: isapi.UserLevelOf(req.UserType),
+		},
+		Password: password,
+	})
+	if err == nil {
+		err = checkResponseStatus(status)
+	}
+	if err != nil {
+		r.newDeviceId = 0
+		return fmt.Errorf("failed to create device user: %w", err)
+	}
+	r.step("created device user %s (id %d)", req.Username, r.newDeviceId)
+
+	err = verifyOnvifCredentials(r.dev.Url.Host, req.Username, password, timeout)
+	if err != nil {
+		return fmt.Errorf("ONVIF access check failed: %w", err)
+	}
+	r.step("verified ONVIF access")
+
+	if r.dev.StreamUris != nil && len(*r.dev.StreamUris) != 0 {
+		source, err := r.dev.StreamSource((*r.dev.StreamUris)[0])
+		if err != nil {
+			return err
+		}
+
+		err = verifyRTSPCredentials(source, req.Username, password, timeout)
+		if err != nil {
+			return fmt.Errorf("RTSP access check failed: %w", err)
+		}
+		r.step("verified RTSP access")
+	}
+
+	return nil
+}
+
+// rollbackCredentialRotation은 prepareCredentialRotation에서 만든 새 사용자를 삭제한다.
+func (c *Control) rollbackCredentialRotation(r *credentialRotation) {
+	if r.newId == 0 && r.newDeviceId == 0 {
+		return
+	}
+
+	var warnings []string
+
+	if r.newDeviceId != 0 {
+		status, err := isapi.DeleteDeviceUser(r.admin, r.newDeviceId)
+		if err == nil {
+			err = checkResponseStatus(status)
+		}
+		if err != nil {
+			c.Log(logger.Error, "failed to roll back device user %d of %s: %v", r.newDeviceId, r.dev.Conf.Name, err)
+			warnings = append(warnings, "failed to delete new device user: "+err.Error())
+		} else {
+			r.step("deleted device user id %d", r.newDeviceId)
+			r.newDeviceId = 0
+		}
+	}
+
+	if r.newId != 0 {
+		status, err := isapi.DeleteOnvifUser(isapi.UserDeleteParams{
+			HostParams: r.admin,
+			Id:         r.newId,
+		})
+		if err == nil {
+			err = checkResponseStatus(status)
+		}
+		if err != nil {
+			c.Log(logger.Error, "failed to roll back ONVIF user %d of %s: %v", r.newId, r.dev.Conf.Name, err)
+			warnings = append(warnings, "failed to delete new ONVIF user: "+err.Error())
+		} else {
+			r.step("deleted ONVIF user id %d", r.newId)
+			r.newId = 0
+		}
+	}
+
+	if len(warnings) != 0 {
+		r.result.Warning = strings.Join(warnings, "; ")
+		return
+	}
+
+	r.result.Status = defs.CredentialRotationRolledBack
+}
+
+// removeOldUsers는 설정 파일에 새 계정이 기록된 뒤 기존 사용자를 삭제한다.
+// 실패해도 교체는 완료된 것이므로 경고만 남긴다.
+func (c *Control) removeOldUsers(r *credentialRotation, oldUsername string) {
+	// 관리자 계정은 ISAPI 관리를 위해 남겨둔다
+	if oldUsername == r.admin.Username {
+		r.step("kept user %s (administrator)", oldUsername)
+		return
+	}
+
+	var warnings []string
+
+	users, err := isapi.GetOnvifUserList(r.admin)
+	if err == nil {
+		if old := findOnvifUser(users, oldUsername); old != nil {
+			var status *isapi.ResponseStatus
+			status, err = isapi.DeleteOnvifUser(isapi.UserDeleteParams{
+				HostParams: r.admin,
+				Id:         old.Id,
+			})
+			if err == nil {
+				err = checkResponseStatus(status)
+			}
+			if err == nil {
+				r.step("deleted ONVIF user %s (id %d)", oldUsername, old.Id)
+			}
+		} else {
+			r.step("old ONVIF user %s not found", oldUsername)
+		}
+	}
+	if err != nil {
+		warnings = append(warnings, "failed to remove old ONVIF user: "+err.Error())
+	}
+
+	deviceUsers, err := isapi.GetDeviceUserList(r.admin)
+	if err == nil {
+		if old := findDeviceUser(deviceUsers, oldUsername); old != nil {
+			var status *isapi.ResponseStatus
+			status, err = isapi.DeleteDeviceUser(r.admin, old.Id)
+			if err == nil {
+				err = checkResponseStatus(status)
+			}
+			if err == nil {
+				r.step("deleted device user %s (id %d)", oldUsername, old.Id)
+			}
+		} else {
+			r.step("old device user %s not found", oldUsername)
+		}
+	}
+	if err != nil {
+		warnings = append(warnings, "failed to remove old device user: "+err.Error())
+	}
+
+	r.result.Warning = strings.Join(warnings, "; ")
+}
+
+// credentialsPatch는 Path 계정을 바꾸는 카메라 설정 변경을 만든다.
+func credentialsPatch(username string, password string) (*conf.OptionalCamera, error) {
+	enc, err := json.Marshal(map[string]string{
+		"username": username,
+		"password": password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var p conf.OptionalCamera
+	err = p.UnmarshalJSON(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// rotate는 카메라들의 계정을 교체한다.
+// 새 사용자를 만들고 확인한 뒤, 설정 파일에 새 계정을 기록하고, 기록이 성공한 경우에만 기존 사용자를 삭제한다.
+func (c *Control) rotate(devs []*onvifDevice, req *credentialRotationReq, password string) ([]defs.CredentialRotationResult, bool) {
+	rotations := make([]*credentialRotation, len(devs))
+	for i, dev := range devs {
+		admin := dev.isapiHostParams()
+		if req.AdminUsername != "" {
+			admin.Username = req.AdminUsername
+			admin.Password = req.AdminPassword
+		}
+
+		rotations[i] = &credentialRotation{
+			dev:   dev,
+			admin: admin,
+			result: defs.CredentialRotationResult{
+				Camera: dev.Conf.Name,
+				Steps:  []string{},
+			},
+		}
+	}
+
+	// 1단계: 모든 카메라에 새 사용자를 만들고 접속을 확인한다
+	var wg sync.WaitGroup
+	for _, r := range rotations {
+		wg.Add(1)
+		go func(r *credentialRotation) {
+			defer wg.Done()
+
+			err := c.prepareCredentialRotation(r, req, password)
+			if err != nil {
+				r.fail(err)
+				c.rollbackCredentialRotation(r)
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	failed := false
+	for _, r := range rotations {
+		if r.result.Error != "" {
+			failed = true
+		}
+	}
+
+	var prepared []*credentialRotation
+	for _, r := range rotations {
+		if r.result.Error != "" {
+			continue
+		}
+
+		if req.Atomic && failed {
+			r.fail(errors.New("rotation of another camera failed"))
+			c.rollbackCredentialRotation(r)
+			continue
+		}
+
+		prepared = append(prepared, r)
+	}
+
+	// 2단계: 확인이 끝난 카메라의 계정을 설정 파일에 한 번에 기록한다
+	if len(prepared) != 0 {
+		patches := make(map[string]*conf.OptionalCamera)
+		var err error
+		for _, r := range prepared {
+			patches[r.dev.Conf.Name], err = credentialsPatch(req.Username, password)
+			if err != nil {
+				break
+			}
+		}
+
+		if err == nil {
+			err = c.Parent.ControlCamerasPatch(patches)
+		}
+
+		if err != nil {
+			for _, r := range prepared {
+				r.fail(fmt.Errorf("failed to save configuration: %w", err))
+				c.rollbackCredentialRotation(r)
+			}
+			failed = true
+			prepared = nil
+		}
+	}
+
+	// 3단계: 새 계정이 기록된 카메라의 기존 사용자를 삭제한다
+	for _, r := range prepared {
+		r.step("updated path credentials")
+		r.result.Status = defs.CredentialRotationRotated
+		c.removeOldUsers(r, r.dev.Conf.Username)
+	}
+
+	results := make([]defs.CredentialRotationResult, len(rotations))
+	for i, r := range rotations {
+		results[i] = r.result
+		if r.result.Error != "" {
+			c.Log(logger.Warn, "credential rotation of %s %s: %s", r.result.Camera, r.result.Status, r.result.Error)
+		} else {
+			c.Log(logger.Info, "credential rotation of %s %s", r.result.Camera, r.result.Status)
+		}
+	}
+
+	return results, failed
+}
+
+func (c *Control) rotateCredentials(ctx *gin.Context) {
+	var req credentialRotationReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `username` and `password` are required"))
+		return
+	}
+
+	if req.UserType == "" {
+		req.UserType = isapi.Operator
+	}
+
+	password := req.Password
+	if req.Encrypted {
+		key, ok := confKey()
+		if !ok {
+			c.writeError(ctx, http.StatusBadRequest, errors.New("encrypted password requires MTX_CONFKEY"))
+			return
+		}
+
+		byts, err := decrypt.Decrypt(key, []byte(req.Password))
+		if err != nil {
+			c.writeError(ctx, http.StatusBadRequest, errors.New("Error decrypting password: "+err.Error()))
+			return
+		}
+		password = string(byts)
+	}
+
+	var devs []*onvifDevice
+	if len(req.Cameras) == 0 {
+		devs = c.OnvifDevices
+	} else {
+		for _, name := range req.Cameras {
+			dev := c.getOnvifDevice(name)
+			if dev == nil {
+				c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+				return
+			}
+			devs = append(devs, dev)
+		}
+	}
+
+	devs = uniqueDevices(devs)
+
+	if !c.checkNotInMaintenance(ctx, devs) {
+		return
+	}
+
+	// 같은 카메라의 주소 변경과 동시에 실행되지 않도록 한다
+	for _, dev := range devs {
+		dev.confMutex.Lock()
+		defer dev.confMutex.Unlock()
+	}
+
+	results, failed := c.rotate(devs, &req, password)
+
+	status := http.StatusOK
+	if failed {
+		status = http.StatusMultiStatus
+	}
+
+	ctx.JSON(status, gin.H{
+		"results": results,
+	})
+}
@@ -0,0 +1,274 @@
+package control
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+const fakeCapabilitiesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><tds:GetCapabilitiesResponse><tds:Capabilities>
+<tt:Device><tt:XAddr>http://%[1]s/onvif/device_service</tt:XAddr></tt:Device>
+<tt:Media><tt:XAddr>http://%[1]s/onvif/Media</tt:XAddr></tt:Media>
+</tds:Capabilities></tds:GetCapabilitiesResponse></env:Body></env:Envelope>`
+
+const fakeResponseStatusXML = `<?xml version="1.0" encoding="UTF-8"?>
+<ResponseStatus version="2.0"><statusCode>1</statusCode><statusString>OK</statusString></ResponseStatus>`
+
+// setTestDumpDirectory makes response dumps of devices go into a temporary directory.
+func setTestDumpDirectory(t *testing.T) {
+	prev := directory
+	directory = t.TempDir()
+	t.Cleanup(func() {
+		directory = prev
+	})
+}
+
+// fakeCamera emulates the ONVIF and ISAPI user management of a Hikvision camera.
+type fakeCamera struct {
+	srv *httptest.Server
+
+	mutex       sync.Mutex
+	onvifUsers  map[int]string
+	deviceUsers map[int]string
+	failCreate  bool
+}
+
+func newFakeCamera() *fakeCamera {
+	c := &fakeCamera{
+		onvifUsers:  map[int]string{1: "admin", 2: "nvr"},
+		deviceUsers: map[int]string{1: "admin", 2: "nvr"},
+	}
+	c.srv = httptest.NewServer(http.HandlerFunc(c.handle))
+	return c
+}
+
+func (c *fakeCamera) handle(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/onvif/") {
+		w.Write([]byte(fmt.Sprintf(fakeCapabilitiesXML, r.Host))) //nolint:errcheck
+		return
+	}
+
+	users := c.deviceUsers
+	endpoint := isapi.DEVICE_USER_ENDPOINT
+	if strings.HasPrefix(r.URL.Path, isapi.ONVIF_USER_ENDPOINT) {
+		users = c.onvifUsers
+		endpoint = isapi.ONVIF_USER_ENDPOINT
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var b strings.Builder
+		b.WriteString("<UserList>")
+		for id, name := range users {
+			fmt.Fprintf(&b, "<User><id>%d</id><userName>%s</userName></User>", id, name)
+		}
+		b.WriteString("</UserList>")
+		w.Write([]byte(b.String())) //nolint:errcheck
+		return
+
+	case http.MethodPut, http.MethodPost:
+		if c.failCreate {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<ResponseStatus><statusCode>4</statusCode></ResponseStatus>`)) //nolint:errcheck
+			return
+		}
+
+		byts, _ := io.ReadAll(r.Body)
+		var u struct {
+			Id       int    `xml:"id"`
+			UserName string `xml:"userName"`
+		}
+		if strings.Contains(string(byts), "<UserList") {
+			var l struct {
+				User struct {
+					Id       int    `xml:"id"`
+					UserName string `xml:"userName"`
+				}
+			}
+			xml.Unmarshal(byts, &l) //nolint:errcheck
+			u = l.User
+		} else {
+			xml.Unmarshal(byts, &u) //nolint:errcheck
+		}
+		users[u.Id] = u.UserName
+
+	case http.MethodDelete:
+		var id int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, endpoint+"/"), "%d", &id) //nolint:errcheck
+		delete(users, id)
+	}
+
+	w.Write([]byte(fakeResponseStatusXML)) //nolint:errcheck
+}
+
+func (c *fakeCamera) users() ([]string, []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var onvif, device []string
+	for i := 1; i <= 10; i++ {
+		if n, ok := c.onvifUsers[i]; ok {
+			onvif = append(onvif, n)
+		}
+		if n, ok := c.deviceUsers[i]; ok {
+			device = append(device, n)
+		}
+	}
+	return onvif, device
+}
+
+type credentialsTestParent struct {
+	patchErr error
+	patches  map[string]*conf.OptionalCamera
+}
+
+func (p *credentialsTestParent) Log(logger.Level, string, ...interface{}) {}
+
+func (p *credentialsTestParent) ControlCamerasPatch(cameras map[string]*conf.OptionalCamera) error {
+	if p.patchErr != nil {
+		return p.patchErr
+	}
+	p.patches = cameras
+	return nil
+}
+
+func (p *credentialsTestParent) ControlPathReady(string) bool { return false }
+
+func (p *credentialsTestParent) ControlCameraSessions(string) (*defs.ControlCameraSessions, bool) {
+	return nil, false
+}
+
+func testCredentialRotation(
+	t *testing.T,
+	parent *credentialsTestParent,
+	req credentialRotationReq,
+	cams ...*fakeCamera,
+) ([]defs.CredentialRotationResult, bool) {
+	setTestDumpDirectory(t)
+
+	c := &Control{
+		ReadTimeout: conf.StringDuration(1e9),
+		Parent:      parent,
+	}
+
+	var devs []*onvifDevice
+	for i, cam := range cams {
+		u, err := url.Parse(cam.srv.URL)
+		require.NoError(t, err)
+
+		devs = append(devs, &onvifDevice{
+			Conf: &conf.Path{
+				Name:     fmt.Sprintf("cam%d", i+1),
+				Username: "nvr",
+				Password: "old",
+			},
+			Url:    *u,
+			parent: c,
+		})
+	}
+
+	req.AdminUsername = "admin"
+	req.AdminPassword = "admin"
+	if req.UserType == "" {
+		req.UserType = isapi.Operator
+	}
+
+	return c.rotate(devs, &req, req.Password)
+}
+
+func TestCredentialRotation(t *testing.T) {
+	cam1 := newFakeCamera()
+	defer cam1.srv.Close()
+	cam2 := newFakeCamera()
+	defer cam2.srv.Close()
+
+	parent := &credentialsTestParent{}
+	results, failed := testCredentialRotation(t, parent,
+		credentialRotationReq{Username: "nvr2", Password: "new"}, cam1, cam2)
+	require.False(t, failed)
+
+	for _, res := range results {
+		require.Equal(t, defs.CredentialRotationRotated, res.Status, res.Error)
+		require.Empty(t, res.Warning)
+	}
+
+	// the new credentials are handed over to core in a single change
+	require.Len(t, parent.patches, 2)
+	enc, err := parent.patches["cam1"].MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"username":"nvr2","password":"new"}`, string(enc))
+
+	// old users are removed from both ONVIF and the device
+	for _, cam := range []*fakeCamera{cam1, cam2} {
+		onvif, device := cam.users()
+		require.Equal(t, []string{"admin", "nvr2"}, onvif)
+		require.Equal(t, []string{"admin", "nvr2"}, device)
+	}
+}
+
+func TestCredentialRotationSaveFailure(t *testing.T) {
+	cam1 := newFakeCamera()
+	defer cam1.srv.Close()
+
+	parent := &credentialsTestParent{patchErr: errors.New("disk full")}
+	results, failed := testCredentialRotation(t, parent,
+		credentialRotationReq{Username: "nvr2", Password: "new"}, cam1)
+	require.True(t, failed)
+	require.Equal(t, defs.CredentialRotationRolledBack, results[0].Status)
+	require.Equal(t, "failed to save configuration: disk full", results[0].Error)
+
+	// the old user is kept, the new one is removed
+	onvif, device := cam1.users()
+	require.Equal(t, []string{"admin", "nvr"}, onvif)
+	require.Equal(t, []string{"admin", "nvr"}, device)
+}
+
+func TestCredentialRotationAtomic(t *testing.T) {
+	cam1 := newFakeCamera()
+	defer cam1.srv.Close()
+	cam2 := newFakeCamera()
+	defer cam2.srv.Close()
+	cam2.failCreate = true
+
+	parent := &credentialsTestParent{}
+	results, failed := testCredentialRotation(t, parent,
+		credentialRotationReq{Username: "nvr2", Password: "new", Atomic: true}, cam1, cam2)
+	require.True(t, failed)
+	require.Nil(t, parent.patches)
+
+	require.Equal(t, defs.CredentialRotationRolledBack, results[0].Status)
+	require.Equal(t, "rotation of another camera failed", results[0].Error)
+	require.Equal(t, defs.CredentialRotationFailed, results[1].Status)
+
+	for _, cam := range []*fakeCamera{cam1, cam2} {
+		onvif, device := cam.users()
+		require.Equal(t, []string{"admin", "nvr"}, onvif)
+		require.Equal(t, []string{"admin", "nvr"}, device)
+	}
+}
+
+func TestUniqueDevices(t *testing.T) {
+	a := &onvifDevice{Conf: &conf.Path{Name: "a"}}
+	b := &onvifDevice{Conf: &conf.Path{Name: "b"}}
+	require.Equal(t, []*onvifDevice{a, b}, uniqueDevices([]*onvifDevice{b, a, b}))
+}
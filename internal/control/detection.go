@@ -0,0 +1,250 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// ISAPI 채널 번호는 1부터 시작한다. 쿼리 `channel`이 없으면 1번 채널을 사용한다.
+func parseISAPIChannel(ctx *gin.Context) (int, error) {
+	v := ctx.DefaultQuery("channel", "1")
+
+	channel, err := strconv.Atoi(v)
+	if err != nil || channel < 1 {
+		return 0, errors.New("Invalid channel: " + v)
+	}
+
+	return channel, nil
+}
+
+func (c *Control) getISAPIChannelParams(ctx *gin.Context) (*onvifDevice, *isapi.ChannelParams, bool) {
+	name := ctx.Params.ByName("name")
+
+	cam := c.getOnvifDevice(name)
+	if cam == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return nil, nil, false
+	}
+
+	channel, err := parseISAPIChannel(ctx)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	return cam, &isapi.ChannelParams{
+		HostParams: cam.isapiHostParams(),
+		Channel:    channel,
+	}, true
+}
+
+// bindPartialJSON은 요청 본문을 카메라의 현재 설정 v 위에 덮어쓴다.
+// 본문에 없는 필드는 현재 값을 유지하고, 본문에 있는 목록은 resetLists에서 비운 뒤 통째로 교체한다.
+func (c *Control) bindPartialJSON(ctx *gin.Context, v interface{}, resetLists func(fields map[string]json.RawMessage)) bool {
+	byts, err := ctx.GetRawData()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(byts, &fields)
+	if err == nil && fields == nil {
+		err = errors.New("body must be an object")
+	}
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return false
+	}
+
+	if resetLists != nil {
+		resetLists(fields)
+	}
+
+	err = json.Unmarshal(byts, v)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return false
+	}
+
+	return true
+}
+
+func (c *Control) getMotionDetection(ctx *gin.Context) {
+	cam, params, ok := c.getISAPIChannelParams(ctx)
+	if !ok {
+		return
+	}
+
+	md, err := isapi.GetMotionDetection(*params)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error getting motion detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"motionDetection": md,
+	})
+}
+
+func (c *Control) setMotionDetection(ctx *gin.Context) {
+	cam, params, ok := c.getISAPIChannelParams(ctx)
+	if !ok {
+		return
+	}
+
+	md, err := isapi.GetMotionDetection(*params)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error getting motion detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	if !c.bindPartialJSON(ctx, md, nil) {
+		return
+	}
+
+	err = md.Validate()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	status, err := isapi.SetMotionDetection(isapi.MotionDetectionParams{
+		ChannelParams:   *params,
+		MotionDetection: *md,
+	})
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error setting motion detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "motion detection of %s (channel %d) updated", cam.Conf.Name, params.Channel)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": status,
+	})
+}
+
+func (c *Control) getLineDetection(ctx *gin.Context) {
+	cam, params, ok := c.getISAPIChannelParams(ctx)
+	if !ok {
+		return
+	}
+
+	ld, err := isapi.GetLineDetection(*params)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error getting line detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"lineDetection": ld,
+	})
+}
+
+func (c *Control) setLineDetection(ctx *gin.Context) {
+	cam, params, ok := c.getISAPIChannelParams(ctx)
+	if !ok {
+		return
+	}
+
+	ld, err := isapi.GetLineDetection(*params)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error getting line detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	if !c.bindPartialJSON(ctx, ld, func(fields map[string]json.RawMessage) {
+		if _, ok := fields["lineItems"]; ok {
+			ld.LineItemList = nil
+		}
+	}) {
+		return
+	}
+
+	err = ld.Validate()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	status, err := isapi.SetLineDetection(isapi.LineDetectionParams{
+		ChannelParams: *params,
+		LineDetection: *ld,
+	})
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error setting line detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "line detection of %s (channel %d) updated", cam.Conf.Name, params.Channel)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": status,
+	})
+}
+
+func (c *Control) getFieldDetection(ctx *gin.Context) {
+	cam, params, ok := c.getISAPIChannelParams(ctx)
+	if !ok {
+		return
+	}
+
+	fd, err := isapi.GetFieldDetection(*params)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error getting field detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"fieldDetection": fd,
+	})
+}
+
+func (c *Control) setFieldDetection(ctx *gin.Context) {
+	cam, params, ok := c.getISAPIChannelParams(ctx)
+	if !ok {
+		return
+	}
+
+	fd, err := isapi.GetFieldDetection(*params)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error getting field detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	if !c.bindPartialJSON(ctx, fd, func(fields map[string]json.RawMessage) {
+		if _, ok := fields["regions"]; ok {
+			fd.FieldDetectionRegionList = nil
+		}
+	}) {
+		return
+	}
+
+	err = fd.Validate()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	status, err := isapi.SetFieldDetection(isapi.FieldDetectionParams{
+		ChannelParams:  *params,
+		FieldDetection: *fd,
+	})
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Error setting field detection of "+cam.Conf.Name+": "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "field detection of %s (channel %d) updated", cam.Conf.Name, params.Channel)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": status,
+	})
+}
@@ -0,0 +1,107 @@
+package control
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+)
+
+const fakeLineDetectionXML = `<?xml version="1.0" encoding="UTF-8"?>
+<LineDetection version="2.0"><id>1</id><enabled>true</enabled>
+<normalizedScreenSize><normalizedScreenWidth>1000</normalizedScreenWidth>` +
+	`<normalizedScreenHeight>1000</normalizedScreenHeight></normalizedScreenSize>
+<LineItemList>
+<LineItem><id>1</id><enabled>true</enabled><sensitivityLevel>50</sensitivityLevel>` +
+	`<directionSensitivity>left-right</directionSensitivity><CoordinatesList>` +
+	`<Coordinates><positionX>0</positionX><positionY>0</positionY></Coordinates>` +
+	`<Coordinates><positionX>100</positionX><positionY>100</positionY></Coordinates>` +
+	`</CoordinatesList></LineItem>
+<LineItem><id>2</id><enabled>true</enabled><sensitivityLevel>60</sensitivityLevel>` +
+	`<directionSensitivity>any</directionSensitivity><CoordinatesList>` +
+	`<Coordinates><positionX>200</positionX><positionY>200</positionY></Coordinates>` +
+	`<Coordinates><positionX>300</positionX><positionY>300</positionY></Coordinates>` +
+	`</CoordinatesList></LineItem>
+</LineItemList></LineDetection>`
+
+func TestSetLineDetectionPartial(t *testing.T) {
+	var put []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			byts, _ := io.ReadAll(r.Body)
+			put = append(put, string(byts))
+			w.Write([]byte(fakeResponseStatusXML)) //nolint:errcheck
+			return
+		}
+		w.Write([]byte(fakeLineDetectionXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	c := &Control{
+		Conf:   &conf.Conf{},
+		Parent: &credentialsTestParent{},
+	}
+	c.OnvifDevices = []*onvifDevice{{
+		Conf:   &conf.Path{Name: "cam1"},
+		Url:    *u,
+		parent: c,
+	}}
+
+	do := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPut, "/ipcam/cam1/lineDetection", strings.NewReader(body))
+		ctx.Params = gin.Params{{Key: "name", Value: "cam1"}}
+		c.setLineDetection(ctx)
+		return w
+	}
+
+	// fields that are not in the body keep the values of the camera
+	w := do(`{"enabled":false}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, put, 1)
+
+	var ld isapi.LineDetection
+	require.NoError(t, xml.Unmarshal([]byte(put[0]), &ld))
+	require.False(t, ld.Enabled)
+	require.Equal(t, 1000, ld.NormalizedScreenSize.NormalizedScreenWidth)
+	require.Len(t, ld.LineItemList, 2)
+	require.Equal(t, isapi.DirectionLeftRight, ld.LineItemList[0].DirectionSensitivity)
+
+	// lists in the body replace the ones of the camera
+	w = do(`{"lineItems":[{"id":1,"sensitivityLevel":80,` +
+		`"coordinates":[{"positionX":10,"positionY":10},{"positionX":20,"positionY":20}]}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, put, 2)
+
+	ld = isapi.LineDetection{}
+	require.NoError(t, xml.Unmarshal([]byte(put[1]), &ld))
+	require.True(t, ld.Enabled)
+	require.Equal(t, []isapi.LineItem{{
+		Id:               1,
+		SensitivityLevel: 80,
+		CoordinatesList:  []isapi.Coordinates{{PositionX: 10, PositionY: 10}, {PositionX: 20, PositionY: 20}},
+	}}, ld.LineItemList)
+
+	// invalid settings are not sent to the camera
+	w = do(`{"lineItems":[{"id":1,"sensitivityLevel":150,` +
+		`"coordinates":[{"positionX":10,"positionY":10},{"positionX":20,"positionY":20}]}]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do(`[]`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, put, 2)
+}
@@ -0,0 +1,611 @@
+package control
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	device "github.com/IOTechSystems/onvif/device"
+	xsdonvif "github.com/IOTechSystems/onvif/xsd/onvif"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+const (
+	ioSourceONVIF = "onvif"
+	ioSourceISAPI = "isapi"
+
+	ioStateActive   = "active"
+	ioStateInactive = "inactive"
+
+	ioAuditMaxEntries = 1000
+)
+
+type ioOutputReq struct {
+	State string `json:"state"`
+
+	// 0보다 크면 지정한 시간 후에 펄스 전 상태로 되돌린다
+	Duration conf.StringDuration `json:"duration"`
+}
+
+// callMethodChecked는 callMethod와 같지만 HTTP 에러 응답(SOAP Fault)을 에러로 반환한다.
+func (o *onvifDevice) callMethodChecked(method interface{}, reply interface{}) error {
+	resp, err := o.dev.CallMethod(method)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if (resp.StatusCode / 100) != 2 {
+		return fmt.Errorf("%s failed: bad status code: %d", reflect.TypeOf(method).Name(), resp.StatusCode)
+	}
+
+	return xml.Unmarshal(b, reply)
+}
+
+func (o *onvifDevice) getRelayOutputs() ([]xsdonvif.RelayOutput, error) {
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			GetRelayOutputsResponse struct {
+				RelayOutputs []xsdonvif.RelayOutput
+			}
+		}
+	}
+
+	var reply Envelope
+	err := o.callMethodChecked(device.GetRelayOutputs{}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Body.GetRelayOutputsResponse.RelayOutputs, nil
+}
+
+func (o *onvifDevice) setRelayOutputState(token string, state string) error {
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			SetRelayOutputStateResponse device.SetRelayOutputStateResponse
+		}
+	}
+
+	var reply Envelope
+	return o.callMethodChecked(
+		device.SetRelayOutputState{
+			RelayOutputToken: xsdonvif.ReferenceToken(token),
+			LogicalState:     xsdonvif.RelayLogicalState(state),
+		},
+		&reply,
+	)
+}
+
+// getDigitalInputs는 DeviceIO 서비스의 GetDigitalInputs를 호출한다.
+// 라이브러리에 DeviceIO 서비스가 없어서 SOAP 요청을 직접 만든다.
+func (o *onvifDevice) getDigitalInputs() ([]defs.ControlIOPort, error) {
+	endpoint := o.dev.GetEndpoint("deviceio")
+	if endpoint == "" {
+		return nil, errors.New("DeviceIO service is not supported")
+	}
+
+	resp, err := o.dev.SendSoap(endpoint,
+		`<tmd:GetDigitalInputs xmlns:tmd="http://www.onvif.org/ver10/deviceIO/wsdl"/>`)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if (resp.StatusCode / 100) != 2 {
+		return nil, fmt.Errorf("GetDigitalInputs failed: bad status code: %d", resp.StatusCode)
+	}
+
+	var reply struct {
+		Body struct {
+			GetDigitalInputsResponse struct {
+				DigitalInputs []struct {
+					Token     string `xml:"token,attr"`
+					IdleState string `xml:"IdleState,attr"`
+				}
+			}
+		}
+	}
+	err = xml.Unmarshal(b, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := []defs.ControlIOPort{}
+	for _, in := range reply.Body.GetDigitalInputsResponse.DigitalInputs {
+		inputs = append(inputs, defs.ControlIOPort{
+			Token:     in.Token,
+			Type:      defs.ControlIODigitalInput,
+			IdleState: in.IdleState,
+		})
+	}
+
+	return inputs, nil
+}
+
+func (o *onvifDevice) getONVIFIO() (*defs.ControlIO, error) {
+	relays, err := o.getRelayOutputs()
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := o.getDigitalInputs()
+	if err != nil {
+		// 릴레이만 지원하는 카메라도 있다
+		o.parent.Log(logger.Debug, "failed to get digital inputs of %s: %v", o.Conf.Name, err)
+		inputs = []defs.ControlIOPort{}
+	}
+
+	outputs := []defs.ControlIOPort{}
+	for _, r := range relays {
+		outputs = append(outputs, defs.ControlIOPort{
+			Token:     string(r.Token),
+			Type:      defs.ControlIORelayOutput,
+			Mode:      string(r.Properties.Mode),
+			IdleState: string(r.Properties.IdleState),
+			DelayTime: string(r.Properties.DelayTime),
+		})
+	}
+
+	return &defs.ControlIO{
+		Camera:        o.Conf.Name,
+		Source:        ioSourceONVIF,
+		RelayOutputs:  outputs,
+		DigitalInputs: inputs,
+	}, nil
+}
+
+// getISAPIIOStates는 ISAPI 포트 상태를 "input/1" 형식의 키로 반환한다.
+func (o *onvifDevice) getISAPIIOStates() (map[string]string, error) {
+	status, err := isapi.GetIOStatus(o.isapiHostParams())
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string)
+	for _, s := range status.IOPortStatus {
+		states[s.IOPortType+"/"+strconv.Itoa(s.IOPortID)] = s.IOState
+	}
+
+	return states, nil
+}
+
+func (o *onvifDevice) getISAPIIO() (*defs.ControlIO, error) {
+	params := o.isapiHostParams()
+
+	outputs, err := isapi.GetIOOutputs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := isapi.GetIOInputs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := o.getISAPIIOStates()
+	if err != nil {
+		o.parent.Log(logger.Debug, "failed to get IO status of %s: %v", o.Conf.Name, err)
+		states = map[string]string{}
+	}
+
+	ret := &defs.ControlIO{
+		Camera:        o.Conf.Name,
+		Source:        ioSourceISAPI,
+		RelayOutputs:  []defs.ControlIOPort{},
+		DigitalInputs: []defs.ControlIOPort{},
+	}
+
+	for _, out := range outputs.IOOutputPort {
+		token := strconv.Itoa(out.Id)
+		ret.RelayOutputs = append(ret.RelayOutputs, defs.ControlIOPort{
+			Token:     token,
+			Type:      defs.ControlIORelayOutput,
+			State:     states["output/"+token],
+			IdleState: out.DefaultState,
+		})
+	}
+
+	for _, in := range inputs.IOInputPort {
+		token := strconv.Itoa(in.Id)
+		ret.DigitalInputs = append(ret.DigitalInputs, defs.ControlIOPort{
+			Token:     token,
+			Type:      defs.ControlIODigitalInput,
+			State:     states["input/"+token],
+			IdleState: in.Triggering,
+		})
+	}
+
+	return ret, nil
+}
+
+// getIO는 ONVIF DeviceIO로 입출력 포트를 조회하고, 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) getIO() (*defs.ControlIO, error) {
+	ret, err := o.getONVIFIO()
+	if err == nil {
+		return ret, nil
+	}
+
+	o.parent.Log(logger.Debug, "ONVIF DeviceIO of %s is not available (%v), using ISAPI", o.Conf.Name, err)
+
+	ret, err2 := o.getISAPIIO()
+	if err2 != nil {
+		return nil, fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return ret, nil
+}
+
+// setIOOutput은 릴레이 출력 상태를 변경한다. ONVIF가 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) setIOOutput(token string, state string) error {
+	err := o.setRelayOutputState(token, state)
+	if err == nil {
+		return nil
+	}
+
+	id, err2 := strconv.Atoi(token)
+	if err2 != nil {
+		return err
+	}
+
+	isapiState := isapi.IOStateLow
+	if state == ioStateActive {
+		isapiState = isapi.IOStateHigh
+	}
+
+	status, err2 := isapi.TriggerIOOutput(isapi.IOOutputTriggerParams{
+		HostParams: o.isapiHostParams(),
+		Id:         id,
+		State:      isapiState,
+	})
+	if err2 == nil {
+		err2 = checkResponseStatus(status)
+	}
+	if err2 != nil {
+		return fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return nil
+}
+
+// ioOutputKey는 카메라의 출력 포트를 가리킨다.
+type ioOutputKey struct {
+	camera string
+	output string
+}
+
+// ioOutputState는 출력의 현재 상태를 반환한다.
+// 카메라가 상태를 알려주지 않으면 마지막으로 설정한 상태를, 그것도 없으면 유휴 상태(inactive)를 사용한다.
+func (c *Control) ioOutputState(dev *onvifDevice, key ioOutputKey) string {
+	states, err := dev.getISAPIIOStates()
+	if err == nil {
+		state := states["output/"+key.output]
+		if state == ioStateActive || state == ioStateInactive {
+			return state
+		}
+	}
+
+	c.ioMutex.Lock()
+	defer c.ioMutex.Unlock()
+
+	if state, ok := c.ioOutputs[key]; ok {
+		return state
+	}
+	return ioStateInactive
+}
+
+func (c *Control) audit(entry defs.ControlIOAuditEntry) {
+	if entry.Error != "" {
+		c.Log(logger.Warn, "[audit] %s %s: setting output %s of %s to %s failed: %s",
+			entry.Trigger, entry.Actor, entry.Output, entry.Camera, entry.State, entry.Error)
+	} else {
+		c.Log(logger.Info, "[audit] %s %s: set output %s of %s to %s",
+			entry.Trigger, entry.Actor, entry.Output, entry.Camera, entry.State)
+	}
+
+	c.ioMutex.Lock()
+	defer c.ioMutex.Unlock()
+
+	c.ioAudit = append(c.ioAudit, entry)
+	if len(c.ioAudit) > ioAuditMaxEntries {
+		c.ioAudit = c.ioAudit[len(c.ioAudit)-ioAuditMaxEntries:]
+	}
+}
+
+// triggerIOOutput은 출력 상태를 변경하고 감사 로그를 남긴다.
+// duration이 0보다 크면 그 후에 펄스 전 상태로 되돌린다.
+// 같은 출력에 펄스가 남아 있으면 새 요청이 그 펄스를 대체한다.
+func (c *Control) triggerIOOutput(dev *onvifDevice, token string, state string, duration time.Duration,
+	trigger string, actor string,
+) error {
+	key := ioOutputKey{camera: dev.Conf.Name, output: token}
+
+	var restore string
+	if duration > 0 {
+		restore = c.ioOutputState(dev, key)
+	}
+
+	err := c.setIOOutputState(dev, key, state, trigger, actor)
+	if err != nil {
+		return err
+	}
+
+	if duration <= 0 {
+		c.cancelPulse(key)
+		return nil
+	}
+
+	c.schedulePulseEnd(key, duration, restore, func(restore string) {
+		c.setIOOutputState(dev, key, restore, trigger, actor+" (pulse end)") //nolint:errcheck
+	})
+
+	return nil
+}
+
+// setIOOutputState는 출력 상태를 변경하고 감사 로그를 남긴다.
+func (c *Control) setIOOutputState(dev *onvifDevice, key ioOutputKey, state string,
+	trigger string, actor string,
+) error {
+	err := dev.setIOOutput(key.output, state)
+
+	entry := defs.ControlIOAuditEntry{
+		Time:    time.Now(),
+		Camera:  key.camera,
+		Output:  key.output,
+		State:   state,
+		Trigger: trigger,
+		Actor:   actor,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	c.audit(entry)
+
+	if err != nil {
+		return err
+	}
+
+	c.ioMutex.Lock()
+	defer c.ioMutex.Unlock()
+
+	if c.ioOutputs == nil {
+		c.ioOutputs = make(map[ioOutputKey]string)
+	}
+	c.ioOutputs[key] = state
+
+	return nil
+}
+
+// ioPulse는 펄스가 끝날 때 출력을 되돌리는 예약이다.
+type ioPulse struct {
+	timer *time.Timer
+
+	// 펄스 전 상태
+	restore string
+	end     func(restore string)
+}
+
+// schedulePulseEnd는 duration 후에 end를 펄스 전 상태 restore와 함께 실행한다.
+// 같은 출력에 예약된 펄스가 있으면 그 펄스를 취소하고 그 펄스의 펄스 전 상태를 이어받는다.
+// Close에서 남은 펄스를 바로 끝내므로, 종료나 설정 변경 후에 출력이 바뀌지 않는다.
+func (c *Control) schedulePulseEnd(key ioOutputKey, duration time.Duration, restore string,
+	end func(restore string),
+) {
+	c.ioMutex.Lock()
+
+	if prev, ok := c.ioPulses[key]; ok {
+		prev.timer.Stop()
+		delete(c.ioPulses, key)
+		c.wg.Done()
+		restore = prev.restore
+	}
+
+	// 이미 닫히는 중이면 바로 되돌린다
+	if c.ctx != nil && c.ctx.Err() != nil {
+		c.ioMutex.Unlock()
+		end(restore)
+		return
+	}
+	defer c.ioMutex.Unlock()
+
+	p := &ioPulse{restore: restore, end: end}
+
+	if c.ioPulses == nil {
+		c.ioPulses = make(map[ioOutputKey]*ioPulse)
+	}
+	c.ioPulses[key] = p
+
+	c.wg.Add(1)
+	p.timer = time.AfterFunc(duration, func() {
+		c.ioMutex.Lock()
+		ok := c.ioPulses[key] == p
+		if ok {
+			delete(c.ioPulses, key)
+		}
+		c.ioMutex.Unlock()
+
+		// Close에서 이미 끝냈거나 다른 펄스로 대체된 경우
+		if !ok {
+			return
+		}
+
+		defer c.wg.Done()
+		p.end(p.restore)
+	})
+}
+
+// cancelPulse는 출력에 예약된 펄스를 되돌리지 않고 취소한다.
+func (c *Control) cancelPulse(key ioOutputKey) {
+	c.ioMutex.Lock()
+	defer c.ioMutex.Unlock()
+
+	if p, ok := c.ioPulses[key]; ok {
+		p.timer.Stop()
+		delete(c.ioPulses, key)
+		c.wg.Done()
+	}
+}
+
+// flushIOPulses는 예약된 펄스를 취소하고 출력을 바로 되돌린다.
+func (c *Control) flushIOPulses() {
+	c.ioMutex.Lock()
+	pulses := c.ioPulses
+	c.ioPulses = nil
+	c.ioMutex.Unlock()
+
+	for _, p := range pulses {
+		p.timer.Stop()
+		p.end(p.restore)
+		c.wg.Done()
+	}
+}
+
+// runIORules는 디지털 입력을 주기적으로 확인하고 규칙에 따라 출력을 변경한다.
+// ONVIF는 입력 상태를 이벤트로만 알려주기 때문에 ISAPI 상태 조회를 사용한다.
+func (c *Control) runIORules() {
+	defer c.wg.Done()
+
+	rules := c.Conf.ControlIORules
+	period := time.Duration(c.Conf.ControlIOPollPeriod)
+
+	// 규칙별 마지막 입력 상태
+	last := make(map[string]string)
+
+	t := time.NewTicker(period)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			states := make(map[string]map[string]string)
+
+			for _, rule := range rules {
+				camStates, ok := states[rule.Camera]
+				if !ok {
+					dev := c.getOnvifDevice(rule.Camera)
+					if dev == nil {
+						continue
+					}
+
+					var err error
+					camStates, err = dev.getISAPIIOStates()
+					if err != nil {
+						c.Log(logger.Debug, "failed to get IO status of %s: %v", rule.Camera, err)
+					}
+					states[rule.Camera] = camStates
+				}
+
+				state, ok := camStates["input/"+rule.Input]
+				if !ok {
+					continue
+				}
+
+				prev, seen := last[rule.Name]
+				last[rule.Name] = state
+
+				if !seen || prev == state || state != rule.InputState {
+					continue
+				}
+
+				out := c.getOnvifDevice(rule.OutputCamera)
+				if out == nil {
+					c.Log(logger.Warn, "IO rule %s: camera %s not found", rule.Name, rule.OutputCamera)
+					continue
+				}
+
+				c.triggerIOOutput(out, rule.Output, rule.OutputState, //nolint:errcheck
+					time.Duration(rule.Duration), "rule", rule.Name)
+			}
+
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Control) getIO(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	ret, err := dev.getIO()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to get IO ports: "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ret)
+}
+
+func (c *Control) setIOOutput(ctx *gin.Context) {
+	name := ctx.Param("name")
+	token := ctx.Param("token")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	var req ioOutputReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	if req.State != ioStateActive && req.State != ioStateInactive {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `state` must be `active` or `inactive`"))
+		return
+	}
+
+	if req.Duration < 0 {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `duration` must be positive"))
+		return
+	}
+
+	err = c.triggerIOOutput(dev, token, req.State, time.Duration(req.Duration), "api", ctx.ClientIP())
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to set output: "+err.Error()))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *Control) getIOAudit(ctx *gin.Context) {
+	c.ioMutex.Lock()
+	entries := make([]defs.ControlIOAuditEntry, len(c.ioAudit))
+	copy(entries, c.ioAudit)
+	c.ioMutex.Unlock()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items": entries,
+	})
+}
@@ -0,0 +1,74 @@
+package control
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIOPulses(t *testing.T) {
+	c := &Control{}
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+
+	var short, long, late int32
+
+	c.schedulePulseEnd(ioOutputKey{"cam1", "1"}, 10*time.Millisecond, ioStateInactive,
+		func(string) { atomic.AddInt32(&short, 1) })
+	c.schedulePulseEnd(ioOutputKey{"cam1", "2"}, time.Hour, ioStateInactive,
+		func(string) { atomic.AddInt32(&long, 1) })
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&short) == 1
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int32(0), atomic.LoadInt32(&long))
+
+	// pending pulses end when the control is closed
+	c.ctxCancel()
+	c.flushIOPulses()
+	c.wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&long))
+
+	c.schedulePulseEnd(ioOutputKey{"cam1", "1"}, time.Hour, ioStateInactive,
+		func(string) { atomic.AddInt32(&late, 1) })
+	require.Equal(t, int32(1), atomic.LoadInt32(&late))
+	require.Empty(t, c.ioPulses)
+}
+
+func TestIOPulsesSameOutput(t *testing.T) {
+	c := &Control{}
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+	defer c.ctxCancel()
+
+	key := ioOutputKey{"cam1", "1"}
+
+	var mutex sync.Mutex
+	var restored []string
+	end := func(restore string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		restored = append(restored, restore)
+	}
+
+	// the second pulse replaces the first one and restores the state
+	// that preceded the first one, not the one set by the first pulse
+	c.schedulePulseEnd(key, 20*time.Millisecond, ioStateInactive, end)
+	c.schedulePulseEnd(key, 50*time.Millisecond, ioStateActive, end)
+	c.ioMutex.Lock()
+	require.Len(t, c.ioPulses, 1)
+	c.ioMutex.Unlock()
+
+	c.wg.Wait()
+	require.Equal(t, []string{ioStateInactive}, restored)
+
+	// a pulse is cancelled when the output is set without duration
+	c.schedulePulseEnd(key, 10*time.Millisecond, ioStateActive, end)
+	c.cancelPulse(key)
+	c.wg.Wait()
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, []string{ioStateInactive}, restored)
+	require.Empty(t, c.ioPulses)
+}
@@ -0,0 +1,807 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goonvif "github.com/IOTechSystems/onvif"
+	device "github.com/IOTechSystems/onvif/device"
+	"github.com/IOTechSystems/onvif/gosoap"
+	xsdonvif "github.com/IOTechSystems/onvif/xsd/onvif"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/icholy/digest"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+const (
+	maintenanceDefaultTimeout = 10 * time.Minute
+	maintenanceDialTimeout    = 3 * time.Second
+
+	// 끝난 작업을 보관하는 기간과 최대 개수
+	maintenanceJobRetention = 24 * time.Hour
+	maintenanceMaxJobs      = 100
+)
+
+var (
+	maintenanceDownTimeout = 2 * time.Minute
+	maintenancePollPeriod  = 2 * time.Second
+)
+
+// errMaintenanceUnverified는 카메라가 재시작했는지 확인할 수 없을 때 반환된다.
+var errMaintenanceUnverified = errors.New("camera did not go offline, the restart could not be verified")
+
+var xsdDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseXSDDuration은 ONVIF가 사용하는 xs:duration(PnDTnHnMnS)을 변환한다.
+func parseXSDDuration(s string) (time.Duration, error) {
+	m := xsdDurationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+
+	var d time.Duration
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute}
+	for i, unit := range units {
+		if m[i+1] != "" {
+			v, _ := strconv.Atoi(m[i+1])
+			d += time.Duration(v) * unit
+		}
+	}
+	if m[4] != "" {
+		v, _ := strconv.ParseFloat(m[4], 64)
+		d += time.Duration(v * float64(time.Second))
+	}
+
+	return d, nil
+}
+
+type maintenanceJobReq struct {
+	Action  defs.MaintenanceAction `json:"action"`
+	Cameras []string               `json:"cameras"`
+
+	// 동시에 작업할 카메라 수 (기본값 1)
+	BatchSize int `json:"batchSize"`
+
+	// controlFirmwareDirectory 안의 펌웨어 파일 이름 (firmwareUpgrade)
+	Firmware string `json:"firmware"`
+
+	// 카메라 한 대가 복구될 때까지 기다리는 최대 시간
+	Timeout conf.StringDuration `json:"timeout"`
+
+	// 실패한 카메라가 있어도 다음 배치를 계속 진행할지 여부
+	ContinueOnFailure bool `json:"continueOnFailure"`
+}
+
+// MaintenanceJobs는 Control이 다시 시작되어도 유지되는 유지보수 작업 목록이다.
+// 카메라 설정이 바뀌면 Control이 다시 시작되므로 core가 소유한다.
+type MaintenanceJobs struct {
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	mutex sync.Mutex
+	jobs  map[string]*maintenanceJob
+}
+
+// Initialize initializes MaintenanceJobs.
+func (m *MaintenanceJobs) Initialize() {
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	m.jobs = make(map[string]*maintenanceJob)
+}
+
+// Close cancels running jobs and waits for them.
+func (m *MaintenanceJobs) Close() {
+	m.ctxCancel()
+	m.wg.Wait()
+}
+
+// busy는 카메라가 진행 중인 작업에 포함되어 있으면 작업 ID를 반환한다.
+func (m *MaintenanceJobs) busy(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, j := range m.jobs {
+		if !j.running() {
+			continue
+		}
+		for _, d := range j.devs {
+			if d.Conf.Name == name {
+				return j.data.ID, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (m *MaintenanceJobs) get(id string) (*maintenanceJob, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// checkNotInMaintenance는 진행 중인 유지보수 작업에 포함된 카메라가 있으면 409를 응답한다.
+// 작업은 기존 계정과 주소로 카메라의 복구를 기다리므로 그동안 바꾸지 않는다.
+func (c *Control) checkNotInMaintenance(ctx *gin.Context, devs []*onvifDevice) bool {
+	for _, dev := range devs {
+		if id, ok := c.MaintenanceJobs.busy(dev.Conf.Name); ok {
+			c.writeError(ctx, http.StatusConflict,
+				fmt.Errorf("camera %s is in maintenance job %s", dev.Conf.Name, id))
+			return false
+		}
+	}
+	return true
+}
+
+type maintenanceJob struct {
+	devs              []*onvifDevice
+	firmware          []byte
+	timeout           time.Duration
+	continueOnFailure bool
+
+	ctx       context.Context
+	ctxCancel func()
+
+	mutex sync.Mutex
+	data  defs.MaintenanceJob
+}
+
+func (j *maintenanceJob) update(i int, cb func(r *defs.MaintenanceCameraResult)) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	cb(&j.data.Cameras[i])
+}
+
+func (j *maintenanceJob) setStatus(status defs.MaintenanceStatus) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.data.Status = status
+}
+
+func (j *maintenanceJob) finish(status defs.MaintenanceStatus) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	now := time.Now()
+	j.data.Status = status
+	j.data.Finished = &now
+}
+
+func (j *maintenanceJob) snapshot() defs.MaintenanceJob {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	ret := j.data
+	ret.Cameras = make([]defs.MaintenanceCameraResult, len(j.data.Cameras))
+	copy(ret.Cameras, j.data.Cameras)
+	return ret
+}
+
+func (j *maintenanceJob) running() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.data.Status == defs.MaintenancePending || j.data.Status == defs.MaintenanceRunning
+}
+
+func (o *onvifDevice) systemReboot() error {
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			SystemRebootResponse device.SystemRebootResponse
+		}
+	}
+
+	var reply Envelope
+	err := o.callMethodChecked(device.SystemReboot{}, &reply)
+	if err != nil {
+		return err
+	}
+
+	o.parent.Log(logger.Info, "onvif device %s is rebooting: %s", o.Conf.Name, reply.Body.SystemRebootResponse.Message)
+	return nil
+}
+
+func (o *onvifDevice) setSystemFactoryDefault() error {
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			SetSystemFactoryDefaultResponse device.SetSystemFactoryDefaultResponse
+		}
+	}
+
+	var reply Envelope
+	return o.callMethodChecked(
+		device.SetSystemFactoryDefault{
+			// 네트워크 설정을 유지해야 복구를 기다릴 수 있다
+			FactoryDefault: xsdonvif.FactoryDefaultType("Soft"),
+		},
+		&reply,
+	)
+}
+
+// startFirmwareUpgrade는 StartFirmwareUpgrade로 받은 주소에 펌웨어를 HTTP POST로 업로드한다.
+func (o *onvifDevice) startFirmwareUpgrade(ctx context.Context, firmware []byte) error {
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			StartFirmwareUpgradeResponse device.StartFirmwareUpgradeResponse
+		}
+	}
+
+	var reply Envelope
+	err := o.callMethodChecked(device.StartFirmwareUpgrade{}, &reply)
+	if err != nil {
+		return err
+	}
+
+	res := reply.Body.StartFirmwareUpgradeResponse
+
+	// 카메라가 알려주는 내부 주소 대신 접속 주소를 사용한다
+	uploadUri, err := o.rewriteAPIURI(string(res.UploadUri))
+	if err != nil {
+		return err
+	}
+
+	if res.UploadDelay != "" {
+		delay, err := parseXSDDuration(string(res.UploadDelay))
+		if err == nil {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return errors.New("canceled")
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadUri, bytes.NewReader(firmware))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	client := &http.Client{
+		Transport: &digest.Transport{
+			Username: o.Conf.Username,
+			Password: o.Conf.Password,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+	if (resp.StatusCode / 100) != 2 {
+		return fmt.Errorf("firmware upload failed: bad status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// upgradeSystemFirmware는 UpgradeSystemFirmware로 펌웨어를 전송한다.
+// MTOM 첨부 대신 base64 인라인 데이터를 사용하므로 일부 카메라만 지원한다.
+// 업로드가 길어질 수 있으므로 SendSoap 대신 ctx로 취소할 수 있는 요청을 보낸다.
+func (o *onvifDevice) upgradeSystemFirmware(ctx context.Context, firmware []byte) error {
+	endpoint := o.dev.GetEndpoint("device")
+
+	// SendSoap과 같은 봉투를 만든다
+	soap := gosoap.NewEmptySOAP()
+	soap.AddStringBodyContent(`<tds:UpgradeSystemFirmware><tds:Firmware xmlns:xmime="http://www.w3.org/2005/05/xmlmime" ` +
+		`xmime:contentType="application/octet-stream">` + base64.StdEncoding.EncodeToString(firmware) +
+		`</tds:Firmware></tds:UpgradeSystemFirmware>`)
+	soap.AddRootNamespaces(goonvif.Xlmns)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(soap.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	client := &http.Client{
+		Transport: &digest.Transport{
+			Username: o.Conf.Username,
+			Password: o.Conf.Password,
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+	if (resp.StatusCode / 100) != 2 {
+		return fmt.Errorf("UpgradeSystemFirmware failed: bad status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// upgradeFirmware는 StartFirmwareUpgrade, UpgradeSystemFirmware, ISAPI 순서로 펌웨어 업그레이드를 시도한다.
+func (o *onvifDevice) upgradeFirmware(ctx context.Context, firmware []byte) (string, error) {
+	errs := []error{}
+
+	err := o.startFirmwareUpgrade(ctx, firmware)
+	if err == nil {
+		return "onvif", nil
+	}
+	if ctx.Err() != nil {
+		return "", err
+	}
+	errs = append(errs, fmt.Errorf("StartFirmwareUpgrade: %w", err))
+
+	err = o.upgradeSystemFirmware(ctx, firmware)
+	if err == nil {
+		return "onvif", nil
+	}
+	if ctx.Err() != nil {
+		return "", err
+	}
+	errs = append(errs, fmt.Errorf("UpgradeSystemFirmware: %w", err))
+
+	status, err := isapi.UpgradeFirmware(isapi.FirmwareUpgradeParams{
+		HostParams: o.isapiHostParams(),
+		Firmware:   firmware,
+	})
+	if err == nil && status.StatusCode != isapi.STATUS_REBOOT_REQUIRED {
+		err = checkResponseStatus(status)
+	}
+	if err == nil {
+		// ISAPI는 펌웨어 기록이 끝난 뒤에 응답하고 스스로 재부팅하지 않으므로,
+		// 여기서 재부팅해도 기록을 방해하지 않는다
+		err = o.systemReboot()
+		if err != nil {
+			return "isapi", fmt.Errorf("firmware written but reboot failed: %w", err)
+		}
+		return "isapi", nil
+	}
+	errs = append(errs, fmt.Errorf("ISAPI: %w", err))
+
+	return "", errors.Join(errs...)
+}
+
+// reachable은 카메라의 ONVIF 서비스가 응답하는지 확인한다.
+func (o *onvifDevice) reachable() bool {
+	conn, err := net.DialTimeout("tcp", o.Url.Host, maintenanceDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			GetSystemDateAndTimeResponse device.GetSystemDateAndTimeResponse
+		}
+	}
+
+	var reply Envelope
+	return o.callMethodChecked(device.GetSystemDateAndTime{}, &reply) == nil
+}
+
+func (c *Control) runMaintenanceAction(j *maintenanceJob, dev *onvifDevice) (string, error) {
+	switch j.data.Action {
+	case defs.MaintenanceReboot:
+		return "onvif", dev.systemReboot()
+
+	case defs.MaintenanceFactoryDefault:
+		return "onvif", dev.setSystemFactoryDefault()
+
+	default:
+		return dev.upgradeFirmware(j.ctx, j.firmware)
+	}
+}
+
+// waitCameraBack은 카메라가 재시작된 후 ONVIF 응답과 스트림 Path 준비를 기다린다.
+// 카메라가 응답을 멈추지 않으면 재시작을 확인할 수 없으므로 errMaintenanceUnverified를 반환한다.
+func (c *Control) waitCameraBack(ctx context.Context, dev *onvifDevice, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	downDeadline := time.Now().Add(maintenanceDownTimeout)
+
+	wait := func() error {
+		select {
+		case <-time.After(maintenancePollPeriod):
+			return nil
+		case <-ctx.Done():
+			return errors.New("canceled")
+		}
+	}
+
+	// 재시작이 시작될 때까지 기다린다
+	for dev.reachable() {
+		if time.Now().After(downDeadline) {
+			return errMaintenanceUnverified
+		}
+		err := wait()
+		if err != nil {
+			return err
+		}
+	}
+
+	for !dev.reachable() {
+		if time.Now().After(deadline) {
+			return errors.New("camera did not come back online")
+		}
+		err := wait()
+		if err != nil {
+			return err
+		}
+	}
+
+	// 요청이 있을 때만 연결되는 Path는 확인하지 않는다
+	if dev.Conf.SourceOnDemand || dev.StreamUris == nil {
+		return nil
+	}
+
+	for _, u := range *dev.StreamUris {
+		for !c.Parent.ControlPathReady(u.Profile.PathName) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("path %s did not become ready", u.Profile.PathName)
+			}
+			err := wait()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Control) runMaintenanceCamera(j *maintenanceJob, i int) {
+	dev := j.devs[i]
+	now := time.Now()
+	j.update(i, func(r *defs.MaintenanceCameraResult) {
+		r.Status = defs.MaintenanceRunning
+		r.Started = &now
+	})
+
+	fail := func(err error) {
+		status := defs.MaintenanceFailed
+		switch {
+		case j.ctx.Err() != nil:
+			status = defs.MaintenanceCanceled
+		case errors.Is(err, errMaintenanceUnverified):
+			status = defs.MaintenanceUnverified
+		}
+
+		now := time.Now()
+		j.update(i, func(r *defs.MaintenanceCameraResult) {
+			r.Status = status
+			r.Error = err.Error()
+			r.Finished = &now
+		})
+		c.Log(logger.Warn, "maintenance %s of %s failed: %v", j.data.Action, dev.Conf.Name, err)
+	}
+
+	method, err := c.runMaintenanceAction(j, dev)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	c.Log(logger.Info, "maintenance %s of %s started, waiting for the camera", j.data.Action, dev.Conf.Name)
+	j.update(i, func(r *defs.MaintenanceCameraResult) {
+		r.Status = defs.MaintenanceWaiting
+		r.Method = method
+	})
+
+	err = c.waitCameraBack(j.ctx, dev, j.timeout)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	now = time.Now()
+	j.update(i, func(r *defs.MaintenanceCameraResult) {
+		r.Status = defs.MaintenanceDone
+		r.Finished = &now
+	})
+	c.Log(logger.Info, "maintenance %s of %s done", j.data.Action, dev.Conf.Name)
+}
+
+// runMaintenanceJob은 카메라를 배치 단위로 작업하고, 배치의 모든 카메라가 복구된 후 다음 배치를 진행한다.
+// 작업은 MaintenanceJobs의 컨텍스트에서 실행되므로 Control이 닫혀도 계속된다.
+func (c *Control) runMaintenanceJob(j *maintenanceJob) {
+	j.setStatus(defs.MaintenanceRunning)
+
+	skipRemaining := func(from int) {
+		for i := from; i < len(j.devs); i++ {
+			j.update(i, func(r *defs.MaintenanceCameraResult) {
+				r.Status = defs.MaintenanceSkipped
+			})
+		}
+	}
+
+	failed := false
+	batchSize := j.data.BatchSize
+
+	for start := 0; start < len(j.devs); start += batchSize {
+		if j.ctx.Err() != nil {
+			skipRemaining(start)
+			j.finish(defs.MaintenanceCanceled)
+			return
+		}
+
+		end := start + batchSize
+		if end > len(j.devs) {
+			end = len(j.devs)
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c.runMaintenanceCamera(j, i)
+			}(i)
+		}
+		wg.Wait()
+
+		if j.ctx.Err() != nil {
+			skipRemaining(end)
+			j.finish(defs.MaintenanceCanceled)
+			return
+		}
+
+		// 재시작을 확인할 수 없는 카메라도 실패로 본다
+		for _, r := range j.snapshot().Cameras[start:end] {
+			if r.Status == defs.MaintenanceFailed || r.Status == defs.MaintenanceUnverified {
+				failed = true
+			}
+		}
+
+		if failed && !j.continueOnFailure {
+			skipRemaining(end)
+			j.finish(defs.MaintenanceFailed)
+			return
+		}
+	}
+
+	if j.ctx.Err() != nil {
+		j.finish(defs.MaintenanceCanceled)
+	} else if failed {
+		j.finish(defs.MaintenanceFailed)
+	} else {
+		j.finish(defs.MaintenanceDone)
+	}
+}
+
+// readFirmware는 controlFirmwareDirectory 안의 펌웨어 파일만 읽는다.
+func (c *Control) readFirmware(name string) ([]byte, error) {
+	if c.Conf.ControlFirmwareDirectory == "" {
+		return nil, errors.New("firmware upgrades are disabled, set controlFirmwareDirectory")
+	}
+
+	if !filepath.IsLocal(name) {
+		return nil, errors.New("invalid firmware file name: " + name)
+	}
+
+	dir, err := filepath.EvalSymlinks(c.Conf.ControlFirmwareDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	// 심볼릭 링크로 디렉터리 밖의 파일을 가리키지 못하게 한다
+	fpath, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(dir, fpath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return nil, errors.New("invalid firmware file name: " + name)
+	}
+
+	return os.ReadFile(fpath)
+}
+
+// prune은 보관 기간이 지났거나 최대 개수를 넘은 끝난 작업을 지운다.
+// mutex를 잡은 상태에서 호출해야 한다.
+func (m *MaintenanceJobs) prune() {
+	var finished []*maintenanceJob
+	for id, j := range m.jobs {
+		data := j.snapshot()
+		if data.Finished == nil {
+			continue
+		}
+		if time.Since(*data.Finished) > maintenanceJobRetention {
+			delete(m.jobs, id)
+			continue
+		}
+		finished = append(finished, j)
+	}
+
+	if len(finished) <= maintenanceMaxJobs {
+		return
+	}
+
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].snapshot().Finished.Before(*finished[b].snapshot().Finished)
+	})
+	for _, j := range finished[:len(finished)-maintenanceMaxJobs] {
+		delete(m.jobs, j.data.ID)
+	}
+}
+
+func (c *Control) createMaintenanceJob(ctx *gin.Context) {
+	var req maintenanceJobReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	switch req.Action {
+	case defs.MaintenanceReboot, defs.MaintenanceFactoryDefault, defs.MaintenanceFirmwareUpgrade:
+	default:
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid action: "+string(req.Action)))
+		return
+	}
+
+	if len(req.Cameras) == 0 {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `cameras` is required"))
+		return
+	}
+
+	if req.BatchSize <= 0 {
+		req.BatchSize = 1
+	}
+
+	timeout := time.Duration(req.Timeout)
+	if timeout <= 0 {
+		timeout = maintenanceDefaultTimeout
+	}
+
+	var firmware []byte
+	if req.Action == defs.MaintenanceFirmwareUpgrade {
+		if req.Firmware == "" {
+			c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `firmware` is required"))
+			return
+		}
+
+		firmware, err = c.readFirmware(req.Firmware)
+		if err != nil {
+			c.writeError(ctx, http.StatusBadRequest, errors.New("Failed to read firmware: "+err.Error()))
+			return
+		}
+	}
+
+	devs := make([]*onvifDevice, len(req.Cameras))
+	for i, name := range req.Cameras {
+		devs[i] = c.getOnvifDevice(name)
+		if devs[i] == nil {
+			c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+			return
+		}
+	}
+
+	m := c.MaintenanceJobs
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.prune()
+
+	// 작업 중인 카메라는 다른 작업에 포함할 수 없다.
+	// Control이 다시 시작되면 디바이스가 새로 만들어지므로 이름으로 비교한다.
+	for _, other := range m.jobs {
+		if !other.running() {
+			continue
+		}
+		for _, od := range other.devs {
+			for _, d := range devs {
+				if od.Conf.Name == d.Conf.Name {
+					c.writeError(ctx, http.StatusConflict,
+						fmt.Errorf("camera %s is already in maintenance job %s", d.Conf.Name, other.data.ID))
+					return
+				}
+			}
+		}
+	}
+
+	jobCtx, jobCtxCancel := context.WithCancel(m.ctx)
+
+	j := &maintenanceJob{
+		devs:              devs,
+		firmware:          firmware,
+		timeout:           timeout,
+		continueOnFailure: req.ContinueOnFailure,
+		ctx:               jobCtx,
+		ctxCancel:         jobCtxCancel,
+		data: defs.MaintenanceJob{
+			ID:        uuid.New().String(),
+			Action:    req.Action,
+			Status:    defs.MaintenancePending,
+			BatchSize: req.BatchSize,
+			Created:   time.Now(),
+			Cameras:   make([]defs.MaintenanceCameraResult, len(devs)),
+		},
+	}
+
+	for i, dev := range devs {
+		j.data.Cameras[i] = defs.MaintenanceCameraResult{
+			Camera: dev.Conf.Name,
+			Batch:  i / req.BatchSize,
+			Status: defs.MaintenancePending,
+		}
+	}
+
+	m.jobs[j.data.ID] = j
+
+	c.Log(logger.Info, "maintenance job %s created: %s of %d cameras", j.data.ID, req.Action, len(devs))
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		c.runMaintenanceJob(j)
+	}()
+
+	ctx.JSON(http.StatusAccepted, j.snapshot())
+}
+
+func (c *Control) getMaintenanceJobs(ctx *gin.Context) {
+	m := c.MaintenanceJobs
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.prune()
+
+	items := []defs.MaintenanceJob{}
+	for _, j := range m.jobs {
+		items = append(items, j.snapshot())
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items": items,
+	})
+}
+
+func (c *Control) getMaintenanceJob(ctx *gin.Context) {
+	j, ok := c.MaintenanceJobs.get(ctx.Param("id"))
+
+	if !ok {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such maintenance job found"))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, j.snapshot())
+}
+
+// cancelMaintenanceJob은 작업을 중단한다. 이미 카메라에 보낸 요청은 취소되지 않는다.
+func (c *Control) cancelMaintenanceJob(ctx *gin.Context) {
+	j, ok := c.MaintenanceJobs.get(ctx.Param("id"))
+
+	if !ok {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such maintenance job found"))
+		return
+	}
+
+	j.ctxCancel()
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,400 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+)
+
+const fakeDateTimeXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+<env:Body><tds:GetSystemDateAndTimeResponse/></env:Body></env:Envelope>`
+
+const fakeRebootXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+<env:Body><tds:SystemRebootResponse><tds:Message>Rebooting</tds:Message></tds:SystemRebootResponse></env:Body></env:Envelope>`
+
+// fakeRebootCamera emulates an ONVIF camera that goes offline for a while after a reboot.
+type fakeRebootCamera struct {
+	srv *httptest.Server
+
+	mutex      sync.Mutex
+	failReboot bool
+	noRestart  bool
+	downPolls  int // -1 = never comes back
+	rebooted   bool
+	down       int
+}
+
+func newFakeRebootCamera() *fakeRebootCamera {
+	c := &fakeRebootCamera{downPolls: 2}
+	c.srv = httptest.NewServer(http.HandlerFunc(c.handle))
+	return c
+}
+
+func (c *fakeRebootCamera) handle(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	byts, _ := io.ReadAll(r.Body)
+	body := string(byts)
+
+	switch {
+	case strings.Contains(body, "SystemReboot"):
+		if c.failReboot {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.rebooted = true
+		if !c.noRestart {
+			c.down = c.downPolls
+		}
+		w.Write([]byte(fakeRebootXML)) //nolint:errcheck
+
+	case strings.Contains(body, "GetSystemDateAndTime"):
+		if c.down != 0 {
+			if c.down > 0 {
+				c.down--
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(fakeDateTimeXML)) //nolint:errcheck
+
+	default:
+		w.Write([]byte(fmt.Sprintf(fakeCapabilitiesXML, r.Host))) //nolint:errcheck
+	}
+}
+
+func setMaintenanceTimings(t *testing.T) {
+	downTimeout, pollPeriod := maintenanceDownTimeout, maintenancePollPeriod
+	maintenanceDownTimeout = 200 * time.Millisecond
+	maintenancePollPeriod = 10 * time.Millisecond
+	t.Cleanup(func() {
+		maintenanceDownTimeout, maintenancePollPeriod = downTimeout, pollPeriod
+	})
+}
+
+func newTestMaintenanceJob(
+	t *testing.T,
+	batchSize int,
+	continueOnFailure bool,
+	cams ...*fakeRebootCamera,
+) (*Control, *maintenanceJob) {
+	setTestDumpDirectory(t)
+
+	c := &Control{
+		Conf:   &conf.Conf{},
+		Parent: &credentialsTestParent{},
+	}
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	t.Cleanup(ctxCancel)
+
+	j := &maintenanceJob{
+		timeout:           2 * time.Second,
+		continueOnFailure: continueOnFailure,
+		ctx:               ctx,
+		ctxCancel:         ctxCancel,
+		data: defs.MaintenanceJob{
+			ID:        "job",
+			Action:    defs.MaintenanceReboot,
+			Status:    defs.MaintenancePending,
+			BatchSize: batchSize,
+		},
+	}
+
+	for i, cam := range cams {
+		u, err := url.Parse(cam.srv.URL)
+		require.NoError(t, err)
+
+		dev := &onvifDevice{
+			Conf:   &conf.Path{Name: fmt.Sprintf("cam%d", i+1)},
+			Url:    *u,
+			parent: c,
+		}
+		require.NoError(t, dev.connect())
+
+		j.devs = append(j.devs, dev)
+		j.data.Cameras = append(j.data.Cameras, defs.MaintenanceCameraResult{
+			Camera: dev.Conf.Name,
+			Batch:  i / batchSize,
+			Status: defs.MaintenancePending,
+		})
+	}
+
+	return c, j
+}
+
+func maintenanceStatuses(j *maintenanceJob) []defs.MaintenanceStatus {
+	var ret []defs.MaintenanceStatus
+	for _, r := range j.snapshot().Cameras {
+		ret = append(ret, r.Status)
+	}
+	return ret
+}
+
+func TestMaintenanceJobDone(t *testing.T) {
+	setMaintenanceTimings(t)
+
+	var cams []*fakeRebootCamera
+	for i := 0; i < 3; i++ {
+		cam := newFakeRebootCamera()
+		defer cam.srv.Close()
+		cams = append(cams, cam)
+	}
+
+	c, j := newTestMaintenanceJob(t, 2, false, cams...)
+	c.runMaintenanceJob(j)
+
+	data := j.snapshot()
+	require.Equal(t, defs.MaintenanceDone, data.Status)
+	require.NotNil(t, data.Finished)
+	require.Equal(t, []defs.MaintenanceStatus{
+		defs.MaintenanceDone,
+		defs.MaintenanceDone,
+		defs.MaintenanceDone,
+	}, maintenanceStatuses(j))
+
+	for _, r := range data.Cameras {
+		require.Equal(t, "onvif", r.Method)
+		require.NotNil(t, r.Finished)
+	}
+}
+
+func TestMaintenanceJobFailure(t *testing.T) {
+	setMaintenanceTimings(t)
+
+	for _, ca := range []struct {
+		name              string
+		continueOnFailure bool
+		statuses          []defs.MaintenanceStatus
+	}{
+		{
+			"stop",
+			false,
+			[]defs.MaintenanceStatus{
+				defs.MaintenanceFailed,
+				defs.MaintenanceSkipped,
+				defs.MaintenanceSkipped,
+			},
+		},
+		{
+			"continue",
+			true,
+			[]defs.MaintenanceStatus{
+				defs.MaintenanceFailed,
+				defs.MaintenanceDone,
+				defs.MaintenanceDone,
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			var cams []*fakeRebootCamera
+			for i := 0; i < 3; i++ {
+				cam := newFakeRebootCamera()
+				defer cam.srv.Close()
+				cams = append(cams, cam)
+			}
+			cams[0].failReboot = true
+
+			c, j := newTestMaintenanceJob(t, 1, ca.continueOnFailure, cams...)
+			c.runMaintenanceJob(j)
+
+			require.Equal(t, defs.MaintenanceFailed, j.snapshot().Status)
+			require.Equal(t, ca.statuses, maintenanceStatuses(j))
+			require.Equal(t, ca.continueOnFailure, cams[1].rebooted)
+		})
+	}
+}
+
+func TestMaintenanceJobUnverified(t *testing.T) {
+	setMaintenanceTimings(t)
+
+	cam1 := newFakeRebootCamera()
+	defer cam1.srv.Close()
+	cam1.noRestart = true
+	cam2 := newFakeRebootCamera()
+	defer cam2.srv.Close()
+
+	c, j := newTestMaintenanceJob(t, 1, false, cam1, cam2)
+	c.runMaintenanceJob(j)
+
+	data := j.snapshot()
+	require.Equal(t, defs.MaintenanceFailed, data.Status)
+	require.Equal(t, []defs.MaintenanceStatus{
+		defs.MaintenanceUnverified,
+		defs.MaintenanceSkipped,
+	}, maintenanceStatuses(j))
+	require.Equal(t, errMaintenanceUnverified.Error(), data.Cameras[0].Error)
+}
+
+func TestMaintenanceJobCancel(t *testing.T) {
+	setMaintenanceTimings(t)
+
+	cam1 := newFakeRebootCamera()
+	defer cam1.srv.Close()
+	cam1.downPolls = -1
+	cam2 := newFakeRebootCamera()
+	defer cam2.srv.Close()
+
+	c, j := newTestMaintenanceJob(t, 1, true, cam1, cam2)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.runMaintenanceJob(j)
+	}()
+
+	require.Eventually(t, func() bool {
+		return j.snapshot().Cameras[0].Status == defs.MaintenanceWaiting
+	}, 2*time.Second, 5*time.Millisecond)
+	j.ctxCancel()
+	<-done
+
+	require.Equal(t, defs.MaintenanceCanceled, j.snapshot().Status)
+	require.Equal(t, []defs.MaintenanceStatus{
+		defs.MaintenanceCanceled,
+		defs.MaintenanceSkipped,
+	}, maintenanceStatuses(j))
+	require.False(t, cam2.rebooted)
+}
+
+func TestMaintenanceJobOutlivesControl(t *testing.T) {
+	setMaintenanceTimings(t)
+	setTestDumpDirectory(t)
+
+	cam := newFakeRebootCamera()
+	defer cam.srv.Close()
+	cam.downPolls = 10
+
+	m := &MaintenanceJobs{}
+	m.Initialize()
+	defer m.Close()
+
+	newControl := func() *Control {
+		u, err := url.Parse(cam.srv.URL)
+		require.NoError(t, err)
+
+		c := &Control{
+			Conf:            &conf.Conf{},
+			Parent:          &credentialsTestParent{},
+			MaintenanceJobs: m,
+		}
+		c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+
+		dev := &onvifDevice{
+			Conf:   &conf.Path{Name: "cam1"},
+			Url:    *u,
+			parent: c,
+		}
+		require.NoError(t, dev.connect())
+		c.OnvifDevices = []*onvifDevice{dev}
+
+		return c
+	}
+
+	do := func(c *Control, method string, path string, body string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+		ctx.Params = gin.Params{{Key: "name", Value: "cam1"}}
+		handler(ctx)
+		return w
+	}
+
+	c1 := newControl()
+	w := do(c1, http.MethodPost, "/ipcam/maintenance", `{"action":"reboot","cameras":["cam1"]}`,
+		c1.createMaintenanceJob)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	var job defs.MaintenanceJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+
+	// control is restarted, for instance because cameras changed
+	c1.ctxCancel()
+	c1.wg.Wait()
+
+	c2 := newControl()
+	defer c2.ctxCancel()
+
+	// the camera can't be changed while it is in maintenance
+	w = do(c2, http.MethodPatch, "/ipcam/cam1/network", `{"dhcp":true}`, c2.setNetwork)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	require.Eventually(t, func() bool {
+		j, ok := m.get(job.ID)
+		return ok && j.snapshot().Status == defs.MaintenanceDone
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestPruneMaintenanceJobs(t *testing.T) {
+	m := &MaintenanceJobs{jobs: make(map[string]*maintenanceJob)}
+
+	add := func(id string, finished time.Duration) {
+		j := &maintenanceJob{data: defs.MaintenanceJob{ID: id, Status: defs.MaintenanceRunning}}
+		if finished != 0 {
+			t := time.Now().Add(-finished)
+			j.data.Status = defs.MaintenanceDone
+			j.data.Finished = &t
+		}
+		m.jobs[id] = j
+	}
+
+	add("running", 0)
+	add("expired", maintenanceJobRetention+time.Minute)
+	for i := 0; i < maintenanceMaxJobs+1; i++ {
+		add(fmt.Sprintf("job%d", i), time.Duration(i+1)*time.Second)
+	}
+
+	m.prune()
+
+	require.Len(t, m.jobs, maintenanceMaxJobs+1)
+	require.Contains(t, m.jobs, "running")
+	require.NotContains(t, m.jobs, "expired")
+
+	// the oldest finished job is removed first
+	require.NotContains(t, m.jobs, fmt.Sprintf("job%d", maintenanceMaxJobs))
+	require.Contains(t, m.jobs, "job0")
+}
+
+func TestReadFirmware(t *testing.T) {
+	dir := t.TempDir()
+	fwdir := filepath.Join(dir, "firmware")
+	require.NoError(t, os.Mkdir(fwdir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(fwdir, "digicap.dav"), []byte("fw"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret"), filepath.Join(fwdir, "link")))
+
+	c := &Control{Conf: &conf.Conf{}}
+
+	_, err := c.readFirmware("digicap.dav")
+	require.EqualError(t, err, "firmware upgrades are disabled, set controlFirmwareDirectory")
+
+	c.Conf.ControlFirmwareDirectory = fwdir
+
+	byts, err := c.readFirmware("digicap.dav")
+	require.NoError(t, err)
+	require.Equal(t, []byte("fw"), byts)
+
+	for _, name := range []string{"../secret", filepath.Join(dir, "secret"), "link"} {
+		_, err = c.readFirmware(name)
+		require.EqualError(t, err, "invalid firmware file name: "+name)
+	}
+}
@@ -0,0 +1,223 @@
+package control
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/IOTechSystems/onvif/device"
+	xsdonvif "github.com/IOTechSystems/onvif/xsd/onvif"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+const media2Namespace = "http://www.onvif.org/ver20/media/wsdl"
+
+type media2Resolution struct {
+	Width  int
+	Height int
+}
+
+type media2Profile struct {
+	Token          string `xml:"token,attr"`
+	Name           string
+	Configurations struct {
+		VideoSource *struct {
+			Token string `xml:"token,attr"`
+		}
+		VideoEncoder *struct {
+			Encoding    string
+			Resolution  media2Resolution
+			RateControl *struct {
+				FrameRateLimit float64
+				BitrateLimit   int
+			}
+			Multicast *struct {
+				Address onvifIPAddress
+			}
+		}
+		AudioEncoder *struct {
+			Encoding string
+		}
+	}
+}
+
+// getServices는 GetServices로 디바이스가 제공하는 서비스 목록을 조회한다.
+func (o *onvifDevice) getServices() ([]device.Service, error) {
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			GetServicesResponse struct {
+				Service []device.Service
+			}
+		}
+	}
+
+	var reply Envelope
+	err := o.callMethodChecked(device.GetServices{IncludeCapability: false}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Body.GetServicesResponse.Service, nil
+}
+
+// detectMedia2는 Media2 서비스 주소를 찾는다. 지원하지 않으면 빈 문자열이 된다.
+func (o *onvifDevice) detectMedia2() {
+	o.media2Url = ""
+
+	services, err := o.getServices()
+	if err != nil {
+		return
+	}
+
+	for _, s := range services {
+		if string(s.Namespace) != media2Namespace {
+			continue
+		}
+
+		// 카메라가 내부 주소를 알려주는 경우가 있으므로 접속 주소로 바꾼다.
+		u, err := o.rewriteAPIURI(string(s.XAddr))
+		if err != nil {
+			return
+		}
+
+		o.media2Url = u
+		return
+	}
+}
+
+// sendSoapChecked는 SOAP 요청을 보내고, HTTP 에러 응답(SOAP Fault)을 에러로 반환한다.
+func (o *onvifDevice) sendSoapChecked(endpoint string, method string, body string, reply interface{}) error {
+	resp, err := o.dev.SendSoap(endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if (resp.StatusCode / 100) != 2 {
+		return fmt.Errorf("%s failed: bad status code: %d", method, resp.StatusCode)
+	}
+
+	return xml.Unmarshal(b, reply)
+}
+
+func (o *onvifDevice) sendMedia2(method string, body string, reply interface{}) error {
+	return o.sendSoapChecked(o.media2Url, method, body, reply)
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s)) //nolint:errcheck
+	return buf.String()
+}
+
+func (o *onvifDevice) getMedia2Profiles() ([]media2Profile, error) {
+	var reply struct {
+		Body struct {
+			GetProfilesResponse struct {
+				Profiles []media2Profile
+			}
+		}
+	}
+
+	err := o.sendMedia2("GetProfiles",
+		`<tr2:GetProfiles xmlns:tr2="`+media2Namespace+`"><tr2:Type>All</tr2:Type></tr2:GetProfiles>`,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Body.GetProfilesResponse.Profiles, nil
+}
+
+// media2StreamProtocol은 설정된 스트림 프로토콜을 Media2 GetStreamUri의 Protocol 값으로 바꾼다.
+func media2StreamProtocol(p conf.CameraStreamProtocol) string {
+	switch p {
+	case conf.CameraStreamProtocolRTSPMulticast:
+		return "RtspMulticast"
+
+	case conf.CameraStreamProtocolRTSPOverHTTP:
+		return "RtspOverHttp"
+
+	default:
+		return "RtspUnicast"
+	}
+}
+
+// mediaStreamSetup은 설정된 스트림 프로토콜을 Media GetStreamUri의 StreamSetup 값으로 바꾼다.
+func mediaStreamSetup(p conf.CameraStreamProtocol) *xsdonvif.StreamSetup {
+	stream := xsdonvif.StreamType("RTP-Unicast")
+	protocol := xsdonvif.TransportProtocol("RTSP")
+
+	switch p {
+	case conf.CameraStreamProtocolRTSPMulticast:
+		stream = "RTP-Multicast"
+		protocol = "UDP"
+
+	case conf.CameraStreamProtocolRTSPOverHTTP:
+		protocol = "HTTP"
+	}
+
+	return &xsdonvif.StreamSetup{
+		Stream: &stream,
+		Transport: &xsdonvif.Transport{
+			Protocol: &protocol,
+		},
+	}
+}
+
+func (o *onvifDevice) getMedia2StreamUri(token string, protocol conf.CameraStreamProtocol) (string, error) {
+	var reply struct {
+		Body struct {
+			GetStreamUriResponse struct {
+				Uri string
+			}
+		}
+	}
+
+	err := o.sendMedia2("GetStreamUri",
+		`<tr2:GetStreamUri xmlns:tr2="`+media2Namespace+`">`+
+			`<tr2:Protocol>`+media2StreamProtocol(protocol)+`</tr2:Protocol>`+
+			`<tr2:ProfileToken>`+escapeXML(token)+`</tr2:ProfileToken>`+
+			`</tr2:GetStreamUri>`,
+		&reply)
+	if err != nil {
+		return "", err
+	}
+
+	uri := strings.TrimSpace(reply.Body.GetStreamUriResponse.Uri)
+	if uri == "" {
+		return "", fmt.Errorf("GetStreamUri failed: empty URI")
+	}
+
+	return uri, nil
+}
+
+func (o *onvifDevice) getMedia2SnapshotUri(token string) (string, error) {
+	var reply struct {
+		Body struct {
+			GetSnapshotUriResponse struct {
+				Uri string
+			}
+		}
+	}
+
+	err := o.sendMedia2("GetSnapshotUri",
+		`<tr2:GetSnapshotUri xmlns:tr2="`+media2Namespace+`">`+
+			`<tr2:ProfileToken>`+escapeXML(token)+`</tr2:ProfileToken>`+
+			`</tr2:GetSnapshotUri>`,
+		&reply)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(reply.Body.GetSnapshotUriResponse.Uri), nil
+}
@@ -0,0 +1,262 @@
+package control
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+const fakeServicesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl">
+<env:Body><tds:GetServicesResponse>
+<tds:Service><tds:Namespace>http://www.onvif.org/ver10/device/wsdl</tds:Namespace>` +
+	`<tds:XAddr>http://%[1]s/onvif/device_service</tds:XAddr></tds:Service>
+<tds:Service><tds:Namespace>http://www.onvif.org/ver10/media/wsdl</tds:Namespace>` +
+	`<tds:XAddr>http://%[1]s/onvif/Media</tds:XAddr></tds:Service>
+%[2]s
+</tds:GetServicesResponse></env:Body></env:Envelope>`
+
+const fakeMedia2ServiceXML = `<tds:Service><tds:Namespace>http://www.onvif.org/ver20/media/wsdl</tds:Namespace>` +
+	`<tds:XAddr>http://%s/onvif/Media2</tds:XAddr></tds:Service>`
+
+const fakeMedia2ProfilesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:tr2="http://www.onvif.org/ver20/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><tr2:GetProfilesResponse>
+<tr2:Profiles token="Profile_1" fixed="true"><tr2:Name>mainStream</tr2:Name><tr2:Configurations>
+<tr2:VideoSource token="VideoSource_1"><tt:Name>VideoSource_1</tt:Name></tr2:VideoSource>
+<tr2:VideoEncoder token="VideoEncoder_1"><tt:Name>VideoEncoder_1</tt:Name>
+<tt:Encoding>H265</tt:Encoding><tt:Resolution><tt:Width>3840</tt:Width><tt:Height>2160</tt:Height></tt:Resolution>
+<tt:Multicast><tt:Address><tt:Type>IPv4</tt:Type><tt:IPv4Address>239.0.0.1</tt:IPv4Address></tt:Address></tt:Multicast>
+</tr2:VideoEncoder>
+<tr2:AudioEncoder token="AudioEncoder_1"><tt:Name>AudioEncoder_1</tt:Name><tt:Encoding>MP4A-LATM</tt:Encoding></tr2:AudioEncoder>
+</tr2:Configurations></tr2:Profiles>
+</tr2:GetProfilesResponse></env:Body></env:Envelope>`
+
+const fakeMediaProfilesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><trt:GetProfilesResponse>
+<trt:Profiles token="Profile_101" fixed="true"><tt:Name>mainStream</tt:Name>
+<tt:VideoSourceConfiguration token="VideoSource_1"><tt:Name>VideoSource_1</tt:Name></tt:VideoSourceConfiguration>
+<tt:VideoEncoderConfiguration token="VideoEncoder_1"><tt:Name>VideoEncoder_1</tt:Name>
+<tt:Encoding>H264</tt:Encoding><tt:Resolution><tt:Width>1920</tt:Width><tt:Height>1080</tt:Height></tt:Resolution>
+<tt:Multicast><tt:Address><tt:Type>IPv4</tt:Type><tt:IPv4Address>239.0.0.2</tt:IPv4Address></tt:Address></tt:Multicast>
+</tt:VideoEncoderConfiguration>
+<tt:AudioEncoderConfiguration token="AudioEncoder_1"><tt:Name>AudioEncoder_1</tt:Name><tt:Encoding>G711</tt:Encoding></tt:AudioEncoderConfiguration>
+</trt:Profiles>
+</trt:GetProfilesResponse></env:Body></env:Envelope>`
+
+const fakeMedia2StreamUriXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tr2="http://www.onvif.org/ver20/media/wsdl">
+<env:Body><tr2:GetStreamUriResponse><tr2:Uri>rtsp://%s/Streaming/Channels/101</tr2:Uri></tr2:GetStreamUriResponse></env:Body></env:Envelope>`
+
+const fakeMediaStreamUriXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>rtsp://%s/Streaming/Channels/101</tt:Uri></trt:MediaUri>` +
+	`</trt:GetStreamUriResponse></env:Body></env:Envelope>`
+
+// fakeMediaCamera emulates the Media and Media2 services of an ONVIF camera.
+type fakeMediaCamera struct {
+	srv *httptest.Server
+
+	mutex             sync.Mutex
+	media2            bool
+	failMedia2        bool
+	streamUriRequests []string
+}
+
+func newFakeMediaCamera() *fakeMediaCamera {
+	c := &fakeMediaCamera{}
+	c.srv = httptest.NewServer(http.HandlerFunc(c.handle))
+	return c
+}
+
+func (c *fakeMediaCamera) handle(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	byts, _ := io.ReadAll(r.Body)
+	body := string(byts)
+	isMedia2 := strings.Contains(body, "<tr2:")
+
+	switch {
+	case strings.Contains(body, "GetServices"):
+		media2 := ""
+		if c.media2 {
+			media2 = fmt.Sprintf(fakeMedia2ServiceXML, r.Host)
+		}
+		w.Write([]byte(fmt.Sprintf(fakeServicesXML, r.Host, media2))) //nolint:errcheck
+
+	case strings.Contains(body, "GetProfiles") && isMedia2:
+		if !c.media2 || c.failMedia2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(fakeMedia2ProfilesXML)) //nolint:errcheck
+
+	case strings.Contains(body, "GetProfiles"):
+		w.Write([]byte(fakeMediaProfilesXML)) //nolint:errcheck
+
+	case strings.Contains(body, "GetStreamUri"):
+		c.streamUriRequests = append(c.streamUriRequests, body)
+		if isMedia2 {
+			w.Write([]byte(fmt.Sprintf(fakeMedia2StreamUriXML, r.Host))) //nolint:errcheck
+		} else {
+			w.Write([]byte(fmt.Sprintf(fakeMediaStreamUriXML, r.Host))) //nolint:errcheck
+		}
+
+	default:
+		w.Write([]byte(fmt.Sprintf(fakeCapabilitiesXML, r.Host))) //nolint:errcheck
+	}
+}
+
+func newTestMediaDevice(t *testing.T, cam *fakeMediaCamera) *onvifDevice {
+	setTestDumpDirectory(t)
+
+	u, err := url.Parse(cam.srv.URL)
+	require.NoError(t, err)
+
+	o := &onvifDevice{
+		Conf:   &conf.Path{Name: "cam"},
+		Camera: &conf.Camera{Name: "cam"},
+		Url:    *u,
+		parent: &Control{Parent: &credentialsTestParent{}},
+	}
+	require.NoError(t, o.connect())
+
+	return o
+}
+
+func TestLoadProfiles(t *testing.T) {
+	for _, ca := range []string{
+		"media2",
+		"media",
+		"media2 failure",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			cam := newFakeMediaCamera()
+			defer cam.srv.Close()
+
+			cam.media2 = ca != "media"
+			cam.failMedia2 = ca == "media2 failure"
+
+			o := newTestMediaDevice(t, cam)
+			o.detectMedia2()
+
+			if cam.media2 {
+				require.Equal(t, cam.srv.URL+"/onvif/Media2", o.media2Url)
+			} else {
+				require.Empty(t, o.media2Url)
+			}
+
+			profiles := o.loadProfiles()
+			require.Len(t, profiles, 1)
+			p := profiles[0]
+
+			if ca == "media2" {
+				require.True(t, p.Media2)
+				require.Equal(t, "Profile_1", string(p.Token))
+				require.Equal(t, "mainStream", string(p.Name))
+				require.Equal(t, "H265", p.Encoding)
+				require.Equal(t, "MP4A-LATM", p.AudioEncoding)
+				require.Equal(t, 3840, p.Width)
+				require.Equal(t, 2160, p.Height)
+				require.Equal(t, "239.0.0.1", p.MulticastAddress)
+			} else {
+				// later requests are sent to Media too when Media2 is not usable
+				require.Empty(t, o.media2Url)
+				require.False(t, p.Media2)
+				require.Equal(t, "Profile_101", string(p.Token))
+				require.Equal(t, "mainStream", string(p.Name))
+				require.Equal(t, "H264", p.Encoding)
+				require.Equal(t, "G711", p.AudioEncoding)
+				require.Equal(t, 1920, p.Width)
+				require.Equal(t, 1080, p.Height)
+				require.Equal(t, "239.0.0.2", p.MulticastAddress)
+			}
+
+			require.NotNil(t, p.VideoSourceConfiguration)
+			require.Equal(t, "VideoSource_1", string(p.VideoSourceConfiguration.Token))
+		})
+	}
+}
+
+func TestProfileStreamUriProtocol(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		media2   bool
+		protocol conf.CameraStreamProtocol
+		expected []string
+	}{
+		{
+			"media2 unicast",
+			true,
+			conf.CameraStreamProtocolRTSPUnicast,
+			[]string{"<tr2:Protocol>RtspUnicast</tr2:Protocol>"},
+		},
+		{
+			"media2 multicast",
+			true,
+			conf.CameraStreamProtocolRTSPMulticast,
+			[]string{"<tr2:Protocol>RtspMulticast</tr2:Protocol>"},
+		},
+		{
+			"media2 over http",
+			true,
+			conf.CameraStreamProtocolRTSPOverHTTP,
+			[]string{"<tr2:Protocol>RtspOverHttp</tr2:Protocol>"},
+		},
+		{
+			"media unicast",
+			false,
+			conf.CameraStreamProtocolRTSPUnicast,
+			[]string{">RTP-Unicast<", ">RTSP<"},
+		},
+		{
+			"media multicast",
+			false,
+			conf.CameraStreamProtocolRTSPMulticast,
+			[]string{">RTP-Multicast<", ">UDP<"},
+		},
+		{
+			"media over http",
+			false,
+			conf.CameraStreamProtocolRTSPOverHTTP,
+			[]string{">RTP-Unicast<", ">HTTP<"},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			cam := newFakeMediaCamera()
+			defer cam.srv.Close()
+
+			cam.media2 = ca.media2
+
+			o := newTestMediaDevice(t, cam)
+			o.detectMedia2()
+
+			profiles := o.loadProfiles()
+			require.Len(t, profiles, 1)
+			require.Equal(t, ca.media2, profiles[0].Media2)
+
+			uri, err := o.profileStreamUri(profiles[0], ca.protocol)
+			require.NoError(t, err)
+			require.Equal(t, "rtsp://"+cam.srv.Listener.Addr().String()+"/Streaming/Channels/101", string(uri.Uri))
+
+			require.Len(t, cam.streamUriRequests, 1)
+			for _, e := range ca.expected {
+				require.Contains(t, cam.streamUriRequests[0], e)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package control
+
+import (
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+// unicastStreamProtocol은 유니캐스트 수신에 사용할 스트림 프로토콜을 반환한다.
+func unicastStreamProtocol(p conf.CameraStreamProtocol) conf.CameraStreamProtocol {
+	if p == conf.CameraStreamProtocolRTSPMulticast {
+		return conf.CameraStreamProtocolRTSPUnicast
+	}
+	return p
+}
+
+// ingestStreamUri는 프로파일에서 스트림을 받을 주소를 조회한다.
+// ingestMode가 multicast이면 멀티캐스트 주소를 사용하고, 유니캐스트 주소를 대체 주소로 함께 조회한다.
+func (o *onvifDevice) ingestStreamUri(profile Profile) (MediaUri, error) {
+	if o.Camera.IngestMode != conf.CameraIngestModeMulticast {
+		uri, err := o.profileStreamUri(profile, o.Camera.StreamProtocol)
+		if err != nil {
+			return MediaUri{}, err
+		}
+		return MediaUri{MediaUri: uri, Profile: &profile}, nil
+	}
+
+	unicast, err := o.profileStreamUri(profile, unicastStreamProtocol(o.Camera.StreamProtocol))
+	if err != nil {
+		return MediaUri{}, err
+	}
+
+	ret := MediaUri{MediaUri: unicast, Profile: &profile}
+
+	// 주소가 없으면 카메라가 SETUP 응답에서 임의의 그룹을 알려주거나 멀티캐스트를 거부한다
+	if profile.MulticastAddress == "" || profile.MulticastAddress == "0.0.0.0" {
+		o.parent.Log(logger.Warn, "multicast address of profile %s of %s is not configured",
+			profile.Token, o.Conf.Name)
+	}
+
+	multicast, err := o.profileStreamUri(profile, conf.CameraStreamProtocolRTSPMulticast)
+	if err != nil {
+		o.parent.Log(logger.Warn, "Failed to get multicast stream uri of profile %s of %s, using unicast: %v",
+			profile.Token, o.Conf.Name, err)
+		return ret, nil
+	}
+
+	ret.MediaUri = multicast
+	ret.Unicast = &unicast
+
+	return ret, nil
+}
+
+// UnicastSource returns the RTSP URL that paths read from when no multicast packets arrive.
+// It is empty when the stream is not received with multicast.
+func (o *onvifDevice) UnicastSource(u MediaUri) (string, error) {
+	if u.Unicast == nil {
+		return "", nil
+	}
+
+	return o.StreamSource(MediaUri{MediaUri: *u.Unicast, Profile: u.Profile})
+}
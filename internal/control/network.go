@@ -0,0 +1,675 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	goonvif "github.com/IOTechSystems/onvif"
+	device "github.com/IOTechSystems/onvif/device"
+	"github.com/gin-gonic/gin"
+	"github.com/icholy/digest"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+const (
+	// IP 변경 후 카메라가 새 주소로 응답할 때까지 기다리는 시간
+	networkReconnectTimeout = 60 * time.Second
+	networkReconnectPeriod  = 2 * time.Second
+)
+
+type networkPatchReq struct {
+	Hostname *string `json:"hostname"`
+
+	DNSFromDHCP   *bool     `json:"dnsFromDHCP"`
+	DNSServers    *[]string `json:"dnsServers"`
+	SearchDomains *[]string `json:"searchDomains"`
+
+	NTPFromDHCP *bool     `json:"ntpFromDHCP"`
+	NTPServers  *[]string `json:"ntpServers"`
+
+	// 변경할 인터페이스 토큰. 비어 있으면 첫 번째 인터페이스
+	Interface    string  `json:"interface"`
+	DHCP         *bool   `json:"dhcp"`
+	Address      *string `json:"address"`
+	PrefixLength *int    `json:"prefixLength"`
+}
+
+func (r *networkPatchReq) changesDNS() bool {
+	return r.DNSFromDHCP != nil || r.DNSServers != nil || r.SearchDomains != nil
+}
+
+func (r *networkPatchReq) changesNTP() bool {
+	return r.NTPFromDHCP != nil || r.NTPServers != nil
+}
+
+func (r *networkPatchReq) changesInterface() bool {
+	return r.DHCP != nil || r.Address != nil || r.PrefixLength != nil
+}
+
+func (r *networkPatchReq) validate() error {
+	if r.Hostname != nil && !isValidHostname(*r.Hostname) {
+		return fmt.Errorf("invalid hostname: '%s'", *r.Hostname)
+	}
+
+	if r.DNSServers != nil {
+		for _, s := range *r.DNSServers {
+			if net.ParseIP(s) == nil {
+				return fmt.Errorf("invalid DNS server: '%s'", s)
+			}
+		}
+	}
+
+	if r.NTPServers != nil {
+		for _, s := range *r.NTPServers {
+			if net.ParseIP(s) == nil && !isValidHostname(s) {
+				return fmt.Errorf("invalid NTP server: '%s'", s)
+			}
+		}
+	}
+
+	if r.Address != nil {
+		ip := net.ParseIP(*r.Address)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("invalid IPv4 address: '%s'", *r.Address)
+		}
+	}
+
+	if r.PrefixLength != nil && (*r.PrefixLength < 1 || *r.PrefixLength > 32) {
+		return fmt.Errorf("invalid prefix length: %d", *r.PrefixLength)
+	}
+
+	if r.DHCP != nil && *r.DHCP && (r.Address != nil || r.PrefixLength != nil) {
+		return errors.New("Paramater `address` and `prefixLength` can't be used with `dhcp`")
+	}
+
+	return nil
+}
+
+func isValidHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') && c != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+type onvifIPAddress struct {
+	Type        string
+	IPv4Address string
+	IPv6Address string
+}
+
+func (a onvifIPAddress) String() string {
+	if a.IPv4Address != "" {
+		return a.IPv4Address
+	}
+	return a.IPv6Address
+}
+
+type onvifNetworkHost struct {
+	Type        string
+	IPv4Address string
+	IPv6Address string
+	DNSname     string
+}
+
+func (h onvifNetworkHost) String() string {
+	switch {
+	case h.DNSname != "":
+		return h.DNSname
+	case h.IPv4Address != "":
+		return h.IPv4Address
+	}
+	return h.IPv6Address
+}
+
+type onvifPrefixedAddress struct {
+	Address      string
+	PrefixLength int
+}
+
+type onvifNetworkInterface struct {
+	Token   string `xml:"token,attr"`
+	Enabled bool
+	Info    struct {
+		Name      string
+		HwAddress string
+	}
+	IPv4 *struct {
+		Enabled bool
+		Config  struct {
+			Manual    []onvifPrefixedAddress
+			LinkLocal *onvifPrefixedAddress
+			FromDHCP  *onvifPrefixedAddress
+			DHCP      bool
+		}
+	}
+}
+
+func (i *onvifNetworkInterface) toDefs() defs.ControlNetworkInterface {
+	ret := defs.ControlNetworkInterface{
+		Token:     i.Token,
+		Name:      i.Info.Name,
+		HwAddress: i.Info.HwAddress,
+		Enabled:   i.Enabled,
+	}
+
+	if i.IPv4 != nil {
+		cfg := i.IPv4.Config
+		ret.DHCP = cfg.DHCP
+
+		var addr *onvifPrefixedAddress
+		switch {
+		case cfg.DHCP && cfg.FromDHCP != nil:
+			addr = cfg.FromDHCP
+		case len(cfg.Manual) != 0:
+			addr = &cfg.Manual[0]
+		case cfg.LinkLocal != nil:
+			addr = cfg.LinkLocal
+		}
+
+		if addr != nil {
+			ret.Address = addr.Address
+			ret.PrefixLength = addr.PrefixLength
+		}
+	}
+
+	return ret
+}
+
+func (o *onvifDevice) sendDevice(method string, body string, reply interface{}) error {
+	return o.sendSoapChecked(o.dev.GetEndpoint("device"), method, body, reply)
+}
+
+func (o *onvifDevice) getNetworkInterfaces() ([]onvifNetworkInterface, error) {
+	var reply struct {
+		Body struct {
+			GetNetworkInterfacesResponse struct {
+				NetworkInterfaces []onvifNetworkInterface
+			}
+		}
+	}
+
+	err := o.callMethodChecked(device.GetNetworkInterfaces{}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Body.GetNetworkInterfacesResponse.NetworkInterfaces, nil
+}
+
+// getNetwork는 호스트 이름, DNS, NTP, 인터페이스, 프로토콜 설정을 조회한다.
+func (o *onvifDevice) getNetwork() (*defs.ControlNetwork, error) {
+	ret := &defs.ControlNetwork{
+		Camera:        o.Conf.Name,
+		DNSServers:    []string{},
+		SearchDomains: []string{},
+		NTPServers:    []string{},
+		Interfaces:    []defs.ControlNetworkInterface{},
+		Protocols:     []defs.ControlNetworkProtocol{},
+	}
+
+	var hostname struct {
+		Body struct {
+			GetHostnameResponse struct {
+				HostnameInformation struct {
+					FromDHCP bool
+					Name     string
+				}
+			}
+		}
+	}
+	err := o.callMethodChecked(device.GetHostname{}, &hostname)
+	if err != nil {
+		return nil, err
+	}
+	ret.Hostname = hostname.Body.GetHostnameResponse.HostnameInformation.Name
+	ret.HostnameFromDHCP = hostname.Body.GetHostnameResponse.HostnameInformation.FromDHCP
+
+	var dns struct {
+		Body struct {
+			GetDNSResponse struct {
+				DNSInformation struct {
+					FromDHCP     bool
+					SearchDomain []string
+					DNSFromDHCP  []onvifIPAddress
+					DNSManual    []onvifIPAddress
+				}
+			}
+		}
+	}
+	err = o.callMethodChecked(device.GetDNS{}, &dns)
+	if err != nil {
+		return nil, err
+	}
+	info := dns.Body.GetDNSResponse.DNSInformation
+	ret.DNSFromDHCP = info.FromDHCP
+	ret.SearchDomains = append(ret.SearchDomains, info.SearchDomain...)
+	servers := info.DNSManual
+	if info.FromDHCP {
+		servers = info.DNSFromDHCP
+	}
+	for _, s := range servers {
+		ret.DNSServers = append(ret.DNSServers, s.String())
+	}
+
+	var ntp struct {
+		Body struct {
+			GetNTPResponse struct {
+				NTPInformation struct {
+					FromDHCP    bool
+					NTPFromDHCP []onvifNetworkHost
+					NTPManual   []onvifNetworkHost
+				}
+			}
+		}
+	}
+	err = o.callMethodChecked(device.GetNTP{}, &ntp)
+	if err != nil {
+		return nil, err
+	}
+	ntpInfo := ntp.Body.GetNTPResponse.NTPInformation
+	ret.NTPFromDHCP = ntpInfo.FromDHCP
+	hosts := ntpInfo.NTPManual
+	if ntpInfo.FromDHCP {
+		hosts = ntpInfo.NTPFromDHCP
+	}
+	for _, h := range hosts {
+		ret.NTPServers = append(ret.NTPServers, h.String())
+	}
+
+	ifaces, err := o.getNetworkInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range ifaces {
+		ret.Interfaces = append(ret.Interfaces, i.toDefs())
+	}
+
+	var protocols struct {
+		Body struct {
+			GetNetworkProtocolsResponse struct {
+				NetworkProtocols []struct {
+					Name    string
+					Enabled bool
+					Port    []int
+				}
+			}
+		}
+	}
+	err = o.callMethodChecked(device.GetNetworkProtocols{}, &protocols)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range protocols.Body.GetNetworkProtocolsResponse.NetworkProtocols {
+		ret.Protocols = append(ret.Protocols, defs.ControlNetworkProtocol{
+			Name:    p.Name,
+			Enabled: p.Enabled,
+			Ports:   append([]int{}, p.Port...),
+		})
+	}
+
+	return ret, nil
+}
+
+func setHostnameXML(name string) string {
+	return `<tds:SetHostname><tds:Name>` + escapeXML(name) + `</tds:Name></tds:SetHostname>`
+}
+
+func setDNSXML(fromDHCP bool, servers []string, domains []string) string {
+	var b strings.Builder
+
+	b.WriteString(`<tds:SetDNS xmlns:tt="` + schemaNamespace + `">`)
+	b.WriteString(`<tds:FromDHCP>` + strconv.FormatBool(fromDHCP) + `</tds:FromDHCP>`)
+	for _, d := range domains {
+		b.WriteString(`<tds:SearchDomain>` + escapeXML(d) + `</tds:SearchDomain>`)
+	}
+	if !fromDHCP {
+		for _, s := range servers {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() == nil {
+				b.WriteString(`<tds:DNSManual><tt:Type>IPv6</tt:Type><tt:IPv6Address>` + s + `</tt:IPv6Address></tds:DNSManual>`)
+			} else {
+				b.WriteString(`<tds:DNSManual><tt:Type>IPv4</tt:Type><tt:IPv4Address>` + escapeXML(s) + `</tt:IPv4Address></tds:DNSManual>`)
+			}
+		}
+	}
+	b.WriteString(`</tds:SetDNS>`)
+
+	return b.String()
+}
+
+func setNTPXML(fromDHCP bool, servers []string) string {
+	var b strings.Builder
+
+	b.WriteString(`<tds:SetNTP xmlns:tt="` + schemaNamespace + `">`)
+	b.WriteString(`<tds:FromDHCP>` + strconv.FormatBool(fromDHCP) + `</tds:FromDHCP>`)
+	if !fromDHCP {
+		for _, s := range servers {
+			ip := net.ParseIP(s)
+			switch {
+			case ip == nil:
+				b.WriteString(`<tds:NTPManual><tt:Type>DNS</tt:Type><tt:DNSname>` + escapeXML(s) + `</tt:DNSname></tds:NTPManual>`)
+			case ip.To4() == nil:
+				b.WriteString(`<tds:NTPManual><tt:Type>IPv6</tt:Type><tt:IPv6Address>` + s + `</tt:IPv6Address></tds:NTPManual>`)
+			default:
+				b.WriteString(`<tds:NTPManual><tt:Type>IPv4</tt:Type><tt:IPv4Address>` + s + `</tt:IPv4Address></tds:NTPManual>`)
+			}
+		}
+	}
+	b.WriteString(`</tds:SetNTP>`)
+
+	return b.String()
+}
+
+func setNetworkInterfaceXML(iface defs.ControlNetworkInterface) string {
+	var b strings.Builder
+
+	b.WriteString(`<tds:SetNetworkInterfaces xmlns:tt="` + schemaNamespace + `">`)
+	b.WriteString(`<tds:InterfaceToken>` + escapeXML(iface.Token) + `</tds:InterfaceToken>`)
+	b.WriteString(`<tds:NetworkInterface>`)
+	b.WriteString(`<tt:Enabled>true</tt:Enabled>`)
+	b.WriteString(`<tt:IPv4><tt:Enabled>true</tt:Enabled>`)
+	if !iface.DHCP {
+		b.WriteString(`<tt:Manual><tt:Address>` + escapeXML(iface.Address) + `</tt:Address>`)
+		b.WriteString(`<tt:PrefixLength>` + strconv.Itoa(iface.PrefixLength) + `</tt:PrefixLength></tt:Manual>`)
+	}
+	b.WriteString(`<tt:DHCP>` + strconv.FormatBool(iface.DHCP) + `</tt:DHCP>`)
+	b.WriteString(`</tt:IPv4>`)
+	b.WriteString(`</tds:NetworkInterface>`)
+	b.WriteString(`</tds:SetNetworkInterfaces>`)
+
+	return b.String()
+}
+
+// applyNetwork는 요청한 설정을 카메라에 적용하고 cur에 반영한다.
+// 인터페이스 변경 후에는 카메라 주소가 바뀔 수 있으므로 마지막에 적용한다.
+// 접속 중인 주소가 바뀌면 새 주소를 반환한다.
+func (o *onvifDevice) applyNetwork(cur *defs.ControlNetwork, req *networkPatchReq) (string, error) {
+	var empty struct{}
+
+	if req.Hostname != nil {
+		err := o.sendDevice("SetHostname", setHostnameXML(*req.Hostname), &empty)
+		if err != nil {
+			return "", err
+		}
+		cur.Hostname = *req.Hostname
+		cur.HostnameFromDHCP = false
+	}
+
+	if req.changesDNS() {
+		if req.DNSFromDHCP != nil {
+			cur.DNSFromDHCP = *req.DNSFromDHCP
+		}
+		if req.DNSServers != nil {
+			cur.DNSServers = *req.DNSServers
+		}
+		if req.SearchDomains != nil {
+			cur.SearchDomains = *req.SearchDomains
+		}
+
+		err := o.sendDevice("SetDNS", setDNSXML(cur.DNSFromDHCP, cur.DNSServers, cur.SearchDomains), &empty)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if req.changesNTP() {
+		if req.NTPFromDHCP != nil {
+			cur.NTPFromDHCP = *req.NTPFromDHCP
+		}
+		if req.NTPServers != nil {
+			cur.NTPServers = *req.NTPServers
+		}
+
+		err := o.sendDevice("SetNTP", setNTPXML(cur.NTPFromDHCP, cur.NTPServers), &empty)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !req.changesInterface() {
+		return "", nil
+	}
+
+	if len(cur.Interfaces) == 0 {
+		return "", errors.New("camera has no network interfaces")
+	}
+
+	iface := &cur.Interfaces[0]
+	if req.Interface != "" {
+		iface = nil
+		for i := range cur.Interfaces {
+			if cur.Interfaces[i].Token == req.Interface {
+				iface = &cur.Interfaces[i]
+				break
+			}
+		}
+		if iface == nil {
+			return "", errors.New("No such network interface found: " + req.Interface)
+		}
+	}
+
+	oldAddress := iface.Address
+	oldDHCP := iface.DHCP
+
+	if req.DHCP != nil {
+		iface.DHCP = *req.DHCP
+	}
+	if req.Address != nil {
+		iface.Address = *req.Address
+		iface.DHCP = false
+	}
+	if req.PrefixLength != nil {
+		iface.PrefixLength = *req.PrefixLength
+	}
+
+	if !iface.DHCP && (iface.Address == "" || iface.PrefixLength == 0) {
+		return "", errors.New("Paramater `address` and `prefixLength` are required for a static address")
+	}
+
+	var reply struct {
+		Body struct {
+			SetNetworkInterfacesResponse struct {
+				RebootNeeded bool
+			}
+		}
+	}
+	err := o.sendDevice("SetNetworkInterfaces", setNetworkInterfaceXML(*iface), &reply)
+	if err != nil {
+		return "", err
+	}
+	cur.RebootNeeded = reply.Body.SetNetworkInterfacesResponse.RebootNeeded
+
+	// 다른 주소(NAT, 포트 포워딩)로 접속하는 경우에는 접속 정보를 바꾸지 않는다
+	if oldAddress != o.Url.Hostname() {
+		return "", nil
+	}
+
+	if iface.DHCP {
+		if !oldDHCP {
+			o.parent.Log(logger.Warn, "%s switched to DHCP, its new address is unknown", o.Conf.Name)
+		}
+		return "", nil
+	}
+
+	if iface.Address == oldAddress {
+		return "", nil
+	}
+
+	return iface.Address, nil
+}
+
+func replaceHost(hostport string, host string) string {
+	if _, port, err := net.SplitHostPort(hostport); err == nil {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// replaceURIHost는 raw의 호스트가 oldHost이면 newHost로 바꾼다.
+func replaceURIHost(raw string, oldHost string, newHost string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() != oldHost {
+		return raw
+	}
+
+	u.Host = replaceHost(u.Host, newHost)
+	return u.String()
+}
+
+// waitReachable은 카메라가 새 주소에서 ONVIF 요청에 응답할 때까지 기다린다.
+func (o *onvifDevice) waitReachable(ctx context.Context, hostport string) error {
+	ctx, cancel := context.WithTimeout(ctx, networkReconnectTimeout)
+	defer cancel()
+
+	for {
+		_, err := goonvif.NewDevice(goonvif.DeviceParams{
+			Xaddr:    hostport,
+			Username: o.Conf.Username,
+			Password: o.Conf.Password,
+			HttpClient: &http.Client{
+				Timeout: networkReconnectPeriod,
+				Transport: &digest.Transport{
+					Username: o.Conf.Username,
+					Password: o.Conf.Password,
+				},
+			},
+		})
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(networkReconnectPeriod):
+		case <-ctx.Done():
+			return fmt.Errorf("camera is not reachable at %s: %w", hostport, err)
+		}
+	}
+}
+
+// changeAddress는 카메라의 새 주소를 설정 파일의 소스에 기록한다.
+// 장치는 직접 바꾸지 않으며, core가 설정을 다시 읽으면서 새 주소로 장치와 Path를 다시 만든다.
+func (c *Control) changeAddress(ctx context.Context, o *onvifDevice, host string) error {
+	source := replaceURIHost(o.Conf.Source, o.Url.Hostname(), host)
+
+	// 카메라가 새 주소를 적용할 때까지 기다린다. 응답하지 않아도 이전 주소는 더 이상 유효하지 않으므로 기록한다
+	reachErr := o.waitReachable(ctx, replaceHost(o.Url.Host, host))
+
+	enc, err := json.Marshal(map[string]string{"source": source})
+	if err != nil {
+		return err
+	}
+
+	var patch conf.OptionalCamera
+	err = patch.UnmarshalJSON(enc)
+	if err != nil {
+		return err
+	}
+
+	err = c.Parent.ControlCamerasPatch(map[string]*conf.OptionalCamera{o.Conf.Name: &patch})
+	if err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	return reachErr
+}
+
+func (c *Control) getNetwork(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	ret, err := dev.getNetwork()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to get network configuration: "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ret)
+}
+
+func (c *Control) setNetwork(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	var req networkPatchReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	err = req.validate()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if !c.checkNotInMaintenance(ctx, []*onvifDevice{dev}) {
+		return
+	}
+
+	// 같은 카메라의 계정 교체와 동시에 실행되지 않도록 한다
+	dev.confMutex.Lock()
+	defer dev.confMutex.Unlock()
+
+	cur, err := dev.getNetwork()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to get network configuration: "+err.Error()))
+		return
+	}
+
+	address, err := dev.applyNetwork(cur, &req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to set network configuration: "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "network configuration of %s changed", name)
+
+	if address != "" {
+		c.Log(logger.Info, "address of %s changed to %s", name, address)
+
+		err = c.changeAddress(ctx.Request.Context(), dev, address)
+		if err != nil {
+			c.writeError(ctx, http.StatusBadGateway, errors.New("Network configuration applied, but "+err.Error()))
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, cur)
+}
@@ -0,0 +1,155 @@
+package control
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+)
+
+const getNetworkInterfacesResponseXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><tds:GetNetworkInterfacesResponse>
+<tds:NetworkInterfaces token="eth0">
+<tt:Enabled>true</tt:Enabled>
+<tt:Info><tt:Name>eth0</tt:Name><tt:HwAddress>44:19:b6:00:00:01</tt:HwAddress><tt:MTU>1500</tt:MTU></tt:Info>
+<tt:IPv4><tt:Enabled>true</tt:Enabled><tt:Config>
+<tt:Manual><tt:Address>192.168.1.64</tt:Address><tt:PrefixLength>24</tt:PrefixLength></tt:Manual>
+<tt:DHCP>false</tt:DHCP>
+</tt:Config></tt:IPv4>
+</tds:NetworkInterfaces>
+<tds:NetworkInterfaces token="wlan0">
+<tt:Enabled>true</tt:Enabled>
+<tt:Info><tt:Name>wlan0</tt:Name></tt:Info>
+<tt:IPv4><tt:Enabled>true</tt:Enabled><tt:Config>
+<tt:FromDHCP><tt:Address>10.0.0.12</tt:Address><tt:PrefixLength>16</tt:PrefixLength></tt:FromDHCP>
+<tt:DHCP>true</tt:DHCP>
+</tt:Config></tt:IPv4>
+</tds:NetworkInterfaces>
+</tds:GetNetworkInterfacesResponse></env:Body></env:Envelope>`
+
+func TestONVIFNetworkInterfaces(t *testing.T) {
+	var reply struct {
+		Body struct {
+			GetNetworkInterfacesResponse struct {
+				NetworkInterfaces []onvifNetworkInterface
+			}
+		}
+	}
+	err := xml.Unmarshal([]byte(getNetworkInterfacesResponseXML), &reply)
+	require.NoError(t, err)
+
+	var ifaces []defs.ControlNetworkInterface
+	for _, i := range reply.Body.GetNetworkInterfacesResponse.NetworkInterfaces {
+		ifaces = append(ifaces, i.toDefs())
+	}
+	require.Equal(t, []defs.ControlNetworkInterface{
+		{
+			Token:        "eth0",
+			Name:         "eth0",
+			HwAddress:    "44:19:b6:00:00:01",
+			Enabled:      true,
+			Address:      "192.168.1.64",
+			PrefixLength: 24,
+		},
+		{
+			Token:        "wlan0",
+			Name:         "wlan0",
+			Enabled:      true,
+			DHCP:         true,
+			Address:      "10.0.0.12",
+			PrefixLength: 16,
+		},
+	}, ifaces)
+
+	require.Equal(t, `<tds:SetNetworkInterfaces xmlns:tt="http://www.onvif.org/ver10/schema">`+
+		`<tds:InterfaceToken>eth0</tds:InterfaceToken>`+
+		`<tds:NetworkInterface><tt:Enabled>true</tt:Enabled>`+
+		`<tt:IPv4><tt:Enabled>true</tt:Enabled>`+
+		`<tt:Manual><tt:Address>192.168.1.64</tt:Address><tt:PrefixLength>24</tt:PrefixLength></tt:Manual>`+
+		`<tt:DHCP>false</tt:DHCP></tt:IPv4>`+
+		`</tds:NetworkInterface></tds:SetNetworkInterfaces>`, setNetworkInterfaceXML(ifaces[0]))
+}
+
+func TestNetworkRequestXML(t *testing.T) {
+	require.Equal(t, `<tds:SetDNS xmlns:tt="http://www.onvif.org/ver10/schema">`+
+		`<tds:FromDHCP>false</tds:FromDHCP>`+
+		`<tds:SearchDomain>example.com</tds:SearchDomain>`+
+		`<tds:DNSManual><tt:Type>IPv4</tt:Type><tt:IPv4Address>8.8.8.8</tt:IPv4Address></tds:DNSManual>`+
+		`<tds:DNSManual><tt:Type>IPv6</tt:Type><tt:IPv6Address>2001:4860::8888</tt:IPv6Address></tds:DNSManual>`+
+		`</tds:SetDNS>`,
+		setDNSXML(false, []string{"8.8.8.8", "2001:4860::8888"}, []string{"example.com"}))
+
+	require.Equal(t, `<tds:SetNTP xmlns:tt="http://www.onvif.org/ver10/schema">`+
+		`<tds:FromDHCP>false</tds:FromDHCP>`+
+		`<tds:NTPManual><tt:Type>DNS</tt:Type><tt:DNSname>pool.ntp.org</tt:DNSname></tds:NTPManual>`+
+		`<tds:NTPManual><tt:Type>IPv4</tt:Type><tt:IPv4Address>192.168.1.1</tt:IPv4Address></tds:NTPManual>`+
+		`</tds:SetNTP>`,
+		setNTPXML(false, []string{"pool.ntp.org", "192.168.1.1"}))
+
+	require.Equal(t, `<tds:SetNTP xmlns:tt="http://www.onvif.org/ver10/schema">`+
+		`<tds:FromDHCP>true</tds:FromDHCP></tds:SetNTP>`,
+		setNTPXML(true, []string{"pool.ntp.org"}))
+}
+
+func TestNetworkPatchReqValidate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	boolean := func(b bool) *bool { return &b }
+
+	require.NoError(t, (&networkPatchReq{Hostname: str("cam-01.site")}).validate())
+	require.Error(t, (&networkPatchReq{Hostname: str("-cam")}).validate())
+	require.Error(t, (&networkPatchReq{Address: str("2001:db8::1")}).validate())
+	require.Error(t, (&networkPatchReq{DNSServers: &[]string{"dns.example.com"}}).validate())
+	require.NoError(t, (&networkPatchReq{NTPServers: &[]string{"pool.ntp.org", "10.0.0.1"}}).validate())
+	require.Error(t, (&networkPatchReq{DHCP: boolean(true), Address: str("10.0.0.2")}).validate())
+}
+
+func TestReplaceURIHost(t *testing.T) {
+	require.Equal(t, "rtsp://10.0.0.2:554/Streaming/Channels/101",
+		replaceURIHost("rtsp://192.168.1.64:554/Streaming/Channels/101", "192.168.1.64", "10.0.0.2"))
+	require.Equal(t, "http://10.0.0.2/onvif/snapshot",
+		replaceURIHost("http://192.168.1.64/onvif/snapshot", "192.168.1.64", "10.0.0.2"))
+	require.Equal(t, "rtsp://172.16.0.1:8554/cam",
+		replaceURIHost("rtsp://172.16.0.1:8554/cam", "192.168.1.64", "10.0.0.2"))
+}
+
+func TestChangeAddress(t *testing.T) {
+	cam := newFakeCamera()
+	defer cam.srv.Close()
+
+	setTestDumpDirectory(t)
+
+	u, err := url.Parse(cam.srv.URL)
+	require.NoError(t, err)
+
+	// the camera is still configured with its old address
+	oldURL := *u
+	oldURL.Host = "192.0.2.10:" + u.Port()
+
+	parent := &credentialsTestParent{}
+	c := &Control{Parent: parent}
+	dev := &onvifDevice{
+		Conf: &conf.Path{
+			Name:   "cam1",
+			Source: "http://192.0.2.10:" + u.Port(),
+		},
+		Url:    oldURL,
+		parent: c,
+	}
+
+	err = c.changeAddress(context.Background(), dev, u.Hostname())
+	require.NoError(t, err)
+
+	// the device is left untouched, the new source is handed over to core
+	require.Equal(t, "192.0.2.10", dev.Url.Hostname())
+	require.Len(t, parent.patches, 1)
+	enc, err := parent.patches["cam1"].MarshalJSON()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"source":"http://`+u.Host+`"}`, string(enc))
+}
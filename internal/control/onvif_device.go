@@ -10,10 +10,14 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/icholy/digest"
 
@@ -29,7 +33,9 @@ import (
 	xsdonvif "github.com/IOTechSystems/onvif/xsd/onvif"
 )
 
-const directory = "onvif-test"
+// directory는 디버그용 응답 덤프를 저장하는 디렉토리이다. 테스트에서는 임시 디렉토리로 바꾼다.
+var directory = "onvif-test"
+
 const debug = true
 
 var filename = time.Now().Format("20060102_150405")
@@ -37,11 +43,24 @@ var filename = time.Now().Format("20060102_150405")
 type Profile struct {
 	xsdonvif.Profile
 	PathName string
+
+	// Media2로 조회한 프로파일인지 여부
+	Media2        bool
+	Encoding      string
+	AudioEncoding string
+	Width         int
+	Height        int
+
+	// 인코더에 설정된 멀티캐스트 주소
+	MulticastAddress string
 }
 
 type MediaUri struct {
 	xsdonvif.MediaUri
 	Profile *Profile
+
+	// ingestMode가 multicast일 때 멀티캐스트 패킷이 오지 않으면 사용할 유니캐스트 주소
+	Unicast *xsdonvif.MediaUri
 }
 
 // 채널 사용해서 Intializing이 Done 됐는지
@@ -50,6 +69,7 @@ type onvifDevice struct {
 	ctxCancel func()
 
 	Conf   *conf.Path
+	Camera *conf.Camera
 	Url    url.URL
 	dev    *goonvif.Device
 	parent *Control
@@ -62,38 +82,133 @@ type onvifDevice struct {
 	RecordingConfiguration *recording.RecordingConfiguration
 	SnapshotUri            *xsdonvif.MediaUri
 
+	// Media2 서비스 주소. 지원하지 않으면 빈 문자열
+	media2Url string
+
 	onvifUrl url.URL
 	client   *http.Client
 
 	ptzRoom *PTZRoom
+
+	// 계정, 주소처럼 설정 파일에 기록되는 카메라 설정의 변경을 직렬화한다
+	confMutex sync.Mutex
 }
 
 func (o *onvifDevice) isEnabledPTZ() bool {
 	return o.Capabilities == nil || o.Capabilities.PTZ.XAddr != ""
 }
 
-func (o *onvifDevice) initialize() error {
-	u, err := convertPathConfToUrl(*o.Conf)
+// streamRewriteRule returns the rule applied to the stream URIs of the camera.
+func (o *onvifDevice) streamRewriteRule() uriRewriteRule {
+	r := uriRewriteRule{
+		host:   o.Camera.URIRewriteHost,
+		ports:  o.Camera.URIRewritePorts,
+		scheme: o.Camera.URIRewriteScheme,
+		path:   o.Camera.URIRewritePath,
+		query:  o.Camera.URIRewriteQuery,
+	}
 
-	if err != nil {
-		return err
+	if o.Camera.URIRewriteCredentials && o.Conf.Username != "" {
+		r.user = url.UserPassword(o.Conf.Username, o.Conf.Password)
 	}
 
-	o.Url = *u
-	ctx, ctxCancel := context.WithCancel(context.Background())
-	o.ctx = ctx
-	o.ctxCancel = ctxCancel
+	// legacy: remoteDevice replaces the host with the one of the ONVIF service
+	if o.Conf.RemoteDevice {
+		if r.host == "" {
+			r.host = o.Url.Hostname()
+		}
+		if port, err := strconv.Atoi(strings.TrimPrefix(o.Conf.RTSPPort, ":")); err == nil {
+			r.port = port
+		}
+	}
 
-	// Add Digest Auth
-	transport := &digest.Transport{
+	return r
+}
+
+// apiRewriteRule returns the rule applied to the HTTP URIs reported by the camera
+// (snapshot, firmware upload, service addresses).
+// By default they are rewritten to the address of the ONVIF service.
+func (o *onvifDevice) apiRewriteRule() uriRewriteRule {
+	r := uriRewriteRule{
+		host:  o.Camera.URIRewriteHost,
+		ports: o.Camera.URIRewritePorts,
+	}
+
+	if r.host == "" {
+		r.host = o.Url.Hostname()
+	}
+	if port, err := strconv.Atoi(o.Url.Port()); err == nil {
+		r.port = port
+	}
+
+	return r
+}
+
+// StreamSource returns the RTSP URL that paths should read the given stream from.
+func (o *onvifDevice) StreamSource(u MediaUri) (string, error) {
+	vars := map[string]string{
+		"%camera": o.Camera.Name,
+	}
+	if u.Profile != nil {
+		vars["%profile"] = url.PathEscape(string(u.Profile.Name))
+		vars["%token"] = url.PathEscape(string(u.Profile.Token))
+		vars["%index"] = strconv.Itoa(o.profileIndex(u.Profile.Token))
+	}
+
+	return o.streamRewriteRule().apply(string(u.Uri), vars)
+}
+
+// rewriteAPIURI rewrites a HTTP URI reported by the camera.
+func (o *onvifDevice) rewriteAPIURI(raw string) (string, error) {
+	return o.apiRewriteRule().apply(raw, nil)
+}
+
+func (o *onvifDevice) profileIndex(token xsdonvif.ReferenceToken) int {
+	if o.Profiles != nil {
+		for i, p := range *o.Profiles {
+			if p.Token == token {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func (o *onvifDevice) channels() []defs.Channel {
+	ch := make([]defs.Channel, 0)
+	if o.Profiles == nil {
+		return ch
+	}
+
+	for _, profile := range *o.Profiles {
+		ch = append(ch, defs.Channel{
+			Name:  profile.PathName,
+			Token: string(profile.Token),
+			Resolution: defs.Resolution{
+				Width:  profile.Width,
+				Height: profile.Height,
+			},
+			Codec:      profile.Encoding,
+			AudioCodec: profile.AudioEncoding,
+		})
+	}
+	return ch
+}
+
+func (o *onvifDevice) isapiHostParams() isapi.HostParams {
+	return isapi.HostParams{
+		Host:     o.Url.Scheme + "://" + o.Url.Host,
 		Username: o.Conf.Username,
 		Password: o.Conf.Password,
 	}
+}
 
-	o.client = &http.Client{
-		Transport: &retryableTransport{
-			transport: transport,
-		},
+// connect은 현재 Conf의 계정으로 HTTP 클라이언트와 ONVIF 디바이스를 생성한다.
+func (o *onvifDevice) connect() error {
+	// Add Digest Auth
+	transport := &digest.Transport{
+		Username: o.Conf.Username,
+		Password: o.Conf.Password,
 	}
 
 	dev, err := goonvif.NewDevice(goonvif.DeviceParams{
@@ -109,7 +224,90 @@ func (o *onvifDevice) initialize() error {
 		return err
 	}
 
+	o.client = &http.Client{
+		Transport: &retryableTransport{
+			transport: transport,
+		},
+	}
 	o.dev = dev
+
+	return o.rewriteEndpoints()
+}
+
+// rewriteEndpoints는 카메라가 알려준 서비스 주소에 apiRewriteRule을 적용한다.
+// 라이브러리는 호스트만 접속 주소로 바꾸므로, 규칙이 있으면 원래 주소에서 다시 계산한다.
+func (o *onvifDevice) rewriteEndpoints() error {
+	if o.Camera == nil || (o.Camera.URIRewriteHost == "" && len(o.Camera.URIRewritePorts) == 0) {
+		return nil
+	}
+
+	type Service struct {
+		XMLName xml.Name
+		XAddr   string `xml:"XAddr"`
+	}
+
+	type Envelope struct {
+		Header struct{}
+		Body   struct {
+			GetCapabilitiesResponse struct {
+				Capabilities struct {
+					Services  []Service `xml:",any"`
+					Extension struct {
+						Services []Service `xml:",any"`
+					}
+				}
+			}
+		}
+	}
+
+	var reply Envelope
+	err := o.callMethodChecked(device.GetCapabilities{Category: []xsdonvif.CapabilityCategory{"All"}}, &reply)
+	if err != nil {
+		return err
+	}
+
+	caps := reply.Body.GetCapabilitiesResponse.Capabilities
+	endpoints := o.dev.GetServices()
+
+	for _, s := range append(caps.Services, caps.Extension.Services...) {
+		if s.XAddr == "" {
+			continue
+		}
+
+		u, err := o.rewriteAPIURI(s.XAddr)
+		if err != nil {
+			return err
+		}
+
+		key := strings.ToLower(s.XMLName.Local)
+		endpoints[key] = u
+
+		// 라이브러리와 같이 Media2는 Media와 같은 주소를 사용한다
+		if key == strings.ToLower(goonvif.MediaWebService) {
+			endpoints[strings.ToLower(goonvif.Media2WebService)] = u
+		}
+	}
+
+	return nil
+}
+
+func (o *onvifDevice) initialize() error {
+	u, err := convertPathConfToUrl(*o.Conf)
+
+	if err != nil {
+		return err
+	}
+
+	o.Url = *u
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	o.ctx = ctx
+	o.ctxCancel = ctxCancel
+
+	err = o.connect()
+	if err != nil {
+		return err
+	}
+
 	var innerWg sync.WaitGroup
 	innerWg.Add(1)
 	go func() {
@@ -127,48 +325,53 @@ func (o *onvifDevice) initialize() error {
 		}
 		o.Capabilities = &capResp.Capabilities
 
-		proResp, err := o.getProfiles()
-		if err != nil {
-			o.parent.Log(logger.Error, "Failed to get profiles of onvif device "+o.Conf.Name+": "+err.Error())
-		}
+		o.detectMedia2()
 
 		profiles := []Profile{}
+		for i, profile := range o.loadProfiles() {
+			cp := conf.CameraProfile{
+				Index:  i,
+				Token:  string(profile.Token),
+				Name:   string(profile.Name),
+				Width:  profile.Width,
+				Height: profile.Height,
+			}
 
-		for i, profile := range proResp.Profiles {
-			pathName := o.Conf.Name + "_" + fmt.Sprint(i)
-			if i == 0 {
-				pathName = o.Conf.Name
+			if !o.Camera.Profiles.Matches(cp) {
+				continue
 			}
-			profiles = append(profiles, Profile{
-				Profile:  profile,
-				PathName: pathName,
-			})
+
+			profile.PathName = o.Camera.ProfilePathName(cp)
+			profiles = append(profiles, profile)
+		}
+
+		if len(profiles) == 0 {
+			o.parent.Log(logger.Warn, "no profile of onvif device %s matches %v", o.Conf.Name, o.Camera.Profiles)
 		}
 
 		o.Profiles = &profiles
 
 		streamUris := []MediaUri{}
 		for _, profile := range *o.Profiles {
-			stResp, err := o.getStreamUri(&profile.Token)
-
+			uri, err := o.ingestStreamUri(profile)
 			if err != nil {
 				o.parent.Log(logger.Error, "Failed to get stream uri of onvif device "+o.Conf.Name+": "+err.Error())
 				continue
 			}
 
-			streamUris = append(streamUris, MediaUri{
-				MediaUri: stResp.MediaUri,
-				Profile:  &profile,
-			})
-
+			streamUris = append(streamUris, uri)
 		}
 		o.StreamUris = &streamUris
 
-		snResp, err := o.getSnapshotUri()
-		if err != nil {
-			o.parent.Log(logger.Error, "Failed to get snapshot uri of onvif device "+o.Conf.Name+": "+err.Error())
+		if len(profiles) != 0 {
+			snUri, err := o.profileSnapshotUri(profiles[0])
+			if err != nil {
+				o.parent.Log(logger.Error, "Failed to get snapshot uri of onvif device "+o.Conf.Name+": "+err.Error())
+			}
+			o.SnapshotUri = &snUri
+		} else {
+			o.SnapshotUri = &xsdonvif.MediaUri{}
 		}
-		o.SnapshotUri = &snResp.MediaUri
 
 		if o.isEnabledPTZ() {
 			p := PTZRoom{
@@ -192,6 +395,112 @@ func (o *onvifDevice) initialize() error {
 	return nil
 }
 
+// loadProfiles는 Media2를 지원하면 Media2로, 아니면 Media로 프로파일을 조회한다.
+// Media2로만 보이는 H.265 프로파일이 있으므로 Media2를 우선한다.
+func (o *onvifDevice) loadProfiles() []Profile {
+	if o.media2Url != "" {
+		m2Profiles, err := o.getMedia2Profiles()
+		if err == nil {
+			profiles := make([]Profile, 0, len(m2Profiles))
+			for _, p := range m2Profiles {
+				profile := Profile{
+					Profile: xsdonvif.Profile{
+						Token: xsdonvif.ReferenceToken(p.Token),
+						Name:  xsdonvif.Name(p.Name),
+					},
+					Media2: true,
+				}
+				if vs := p.Configurations.VideoSource; vs != nil {
+					profile.VideoSourceConfiguration = &xsdonvif.VideoSourceConfiguration{
+						ConfigurationEntity: xsdonvif.ConfigurationEntity{
+							Token: xsdonvif.ReferenceToken(vs.Token),
+						},
+					}
+				}
+				if ve := p.Configurations.VideoEncoder; ve != nil {
+					profile.Encoding = ve.Encoding
+					profile.Width = ve.Resolution.Width
+					profile.Height = ve.Resolution.Height
+					if ve.Multicast != nil {
+						profile.MulticastAddress = ve.Multicast.Address.String()
+					}
+				}
+				if ae := p.Configurations.AudioEncoder; ae != nil {
+					profile.AudioEncoding = ae.Encoding
+				}
+				profiles = append(profiles, profile)
+			}
+			return profiles
+		}
+
+		o.parent.Log(logger.Warn, "Failed to get Media2 profiles of onvif device %s, falling back to Media: %v", o.Conf.Name, err)
+		o.media2Url = ""
+	}
+
+	proResp, err := o.getProfiles()
+	if err != nil {
+		o.parent.Log(logger.Error, "Failed to get profiles of onvif device "+o.Conf.Name+": "+err.Error())
+		return nil
+	}
+
+	profiles := make([]Profile, 0, len(proResp.Profiles))
+	for _, p := range proResp.Profiles {
+		profile := Profile{Profile: p}
+		if ve := p.VideoEncoderConfiguration; ve != nil {
+			if ve.Encoding != nil {
+				profile.Encoding = string(*ve.Encoding)
+			}
+			if res := ve.Resolution; res != nil && res.Width != nil && res.Height != nil {
+				profile.Width = int(*res.Width)
+				profile.Height = int(*res.Height)
+			}
+			if mc := ve.Multicast; mc != nil && mc.Address != nil {
+				profile.MulticastAddress = string(mc.Address.IPv4Address)
+				if profile.MulticastAddress == "" {
+					profile.MulticastAddress = string(mc.Address.IPv6Address)
+				}
+			}
+		}
+		if ae := p.AudioEncoderConfiguration; ae != nil {
+			profile.AudioEncoding = string(ae.Encoding)
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
+
+func (o *onvifDevice) profileStreamUri(profile Profile, protocol conf.CameraStreamProtocol) (xsdonvif.MediaUri, error) {
+	if profile.Media2 {
+		uri, err := o.getMedia2StreamUri(string(profile.Token), protocol)
+		if err != nil {
+			return xsdonvif.MediaUri{}, err
+		}
+		return xsdonvif.MediaUri{Uri: xsd.AnyURI(uri)}, nil
+	}
+
+	stResp, err := o.getStreamUri(&profile.Token, protocol)
+	if err != nil {
+		return xsdonvif.MediaUri{}, err
+	}
+	return stResp.MediaUri, nil
+}
+
+func (o *onvifDevice) profileSnapshotUri(profile Profile) (xsdonvif.MediaUri, error) {
+	if profile.Media2 {
+		uri, err := o.getMedia2SnapshotUri(string(profile.Token))
+		if err != nil {
+			return xsdonvif.MediaUri{}, err
+		}
+		return xsdonvif.MediaUri{Uri: xsd.AnyURI(uri)}, nil
+	}
+
+	snResp, err := o.getSnapshotUri()
+	if err != nil {
+		return xsdonvif.MediaUri{}, err
+	}
+	return snResp.MediaUri, nil
+}
+
 func (o *onvifDevice) test(tag string, err error, t interface{}) {
 	var data []byte
 	filepath := directory + "/" + filename + "_" + o.Conf.Name + ".json"
@@ -332,7 +641,10 @@ func (o *onvifDevice) getCapabilities() (*device.GetCapabilitiesResponse, error)
 	return &reply.Body.GetCapabilitiesResponse, nil
 }
 
-func (o *onvifDevice) getStreamUri(profileToken *xsdonvif.ReferenceToken) (*media.GetStreamUriResponse, error) {
+func (o *onvifDevice) getStreamUri(
+	profileToken *xsdonvif.ReferenceToken,
+	protocol conf.CameraStreamProtocol,
+) (*media.GetStreamUriResponse, error) {
 	type Envelope struct {
 		Header struct{}
 		Body   struct {
@@ -343,6 +655,7 @@ func (o *onvifDevice) getStreamUri(profileToken *xsdonvif.ReferenceToken) (*medi
 	var reply Envelope
 	err := o.callMethod(
 		media.GetStreamUri{
+			StreamSetup:  mediaStreamSetup(protocol),
 			ProfileToken: profileToken,
 		},
 		&reply,
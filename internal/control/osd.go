@@ -0,0 +1,794 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+const (
+	mediaNamespace  = "http://www.onvif.org/ver10/media/wsdl"
+	schemaNamespace = "http://www.onvif.org/ver10/schema"
+
+	osdSourceONVIF = "onvif"
+	osdSourceISAPI = "isapi"
+
+	// ISAPI 오버레이는 고정된 슬롯이므로 토큰을 만들어 사용한다
+	isapiOSDTextPrefix = "text-"
+	isapiOSDDateTime   = "dateTime"
+
+	// 템플릿으로 관리하는 ISAPI 텍스트 오버레이
+	isapiManagedTextOverlay = 1
+)
+
+type osdReq struct {
+	Type     defs.ControlOSDType      `json:"type"`
+	Text     string                   `json:"text"`
+	Position *defs.ControlOSDPosition `json:"position"`
+}
+
+type osdApplyReq struct {
+	// 비어있으면 controlOSDTemplate을 사용한다
+	Template string `json:"template"`
+	// 비어있으면 모든 카메라에 적용한다
+	Cameras []string `json:"cameras"`
+}
+
+type onvifOSDPos struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+type onvifOSD struct {
+	Token                         string `xml:"token,attr"`
+	VideoSourceConfigurationToken string
+	Type                          string
+	Position                      struct {
+		Type string
+		Pos  *onvifOSDPos
+	}
+	TextString *struct {
+		Type       string
+		DateFormat string
+		TimeFormat string
+		PlainText  string
+	}
+}
+
+func (osd *onvifOSD) toDefs() (defs.ControlOSD, bool) {
+	if osd.Type != "Text" || osd.TextString == nil {
+		return defs.ControlOSD{}, false
+	}
+
+	ret := defs.ControlOSD{
+		Token: osd.Token,
+		Type:  defs.ControlOSDText,
+	}
+
+	if osd.TextString.Type == "Plain" {
+		ret.Text = osd.TextString.PlainText
+	} else {
+		ret.Type = defs.ControlOSDDateTime
+	}
+
+	if osd.Position.Pos != nil {
+		ret.Position = &defs.ControlOSDPosition{
+			X: osd.Position.Pos.X,
+			Y: osd.Position.Pos.Y,
+		}
+	}
+
+	return ret, true
+}
+
+func (osd *onvifOSD) xml() string {
+	var b strings.Builder
+
+	b.WriteString(`<trt:OSD token="` + escapeXML(osd.Token) + `">`)
+	b.WriteString(`<tt:VideoSourceConfigurationToken>` + escapeXML(osd.VideoSourceConfigurationToken) +
+		`</tt:VideoSourceConfigurationToken>`)
+	b.WriteString(`<tt:Type>Text</tt:Type>`)
+
+	b.WriteString(`<tt:Position><tt:Type>` + escapeXML(osd.Position.Type) + `</tt:Type>`)
+	if osd.Position.Pos != nil {
+		b.WriteString(fmt.Sprintf(`<tt:Pos x="%g" y="%g"/>`, osd.Position.Pos.X, osd.Position.Pos.Y))
+	}
+	b.WriteString(`</tt:Position>`)
+
+	b.WriteString(`<tt:TextString><tt:Type>` + escapeXML(osd.TextString.Type) + `</tt:Type>`)
+	if osd.TextString.DateFormat != "" {
+		b.WriteString(`<tt:DateFormat>` + escapeXML(osd.TextString.DateFormat) + `</tt:DateFormat>`)
+	}
+	if osd.TextString.TimeFormat != "" {
+		b.WriteString(`<tt:TimeFormat>` + escapeXML(osd.TextString.TimeFormat) + `</tt:TimeFormat>`)
+	}
+	if osd.TextString.Type == "Plain" {
+		b.WriteString(`<tt:PlainText>` + escapeXML(osd.TextString.PlainText) + `</tt:PlainText>`)
+	}
+	b.WriteString(`</tt:TextString>`)
+
+	b.WriteString(`</trt:OSD>`)
+
+	return b.String()
+}
+
+func (osd *onvifOSD) apply(req osdReq) {
+	if req.Position != nil {
+		osd.Position.Type = "Custom"
+		osd.Position.Pos = &onvifOSDPos{X: req.Position.X, Y: req.Position.Y}
+	} else if osd.Position.Type == "" {
+		osd.Position.Type = "UpperLeft"
+	}
+
+	if osd.TextString == nil {
+		osd.TextString = &struct {
+			Type       string
+			DateFormat string
+			TimeFormat string
+			PlainText  string
+		}{}
+	}
+
+	if req.Type == defs.ControlOSDDateTime {
+		osd.TextString.Type = "DateAndTime"
+		osd.TextString.PlainText = ""
+	} else {
+		osd.TextString.Type = "Plain"
+		osd.TextString.PlainText = req.Text
+	}
+}
+
+func (o *onvifDevice) sendMedia(method string, body string, reply interface{}) error {
+	endpoint := o.dev.GetEndpoint("media")
+	if endpoint == "" {
+		return errors.New("Media service is not supported")
+	}
+
+	return o.sendSoapChecked(endpoint, method, body, reply)
+}
+
+func (o *onvifDevice) getONVIFOSDs() ([]onvifOSD, error) {
+	var reply struct {
+		Body struct {
+			GetOSDsResponse struct {
+				OSDs []onvifOSD
+			}
+		}
+	}
+
+	err := o.sendMedia("GetOSDs",
+		`<trt:GetOSDs xmlns:trt="`+mediaNamespace+`"/>`,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Body.GetOSDsResponse.OSDs, nil
+}
+
+// videoSourceConfigurationToken은 OSD를 만들 비디오 소스 설정의 토큰을 찾는다.
+func (o *onvifDevice) videoSourceConfigurationToken() (string, error) {
+	if o.Profiles != nil {
+		for _, p := range *o.Profiles {
+			if p.VideoSourceConfiguration != nil {
+				return string(p.VideoSourceConfiguration.Token), nil
+			}
+		}
+	}
+
+	// Media2로 조회한 프로파일에는 설정이 없다
+	var reply struct {
+		Body struct {
+			GetVideoSourceConfigurationsResponse struct {
+				Configurations []struct {
+					Token string `xml:"token,attr"`
+				}
+			}
+		}
+	}
+
+	err := o.sendMedia("GetVideoSourceConfigurations",
+		`<trt:GetVideoSourceConfigurations xmlns:trt="`+mediaNamespace+`"/>`,
+		&reply)
+	if err != nil {
+		return "", err
+	}
+
+	confs := reply.Body.GetVideoSourceConfigurationsResponse.Configurations
+	if len(confs) == 0 {
+		return "", errors.New("no video source configuration found")
+	}
+
+	return confs[0].Token, nil
+}
+
+func (o *onvifDevice) createONVIFOSD(osd onvifOSD) (string, error) {
+	var reply struct {
+		Body struct {
+			CreateOSDResponse struct {
+				OSDToken string
+			}
+		}
+	}
+
+	err := o.sendMedia("CreateOSD",
+		`<trt:CreateOSD xmlns:trt="`+mediaNamespace+`" xmlns:tt="`+schemaNamespace+`">`+osd.xml()+`</trt:CreateOSD>`,
+		&reply)
+	if err != nil {
+		return "", err
+	}
+
+	return reply.Body.CreateOSDResponse.OSDToken, nil
+}
+
+func (o *onvifDevice) setONVIFOSD(osd onvifOSD) error {
+	var reply struct{}
+
+	return o.sendMedia("SetOSD",
+		`<trt:SetOSD xmlns:trt="`+mediaNamespace+`" xmlns:tt="`+schemaNamespace+`">`+osd.xml()+`</trt:SetOSD>`,
+		&reply)
+}
+
+func (o *onvifDevice) deleteONVIFOSD(token string) error {
+	var reply struct{}
+
+	return o.sendMedia("DeleteOSD",
+		`<trt:DeleteOSD xmlns:trt="`+mediaNamespace+`"><trt:OSDToken>`+escapeXML(token)+`</trt:OSDToken></trt:DeleteOSD>`,
+		&reply)
+}
+
+func (o *onvifDevice) isapiChannelParams() isapi.ChannelParams {
+	return isapi.ChannelParams{
+		HostParams: o.isapiHostParams(),
+		Channel:    1,
+	}
+}
+
+// ISAPI 좌표는 normalizedScreenSize 기준이고 원점이 왼쪽 아래이므로 [-1, 1]로 바꾼다.
+func isapiToOSDPosition(size *isapi.NormalizedScreenSize, x int, y int) *defs.ControlOSDPosition {
+	if size == nil || size.NormalizedScreenWidth <= 0 || size.NormalizedScreenHeight <= 0 {
+		return nil
+	}
+
+	return &defs.ControlOSDPosition{
+		X: float64(x)*2/float64(size.NormalizedScreenWidth) - 1,
+		Y: float64(y)*2/float64(size.NormalizedScreenHeight) - 1,
+	}
+}
+
+func osdToISAPIPosition(size *isapi.NormalizedScreenSize, pos *defs.ControlOSDPosition) (int, int, bool) {
+	if size == nil || pos == nil {
+		return 0, 0, false
+	}
+
+	return int((pos.X + 1) / 2 * float64(size.NormalizedScreenWidth)),
+		int((pos.Y + 1) / 2 * float64(size.NormalizedScreenHeight)), true
+}
+
+func (o *onvifDevice) getISAPIOSDs() ([]defs.ControlOSD, *isapi.VideoOverlay, error) {
+	overlay, err := isapi.GetVideoOverlay(o.isapiChannelParams())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := []defs.ControlOSD{}
+
+	for _, t := range overlay.TextOverlayList {
+		if !t.Enabled {
+			continue
+		}
+		items = append(items, defs.ControlOSD{
+			Token:    isapiOSDTextPrefix + strconv.Itoa(t.Id),
+			Type:     defs.ControlOSDText,
+			Text:     t.DisplayText,
+			Position: isapiToOSDPosition(overlay.NormalizedScreenSize, t.PositionX, t.PositionY),
+		})
+	}
+
+	if dt := overlay.DateTimeOverlay; dt != nil && dt.Enabled {
+		items = append(items, defs.ControlOSD{
+			Token:    isapiOSDDateTime,
+			Type:     defs.ControlOSDDateTime,
+			Position: isapiToOSDPosition(overlay.NormalizedScreenSize, dt.PositionX, dt.PositionY),
+		})
+	}
+
+	return items, overlay, nil
+}
+
+func (o *onvifDevice) setVideoOverlay(overlay *isapi.VideoOverlay) error {
+	status, err := isapi.SetVideoOverlay(isapi.VideoOverlayParams{
+		ChannelParams: o.isapiChannelParams(),
+		VideoOverlay:  *overlay,
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkResponseStatus(status)
+}
+
+// setISAPIOSD는 token에 해당하는 ISAPI 오버레이를 변경한다. enabled가 false이면 끈다.
+func (o *onvifDevice) setISAPIOSD(overlay *isapi.VideoOverlay, token string, req osdReq, enabled bool) error {
+	if token == isapiOSDDateTime {
+		if overlay.DateTimeOverlay == nil {
+			return errors.New("date and time overlay is not supported")
+		}
+
+		overlay.DateTimeOverlay.Enabled = enabled
+		if x, y, ok := osdToISAPIPosition(overlay.NormalizedScreenSize, req.Position); ok {
+			overlay.DateTimeOverlay.PositionX = x
+			overlay.DateTimeOverlay.PositionY = y
+		}
+
+		return o.setVideoOverlay(overlay)
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(token, isapiOSDTextPrefix))
+	if err != nil || !strings.HasPrefix(token, isapiOSDTextPrefix) {
+		return fmt.Errorf("invalid OSD token: %s", token)
+	}
+
+	t := overlay.TextOverlay(id)
+	if t == nil {
+		return fmt.Errorf("OSD not found: %s", token)
+	}
+
+	t.Enabled = enabled
+	t.DisplayText = req.Text
+	if x, y, ok := osdToISAPIPosition(overlay.NormalizedScreenSize, req.Position); ok {
+		t.PositionX = x
+		t.PositionY = y
+	}
+
+	return o.setVideoOverlay(overlay)
+}
+
+// listOSDs는 ONVIF로 OSD를 조회하고, 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) listOSDs() (*defs.ControlOSDList, error) {
+	osds, err := o.getONVIFOSDs()
+	if err == nil {
+		ret := &defs.ControlOSDList{
+			Camera: o.Conf.Name,
+			Source: osdSourceONVIF,
+			Items:  []defs.ControlOSD{},
+		}
+		for _, osd := range osds {
+			if item, ok := osd.toDefs(); ok {
+				ret.Items = append(ret.Items, item)
+			}
+		}
+		return ret, nil
+	}
+
+	o.parent.Log(logger.Debug, "ONVIF OSD of %s is not available (%v), using ISAPI", o.Conf.Name, err)
+
+	items, _, err2 := o.getISAPIOSDs()
+	if err2 != nil {
+		return nil, fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return &defs.ControlOSDList{
+		Camera: o.Conf.Name,
+		Source: osdSourceISAPI,
+		Items:  items,
+	}, nil
+}
+
+// createOSD는 OSD를 만들고 토큰을 반환한다. ONVIF가 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) createOSD(req osdReq) (string, error) {
+	token, err := func() (string, error) {
+		vsc, err := o.videoSourceConfigurationToken()
+		if err != nil {
+			return "", err
+		}
+
+		osd := onvifOSD{
+			VideoSourceConfigurationToken: vsc,
+			Type:                          "Text",
+		}
+		osd.apply(req)
+
+		return o.createONVIFOSD(osd)
+	}()
+	if err == nil {
+		return token, nil
+	}
+
+	_, overlay, err2 := o.getISAPIOSDs()
+	if err2 != nil {
+		return "", fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	if req.Type == defs.ControlOSDDateTime {
+		token = isapiOSDDateTime
+	} else {
+		// 꺼져 있는 슬롯을 사용한다
+		for _, t := range overlay.TextOverlayList {
+			if !t.Enabled {
+				token = isapiOSDTextPrefix + strconv.Itoa(t.Id)
+				break
+			}
+		}
+		if token == "" {
+			return "", fmt.Errorf("ONVIF: %v, ISAPI: no free text overlay", err)
+		}
+	}
+
+	err2 = o.setISAPIOSD(overlay, token, req, true)
+	if err2 != nil {
+		return "", fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return token, nil
+}
+
+// setOSD는 OSD를 변경한다. ONVIF가 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) setOSD(token string, req osdReq) error {
+	err := func() error {
+		osds, err := o.getONVIFOSDs()
+		if err != nil {
+			return err
+		}
+
+		for _, osd := range osds {
+			if osd.Token == token {
+				osd.apply(req)
+				return o.setONVIFOSD(osd)
+			}
+		}
+
+		return fmt.Errorf("OSD not found: %s", token)
+	}()
+	if err == nil {
+		return nil
+	}
+
+	_, overlay, err2 := o.getISAPIOSDs()
+	if err2 == nil {
+		err2 = o.setISAPIOSD(overlay, token, req, true)
+	}
+	if err2 != nil {
+		return fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return nil
+}
+
+// deleteOSD는 OSD를 지운다. ISAPI는 슬롯이 고정되어 있으므로 끄기만 한다.
+func (o *onvifDevice) deleteOSD(token string) error {
+	err := o.deleteONVIFOSD(token)
+	if err == nil {
+		return nil
+	}
+
+	_, overlay, err2 := o.getISAPIOSDs()
+	if err2 == nil {
+		err2 = o.setISAPIOSD(overlay, token, osdReq{}, false)
+	}
+	if err2 != nil {
+		return fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return nil
+}
+
+// managedOSD는 템플릿으로 관리하는 OSD를 찾는다.
+// ONVIF는 첫 번째 텍스트 OSD, ISAPI는 1번 텍스트 오버레이이다.
+func (o *onvifDevice) managedOSD() (*defs.ControlOSD, error) {
+	list, err := o.listOSDs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range list.Items {
+		if item.Type != defs.ControlOSDText {
+			continue
+		}
+		if list.Source == osdSourceISAPI && item.Token != isapiOSDTextPrefix+strconv.Itoa(isapiManagedTextOverlay) {
+			continue
+		}
+		return &item, nil
+	}
+
+	return nil, nil
+}
+
+func (c *Control) osdText(template string, dev *onvifDevice) string {
+	return strings.NewReplacer(
+		"%site", c.Conf.ControlOSDSite,
+		"%camera", dev.Conf.Name,
+	).Replace(template)
+}
+
+// checkOSDDrift는 카메라의 OSD가 템플릿과 다른지 확인한다.
+func (c *Control) checkOSDDrift(dev *onvifDevice, template string) defs.ControlOSDDrift {
+	ret := defs.ControlOSDDrift{
+		Camera:    dev.Conf.Name,
+		Expected:  c.osdText(template, dev),
+		CheckedAt: time.Now(),
+	}
+
+	osd, err := dev.managedOSD()
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+
+	if osd != nil {
+		ret.Token = osd.Token
+		ret.Actual = osd.Text
+	}
+	ret.Drift = ret.Actual != ret.Expected
+
+	return ret
+}
+
+// applyOSDTemplate은 템플릿을 카메라의 OSD에 적용한다. 관리하는 OSD가 없으면 만든다.
+func (c *Control) applyOSDTemplate(dev *onvifDevice, template string) defs.ControlOSDDrift {
+	ret := c.checkOSDDrift(dev, template)
+	if ret.Error != "" || !ret.Drift {
+		return ret
+	}
+
+	req := osdReq{
+		Type: defs.ControlOSDText,
+		Text: ret.Expected,
+	}
+
+	var err error
+	if ret.Token == "" {
+		ret.Token, err = dev.createOSD(req)
+	} else {
+		err = dev.setOSD(ret.Token, req)
+	}
+	if err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+
+	c.Log(logger.Info, "OSD of %s set to '%s' (was '%s')", dev.Conf.Name, ret.Expected, ret.Actual)
+
+	ret.Actual = ret.Expected
+	ret.Drift = false
+
+	return ret
+}
+
+// runOSDDriftCheck는 주기적으로 OSD가 템플릿과 다른지 확인하고 로그를 남긴다.
+func (c *Control) runOSDDriftCheck() {
+	defer c.wg.Done()
+
+	t := time.NewTicker(time.Duration(c.Conf.ControlOSDCheckPeriod))
+	defer t.Stop()
+
+	// 카메라별 마지막 drift 여부
+	drifted := make(map[string]bool)
+
+	for {
+		select {
+		case <-t.C:
+			for _, dev := range c.OnvifDevices {
+				res := c.checkOSDDrift(dev, c.Conf.ControlOSDTemplate)
+				if res.Error != "" {
+					c.Log(logger.Debug, "failed to check OSD of %s: %s", dev.Conf.Name, res.Error)
+					continue
+				}
+
+				if res.Drift && !drifted[dev.Conf.Name] {
+					c.Log(logger.Warn, "OSD of %s was changed on the camera: expected '%s', found '%s'",
+						dev.Conf.Name, res.Expected, res.Actual)
+				}
+				drifted[dev.Conf.Name] = res.Drift
+			}
+
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func validateOSDReq(req *osdReq) error {
+	if req.Type == "" {
+		req.Type = defs.ControlOSDText
+	}
+
+	if req.Type != defs.ControlOSDText && req.Type != defs.ControlOSDDateTime {
+		return errors.New("Paramater `type` must be `text` or `dateTime`")
+	}
+
+	if req.Type == defs.ControlOSDText && req.Text == "" {
+		return errors.New("Paramater `text` is required")
+	}
+
+	if req.Position != nil && (req.Position.X < -1 || req.Position.X > 1 ||
+		req.Position.Y < -1 || req.Position.Y > 1) {
+		return errors.New("Paramater `position` must be between -1 and 1")
+	}
+
+	return nil
+}
+
+func (c *Control) getOSDs(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	ret, err := dev.listOSDs()
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to get OSDs: "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ret)
+}
+
+func (c *Control) createOSD(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	var req osdReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	err = validateOSDReq(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	token, err := dev.createOSD(req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to create OSD: "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "OSD %s of %s created", token, name)
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"token": token,
+	})
+}
+
+func (c *Control) setOSD(ctx *gin.Context) {
+	name := ctx.Param("name")
+	token := ctx.Param("token")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	var req osdReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	err = validateOSDReq(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = dev.setOSD(token, req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to set OSD: "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "OSD %s of %s updated", token, name)
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *Control) deleteOSD(ctx *gin.Context) {
+	name := ctx.Param("name")
+	token := ctx.Param("token")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	err := dev.deleteOSD(token)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to delete OSD: "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "OSD %s of %s deleted", token, name)
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *Control) osdCameras(names []string) ([]*onvifDevice, error) {
+	if len(names) == 0 {
+		return c.OnvifDevices, nil
+	}
+
+	devs := make([]*onvifDevice, 0, len(names))
+	for _, name := range names {
+		dev := c.getOnvifDevice(name)
+		if dev == nil {
+			return nil, errors.New("No such camera found: " + name)
+		}
+		devs = append(devs, dev)
+	}
+
+	return devs, nil
+}
+
+func (c *Control) applyOSD(ctx *gin.Context) {
+	var req osdApplyReq
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	if req.Template == "" {
+		req.Template = c.Conf.ControlOSDTemplate
+	}
+	if req.Template == "" {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `template` is required"))
+		return
+	}
+
+	devs, err := c.osdCameras(req.Cameras)
+	if err != nil {
+		c.writeError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	items := make([]defs.ControlOSDDrift, len(devs))
+	for i, dev := range devs {
+		items[i] = c.applyOSDTemplate(dev, req.Template)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items": items,
+	})
+}
+
+func (c *Control) getOSDDrift(ctx *gin.Context) {
+	template := ctx.DefaultQuery("template", c.Conf.ControlOSDTemplate)
+	if template == "" {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Paramater `template` is required"))
+		return
+	}
+
+	items := make([]defs.ControlOSDDrift, len(c.OnvifDevices))
+	for i, dev := range c.OnvifDevices {
+		items[i] = c.checkOSDDrift(dev, template)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items": items,
+	})
+}
@@ -0,0 +1,105 @@
+package control
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+)
+
+const getOSDsResponseXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><trt:GetOSDsResponse>
+<trt:OSDs token="OSD_1">
+<tt:VideoSourceConfigurationToken>VideoSourceToken</tt:VideoSourceConfigurationToken>
+<tt:Type>Text</tt:Type>
+<tt:Position><tt:Type>Custom</tt:Type><tt:Pos x="-0.9" y="0.8"/></tt:Position>
+<tt:TextString><tt:Type>Plain</tt:Type><tt:PlainText>Site A - entrance</tt:PlainText></tt:TextString>
+</trt:OSDs>
+<trt:OSDs token="OSD_2">
+<tt:VideoSourceConfigurationToken>VideoSourceToken</tt:VideoSourceConfigurationToken>
+<tt:Type>Text</tt:Type>
+<tt:Position><tt:Type>LowerLeft</tt:Type></tt:Position>
+<tt:TextString><tt:Type>DateAndTime</tt:Type><tt:DateFormat>yyyy-MM-dd</tt:DateFormat>` +
+	`<tt:TimeFormat>HH:mm:ss</tt:TimeFormat></tt:TextString>
+</trt:OSDs>
+<trt:OSDs token="OSD_3">
+<tt:VideoSourceConfigurationToken>VideoSourceToken</tt:VideoSourceConfigurationToken>
+<tt:Type>Image</tt:Type>
+<tt:Position><tt:Type>UpperRight</tt:Type></tt:Position>
+</trt:OSDs>
+</trt:GetOSDsResponse></env:Body></env:Envelope>`
+
+func TestONVIFOSD(t *testing.T) {
+	var reply struct {
+		Body struct {
+			GetOSDsResponse struct {
+				OSDs []onvifOSD
+			}
+		}
+	}
+	err := xml.Unmarshal([]byte(getOSDsResponseXML), &reply)
+	require.NoError(t, err)
+
+	osds := reply.Body.GetOSDsResponse.OSDs
+	require.Len(t, osds, 3)
+
+	var items []defs.ControlOSD
+	for _, osd := range osds {
+		if item, ok := osd.toDefs(); ok {
+			items = append(items, item)
+		}
+	}
+	require.Equal(t, []defs.ControlOSD{
+		{
+			Token:    "OSD_1",
+			Type:     defs.ControlOSDText,
+			Text:     "Site A - entrance",
+			Position: &defs.ControlOSDPosition{X: -0.9, Y: 0.8},
+		},
+		{
+			Token: "OSD_2",
+			Type:  defs.ControlOSDDateTime,
+		},
+	}, items)
+
+	osd := osds[0]
+	osd.apply(osdReq{Type: defs.ControlOSDText, Text: "Site <B>"})
+	require.Equal(t, `<trt:OSD token="OSD_1">`+
+		`<tt:VideoSourceConfigurationToken>VideoSourceToken</tt:VideoSourceConfigurationToken>`+
+		`<tt:Type>Text</tt:Type>`+
+		`<tt:Position><tt:Type>Custom</tt:Type><tt:Pos x="-0.9" y="0.8"/></tt:Position>`+
+		`<tt:TextString><tt:Type>Plain</tt:Type><tt:PlainText>Site &lt;B&gt;</tt:PlainText></tt:TextString>`+
+		`</trt:OSD>`, osd.xml())
+
+	osd = osds[1]
+	osd.apply(osdReq{Type: defs.ControlOSDDateTime})
+	require.Equal(t, `<trt:OSD token="OSD_2">`+
+		`<tt:VideoSourceConfigurationToken>VideoSourceToken</tt:VideoSourceConfigurationToken>`+
+		`<tt:Type>Text</tt:Type>`+
+		`<tt:Position><tt:Type>LowerLeft</tt:Type></tt:Position>`+
+		`<tt:TextString><tt:Type>DateAndTime</tt:Type><tt:DateFormat>yyyy-MM-dd</tt:DateFormat>`+
+		`<tt:TimeFormat>HH:mm:ss</tt:TimeFormat></tt:TextString>`+
+		`</trt:OSD>`, osd.xml())
+}
+
+func TestISAPIOSDPosition(t *testing.T) {
+	size := &isapi.NormalizedScreenSize{
+		NormalizedScreenWidth:  704,
+		NormalizedScreenHeight: 576,
+	}
+
+	pos := isapiToOSDPosition(size, 176, 432)
+	require.Equal(t, &defs.ControlOSDPosition{X: -0.5, Y: 0.5}, pos)
+
+	x, y, ok := osdToISAPIPosition(size, pos)
+	require.True(t, ok)
+	require.Equal(t, 176, x)
+	require.Equal(t, 432, y)
+
+	require.Nil(t, isapiToOSDPosition(nil, 0, 0))
+}
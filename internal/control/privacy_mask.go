@@ -0,0 +1,513 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/ctenhank/mediamtx/internal/logger"
+)
+
+const (
+	maskSourceONVIF = "onvif"
+	maskSourceISAPI = "isapi"
+
+	isapiMaskRegionPrefix = "region-"
+)
+
+type privacyMaskReq struct {
+	Enabled *bool               `json:"enabled"`
+	Polygon []defs.ControlPoint `json:"polygon"`
+}
+
+type onvifMaskPoint struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+type onvifMask struct {
+	Token              string `xml:"token,attr"`
+	ConfigurationToken string
+	Polygon            struct {
+		Point []onvifMaskPoint
+	}
+	Type    string
+	Enabled bool
+}
+
+// 좌표 변환. API는 프로파일 해상도의 픽셀 좌표(원점 왼쪽 위)를 사용하고,
+// ONVIF는 [-1, 1] (y는 위쪽), ISAPI는 normalizedScreenSize 기준(원점 왼쪽 아래)을 사용한다.
+
+func pointToONVIF(p defs.ControlPoint, res defs.Resolution) onvifMaskPoint {
+	return onvifMaskPoint{
+		X: float64(p.X)*2/float64(res.Width) - 1,
+		Y: 1 - float64(p.Y)*2/float64(res.Height),
+	}
+}
+
+func pointFromONVIF(p onvifMaskPoint, res defs.Resolution) defs.ControlPoint {
+	return defs.ControlPoint{
+		X: int(math.Round((p.X + 1) / 2 * float64(res.Width))),
+		Y: int(math.Round((1 - p.Y) / 2 * float64(res.Height))),
+	}
+}
+
+func pointToISAPI(p defs.ControlPoint, res defs.Resolution, size isapi.NormalizedScreenSize) isapi.Coordinates {
+	return isapi.Coordinates{
+		PositionX: int(math.Round(float64(p.X) / float64(res.Width) * float64(size.NormalizedScreenWidth))),
+		PositionY: int(math.Round((1 - float64(p.Y)/float64(res.Height)) * float64(size.NormalizedScreenHeight))),
+	}
+}
+
+func pointFromISAPI(c isapi.Coordinates, res defs.Resolution, size isapi.NormalizedScreenSize) defs.ControlPoint {
+	return defs.ControlPoint{
+		X: int(math.Round(float64(c.PositionX) / float64(size.NormalizedScreenWidth) * float64(res.Width))),
+		Y: int(math.Round((1 - float64(c.PositionY)/float64(size.NormalizedScreenHeight)) * float64(res.Height))),
+	}
+}
+
+func (m *onvifMask) toDefs(res defs.Resolution) defs.ControlPrivacyMask {
+	ret := defs.ControlPrivacyMask{
+		Token:   m.Token,
+		Enabled: m.Enabled,
+		Polygon: []defs.ControlPoint{},
+	}
+	for _, p := range m.Polygon.Point {
+		ret.Polygon = append(ret.Polygon, pointFromONVIF(p, res))
+	}
+	return ret
+}
+
+func (m *onvifMask) xml() string {
+	var b strings.Builder
+
+	b.WriteString(`<tr2:Mask>`)
+	b.WriteString(`<tt:ConfigurationToken>` + escapeXML(m.ConfigurationToken) + `</tt:ConfigurationToken>`)
+	b.WriteString(`<tt:Polygon>`)
+	for _, p := range m.Polygon.Point {
+		b.WriteString(fmt.Sprintf(`<tt:Point x="%g" y="%g"/>`, p.X, p.Y))
+	}
+	b.WriteString(`</tt:Polygon>`)
+	b.WriteString(`<tt:Type>` + escapeXML(m.Type) + `</tt:Type>`)
+	b.WriteString(`<tt:Enabled>` + strconv.FormatBool(m.Enabled) + `</tt:Enabled>`)
+	b.WriteString(`</tr2:Mask>`)
+
+	return b.String()
+}
+
+// maskChannel은 `profile`로 지정한 채널(경로 이름 또는 프로파일 토큰)을 찾는다. 없으면 첫 번째 채널이다.
+func (o *onvifDevice) maskChannel(profile string) (*defs.Channel, error) {
+	channels := o.channels()
+	if len(channels) == 0 {
+		return nil, errors.New("camera has no channels")
+	}
+
+	ch := &channels[0]
+	if profile != "" {
+		ch = nil
+		for i := range channels {
+			if channels[i].Name == profile || channels[i].Token == profile {
+				ch = &channels[i]
+				break
+			}
+		}
+		if ch == nil {
+			return nil, errors.New("No such profile found: " + profile)
+		}
+	}
+
+	if ch.Resolution.Width <= 0 || ch.Resolution.Height <= 0 {
+		return nil, fmt.Errorf("resolution of %s is unknown", ch.Name)
+	}
+
+	return ch, nil
+}
+
+// channelVideoSourceToken은 채널 프로파일의 비디오 소스 설정 토큰을 찾는다.
+func (o *onvifDevice) channelVideoSourceToken(ch *defs.Channel) (string, error) {
+	if o.Profiles != nil {
+		for _, p := range *o.Profiles {
+			if string(p.Token) != ch.Token {
+				continue
+			}
+			if p.VideoSourceConfiguration == nil || p.VideoSourceConfiguration.Token == "" {
+				return "", fmt.Errorf("profile %s has no video source configuration", ch.Token)
+			}
+			return string(p.VideoSourceConfiguration.Token), nil
+		}
+	}
+
+	return "", errors.New("No such profile found: " + ch.Token)
+}
+
+func (o *onvifDevice) getONVIFMasks() ([]onvifMask, error) {
+	if o.media2Url == "" {
+		return nil, errors.New("Media2 service is not supported")
+	}
+
+	var reply struct {
+		Body struct {
+			GetMasksResponse struct {
+				Masks []onvifMask
+			}
+		}
+	}
+
+	err := o.sendMedia2("GetMasks",
+		`<tr2:GetMasks xmlns:tr2="`+media2Namespace+`"/>`,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Body.GetMasksResponse.Masks, nil
+}
+
+func (o *onvifDevice) createONVIFMask(m onvifMask) (string, error) {
+	if o.media2Url == "" {
+		return "", errors.New("Media2 service is not supported")
+	}
+
+	var reply struct {
+		Body struct {
+			CreateMaskResponse struct {
+				Token string
+			}
+		}
+	}
+
+	err := o.sendMedia2("CreateMask",
+		`<tr2:CreateMask xmlns:tr2="`+media2Namespace+`" xmlns:tt="`+schemaNamespace+`">`+m.xml()+`</tr2:CreateMask>`,
+		&reply)
+	if err != nil {
+		return "", err
+	}
+
+	return reply.Body.CreateMaskResponse.Token, nil
+}
+
+func (o *onvifDevice) deleteONVIFMask(token string) error {
+	if o.media2Url == "" {
+		return errors.New("Media2 service is not supported")
+	}
+
+	var reply struct{}
+
+	return o.sendMedia2("DeleteMask",
+		`<tr2:DeleteMask xmlns:tr2="`+media2Namespace+`"><tr2:Token>`+escapeXML(token)+`</tr2:Token></tr2:DeleteMask>`,
+		&reply)
+}
+
+func (o *onvifDevice) getISAPIPrivacyMask() (*isapi.PrivacyMask, isapi.NormalizedScreenSize, error) {
+	mask, err := isapi.GetPrivacyMask(o.isapiChannelParams())
+	if err != nil {
+		return nil, isapi.NormalizedScreenSize{}, err
+	}
+
+	size := isapi.NormalizedScreenSize{NormalizedScreenWidth: 704, NormalizedScreenHeight: 576}
+	if mask.NormalizedScreenSize != nil && mask.NormalizedScreenSize.NormalizedScreenWidth > 0 &&
+		mask.NormalizedScreenSize.NormalizedScreenHeight > 0 {
+		size = *mask.NormalizedScreenSize
+	}
+
+	return mask, size, nil
+}
+
+func (o *onvifDevice) setISAPIPrivacyMask(mask *isapi.PrivacyMask) error {
+	status, err := isapi.SetPrivacyMask(isapi.PrivacyMaskParams{
+		ChannelParams: o.isapiChannelParams(),
+		PrivacyMask:   *mask,
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkResponseStatus(status)
+}
+
+func parseISAPIMaskToken(token string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(token, isapiMaskRegionPrefix))
+	if err != nil || !strings.HasPrefix(token, isapiMaskRegionPrefix) {
+		return 0, fmt.Errorf("invalid mask token: %s", token)
+	}
+	return id, nil
+}
+
+// listPrivacyMasks는 Media2로 마스크를 조회하고, 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) listPrivacyMasks(ch *defs.Channel) (*defs.ControlPrivacyMaskList, error) {
+	ret := &defs.ControlPrivacyMaskList{
+		Camera:     o.Conf.Name,
+		Channel:    ch.Name,
+		Resolution: ch.Resolution,
+		Items:      []defs.ControlPrivacyMask{},
+	}
+
+	masks, err := func() ([]onvifMask, error) {
+		vsc, err := o.channelVideoSourceToken(ch)
+		if err != nil {
+			return nil, err
+		}
+
+		masks, err := o.getONVIFMasks()
+		if err != nil {
+			return nil, err
+		}
+
+		// 마스크는 비디오 소스별로 설정되므로 채널의 소스에 속한 것만 반환한다
+		filtered := make([]onvifMask, 0, len(masks))
+		for _, m := range masks {
+			if m.ConfigurationToken == vsc {
+				filtered = append(filtered, m)
+			}
+		}
+		return filtered, nil
+	}()
+	if err == nil {
+		ret.Source = maskSourceONVIF
+		for _, m := range masks {
+			ret.Items = append(ret.Items, m.toDefs(ch.Resolution))
+		}
+		return ret, nil
+	}
+
+	o.parent.Log(logger.Debug, "ONVIF masks of %s are not available (%v), using ISAPI", o.Conf.Name, err)
+
+	mask, size, err2 := o.getISAPIPrivacyMask()
+	if err2 != nil {
+		return nil, fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	ret.Source = maskSourceISAPI
+	for _, r := range mask.PrivacyMaskRegionList {
+		if len(r.RegionCoordinatesList) == 0 {
+			continue
+		}
+
+		item := defs.ControlPrivacyMask{
+			Token:   isapiMaskRegionPrefix + strconv.Itoa(r.Id),
+			Enabled: mask.Enabled && r.Enabled,
+			Polygon: []defs.ControlPoint{},
+		}
+		for _, c := range r.RegionCoordinatesList {
+			item.Polygon = append(item.Polygon, pointFromISAPI(c, ch.Resolution, size))
+		}
+		ret.Items = append(ret.Items, item)
+	}
+
+	return ret, nil
+}
+
+// createPrivacyMask는 마스크를 만들고 토큰을 반환한다. Media2가 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) createPrivacyMask(ch *defs.Channel, polygon []defs.ControlPoint, enabled bool) (string, error) {
+	token, err := func() (string, error) {
+		if o.media2Url == "" {
+			return "", errors.New("Media2 service is not supported")
+		}
+
+		vsc, err := o.channelVideoSourceToken(ch)
+		if err != nil {
+			return "", err
+		}
+
+		m := onvifMask{
+			ConfigurationToken: vsc,
+			Type:               "Color",
+			Enabled:            enabled,
+		}
+		for _, p := range polygon {
+			m.Polygon.Point = append(m.Polygon.Point, pointToONVIF(p, ch.Resolution))
+		}
+
+		return o.createONVIFMask(m)
+	}()
+	if err == nil {
+		return token, nil
+	}
+
+	mask, size, err2 := o.getISAPIPrivacyMask()
+	if err2 != nil {
+		return "", fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	coords := make([]isapi.Coordinates, len(polygon))
+	for i, p := range polygon {
+		coords[i] = pointToISAPI(p, ch.Resolution, size)
+	}
+
+	// 비어있는 영역을 사용하고, 없으면 새 영역을 추가한다
+	var region *isapi.PrivacyMaskRegion
+	maxId := 0
+	for i := range mask.PrivacyMaskRegionList {
+		r := &mask.PrivacyMaskRegionList[i]
+		if region == nil && len(r.RegionCoordinatesList) == 0 {
+			region = r
+		}
+		if r.Id > maxId {
+			maxId = r.Id
+		}
+	}
+	if region == nil {
+		mask.PrivacyMaskRegionList = append(mask.PrivacyMaskRegionList, isapi.PrivacyMaskRegion{Id: maxId + 1})
+		region = &mask.PrivacyMaskRegionList[len(mask.PrivacyMaskRegionList)-1]
+	}
+
+	region.Enabled = enabled
+	region.RegionCoordinatesList = coords
+	if enabled {
+		mask.Enabled = true
+	}
+
+	err2 = o.setISAPIPrivacyMask(mask)
+	if err2 != nil {
+		return "", fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return isapiMaskRegionPrefix + strconv.Itoa(region.Id), nil
+}
+
+// deletePrivacyMask는 마스크를 지운다. Media2가 실패하면 ISAPI를 사용한다.
+func (o *onvifDevice) deletePrivacyMask(token string) error {
+	err := o.deleteONVIFMask(token)
+	if err == nil {
+		return nil
+	}
+
+	err2 := func() error {
+		id, err := parseISAPIMaskToken(token)
+		if err != nil {
+			return err
+		}
+
+		mask, _, err := o.getISAPIPrivacyMask()
+		if err != nil {
+			return err
+		}
+
+		region := mask.Region(id)
+		if region == nil || len(region.RegionCoordinatesList) == 0 {
+			return fmt.Errorf("mask not found: %s", token)
+		}
+
+		region.Enabled = false
+		region.RegionCoordinatesList = nil
+
+		return o.setISAPIPrivacyMask(mask)
+	}()
+	if err2 != nil {
+		return fmt.Errorf("ONVIF: %v, ISAPI: %v", err, err2)
+	}
+
+	return nil
+}
+
+func validatePolygon(polygon []defs.ControlPoint, res defs.Resolution) error {
+	if len(polygon) < 3 {
+		return errors.New("Paramater `polygon` must have at least 3 points")
+	}
+
+	for _, p := range polygon {
+		if p.X < 0 || p.X > res.Width || p.Y < 0 || p.Y > res.Height {
+			return fmt.Errorf("point (%d, %d) is outside of the %dx%d frame", p.X, p.Y, res.Width, res.Height)
+		}
+	}
+
+	return nil
+}
+
+func (c *Control) getPrivacyMasks(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	ch, err := dev.maskChannel(ctx.Query("profile"))
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ret, err := dev.listPrivacyMasks(ch)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to get privacy masks: "+err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ret)
+}
+
+func (c *Control) createPrivacyMask(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	ch, err := dev.maskChannel(ctx.Query("profile"))
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var req privacyMaskReq
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, errors.New("Invalid request body: "+err.Error()))
+		return
+	}
+
+	err = validatePolygon(req.Polygon, ch.Resolution)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	token, err := dev.createPrivacyMask(ch, req.Polygon, enabled)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to create privacy mask: "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "privacy mask %s of %s created", token, name)
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"token": token,
+	})
+}
+
+func (c *Control) deletePrivacyMask(ctx *gin.Context) {
+	name := ctx.Param("name")
+	token := ctx.Param("token")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	err := dev.deletePrivacyMask(token)
+	if err != nil {
+		c.writeError(ctx, http.StatusBadGateway, errors.New("Failed to delete privacy mask: "+err.Error()))
+		return
+	}
+
+	c.Log(logger.Info, "privacy mask %s of %s deleted", token, name)
+
+	ctx.Status(http.StatusNoContent)
+}
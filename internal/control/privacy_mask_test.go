@@ -0,0 +1,173 @@
+package control
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	xsdonvif "github.com/IOTechSystems/onvif/xsd/onvif"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/isapi"
+)
+
+const getMasksResponseXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:tr2="http://www.onvif.org/ver20/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><tr2:GetMasksResponse>
+<tr2:Masks token="Mask_1">
+<tt:ConfigurationToken>VideoSourceToken</tt:ConfigurationToken>
+<tt:Polygon>
+<tt:Point x="-1" y="1"/><tt:Point x="0" y="1"/><tt:Point x="0" y="0"/><tt:Point x="-1" y="0"/>
+</tt:Polygon>
+<tt:Type>Color</tt:Type>
+<tt:Enabled>true</tt:Enabled>
+</tr2:Masks>
+</tr2:GetMasksResponse></env:Body></env:Envelope>`
+
+func TestONVIFMask(t *testing.T) {
+	var reply struct {
+		Body struct {
+			GetMasksResponse struct {
+				Masks []onvifMask
+			}
+		}
+	}
+	err := xml.Unmarshal([]byte(getMasksResponseXML), &reply)
+	require.NoError(t, err)
+
+	masks := reply.Body.GetMasksResponse.Masks
+	require.Len(t, masks, 1)
+
+	res := defs.Resolution{Width: 1920, Height: 1080}
+	require.Equal(t, defs.ControlPrivacyMask{
+		Token:   "Mask_1",
+		Enabled: true,
+		Polygon: []defs.ControlPoint{{X: 0, Y: 0}, {X: 960, Y: 0}, {X: 960, Y: 540}, {X: 0, Y: 540}},
+	}, masks[0].toDefs(res))
+
+	m := onvifMask{ConfigurationToken: "VideoSourceToken", Type: "Color", Enabled: true}
+	for _, p := range []defs.ControlPoint{{X: 480, Y: 270}, {X: 1920, Y: 270}, {X: 1920, Y: 1080}} {
+		m.Polygon.Point = append(m.Polygon.Point, pointToONVIF(p, res))
+	}
+	require.Equal(t, `<tr2:Mask>`+
+		`<tt:ConfigurationToken>VideoSourceToken</tt:ConfigurationToken>`+
+		`<tt:Polygon><tt:Point x="-0.5" y="0.5"/><tt:Point x="1" y="0.5"/><tt:Point x="1" y="-1"/></tt:Polygon>`+
+		`<tt:Type>Color</tt:Type>`+
+		`<tt:Enabled>true</tt:Enabled>`+
+		`</tr2:Mask>`, m.xml())
+}
+
+const fakeMasksXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"
+ xmlns:tr2="http://www.onvif.org/ver20/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema">
+<env:Body><tr2:GetMasksResponse>
+<tr2:Masks token="Mask_1"><tt:ConfigurationToken>VideoSource_1</tt:ConfigurationToken>
+<tt:Polygon><tt:Point x="-1" y="1"/><tt:Point x="0" y="1"/><tt:Point x="0" y="0"/></tt:Polygon>
+<tt:Type>Color</tt:Type><tt:Enabled>true</tt:Enabled></tr2:Masks>
+<tr2:Masks token="Mask_2"><tt:ConfigurationToken>VideoSource_2</tt:ConfigurationToken>
+<tt:Polygon><tt:Point x="0" y="0"/><tt:Point x="1" y="0"/><tt:Point x="1" y="-1"/></tt:Polygon>
+<tt:Type>Color</tt:Type><tt:Enabled>true</tt:Enabled></tr2:Masks>
+</tr2:GetMasksResponse></env:Body></env:Envelope>`
+
+const fakeCreateMaskXML = `<?xml version="1.0" encoding="UTF-8"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tr2="http://www.onvif.org/ver20/media/wsdl">
+<env:Body><tr2:CreateMaskResponse><tr2:Token>Mask_3</tr2:Token></tr2:CreateMaskResponse></env:Body></env:Envelope>`
+
+func TestPrivacyMaskChannel(t *testing.T) {
+	var created []string
+	reCreated := regexp.MustCompile(`<tt:ConfigurationToken>(.*?)</tt:ConfigurationToken>`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		byts, _ := io.ReadAll(r.Body)
+		body := string(byts)
+
+		switch {
+		case strings.Contains(body, "GetMasks"):
+			w.Write([]byte(fakeMasksXML)) //nolint:errcheck
+
+		case strings.Contains(body, "CreateMask"):
+			created = append(created, reCreated.FindStringSubmatch(body)[1])
+			w.Write([]byte(fakeCreateMaskXML)) //nolint:errcheck
+
+		default:
+			w.Write([]byte(fmt.Sprintf(fakeCapabilitiesXML, r.Host))) //nolint:errcheck
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	setTestDumpDirectory(t)
+
+	profiles := []Profile{}
+	for i := 1; i <= 2; i++ {
+		p := Profile{PathName: fmt.Sprintf("cam_%d", i), Width: 1920, Height: 1080}
+		p.Token = xsdonvif.ReferenceToken(fmt.Sprintf("Profile_%d", i))
+		p.VideoSourceConfiguration = &xsdonvif.VideoSourceConfiguration{}
+		p.VideoSourceConfiguration.Token = xsdonvif.ReferenceToken(fmt.Sprintf("VideoSource_%d", i))
+		profiles = append(profiles, p)
+	}
+
+	o := &onvifDevice{
+		Conf:      &conf.Path{Name: "cam"},
+		Url:       *u,
+		Profiles:  &profiles,
+		media2Url: srv.URL + "/onvif/Media2",
+		parent:    &Control{Parent: &credentialsTestParent{}},
+	}
+	require.NoError(t, o.connect())
+
+	ch, err := o.maskChannel("cam_2")
+	require.NoError(t, err)
+
+	list, err := o.listPrivacyMasks(ch)
+	require.NoError(t, err)
+	require.Equal(t, maskSourceONVIF, list.Source)
+	require.Equal(t, []defs.ControlPrivacyMask{{
+		Token:   "Mask_2",
+		Enabled: true,
+		Polygon: []defs.ControlPoint{{X: 960, Y: 540}, {X: 1920, Y: 540}, {X: 1920, Y: 1080}},
+	}}, list.Items)
+
+	token, err := o.createPrivacyMask(ch, []defs.ControlPoint{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}}, true)
+	require.NoError(t, err)
+	require.Equal(t, "Mask_3", token)
+	require.Equal(t, []string{"VideoSource_2"}, created)
+}
+
+func TestISAPIMaskPoint(t *testing.T) {
+	res := defs.Resolution{Width: 1920, Height: 1080}
+	size := isapi.NormalizedScreenSize{
+		NormalizedScreenWidth:  704,
+		NormalizedScreenHeight: 576,
+	}
+
+	c := pointToISAPI(defs.ControlPoint{X: 480, Y: 270}, res, size)
+	require.Equal(t, isapi.Coordinates{PositionX: 176, PositionY: 432}, c)
+	require.Equal(t, defs.ControlPoint{X: 480, Y: 270}, pointFromISAPI(c, res, size))
+
+	id, err := parseISAPIMaskToken("region-3")
+	require.NoError(t, err)
+	require.Equal(t, 3, id)
+
+	_, err = parseISAPIMaskToken("Mask_1")
+	require.Error(t, err)
+}
+
+func TestValidatePolygon(t *testing.T) {
+	res := defs.Resolution{Width: 640, Height: 480}
+
+	require.NoError(t, validatePolygon([]defs.ControlPoint{{X: 0, Y: 0}, {X: 640, Y: 0}, {X: 640, Y: 480}}, res))
+	require.Error(t, validatePolygon([]defs.ControlPoint{{X: 0, Y: 0}, {X: 640, Y: 0}}, res))
+	require.Error(t, validatePolygon([]defs.ControlPoint{{X: 0, Y: 0}, {X: 641, Y: 0}, {X: 640, Y: 480}}, res))
+}
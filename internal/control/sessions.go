@@ -0,0 +1,36 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/gin-gonic/gin"
+)
+
+// 카메라와 맺은 RTSP 세션 현황을 반환한다.
+// 세션 한도에 도달해 대기 중인 경로는 queued 상태와 오류 메시지로 표시된다.
+func (c *Control) getSessions(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	dev := c.getOnvifDevice(name)
+	if dev == nil {
+		c.writeError(ctx, http.StatusNotFound, errors.New("No such camera found: "+name))
+		return
+	}
+
+	ret, ok := c.Parent.ControlCameraSessions(name)
+	if !ok {
+		// 스트림 URI를 아직 얻지 못해 경로가 없는 카메라
+		ret = &defs.ControlCameraSessions{
+			Camera:   name,
+			Sessions: []defs.ControlCameraSession{},
+		}
+		if dev.Camera != nil {
+			ret.MaxSessions = dev.Camera.MaxSessions
+			ret.Share = dev.Camera.ShareSessions
+		}
+	}
+
+	ctx.JSON(http.StatusOK, ret)
+}
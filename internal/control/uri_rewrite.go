@@ -0,0 +1,124 @@
+package control
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+var reURIRewriteVar = regexp.MustCompile(`%[a-z]+`)
+
+var defaultSchemePorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"rtsp":  554,
+	"rtsps": 322,
+}
+
+// uriRewriteRule은 카메라가 알려준 URI를 실제로 접속할 수 있는 URI로 바꾸는 규칙이다.
+type uriRewriteRule struct {
+	// 비어있지 않으면 호스트를 바꾼다. IPv6 주소는 괄호 없이 써도 된다.
+	host string
+	// 카메라가 알려준 포트를 다른 포트로 바꾼다.
+	ports conf.CameraPortMap
+	// ports에 없는 경우 사용할 포트. 0이면 그대로 둔다.
+	port int
+	// rtsp, rtsps URI의 스킴을 바꾼다.
+	scheme string
+	// 경로와 쿼리 템플릿. %path, %query는 원래 값이다.
+	path  string
+	query string
+	// nil이 아니면 URI에 계정을 넣는다.
+	user *url.Userinfo
+}
+
+func (r uriRewriteRule) isEmpty() bool {
+	return r.host == "" && len(r.ports) == 0 && r.port == 0 && r.scheme == "" &&
+		r.path == "" && r.query == "" && r.user == nil
+}
+
+func expandURIRewriteTemplate(tpl string, vars map[string]string) string {
+	return reURIRewriteVar.ReplaceAllStringFunc(tpl, func(v string) string {
+		if val, ok := vars[v]; ok {
+			return val
+		}
+		return v
+	})
+}
+
+// apply는 규칙을 적용한 URI를 반환한다. vars는 템플릿 변수(%camera 등)이다.
+func (r uriRewriteRule) apply(raw string, vars map[string]string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if r.isEmpty() {
+		return u.String(), nil
+	}
+
+	isRTSP := u.Scheme == "rtsp" || u.Scheme == "rtsps"
+
+	host := u.Hostname()
+	if r.host != "" {
+		host = strings.TrimSuffix(strings.TrimPrefix(r.host, "["), "]")
+	}
+
+	port := u.Port()
+	reported := defaultSchemePorts[u.Scheme]
+	if port != "" {
+		reported, err = strconv.Atoi(port)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if mapped, ok := r.ports[reported]; ok {
+		port = strconv.Itoa(mapped)
+	} else if r.port != 0 {
+		port = strconv.Itoa(r.port)
+	}
+
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	if isRTSP && r.scheme != "" {
+		u.Scheme = r.scheme
+	}
+
+	tplVars := make(map[string]string, len(vars)+2)
+	for k, v := range vars {
+		tplVars[k] = v
+	}
+	tplVars["%path"] = u.EscapedPath()
+	tplVars["%query"] = u.RawQuery
+
+	if r.path != "" {
+		p := expandURIRewriteTemplate(r.path, tplVars)
+		u.Path, err = url.PathUnescape(p)
+		if err != nil {
+			return "", err
+		}
+		u.RawPath = p
+	}
+
+	if r.query != "" {
+		u.RawQuery = strings.TrimPrefix(expandURIRewriteTemplate(r.query, tplVars), "?")
+		u.ForceQuery = false
+	}
+
+	if r.user != nil {
+		u.User = r.user
+	}
+
+	return u.String(), nil
+}
@@ -4,12 +4,12 @@ package core
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -21,18 +21,22 @@ import (
 	"github.com/ctenhank/mediamtx/internal/conf"
 	"github.com/ctenhank/mediamtx/internal/confwatcher"
 	"github.com/ctenhank/mediamtx/internal/control"
+	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/externalcmd"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/ctenhank/mediamtx/internal/metrics"
 	"github.com/ctenhank/mediamtx/internal/playback"
 	"github.com/ctenhank/mediamtx/internal/pprof"
 	"github.com/ctenhank/mediamtx/internal/recordcleaner"
+	"github.com/ctenhank/mediamtx/internal/recordmover"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 	"github.com/ctenhank/mediamtx/internal/rlimit"
 	"github.com/ctenhank/mediamtx/internal/servers/hls"
 	"github.com/ctenhank/mediamtx/internal/servers/rtmp"
 	"github.com/ctenhank/mediamtx/internal/servers/rtsp"
 	"github.com/ctenhank/mediamtx/internal/servers/srt"
 	"github.com/ctenhank/mediamtx/internal/servers/webrtc"
+	rtspsource "github.com/ctenhank/mediamtx/internal/source"
 )
 
 var version = "v0.0.0"
@@ -46,8 +50,19 @@ var defaultConfPaths = []string{
 }
 
 var cli struct {
-	Version  bool   `help:"print version"`
-	Confpath string `arg:"" default:""`
+	Version bool `help:"print version"`
+	Run     struct {
+		Confpath string `arg:"" default:""`
+	} `cmd:"" default:"withargs" help:"run the server (default)"`
+	Verify struct {
+		Path     string `arg:"" help:"name of the path whose recordings are verified"`
+		Confpath string `arg:"" default:""`
+	} `cmd:"" help:"verify recordings of a path against their manifests"`
+}
+
+type controlCamerasPatchReq struct {
+	cameras map[string]*conf.OptionalCamera
+	res     chan error
 }
 
 // Core is an instance of MediaMTX.
@@ -62,9 +77,13 @@ type Core struct {
 	authManager     *auth.Manager
 	metrics         *metrics.Metrics
 	pprof           *pprof.PPROF
+	recordIndex     *recordstore.Index
 	recordCleaner   *recordcleaner.Cleaner
+	recordMover     *recordmover.Mover
 	playbackServer  *playback.Server
 	pathManager     *pathManager
+	pathManagerMu   sync.RWMutex // protects pathManager from control requests
+	sessionLimiter  *rtspsource.SessionLimiter
 	rtspServer      *rtsp.Server
 	rtspsServer     *rtsp.Server
 	rtmpServer      *rtmp.Server
@@ -74,10 +93,12 @@ type Core struct {
 	srtServer       *srt.Server
 	api             *api.API
 	controlServer   *control.Control
+	maintenanceJobs *control.MaintenanceJobs
 	confWatcher     *confwatcher.ConfWatcher
 
 	// in
-	chAPIConfigSet chan *conf.Conf
+	chAPIConfigSet        chan *conf.Conf
+	chControlCamerasPatch chan controlCamerasPatchReq
 
 	// out
 	done chan struct{}
@@ -101,7 +122,7 @@ func New(args []string) (*Core, bool) {
 		panic(err)
 	}
 
-	_, err = parser.Parse(args)
+	kctx, err := parser.Parse(args)
 	parser.FatalIfErrorf(err)
 
 	if cli.Version {
@@ -109,16 +130,25 @@ func New(args []string) (*Core, bool) {
 		os.Exit(0)
 	}
 
+	if strings.HasPrefix(kctx.Command(), "verify") {
+		if !verifyRecordings(cli.Verify.Path, cli.Verify.Confpath) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	ctx, ctxCancel := context.WithCancel(context.Background())
 
 	p := &Core{
-		ctx:            ctx,
-		ctxCancel:      ctxCancel,
-		chAPIConfigSet: make(chan *conf.Conf),
-		done:           make(chan struct{}),
+		ctx:                   ctx,
+		ctxCancel:             ctxCancel,
+		chAPIConfigSet:        make(chan *conf.Conf),
+		sessionLimiter:        &rtspsource.SessionLimiter{},
+		chControlCamerasPatch: make(chan controlCamerasPatchReq),
+		done:                  make(chan struct{}),
 	}
 
-	p.conf, p.confPath, err = conf.Load(cli.Confpath, defaultConfPaths)
+	p.conf, p.confPath, err = conf.Load(cli.Run.Confpath, defaultConfPaths)
 	if err != nil {
 		fmt.Printf("ERR: %s\n", err)
 		return nil, false
@@ -196,6 +226,22 @@ outer:
 				break outer
 			}
 
+		case req := <-p.chControlCamerasPatch:
+			newConf, err := p.patchCameras(req.cameras)
+			req.res <- err
+			if err != nil {
+				p.Log(logger.Error, "unable to change cameras: %s", err)
+				continue
+			}
+
+			p.Log(logger.Info, "reloading configuration (control request)")
+
+			err = p.reloadConf(newConf, false)
+			if err != nil {
+				p.Log(logger.Error, "%s", err)
+				break outer
+			}
+
 		case <-interrupt:
 			p.Log(logger.Info, "shutting down gracefully")
 			break outer
@@ -304,17 +350,24 @@ func (p *Core) createResources(initial bool) error {
 		p.pprof = i
 	}
 
+	// maintenance jobs outlive the control server, that is restarted when cameras change
+	if p.conf.Control && p.maintenanceJobs == nil {
+		p.maintenanceJobs = &control.MaintenanceJobs{}
+		p.maintenanceJobs.Initialize()
+	}
+
 	if p.conf.Control && p.controlServer == nil {
 		i := &control.Control{
-			Address:        p.conf.ControlAddress,
-			Encryption:     p.conf.ControlEncryption,
-			ServerKey:      p.conf.ControlServerKey,
-			ServerCert:     p.conf.ControlServerCert,
-			AllowOrigin:    p.conf.ControlAllowOrigin,
-			TrustedProxies: p.conf.ControlTrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			Conf:           p.conf,
-			Parent:         p,
+			Address:         p.conf.ControlAddress,
+			Encryption:      p.conf.ControlEncryption,
+			ServerKey:       p.conf.ControlServerKey,
+			ServerCert:      p.conf.ControlServerCert,
+			AllowOrigin:     p.conf.ControlAllowOrigin,
+			TrustedProxies:  p.conf.ControlTrustedProxies,
+			ReadTimeout:     p.conf.ReadTimeout,
+			Conf:            p.conf,
+			MaintenanceJobs: p.maintenanceJobs,
+			Parent:          p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -323,33 +376,11 @@ func (p *Core) createResources(initial bool) error {
 		p.controlServer = i
 	}
 
-	devices := p.controlServer.OnvifDevices
-	paths := map[string]*conf.Path{}
-	for _, d := range devices {
-
-		// hostname := d.Url.Hostname()
-
-		if d.StreamUris != nil {
-			for _, u := range *d.StreamUris {
-				name := u.Profile.PathName
-
-				_p := *d.Conf
-				_p.Source = string(u.Uri)
-				if d.Conf.RemoteDevice {
-					_u, err := url.Parse(string(u.Uri))
-					if err != nil {
-						p.Log(logger.Error, "Error parsing URI: %s", err)
-						continue
-					}
-					_u.Host = d.Url.Hostname() + _p.RTSPPort
-					_p.Source = _u.String()
-				}
-				_p.Name = name
-
-				paths[name] = &_p
-			}
-		}
+	paths, err := p.onvifDevicePaths()
+	if err != nil {
+		return err
 	}
+	p.sessionLimiter.SetCameras(p.sessionLimiterCameras())
 
 	if p.conf.TerminateIfNoPaths && len(paths) == 0 {
 		panic("No paths found")
@@ -357,27 +388,59 @@ func (p *Core) createResources(initial bool) error {
 
 	p.conf.OnvifDevicePaths = paths
 
+	if p.conf.RecordIndexPath != "" &&
+		p.recordIndex == nil {
+		i := &recordstore.Index{
+			FilePath:  p.conf.RecordIndexPath,
+			PathConfs: p.conf.OnvifDevicePaths,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.recordIndex = i
+	}
+
 	if p.recordCleaner == nil {
 		p.recordCleaner = &recordcleaner.Cleaner{
+			PathConfs:    p.conf.OnvifDevicePaths,
+			MaxDiskUsage: p.conf.RecordMaxDiskUsage,
+			MinFreeSpace: p.conf.RecordMinFreeSpace,
+			Index:        p.recordIndex,
+			Parent:       p,
+		}
+		p.recordCleaner.Initialize()
+
+		if p.metrics != nil {
+			p.metrics.SetRecordCleaner(p.recordCleaner)
+		}
+	}
+
+	if p.recordMover == nil {
+		p.recordMover = &recordmover.Mover{
 			PathConfs: p.conf.OnvifDevicePaths,
+			Index:     p.recordIndex,
 			Parent:    p,
 		}
-		p.recordCleaner.Initialize()
+		p.recordMover.Initialize()
 	}
 
 	if p.conf.Playback &&
 		p.playbackServer == nil {
 		i := &playback.Server{
-			Address:        p.conf.PlaybackAddress,
-			Encryption:     p.conf.PlaybackEncryption,
-			ServerKey:      p.conf.PlaybackServerKey,
-			ServerCert:     p.conf.PlaybackServerCert,
-			AllowOrigin:    p.conf.PlaybackAllowOrigin,
-			TrustedProxies: p.conf.PlaybackTrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			PathConfs:      p.conf.OnvifDevicePaths,
-			AuthManager:    p.authManager,
-			Parent:         p,
+			Address:         p.conf.PlaybackAddress,
+			Encryption:      p.conf.PlaybackEncryption,
+			ServerKey:       p.conf.PlaybackServerKey,
+			ServerCert:      p.conf.PlaybackServerCert,
+			AllowOrigin:     p.conf.PlaybackAllowOrigin,
+			TrustedProxies:  p.conf.PlaybackTrustedProxies,
+			ExportPath:      p.conf.PlaybackExportPath,
+			ExportRetention: p.conf.PlaybackExportRetention,
+			ReadTimeout:     p.conf.ReadTimeout,
+			PathConfs:       p.conf.OnvifDevicePaths,
+			Index:           p.recordIndex,
+			AuthManager:     p.authManager,
+			Parent:          p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -387,8 +450,7 @@ func (p *Core) createResources(initial bool) error {
 	}
 
 	if p.pathManager == nil {
-
-		p.pathManager = &pathManager{
+		pm := &pathManager{
 			logLevel:          p.conf.LogLevel,
 			authManager:       p.authManager,
 			rtspAddress:       p.conf.RTSPAddress,
@@ -397,10 +459,16 @@ func (p *Core) createResources(initial bool) error {
 			writeQueueSize:    p.conf.WriteQueueSize,
 			udpMaxPayloadSize: p.conf.UDPMaxPayloadSize,
 			pathConfs:         p.conf.OnvifDevicePaths,
+			sessionLimiter:    p.sessionLimiter,
+			recordIndex:       p.recordIndex,
 			externalCmdPool:   p.externalCmdPool,
 			parent:            p,
 		}
-		p.pathManager.initialize()
+		pm.initialize()
+
+		p.pathManagerMu.Lock()
+		p.pathManager = pm
+		p.pathManagerMu.Unlock()
 
 		if p.metrics != nil {
 			p.metrics.SetPathManager(p.pathManager)
@@ -668,6 +736,7 @@ func (p *Core) createResources(initial bool) error {
 			HLSServer:      p.hlsServer,
 			WebRTCServer:   p.webRTCServer,
 			SRTServer:      p.srtServer,
+			RecordIndex:    p.recordIndex,
 			Parent:         p,
 		}
 		err = i.Initialize()
@@ -687,6 +756,168 @@ func (p *Core) createResources(initial bool) error {
 	return nil
 }
 
+func (p *Core) onvifDevicePaths() (map[string]*conf.Path, error) {
+	paths := map[string]*conf.Path{}
+	if p.controlServer == nil {
+		return paths, nil
+	}
+
+	// names are generated from camera names, templates and suffixes, therefore they may collide.
+	addPath := func(cameraName string, pathConf *conf.Path) error {
+		if _, ok := paths[pathConf.Name]; ok {
+			return fmt.Errorf("camera '%s': path '%s' is already used by another camera or profile",
+				cameraName, pathConf.Name)
+		}
+		paths[pathConf.Name] = pathConf
+		return nil
+	}
+
+	devices := p.controlServer.OnvifDevices
+	for _, d := range devices {
+
+		// hostname := d.Url.Hostname()
+
+		if d.StreamUris != nil {
+			backChannel := d.Conf.RTSPBackChannel
+
+			// sources of the profiles, used as alternates of each other
+			var profileSources []string
+			if d.Camera != nil && d.Camera.AlternateProfiles {
+				for _, u := range *d.StreamUris {
+					source, err := d.UnicastSource(u)
+					if err == nil && source == "" {
+						source, err = d.StreamSource(u)
+					}
+					if err != nil {
+						source = ""
+					}
+					profileSources = append(profileSources, source)
+				}
+			}
+
+			for i, u := range *d.StreamUris {
+				name := u.Profile.PathName
+
+				source, err := d.StreamSource(u)
+				if err != nil {
+					p.Log(logger.Error, "Error parsing URI: %s", err)
+					continue
+				}
+
+				_p := *d.Conf
+				_p.Source = source
+				_p.Name = name
+
+				if profileSources != nil {
+					_p.SourceAlternates = append(conf.SourceAlternates(nil), d.Conf.SourceAlternates...)
+					for j, alt := range profileSources {
+						if j != i && alt != "" {
+							_p.SourceAlternates = append(_p.SourceAlternates, alt)
+						}
+					}
+				}
+
+				unicast, err := d.UnicastSource(u)
+				if err != nil {
+					p.Log(logger.Error, "Error parsing URI: %s", err)
+					continue
+				}
+
+				if unicast != "" {
+					multicast := gortsplib.TransportUDPMulticast
+					_p.RTSPTransport = conf.RTSPTransport{Transport: &multicast}
+					_p.RTSPMulticastFallback = unicast
+				}
+
+				// cameras usually accept a single back channel session,
+				// therefore it is requested by the first profile only.
+				_p.RTSPBackChannel = backChannel
+				if backChannel {
+					talk := *d.Conf
+					talk.Source = "publisher"
+					talk.SourceOnDemand = false
+					talk.Record = false
+					talk.RTSPBackChannel = false
+					talk.Name = name + rtspsource.BackChannelPathSuffix
+
+					err = addPath(d.Conf.Name, &talk)
+					if err != nil {
+						return nil, err
+					}
+					backChannel = false
+				}
+
+				err = addPath(d.Conf.Name, &_p)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// sessionLimiterCameras returns the session settings of the cameras.
+func (p *Core) sessionLimiterCameras() []rtspsource.SessionLimiterCamera {
+	if p.controlServer == nil {
+		return nil
+	}
+
+	var cameras []rtspsource.SessionLimiterCamera
+
+	for _, d := range p.controlServer.OnvifDevices {
+		if d.Camera == nil || d.StreamUris == nil {
+			continue
+		}
+
+		cam := rtspsource.SessionLimiterCamera{
+			Name:        d.Camera.Name,
+			MaxSessions: d.Camera.MaxSessions,
+			Share:       d.Camera.ShareSessions,
+		}
+
+		for _, u := range *d.StreamUris {
+			cam.Paths = append(cam.Paths, u.Profile.PathName)
+		}
+
+		cameras = append(cameras, cam)
+	}
+
+	return cameras
+}
+
+func (p *Core) reloadOnvifDevicePaths() error {
+	paths, err := p.onvifDevicePaths()
+	if err != nil {
+		return err
+	}
+	p.conf.OnvifDevicePaths = paths
+	p.sessionLimiter.SetCameras(p.sessionLimiterCameras())
+
+	if p.pathManager != nil {
+		p.pathManager.ReloadPathConfs(paths)
+	}
+
+	if p.recordIndex != nil {
+		p.recordIndex.ReloadPathConfs(paths)
+	}
+
+	if p.recordCleaner != nil {
+		p.recordCleaner.ReloadPathConfs(paths)
+	}
+
+	if p.recordMover != nil {
+		p.recordMover.ReloadPathConfs(paths)
+	}
+
+	if p.playbackServer != nil {
+		p.playbackServer.ReloadPathConfs(paths)
+	}
+
+	return nil
+}
+
 func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	closeLogger := newConf == nil ||
 		newConf.LogLevel != p.conf.LogLevel ||
@@ -729,11 +960,42 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closeAuthManager ||
 		closeLogger
 
+	closeControlServer := newConf == nil ||
+		newConf.Control != p.conf.Control ||
+		newConf.ControlAddress != p.conf.ControlAddress ||
+		newConf.ControlEncryption != p.conf.ControlEncryption ||
+		newConf.ControlServerKey != p.conf.ControlServerKey ||
+		newConf.ControlServerCert != p.conf.ControlServerCert ||
+		newConf.ControlAllowOrigin != p.conf.ControlAllowOrigin ||
+		!reflect.DeepEqual(newConf.ControlTrustedProxies, p.conf.ControlTrustedProxies) ||
+		newConf.ControlIOPollPeriod != p.conf.ControlIOPollPeriod ||
+		!reflect.DeepEqual(newConf.ControlIORules, p.conf.ControlIORules) ||
+		newConf.ControlOSDSite != p.conf.ControlOSDSite ||
+		newConf.ControlOSDTemplate != p.conf.ControlOSDTemplate ||
+		newConf.ControlOSDCheckPeriod != p.conf.ControlOSDCheckPeriod ||
+		newConf.ControlFirmwareDirectory != p.conf.ControlFirmwareDirectory ||
+		!reflect.DeepEqual(newConf.Cameras, p.conf.Cameras) ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeLogger
+
+	closeMaintenanceJobs := newConf == nil ||
+		!newConf.Control ||
+		closeLogger
+
+	closeRecordIndex := newConf == nil ||
+		newConf.RecordIndexPath != p.conf.RecordIndexPath ||
+		closeLogger
+
 	closeRecorderCleaner := newConf == nil ||
+		closeRecordIndex ||
+		newConf.RecordMaxDiskUsage != p.conf.RecordMaxDiskUsage ||
+		newConf.RecordMinFreeSpace != p.conf.RecordMinFreeSpace ||
+		closeMetrics ||
+		closeLogger
+
+	closeRecordMover := newConf == nil ||
+		closeRecordIndex ||
 		closeLogger
-	if !closeRecorderCleaner && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
-		p.recordCleaner.ReloadPathConfs(newConf.Paths)
-	}
 
 	closePlaybackServer := newConf == nil ||
 		newConf.Playback != p.conf.Playback ||
@@ -743,12 +1005,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.PlaybackServerCert != p.conf.PlaybackServerCert ||
 		newConf.PlaybackAllowOrigin != p.conf.PlaybackAllowOrigin ||
 		!reflect.DeepEqual(newConf.PlaybackTrustedProxies, p.conf.PlaybackTrustedProxies) ||
+		newConf.PlaybackExportPath != p.conf.PlaybackExportPath ||
+		newConf.PlaybackExportRetention != p.conf.PlaybackExportRetention ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeRecordIndex ||
 		closeAuthManager ||
 		closeLogger
-	if !closePlaybackServer && p.playbackServer != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
-		p.playbackServer.ReloadPathConfs(newConf.Paths)
-	}
 
 	closePathManager := newConf == nil ||
 		newConf.LogLevel != p.conf.LogLevel ||
@@ -759,11 +1021,9 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
 		closeMetrics ||
+		closeRecordIndex ||
 		closeAuthManager ||
 		closeLogger
-	if !closePathManager && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
-		p.pathManager.ReloadPathConfs(newConf.Paths)
-	}
 
 	closeRTSPServer := newConf == nil ||
 		newConf.RTSP != p.conf.RTSP ||
@@ -921,6 +1181,16 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.confWatcher = nil
 	}
 
+	if closeControlServer && p.controlServer != nil {
+		p.controlServer.Close()
+		p.controlServer = nil
+	}
+
+	if closeMaintenanceJobs && p.maintenanceJobs != nil {
+		p.maintenanceJobs.Close()
+		p.maintenanceJobs = nil
+	}
+
 	if p.api != nil {
 		if closeAPI {
 			p.api.Close()
@@ -1001,7 +1271,10 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		}
 
 		p.pathManager.close()
+
+		p.pathManagerMu.Lock()
 		p.pathManager = nil
+		p.pathManagerMu.Unlock()
 	}
 
 	if closePlaybackServer && p.playbackServer != nil {
@@ -1009,11 +1282,25 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.playbackServer = nil
 	}
 
+	if closeRecordMover && p.recordMover != nil {
+		p.recordMover.Close()
+		p.recordMover = nil
+	}
+
 	if closeRecorderCleaner && p.recordCleaner != nil {
+		if p.metrics != nil {
+			p.metrics.SetRecordCleaner(nil)
+		}
+
 		p.recordCleaner.Close()
 		p.recordCleaner = nil
 	}
 
+	if closeRecordIndex && p.recordIndex != nil {
+		p.recordIndex.Close()
+		p.recordIndex = nil
+	}
+
 	if closePPROF && p.pprof != nil {
 		p.pprof.Close()
 		p.pprof = nil
@@ -1042,7 +1329,82 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 func (p *Core) reloadConf(newConf *conf.Conf, calledByAPI bool) error {
 	p.closeResources(newConf, calledByAPI)
 	p.conf = newConf
-	return p.createResources(false)
+
+	// providers of encryption keys may have different parameters
+	recordstore.ResetKeyProviders()
+
+	err := p.createResources(false)
+	if err != nil {
+		return err
+	}
+
+	// cameras may have been added or removed
+	return p.reloadOnvifDevicePaths()
+}
+
+// patchCameras applies camera changes requested by control
+// and writes them into the configuration file, so that they survive reloads and restarts.
+func (p *Core) patchCameras(cameras map[string]*conf.OptionalCamera) (*conf.Conf, error) {
+	newConf := p.conf.Clone()
+
+	for name, camera := range cameras {
+		err := newConf.PatchCameraValues(name, camera)
+		if err != nil {
+			return nil, fmt.Errorf("camera '%s': %w", name, err)
+		}
+	}
+
+	err := newConf.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.SavesPlaintextSecrets(cameras) {
+		p.Log(logger.Warn, "camera passwords are written in plain text into %s, "+
+			"set MTX_CONFKEY in order to encrypt the configuration file", p.confPath)
+	}
+
+	err = conf.SaveCameras(p.confPath, cameras)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConf, nil
+}
+
+// ControlCamerasPatch is called by control.
+func (p *Core) ControlCamerasPatch(cameras map[string]*conf.OptionalCamera) error {
+	req := controlCamerasPatchReq{
+		cameras: cameras,
+		res:     make(chan error, 1),
+	}
+
+	select {
+	case p.chControlCamerasPatch <- req:
+		return <-req.res
+	case <-p.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
+
+// ControlPathReady is called by control, outside of the run loop.
+// A path manager that is being closed replies with an error.
+func (p *Core) ControlPathReady(name string) bool {
+	p.pathManagerMu.RLock()
+	pm := p.pathManager
+	p.pathManagerMu.RUnlock()
+
+	if pm == nil {
+		return false
+	}
+
+	data, err := pm.APIPathsGet(name)
+	return err == nil && data.Ready
+}
+
+// ControlCameraSessions is called by control.
+func (p *Core) ControlCameraSessions(name string) (*defs.ControlCameraSessions, bool) {
+	return p.sessionLimiter.Status(name)
 }
 
 // APIConfigSet is called by api.
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"net"
 	"strconv"
@@ -18,6 +19,8 @@ import (
 	"github.com/ctenhank/mediamtx/internal/hooks"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/ctenhank/mediamtx/internal/recorder"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	rtspsource "github.com/ctenhank/mediamtx/internal/source"
 	"github.com/ctenhank/mediamtx/internal/stream"
 )
 
@@ -32,6 +35,7 @@ type pathParent interface {
 	pathReady(*path)
 	pathNotReady(*path)
 	closePath(*path)
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
 }
 
 type pathOnDemandState int
@@ -71,6 +75,8 @@ type path struct {
 	writeTimeout      conf.StringDuration
 	writeQueueSize    int
 	udpMaxPayloadSize int
+	sessionLimiter    *rtspsource.SessionLimiter
+	recordIndex       *recordstore.Index
 	conf              *conf.Path
 	name              string
 	matches           []string
@@ -175,6 +181,8 @@ func (pa *path) run() {
 			writeTimeout:   pa.writeTimeout,
 			writeQueueSize: pa.writeQueueSize,
 			matches:        pa.matches,
+			pathManager:    pa.parent,
+			sessionLimiter: pa.sessionLimiter,
 			parent:         pa,
 		}
 		pa.source.(*staticSourceHandler).initialize()
@@ -612,6 +620,18 @@ func (pa *path) doAPIPathsGet(req pathAPIPathsGetReq) {
 				}
 				return ret
 			}(),
+			SourceDiagnostics: func() *defs.APIPathSourceDiagnostics {
+				if sh, ok := pa.source.(*staticSourceHandler); ok {
+					return sh.APISourceDiagnostics()
+				}
+				return nil
+			}(),
+			SourceRetry: func() *defs.APIPathSourceRetry {
+				if sh, ok := pa.source.(*staticSourceHandler); ok {
+					return sh.APISourceRetry()
+				}
+				return nil
+			}(),
 		},
 	}
 }
@@ -776,14 +796,41 @@ func (pa *path) setNotReady() {
 }
 
 func (pa *path) startRecording() {
+	var signingKey ed25519.PrivateKey
+
+	if pa.conf.RecordManifest && pa.conf.RecordSigningKey != "" {
+		var err error
+		signingKey, err = recordstore.LoadSigningKey(pa.conf.RecordSigningKey)
+		if err != nil {
+			pa.Log(logger.Error, "unable to load signing key, manifests will not be signed: %v", err)
+		}
+	}
+
+	var encryptionKeys recordstore.KeyProvider
+
+	if pa.conf.RecordEncryption != conf.RecordEncryptionNone {
+		var err error
+		encryptionKeys, err = recordstore.PathKeyProvider(pa.conf)
+		if err != nil {
+			// recordings are not written in plain form when encryption is requested
+			pa.Log(logger.Error, "unable to load encryption key, recording is disabled: %v", err)
+			return
+		}
+	}
+
 	pa.recorder = &recorder.Recorder{
-		WriteQueueSize:  pa.writeQueueSize,
-		PathFormat:      pa.conf.RecordPath,
-		Format:          pa.conf.RecordFormat,
-		PartDuration:    time.Duration(pa.conf.RecordPartDuration),
-		SegmentDuration: time.Duration(pa.conf.RecordSegmentDuration),
-		PathName:        pa.name,
-		Stream:          pa.stream,
+		WriteQueueSize:    pa.writeQueueSize,
+		PathFormat:        pa.conf.RecordPath,
+		Format:            pa.conf.RecordFormat,
+		PartDuration:      time.Duration(pa.conf.RecordPartDuration),
+		SegmentDuration:   time.Duration(pa.conf.RecordSegmentDuration),
+		ThumbnailInterval: time.Duration(pa.conf.RecordThumbnailInterval),
+		Manifest:          pa.conf.RecordManifest,
+		SigningKey:        signingKey,
+		EncryptionKeys:    encryptionKeys,
+		PathName:          pa.name,
+		Stream:            pa.stream,
+		Index:             pa.recordIndex,
 		OnSegmentCreate: func(segmentPath string) {
 			if pa.conf.RunOnRecordSegmentCreate != "" {
 				env := pa.ExternalCmdEnv()
@@ -11,6 +11,8 @@ import (
 	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/externalcmd"
 	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	rtspsource "github.com/ctenhank/mediamtx/internal/source"
 	"github.com/ctenhank/mediamtx/internal/stream"
 )
 
@@ -40,6 +42,8 @@ type pathManager struct {
 	writeQueueSize    int
 	udpMaxPayloadSize int
 	pathConfs         map[string]*conf.Path
+	sessionLimiter    *rtspsource.SessionLimiter
+	recordIndex       *recordstore.Index
 	externalCmdPool   *externalcmd.Pool
 	parent            pathManagerParent
 
@@ -329,6 +333,8 @@ func (pm *pathManager) createPath(
 		writeTimeout:      pm.writeTimeout,
 		writeQueueSize:    pm.writeQueueSize,
 		udpMaxPayloadSize: pm.udpMaxPayloadSize,
+		sessionLimiter:    pm.sessionLimiter,
+		recordIndex:       pm.recordIndex,
 		conf:              pathConf,
 		name:              name,
 		matches:           matches,
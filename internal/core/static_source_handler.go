@@ -8,16 +8,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bluenviron/gortsplib/v4"
+
 	"github.com/ctenhank/mediamtx/internal/conf"
 	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	rtspsource "github.com/ctenhank/mediamtx/internal/source"
 )
 
-const (
-	staticSourceHandlerRetryPause = 5 * time.Second
-)
-
 func resolveSource(s string, matches []string, query string, username string, password string) (string, error) {
 	if len(matches) > 1 {
 		for i, ma := range matches[1:] {
@@ -51,6 +49,8 @@ type staticSourceHandler struct {
 	writeTimeout   conf.StringDuration
 	writeQueueSize int
 	matches        []string
+	pathManager    rtspsource.PathManager
+	sessionLimiter *rtspsource.SessionLimiter
 	parent         staticSourceHandlerParent
 
 	ctx       context.Context
@@ -58,6 +58,7 @@ type staticSourceHandler struct {
 	instance  defs.StaticSource
 	running   bool
 	query     string
+	retry     staticSourceRetry
 
 	// in
 	chReloadConf          chan *conf.Path
@@ -72,6 +73,7 @@ func (s *staticSourceHandler) initialize() {
 	s.chReloadConf = make(chan *conf.Path)
 	s.chInstanceSetReady = make(chan defs.PathSourceStaticSetReadyReq)
 	s.chInstanceSetNotReady = make(chan defs.PathSourceStaticSetNotReadyReq)
+	s.retry.reset(s.conf)
 
 	switch {
 	case strings.HasPrefix(s.conf.Source, "rtsp://") ||
@@ -80,6 +82,8 @@ func (s *staticSourceHandler) initialize() {
 			ReadTimeout:    s.readTimeout,
 			WriteTimeout:   s.writeTimeout,
 			WriteQueueSize: s.writeQueueSize,
+			PathManager:    s.pathManager,
+			Sessions:       s.sessionLimiter,
 			Parent:         s,
 		}
 
@@ -99,6 +103,7 @@ func (s *staticSourceHandler) start(onDemand bool, query string) {
 
 	s.running = true
 	s.query = query
+	s.retry.reset(s.conf)
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 	s.done = make(chan struct{})
 
@@ -142,18 +147,31 @@ func (s *staticSourceHandler) run() {
 	runReloadConf := make(chan *conf.Path)
 
 	recreate := func() {
-		resolvedSource, err := resolveSource(s.conf.Source, s.matches, s.query, s.conf.Username, s.conf.Password)
+		source := s.retry.source()
+
+		resolvedSource, err := resolveSource(source, s.matches, s.query, s.conf.Username, s.conf.Password)
 		if err != nil {
-			s.Log(logger.Error, "Failed to resolve Source %s: %s", s.conf.Source, err)
+			s.Log(logger.Error, "Failed to resolve Source %s: %s", source, err)
 			return
 		}
 
+		cnf := s.conf
+
+		// multicast groups belong to the main source, alternates are read with automatic transport.
+		if source != s.conf.Source && s.conf.RTSPTransport.Transport != nil &&
+			*s.conf.RTSPTransport.Transport == gortsplib.TransportUDPMulticast {
+			c := *s.conf
+			c.RTSPTransport = conf.RTSPTransport{}
+			c.RTSPMulticastFallback = ""
+			cnf = &c
+		}
+
 		runCtx, runCtxCancel = context.WithCancel(context.Background())
 		go func() {
 			runErr <- s.instance.Run(defs.StaticSourceRunParams{
 				Context:        runCtx,
 				ResolvedSource: resolvedSource,
-				Conf:           s.conf,
+				Conf:           cnf,
 				ReloadConf:     runReloadConf,
 			})
 		}()
@@ -162,6 +180,7 @@ func (s *staticSourceHandler) run() {
 	recreate()
 
 	recreating := false
+	exhausted := false
 	recreateTimer := emptyTimer()
 
 	for {
@@ -170,9 +189,18 @@ func (s *staticSourceHandler) run() {
 			runCtxCancel()
 			s.instance.Log(logger.Error, err.Error())
 			recreating = true
-			recreateTimer = time.NewTimer(staticSourceHandlerRetryPause)
+
+			pause, decision, ok := s.retry.onFailure()
+			if ok {
+				s.instance.Log(logger.Info, decision)
+				recreateTimer = time.NewTimer(pause)
+			} else {
+				s.instance.Log(logger.Error, decision)
+				exhausted = true
+			}
 
 		case req := <-s.chInstanceSetReady:
+			s.retry.onReady()
 			s.parent.staticSourceHandlerSetReady(s.ctx, req)
 
 		case req := <-s.chInstanceSetNotReady:
@@ -180,7 +208,15 @@ func (s *staticSourceHandler) run() {
 
 		case newConf := <-s.chReloadConf:
 			s.conf = newConf
-			if !recreating {
+			s.retry.setConf(newConf)
+
+			// a new configuration restores the retry budget
+			if exhausted {
+				s.retry.reset(newConf)
+				recreate()
+				recreating = false
+				exhausted = false
+			} else if !recreating {
 				cReloadConf := runReloadConf
 				cInnerCtx := runCtx
 				go func() {
@@ -225,6 +261,22 @@ func (s *staticSourceHandler) APISourceDescribe() defs.APIPathSourceOrReader {
 	return s.instance.APISourceDescribe()
 }
 
+// APISourceDiagnostics returns diagnostics of the static source, if available.
+func (s *staticSourceHandler) APISourceDiagnostics() *defs.APIPathSourceDiagnostics {
+	if d, ok := s.instance.(defs.StaticSourceDiagnostics); ok {
+		return d.APISourceDiagnostics()
+	}
+	return nil
+}
+
+// APISourceRetry returns the state of the reconnection policy.
+func (s *staticSourceHandler) APISourceRetry() *defs.APIPathSourceRetry {
+	if !s.running {
+		return nil
+	}
+	return s.retry.apiDescribe()
+}
+
 // setReady is called by a staticSource.
 func (s *staticSourceHandler) SetReady(req defs.PathSourceStaticSetReadyReq) defs.PathSourceStaticSetReadyRes {
 	req.Res = make(chan defs.PathSourceStaticSetReadyRes)
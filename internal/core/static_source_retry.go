@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+)
+
+// redactSource removes credentials from a source URL.
+func redactSource(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
+
+// staticSourceRetry is the reconnection policy of a static source.
+// After each failure, the next source among the main one and the alternates is used.
+// The pause before reconnecting is doubled after each round of failed sources.
+type staticSourceRetry struct {
+	mutex        sync.Mutex
+	conf         *conf.Path
+	sourceIndex  int
+	failures     int
+	state        defs.APIPathSourceRetryState
+	pause        time.Duration
+	nextRetry    time.Time
+	lastDecision string
+}
+
+func (r *staticSourceRetry) sources() []string {
+	return append([]string{r.conf.Source}, r.conf.SourceAlternates...)
+}
+
+// reset restarts the policy from the main source.
+func (r *staticSourceRetry) reset(cnf *conf.Path) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.conf = cnf
+	r.sourceIndex = 0
+	r.failures = 0
+	r.state = defs.APIPathSourceRetryStateRunning
+	r.pause = 0
+	r.nextRetry = time.Time{}
+	r.lastDecision = ""
+}
+
+// setConf updates the configuration without resetting the policy.
+func (r *staticSourceRetry) setConf(cnf *conf.Path) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.conf = cnf
+	if r.sourceIndex >= len(r.sources()) {
+		r.sourceIndex = 0
+	}
+}
+
+// source returns the source to connect to.
+func (r *staticSourceRetry) source() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.state = defs.APIPathSourceRetryStateRunning
+	return r.sources()[r.sourceIndex]
+}
+
+// onReady is called when the source is ready.
+func (r *staticSourceRetry) onReady() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.failures != 0 {
+		r.lastDecision = fmt.Sprintf("source %d is ready after %d failures", r.sourceIndex, r.failures)
+	}
+	r.failures = 0
+}
+
+// onFailure is called when the source fails.
+// It returns the pause before reconnecting, the decision and whether to reconnect.
+func (r *staticSourceRetry) onFailure() (time.Duration, string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.failures++
+
+	if r.conf.SourceRetryBudget > 0 && r.failures > r.conf.SourceRetryBudget {
+		r.state = defs.APIPathSourceRetryStateExhausted
+		r.nextRetry = time.Time{}
+		r.lastDecision = fmt.Sprintf("retry budget of %d exhausted, giving up", r.conf.SourceRetryBudget)
+		return 0, r.lastDecision, false
+	}
+
+	sources := r.sources()
+	prev := r.sourceIndex
+	r.sourceIndex = (r.sourceIndex + 1) % len(sources)
+
+	rounds := (r.failures - 1) / len(sources)
+	pause := time.Duration(r.conf.SourceRetryPause)
+	for i := 0; i < rounds && pause < time.Duration(r.conf.SourceRetryMaxPause); i++ {
+		pause *= 2
+	}
+	if pause > time.Duration(r.conf.SourceRetryMaxPause) {
+		pause = time.Duration(r.conf.SourceRetryMaxPause)
+	}
+
+	if r.conf.SourceRetryJitter > 0 {
+		pause += time.Duration((rand.Float64()*2 - 1) * r.conf.SourceRetryJitter * float64(pause)) //nolint:gosec
+	}
+
+	r.state = defs.APIPathSourceRetryStateWaiting
+	r.pause = pause
+	r.nextRetry = time.Now().Add(pause)
+
+	if len(sources) > 1 && r.sourceIndex != prev {
+		r.lastDecision = fmt.Sprintf("failure %d, switching from source %d to source %d in %v",
+			r.failures, prev, r.sourceIndex, pause)
+	} else {
+		r.lastDecision = fmt.Sprintf("failure %d, retrying in %v", r.failures, pause)
+	}
+
+	return pause, r.lastDecision, true
+}
+
+func (r *staticSourceRetry) apiDescribe() *defs.APIPathSourceRetry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ret := &defs.APIPathSourceRetry{
+		State:               r.state,
+		Source:              redactSource(r.sources()[r.sourceIndex]),
+		SourceIndex:         r.sourceIndex,
+		ConsecutiveFailures: r.failures,
+		RetryBudget:         r.conf.SourceRetryBudget,
+		Pause:               r.pause.String(),
+	}
+
+	if r.state == defs.APIPathSourceRetryStateWaiting {
+		v := r.nextRetry
+		ret.NextRetry = &v
+	}
+
+	if r.lastDecision != "" {
+		v := r.lastDecision
+		ret.LastDecision = &v
+	}
+
+	return ret
+}
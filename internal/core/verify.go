@@ -0,0 +1,52 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+)
+
+// verifyRecordings verifies recordings of a path against their manifests and prints a report.
+func verifyRecordings(pathName string, confPath string) bool {
+	c, _, err := conf.Load(confPath, defaultConfPaths)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return false
+	}
+
+	pathConf, _, err := conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return false
+	}
+
+	var key ed25519.PublicKey
+
+	if pathConf.RecordSigningKey != "" {
+		key, err = recordstore.LoadVerificationKey(pathConf.RecordSigningKey)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return false
+		}
+	} else {
+		fmt.Printf("WAR: recordSigningKey is not set, signatures will not be checked\n")
+	}
+
+	segments, err := recordstore.FindSegments(pathConf, pathName)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return false
+	}
+
+	res := recordstore.VerifyManifests(pathConf, segments, key)
+
+	for _, issue := range res.Issues {
+		fmt.Printf("%s: %s (%s)\n", issue.Segment, issue.Type, issue.Reason)
+	}
+
+	fmt.Printf("%d segments verified, %d issues found\n", res.Segments, len(res.Issues))
+
+	return len(res.Issues) == 0
+}
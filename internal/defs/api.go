@@ -13,6 +13,13 @@ type APIError struct {
 	Error string `json:"error"`
 }
 
+// APICameraConfList is a list of camera configurations.
+type APICameraConfList struct {
+	ItemCount int            `json:"itemCount"`
+	PageCount int            `json:"pageCount"`
+	Items     []*conf.Camera `json:"items"`
+}
+
 // APIPathConfList is a list of path configurations.
 type APIPathConfList struct {
 	ItemCount int          `json:"itemCount"`
@@ -37,6 +44,57 @@ type APIPath struct {
 	BytesReceived uint64                  `json:"bytesReceived"`
 	BytesSent     uint64                  `json:"bytesSent"`
 	Readers       []APIPathSourceOrReader `json:"readers"`
+
+	SourceDiagnostics *APIPathSourceDiagnostics `json:"sourceDiagnostics"`
+	SourceRetry       *APIPathSourceRetry       `json:"sourceRetry"`
+}
+
+// APIPathSourceRetryState is the state of the reconnection policy of a static source.
+type APIPathSourceRetryState string
+
+// states.
+const (
+	APIPathSourceRetryStateRunning   APIPathSourceRetryState = "running"
+	APIPathSourceRetryStateWaiting   APIPathSourceRetryState = "waiting"
+	APIPathSourceRetryStateExhausted APIPathSourceRetryState = "exhausted"
+)
+
+// APIPathSourceRetry contains the decisions of the reconnection policy of a static source.
+type APIPathSourceRetry struct {
+	State               APIPathSourceRetryState `json:"state"`
+	Source              string                  `json:"source"`
+	SourceIndex         int                     `json:"sourceIndex"`
+	ConsecutiveFailures int                     `json:"consecutiveFailures"`
+	RetryBudget         int                     `json:"retryBudget"`
+	Pause               string                  `json:"pause"`
+	NextRetry           *time.Time              `json:"nextRetry"`
+	LastDecision        *string                 `json:"lastDecision"`
+}
+
+// APIPathSourceErrorCategory is the category of an error of a static source.
+type APIPathSourceErrorCategory string
+
+// categories.
+const (
+	APIPathSourceErrorCategoryAuth             APIPathSourceErrorCategory = "auth"
+	APIPathSourceErrorCategoryTimeout          APIPathSourceErrorCategory = "timeout"
+	APIPathSourceErrorCategoryNotFound         APIPathSourceErrorCategory = "notFound"
+	APIPathSourceErrorCategoryUnsupportedCodec APIPathSourceErrorCategory = "unsupportedCodec"
+	APIPathSourceErrorCategoryOther            APIPathSourceErrorCategory = "other"
+)
+
+// APIPathSourceDiagnostics contains diagnostics of a static source.
+type APIPathSourceDiagnostics struct {
+	LastError          *string                     `json:"lastError"`
+	LastErrorCategory  *APIPathSourceErrorCategory `json:"lastErrorCategory"`
+	LastErrorTime      *time.Time                  `json:"lastErrorTime"`
+	Reconnects         uint64                      `json:"reconnects"`
+	Transport          *string                     `json:"transport"`
+	SDP                *string                     `json:"sdp"`
+	RTPPacketsReceived uint64                      `json:"rtpPacketsReceived"`
+	RTPPacketsLost     uint64                      `json:"rtpPacketsLost"`
+	RTPJitter          float64                     `json:"rtpJitter"`
+	LastPacketTime     *time.Time                  `json:"lastPacketTime"`
 }
 
 // APIPathList is a list of paths.
@@ -332,3 +390,59 @@ type APIRecordingList struct {
 	PageCount int             `json:"pageCount"`
 	Items     []*APIRecording `json:"items"`
 }
+
+// APIRecordIndexVerify is the result of the verification of the record index.
+type APIRecordIndexVerify struct {
+	Segments     int      `json:"segments"`
+	Missing      []string `json:"missing"`
+	Unindexed    []string `json:"unindexed"`
+	SizeMismatch []string `json:"sizeMismatch"`
+	Truncated    []string `json:"truncated"`
+}
+
+// APIRecordingManifestIssue is an issue found by the verification of manifests.
+type APIRecordingManifestIssue struct {
+	Segment string `json:"segment"`
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+}
+
+// APIRecordingManifestVerify is the result of the verification of the manifests of a path.
+type APIRecordingManifestVerify struct {
+	Segments int                          `json:"segments"`
+	Signed   bool                         `json:"signed"`
+	Valid    bool                         `json:"valid"`
+	Issues   []*APIRecordingManifestIssue `json:"issues"`
+}
+
+// APIRecordingMarker is a marker attached to the recordings of a path.
+type APIRecordingMarker struct {
+	Type  string     `json:"type"`
+	Time  *time.Time `json:"time"`
+	Label string     `json:"label"`
+}
+
+// RecordEvictionReason is the reason why a recording segment was evicted.
+type RecordEvictionReason string
+
+// eviction reasons.
+const (
+	RecordEvictionReasonAge       RecordEvictionReason = "age"
+	RecordEvictionReasonPathSize  RecordEvictionReason = "pathSize"
+	RecordEvictionReasonDiskUsage RecordEvictionReason = "diskUsage"
+	RecordEvictionReasonFreeSpace RecordEvictionReason = "freeSpace"
+)
+
+// RecordEvictions contains the evictions of a path with a given reason.
+type RecordEvictions struct {
+	Path   string
+	Reason RecordEvictionReason
+	Count  uint64
+	Bytes  uint64
+}
+
+// RecordCleanerStats contains statistics of the record cleaner.
+type RecordCleanerStats struct {
+	DiskUsage uint64
+	Evictions []*RecordEvictions
+}
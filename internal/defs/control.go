@@ -1,5 +1,9 @@
 package defs
 
+import (
+	"time"
+)
+
 type ControlError struct {
 	Error string `json:"error"`
 }
@@ -11,7 +15,10 @@ type Resolution struct {
 
 type Channel struct {
 	Name       string     `json:"name"`
+	Token      string     `json:"token"`
 	Resolution Resolution `json:"resolution"`
+	Codec      string     `json:"codec,omitempty"`
+	AudioCodec string     `json:"audioCodec,omitempty"`
 }
 
 type IPCamera struct {
@@ -20,3 +27,205 @@ type IPCamera struct {
 	PtzSupprt bool      `json:"ptz_support"`
 	Channels  []Channel `json:"channels"`
 }
+
+type CredentialRotationStatus string
+
+const (
+	CredentialRotationRotated    CredentialRotationStatus = "rotated"
+	CredentialRotationFailed     CredentialRotationStatus = "failed"
+	CredentialRotationRolledBack CredentialRotationStatus = "rolledBack"
+)
+
+type CredentialRotationResult struct {
+	Camera  string                   `json:"camera"`
+	Status  CredentialRotationStatus `json:"status"`
+	Steps   []string                 `json:"steps"`
+	Warning string                   `json:"warning,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+}
+
+type ControlIOPortType string
+
+const (
+	ControlIORelayOutput  ControlIOPortType = "relayOutput"
+	ControlIODigitalInput ControlIOPortType = "digitalInput"
+)
+
+type ControlIOPort struct {
+	Token     string            `json:"token"`
+	Type      ControlIOPortType `json:"type"`
+	State     string            `json:"state,omitempty"`
+	Mode      string            `json:"mode,omitempty"`
+	IdleState string            `json:"idleState,omitempty"`
+	DelayTime string            `json:"delayTime,omitempty"`
+}
+
+type ControlIO struct {
+	Camera        string          `json:"camera"`
+	Source        string          `json:"source"`
+	RelayOutputs  []ControlIOPort `json:"relayOutputs"`
+	DigitalInputs []ControlIOPort `json:"digitalInputs"`
+}
+
+type ControlIOAuditEntry struct {
+	Time    time.Time `json:"time"`
+	Camera  string    `json:"camera"`
+	Output  string    `json:"output"`
+	State   string    `json:"state"`
+	Trigger string    `json:"trigger"`
+	Actor   string    `json:"actor"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type MaintenanceAction string
+
+const (
+	MaintenanceReboot          MaintenanceAction = "reboot"
+	MaintenanceFactoryDefault  MaintenanceAction = "factoryDefault"
+	MaintenanceFirmwareUpgrade MaintenanceAction = "firmwareUpgrade"
+)
+
+type MaintenanceStatus string
+
+const (
+	MaintenancePending    MaintenanceStatus = "pending"
+	MaintenanceRunning    MaintenanceStatus = "running"
+	MaintenanceWaiting    MaintenanceStatus = "waiting"
+	MaintenanceDone       MaintenanceStatus = "done"
+	MaintenanceUnverified MaintenanceStatus = "unverified"
+	MaintenanceFailed     MaintenanceStatus = "failed"
+	MaintenanceSkipped    MaintenanceStatus = "skipped"
+	MaintenanceCanceled   MaintenanceStatus = "canceled"
+)
+
+type MaintenanceCameraResult struct {
+	Camera   string            `json:"camera"`
+	Batch    int               `json:"batch"`
+	Status   MaintenanceStatus `json:"status"`
+	Method   string            `json:"method,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Started  *time.Time        `json:"started,omitempty"`
+	Finished *time.Time        `json:"finished,omitempty"`
+}
+
+type MaintenanceJob struct {
+	ID        string                    `json:"id"`
+	Action    MaintenanceAction         `json:"action"`
+	Status    MaintenanceStatus         `json:"status"`
+	BatchSize int                       `json:"batchSize"`
+	Created   time.Time                 `json:"created"`
+	Finished  *time.Time                `json:"finished,omitempty"`
+	Cameras   []MaintenanceCameraResult `json:"cameras"`
+}
+
+type ControlOSDType string
+
+const (
+	ControlOSDText     ControlOSDType = "text"
+	ControlOSDDateTime ControlOSDType = "dateTime"
+)
+
+// ControlOSDPosition is normalized to [-1, 1], as in ONVIF.
+type ControlOSDPosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type ControlOSD struct {
+	Token    string              `json:"token"`
+	Type     ControlOSDType      `json:"type"`
+	Text     string              `json:"text,omitempty"`
+	Position *ControlOSDPosition `json:"position,omitempty"`
+}
+
+type ControlOSDList struct {
+	Camera string       `json:"camera"`
+	Source string       `json:"source"`
+	Items  []ControlOSD `json:"items"`
+}
+
+type ControlOSDDrift struct {
+	Camera    string    `json:"camera"`
+	Token     string    `json:"token,omitempty"`
+	Expected  string    `json:"expected"`
+	Actual    string    `json:"actual"`
+	Drift     bool      `json:"drift"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// ControlPoint is a point in pixels of a profile resolution, with the origin at the top left.
+type ControlPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type ControlPrivacyMask struct {
+	Token   string         `json:"token"`
+	Enabled bool           `json:"enabled"`
+	Polygon []ControlPoint `json:"polygon"`
+}
+
+type ControlPrivacyMaskList struct {
+	Camera     string               `json:"camera"`
+	Source     string               `json:"source"`
+	Channel    string               `json:"channel"`
+	Resolution Resolution           `json:"resolution"`
+	Items      []ControlPrivacyMask `json:"items"`
+}
+
+type ControlNetworkInterface struct {
+	Token        string `json:"token"`
+	Name         string `json:"name"`
+	HwAddress    string `json:"hwAddress"`
+	Enabled      bool   `json:"enabled"`
+	DHCP         bool   `json:"dhcp"`
+	Address      string `json:"address"`
+	PrefixLength int    `json:"prefixLength"`
+}
+
+type ControlNetworkProtocol struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Ports   []int  `json:"ports"`
+}
+
+type ControlNetwork struct {
+	Camera           string                    `json:"camera"`
+	Hostname         string                    `json:"hostname"`
+	HostnameFromDHCP bool                      `json:"hostnameFromDHCP"`
+	DNSFromDHCP      bool                      `json:"dnsFromDHCP"`
+	DNSServers       []string                  `json:"dnsServers"`
+	SearchDomains    []string                  `json:"searchDomains"`
+	NTPFromDHCP      bool                      `json:"ntpFromDHCP"`
+	NTPServers       []string                  `json:"ntpServers"`
+	Interfaces       []ControlNetworkInterface `json:"interfaces"`
+	Protocols        []ControlNetworkProtocol  `json:"protocols"`
+	RebootNeeded     bool                      `json:"rebootNeeded,omitempty"`
+}
+
+type ControlCameraSessionState string
+
+// states.
+const (
+	ControlCameraSessionActive ControlCameraSessionState = "active"
+	ControlCameraSessionShared ControlCameraSessionState = "shared"
+	ControlCameraSessionQueued ControlCameraSessionState = "queued"
+)
+
+type ControlCameraSession struct {
+	Path       string                    `json:"path"`
+	State      ControlCameraSessionState `json:"state"`
+	SharedFrom string                    `json:"sharedFrom,omitempty"`
+	Since      time.Time                 `json:"since"`
+	Error      string                    `json:"error,omitempty"`
+}
+
+type ControlCameraSessions struct {
+	Camera       string                 `json:"camera"`
+	MaxSessions  int                    `json:"maxSessions"`
+	Share        bool                   `json:"shareSessions"`
+	Active       int                    `json:"active"`
+	LimitReached bool                   `json:"limitReached"`
+	Sessions     []ControlCameraSession `json:"sessions"`
+}
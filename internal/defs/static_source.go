@@ -14,6 +14,11 @@ type StaticSource interface {
 	APISourceDescribe() APIPathSourceOrReader
 }
 
+// StaticSourceDiagnostics is implemented by static sources that provide diagnostics.
+type StaticSourceDiagnostics interface {
+	APISourceDiagnostics() *APIPathSourceDiagnostics
+}
+
 // StaticSourceParent is the parent of a static source.
 type StaticSourceParent interface {
 	logger.Writer
@@ -0,0 +1,274 @@
+package isapi
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/icholy/digest"
+)
+
+const (
+	MOTION_DETECTION_ENDPOINT = "/ISAPI/System/Video/inputs/channels/%d/motionDetection"
+	LINE_DETECTION_ENDPOINT   = "/ISAPI/Smart/LineDetection/%d"
+	FIELD_DETECTION_ENDPOINT  = "/ISAPI/Smart/FieldDetection/%d"
+)
+
+type DirectionSensitivity string
+
+const (
+	DirectionAny       DirectionSensitivity = "any"
+	DirectionLeftRight DirectionSensitivity = "left-right"
+	DirectionRightLeft DirectionSensitivity = "right-left"
+)
+
+type Grid struct {
+	RowGranularity    int `xml:"rowGranularity" json:"rowGranularity"`
+	ColumnGranularity int `xml:"columnGranularity" json:"columnGranularity"`
+}
+
+type MotionDetectionLayoutGrid struct {
+	// 각 셀의 활성화 여부를 행 단위로 hex 문자열로 표현한 값 (Hikvision gridMap)
+	GridMap string `xml:"gridMap" json:"gridMap"`
+}
+
+type MotionDetectionLayout struct {
+	SensitivityLevel int                       `xml:"sensitivityLevel" json:"sensitivityLevel"`
+	Layout           MotionDetectionLayoutGrid `xml:"layout" json:"layout"`
+}
+
+type MotionDetection struct {
+	XMLName               xml.Name              `xml:"MotionDetection" json:"-"`
+	Version               string                `xml:"version,attr,omitempty" json:"-"`
+	Enabled               bool                  `xml:"enabled" json:"enabled"`
+	EnableHighlight       bool                  `xml:"enableHighlight" json:"enableHighlight"`
+	SamplingInterval      int                   `xml:"samplingInterval,omitempty" json:"samplingInterval,omitempty"`
+	StartTriggerTime      int                   `xml:"startTriggerTime,omitempty" json:"startTriggerTime,omitempty"`
+	EndTriggerTime        int                   `xml:"endTriggerTime,omitempty" json:"endTriggerTime,omitempty"`
+	RegionType            string                `xml:"regionType,omitempty" json:"regionType,omitempty"`
+	Grid                  Grid                  `xml:"Grid" json:"grid"`
+	MotionDetectionLayout MotionDetectionLayout `xml:"MotionDetectionLayout" json:"motionDetectionLayout"`
+}
+
+type NormalizedScreenSize struct {
+	NormalizedScreenWidth  int `xml:"normalizedScreenWidth" json:"normalizedScreenWidth"`
+	NormalizedScreenHeight int `xml:"normalizedScreenHeight" json:"normalizedScreenHeight"`
+}
+
+type Coordinates struct {
+	PositionX int `xml:"positionX" json:"positionX"`
+	PositionY int `xml:"positionY" json:"positionY"`
+}
+
+type LineItem struct {
+	Id                   int                  `xml:"id" json:"id"`
+	Enabled              bool                 `xml:"enabled" json:"enabled"`
+	SensitivityLevel     int                  `xml:"sensitivityLevel" json:"sensitivityLevel"`
+	DirectionSensitivity DirectionSensitivity `xml:"directionSensitivity" json:"directionSensitivity"`
+	CoordinatesList      []Coordinates        `xml:"CoordinatesList>Coordinates" json:"coordinates"`
+}
+
+type LineDetection struct {
+	XMLName              xml.Name             `xml:"LineDetection" json:"-"`
+	Version              string               `xml:"version,attr,omitempty" json:"-"`
+	Id                   int                  `xml:"id" json:"id"`
+	Enabled              bool                 `xml:"enabled" json:"enabled"`
+	NormalizedScreenSize NormalizedScreenSize `xml:"normalizedScreenSize" json:"normalizedScreenSize"`
+	LineItemList         []LineItem           `xml:"LineItemList>LineItem" json:"lineItems"`
+}
+
+type FieldDetectionRegion struct {
+	Id                    int           `xml:"id" json:"id"`
+	Enabled               bool          `xml:"enabled" json:"enabled"`
+	SensitivityLevel      int           `xml:"sensitivityLevel" json:"sensitivityLevel"`
+	TimeThreshold         int           `xml:"timeThreshold" json:"timeThreshold"`
+	DetectionTarget       string        `xml:"detectionTarget,omitempty" json:"detectionTarget,omitempty"`
+	RegionCoordinatesList []Coordinates `xml:"RegionCoordinatesList>RegionCoordinates" json:"regionCoordinates"`
+}
+
+type FieldDetection struct {
+	XMLName                  xml.Name               `xml:"FieldDetection" json:"-"`
+	Version                  string                 `xml:"version,attr,omitempty" json:"-"`
+	Id                       int                    `xml:"id" json:"id"`
+	Enabled                  bool                   `xml:"enabled" json:"enabled"`
+	StartTriggerTime         int                    `xml:"startTriggerTime,omitempty" json:"startTriggerTime,omitempty"`
+	EndTriggerTime           int                    `xml:"endTriggerTime,omitempty" json:"endTriggerTime,omitempty"`
+	NormalizedScreenSize     NormalizedScreenSize   `xml:"normalizedScreenSize" json:"normalizedScreenSize"`
+	FieldDetectionRegionList []FieldDetectionRegion `xml:"FieldDetectionRegionList>FieldDetectionRegion" json:"regions"`
+}
+
+type ChannelParams struct {
+	HostParams
+	Channel int
+}
+
+type MotionDetectionParams struct {
+	ChannelParams
+	MotionDetection MotionDetection
+}
+
+type LineDetectionParams struct {
+	ChannelParams
+	LineDetection LineDetection
+}
+
+type FieldDetectionParams struct {
+	ChannelParams
+	FieldDetection FieldDetection
+}
+
+func newDigestClient(params HostParams) http.Client {
+	return http.Client{
+		Transport: &digest.Transport{
+			Username: params.Username,
+			Password: params.Password,
+		},
+	}
+}
+
+func getXML(params HostParams, endpoint string, v interface{}) error {
+	client := newDigestClient(params)
+
+	resp, err := client.Get(params.Host + endpoint)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+
+	return ReadAndParse(resp, v)
+}
+
+func putXML(params HostParams, endpoint string, v interface{}) (*ResponseStatus, error) {
+	client := newDigestClient(params)
+
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, errors.New("xml marshal error")
+	}
+
+	resp, err := sendPutMethod(client, params.Host+endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply ResponseStatus
+	err = ReadAndParse(resp, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &reply, fmt.Errorf("bad status code: %d (%s)", resp.StatusCode, reply.SubStatusCode)
+	}
+
+	return &reply, nil
+}
+
+func validateSensitivity(level int) error {
+	if level < 0 || level > 100 {
+		return fmt.Errorf("sensitivity level must be between 0 and 100: %d", level)
+	}
+	return nil
+}
+
+// Validate checks the grid and the sensitivity of a motion detection configuration.
+func (m *MotionDetection) Validate() error {
+	err := validateSensitivity(m.MotionDetectionLayout.SensitivityLevel)
+	if err != nil {
+		return err
+	}
+
+	if m.Grid.RowGranularity < 0 || m.Grid.ColumnGranularity < 0 {
+		return errors.New("grid granularity must be positive")
+	}
+
+	return nil
+}
+
+// Validate checks lines and sensitivities of a line crossing configuration.
+func (l *LineDetection) Validate() error {
+	for _, item := range l.LineItemList {
+		err := validateSensitivity(item.SensitivityLevel)
+		if err != nil {
+			return err
+		}
+
+		if item.Enabled && len(item.CoordinatesList) != 2 {
+			return fmt.Errorf("line %d must have exactly 2 coordinates", item.Id)
+		}
+	}
+	return nil
+}
+
+// Validate checks regions and sensitivities of an intrusion configuration.
+func (f *FieldDetection) Validate() error {
+	for _, region := range f.FieldDetectionRegionList {
+		err := validateSensitivity(region.SensitivityLevel)
+		if err != nil {
+			return err
+		}
+
+		if region.Enabled && len(region.RegionCoordinatesList) < 3 {
+			return fmt.Errorf("region %d must have at least 3 coordinates", region.Id)
+		}
+	}
+	return nil
+}
+
+func GetMotionDetection(params ChannelParams) (*MotionDetection, error) {
+	var motionDetection MotionDetection
+	err := getXML(params.HostParams, fmt.Sprintf(MOTION_DETECTION_ENDPOINT, params.Channel), &motionDetection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &motionDetection, nil
+}
+
+func SetMotionDetection(params MotionDetectionParams) (*ResponseStatus, error) {
+	form := params.MotionDetection
+	form.Version = "2.0"
+
+	return putXML(params.HostParams, fmt.Sprintf(MOTION_DETECTION_ENDPOINT, params.Channel), form)
+}
+
+func GetLineDetection(params ChannelParams) (*LineDetection, error) {
+	var lineDetection LineDetection
+	err := getXML(params.HostParams, fmt.Sprintf(LINE_DETECTION_ENDPOINT, params.Channel), &lineDetection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lineDetection, nil
+}
+
+func SetLineDetection(params LineDetectionParams) (*ResponseStatus, error) {
+	form := params.LineDetection
+	form.Version = "2.0"
+	form.Id = params.Channel
+
+	return putXML(params.HostParams, fmt.Sprintf(LINE_DETECTION_ENDPOINT, params.Channel), form)
+}
+
+func GetFieldDetection(params ChannelParams) (*FieldDetection, error) {
+	var fieldDetection FieldDetection
+	err := getXML(params.HostParams, fmt.Sprintf(FIELD_DETECTION_ENDPOINT, params.Channel), &fieldDetection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fieldDetection, nil
+}
+
+func SetFieldDetection(params FieldDetectionParams) (*ResponseStatus, error) {
+	form := params.FieldDetection
+	form.Version = "2.0"
+	form.Id = params.Channel
+
+	return putXML(params.HostParams, fmt.Sprintf(FIELD_DETECTION_ENDPOINT, params.Channel), form)
+}
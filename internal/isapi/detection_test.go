@@ -0,0 +1,173 @@
+package isapi_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/stretchr/testify/require"
+)
+
+const motionDetectionXML = `<?xml version="1.0" encoding="UTF-8"?>
+<MotionDetection version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<enabled>true</enabled>
+<enableHighlight>false</enableHighlight>
+<samplingInterval>2</samplingInterval>
+<startTriggerTime>500</startTriggerTime>
+<endTriggerTime>500</endTriggerTime>
+<regionType>grid</regionType>
+<Grid>
+<rowGranularity>18</rowGranularity>
+<columnGranularity>22</columnGranularity>
+</Grid>
+<MotionDetectionLayout version="2.0">
+<sensitivityLevel>60</sensitivityLevel>
+<layout>
+<gridMap>fffffcfffffcfffffc</gridMap>
+</layout>
+</MotionDetectionLayout>
+</MotionDetection>`
+
+const fieldDetectionXML = `<?xml version="1.0" encoding="UTF-8"?>
+<FieldDetection version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<id>1</id>
+<enabled>true</enabled>
+<normalizedScreenSize>
+<normalizedScreenWidth>1000</normalizedScreenWidth>
+<normalizedScreenHeight>1000</normalizedScreenHeight>
+</normalizedScreenSize>
+<FieldDetectionRegionList size="4">
+<FieldDetectionRegion>
+<id>1</id>
+<enabled>true</enabled>
+<sensitivityLevel>50</sensitivityLevel>
+<timeThreshold>5</timeThreshold>
+<RegionCoordinatesList>
+<RegionCoordinates><positionX>100</positionX><positionY>100</positionY></RegionCoordinates>
+<RegionCoordinates><positionX>900</positionX><positionY>100</positionY></RegionCoordinates>
+<RegionCoordinates><positionX>900</positionX><positionY>900</positionY></RegionCoordinates>
+</RegionCoordinatesList>
+</FieldDetectionRegion>
+</FieldDetectionRegionList>
+</FieldDetection>`
+
+const responseStatusXML = `<?xml version="1.0" encoding="UTF-8"?>
+<ResponseStatus version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<requestURL>/ISAPI/Smart/LineDetection/1</requestURL>
+<statusCode>1</statusCode>
+<statusString>OK</statusString>
+<subStatusCode>ok</subStatusCode>
+</ResponseStatus>`
+
+func TestGetMotionDetection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ISAPI/System/Video/inputs/channels/1/motionDetection", r.URL.Path)
+		w.Write([]byte(motionDetectionXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	md, err := isapi.GetMotionDetection(isapi.ChannelParams{
+		HostParams: isapi.HostParams{
+			Host:     srv.URL,
+			Username: username,
+			Password: password,
+		},
+		Channel: 1,
+	})
+	require.NoError(t, err)
+
+	require.True(t, md.Enabled)
+	require.Equal(t, isapi.Grid{RowGranularity: 18, ColumnGranularity: 22}, md.Grid)
+	require.Equal(t, 60, md.MotionDetectionLayout.SensitivityLevel)
+	require.Equal(t, "fffffcfffffcfffffc", md.MotionDetectionLayout.Layout.GridMap)
+}
+
+func TestGetFieldDetection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ISAPI/Smart/FieldDetection/2", r.URL.Path)
+		w.Write([]byte(fieldDetectionXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	fd, err := isapi.GetFieldDetection(isapi.ChannelParams{
+		HostParams: isapi.HostParams{Host: srv.URL},
+		Channel:    2,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, fd.FieldDetectionRegionList, 1)
+	require.Equal(t, 5, fd.FieldDetectionRegionList[0].TimeThreshold)
+	require.Equal(t, []isapi.Coordinates{
+		{PositionX: 100, PositionY: 100},
+		{PositionX: 900, PositionY: 100},
+		{PositionX: 900, PositionY: 900},
+	}, fd.FieldDetectionRegionList[0].RegionCoordinatesList)
+}
+
+func TestSetLineDetection(t *testing.T) {
+	var received isapi.LineDetection
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "/ISAPI/Smart/LineDetection/1", r.URL.Path)
+
+		byts, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, xml.Unmarshal(byts, &received))
+
+		w.Write([]byte(responseStatusXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	status, err := isapi.SetLineDetection(isapi.LineDetectionParams{
+		ChannelParams: isapi.ChannelParams{
+			HostParams: isapi.HostParams{Host: srv.URL},
+			Channel:    1,
+		},
+		LineDetection: isapi.LineDetection{
+			Enabled: true,
+			LineItemList: []isapi.LineItem{{
+				Id:                   1,
+				Enabled:              true,
+				SensitivityLevel:     50,
+				DirectionSensitivity: isapi.DirectionLeftRight,
+				CoordinatesList: []isapi.Coordinates{
+					{PositionX: 0, PositionY: 500},
+					{PositionX: 1000, PositionY: 500},
+				},
+			}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "OK", status.StatusString)
+
+	require.Equal(t, "2.0", received.Version)
+	require.Equal(t, 1, received.Id)
+	require.Len(t, received.LineItemList, 1)
+	require.Equal(t, isapi.DirectionLeftRight, received.LineItemList[0].DirectionSensitivity)
+}
+
+func TestDetectionValidate(t *testing.T) {
+	md := isapi.MotionDetection{
+		MotionDetectionLayout: isapi.MotionDetectionLayout{SensitivityLevel: 101},
+	}
+	require.Error(t, md.Validate())
+
+	ld := isapi.LineDetection{
+		LineItemList: []isapi.LineItem{{Id: 1, Enabled: true, SensitivityLevel: 50}},
+	}
+	require.EqualError(t, ld.Validate(), "line 1 must have exactly 2 coordinates")
+
+	fd := isapi.FieldDetection{
+		FieldDetectionRegionList: []isapi.FieldDetectionRegion{{
+			Id:                    1,
+			Enabled:               true,
+			SensitivityLevel:      50,
+			RegionCoordinatesList: []isapi.Coordinates{{}, {}},
+		}},
+	}
+	require.EqualError(t, fd.Validate(), "region 1 must have at least 3 coordinates")
+}
@@ -0,0 +1,112 @@
+package isapi
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	IO_INPUTS_ENDPOINT         = "/ISAPI/System/IO/inputs"
+	IO_OUTPUTS_ENDPOINT        = "/ISAPI/System/IO/outputs"
+	IO_STATUS_ENDPOINT         = "/ISAPI/System/IO/status"
+	IO_OUTPUT_TRIGGER_ENDPOINT = "/ISAPI/System/IO/outputs/%d/trigger"
+)
+
+type IOState string
+
+const (
+	IOStateHigh IOState = "high"
+	IOStateLow  IOState = "low"
+)
+
+type IOInputPort struct {
+	Id         int    `xml:"id" json:"id"`
+	Enabled    bool   `xml:"enabled" json:"enabled"`
+	Triggering string `xml:"triggering" json:"triggering"`
+}
+
+type IOInputPortList struct {
+	XMLName     xml.Name      `xml:"IOInputPortList"`
+	IOInputPort []IOInputPort `xml:"IOInputPort"`
+}
+
+type IOOutputPort struct {
+	Id              int    `xml:"id" json:"id"`
+	DefaultState    string `xml:"PowerOnState>defaultState" json:"defaultState"`
+	OutputState     string `xml:"PowerOnState>outputState" json:"outputState"`
+	PulseDuration   int    `xml:"PowerOnState>pulseDuration" json:"pulseDuration"`
+	Name            string `xml:"name,omitempty" json:"name,omitempty"`
+	NormalStatus    string `xml:"normalStatus,omitempty" json:"normalStatus,omitempty"`
+	OutputDelayTime int    `xml:"outputDelayTime,omitempty" json:"outputDelayTime,omitempty"`
+}
+
+type IOOutputPortList struct {
+	XMLName      xml.Name       `xml:"IOOutputPortList"`
+	IOOutputPort []IOOutputPort `xml:"IOOutputPort"`
+}
+
+type IOPortStatus struct {
+	IOPortID   int    `xml:"ioPortID"`
+	IOPortType string `xml:"ioPortType"`
+	IOState    string `xml:"ioState"`
+}
+
+type IOPortStatusList struct {
+	XMLName      xml.Name       `xml:"IOPortStatusList"`
+	IOPortStatus []IOPortStatus `xml:"IOPortStatus"`
+}
+
+type IOPortData struct {
+	XMLName     xml.Name `xml:"IOPortData"`
+	Version     string   `xml:"version,attr,omitempty"`
+	OutputState IOState  `xml:"outputState"`
+}
+
+type IOOutputTriggerParams struct {
+	HostParams
+	Id    int
+	State IOState
+}
+
+func GetIOInputs(params HostParams) (*IOInputPortList, error) {
+	var inputs IOInputPortList
+	err := getXML(params, IO_INPUTS_ENDPOINT, &inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inputs, nil
+}
+
+func GetIOOutputs(params HostParams) (*IOOutputPortList, error) {
+	var outputs IOOutputPortList
+	err := getXML(params, IO_OUTPUTS_ENDPOINT, &outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &outputs, nil
+}
+
+func GetIOStatus(params HostParams) (*IOPortStatusList, error) {
+	var status IOPortStatusList
+	err := getXML(params, IO_STATUS_ENDPOINT, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func TriggerIOOutput(params IOOutputTriggerParams) (*ResponseStatus, error) {
+	if params.State != IOStateHigh && params.State != IOStateLow {
+		return nil, fmt.Errorf("invalid output state: %s", params.State)
+	}
+
+	form := IOPortData{
+		Version:     "2.0",
+		OutputState: params.State,
+	}
+
+	return putXML(params.HostParams, fmt.Sprintf(IO_OUTPUT_TRIGGER_ENDPOINT, params.Id), form)
+}
@@ -0,0 +1,73 @@
+package isapi_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/stretchr/testify/require"
+)
+
+const ioStatusXML = `<?xml version="1.0" encoding="UTF-8"?>
+<IOPortStatusList version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<IOPortStatus>
+<ioPortID>1</ioPortID>
+<ioPortType>input</ioPortType>
+<ioState>inactive</ioState>
+</IOPortStatus>
+<IOPortStatus>
+<ioPortID>1</ioPortID>
+<ioPortType>output</ioPortType>
+<ioState>active</ioState>
+</IOPortStatus>
+</IOPortStatusList>`
+
+func TestGetIOStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ISAPI/System/IO/status", r.URL.Path)
+		w.Write([]byte(ioStatusXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	status, err := isapi.GetIOStatus(isapi.HostParams{Host: srv.URL})
+	require.NoError(t, err)
+
+	require.Equal(t, []isapi.IOPortStatus{
+		{IOPortID: 1, IOPortType: "input", IOState: "inactive"},
+		{IOPortID: 1, IOPortType: "output", IOState: "active"},
+	}, status.IOPortStatus)
+}
+
+func TestTriggerIOOutput(t *testing.T) {
+	var received isapi.IOPortData
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "/ISAPI/System/IO/outputs/2/trigger", r.URL.Path)
+
+		byts, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, xml.Unmarshal(byts, &received))
+
+		w.Write([]byte(responseStatusXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	_, err := isapi.TriggerIOOutput(isapi.IOOutputTriggerParams{
+		HostParams: isapi.HostParams{Host: srv.URL},
+		Id:         2,
+		State:      isapi.IOStateHigh,
+	})
+	require.NoError(t, err)
+	require.Equal(t, isapi.IOStateHigh, received.OutputState)
+
+	_, err = isapi.TriggerIOOutput(isapi.IOOutputTriggerParams{
+		HostParams: isapi.HostParams{Host: srv.URL},
+		Id:         2,
+		State:      "on",
+	})
+	require.EqualError(t, err, "invalid output state: on")
+}
@@ -132,6 +132,21 @@ func sendPutMethod(client http.Client, url string, data []byte) (*http.Response,
 	return client.Do(req)
 }
 
+func sendPostMethod(client http.Client, url string, data []byte) (*http.Response, error) {
+	u, err := gourl.Parse(url)
+	if err != nil {
+		return nil, errors.New("url parse error")
+	}
+
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(data))
+
+	if err != nil {
+		return nil, errors.New("http request error")
+	}
+
+	return client.Do(req)
+}
+
 func sendDeleteMethod(client http.Client, url string, data []byte) (*http.Response, error) {
 	u, err := gourl.Parse(url)
 	if err != nil {
@@ -159,7 +174,7 @@ func GetNetworkIntegrate(params HostParams) (*NetworkIntegrate, error) {
 
 	resp, err := client.Get(params.Host + SYSTEM_INTEGRATE_ENDPOINT)
 
-	if err != nil && resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return nil, err
 	}
 
@@ -196,7 +211,7 @@ func SetNetworkIntegrate(params IntegrateParams) (*ResponseStatus, error) {
 
 	resp, err := sendPutMethod(client, params.Host+SYSTEM_INTEGRATE_ENDPOINT, data)
 
-	if err != nil && resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return nil, err
 	}
 
@@ -219,7 +234,7 @@ func GetOnvifUserList(params HostParams) (*UserList, error) {
 
 	resp, err := client.Get(params.Host + ONVIF_USER_ENDPOINT)
 
-	if err != nil && resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return nil, err
 	}
 
@@ -258,7 +273,7 @@ func CreateOnvifUser(params UserCreateParams) (*ResponseStatus, error) {
 
 	resp, err := sendPutMethod(client, params.Host+ONVIF_USER_ENDPOINT, data)
 
-	if err != nil && resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return nil, err
 	}
 
@@ -282,7 +297,7 @@ func DeleteOnvifUser(params UserDeleteParams) (*ResponseStatus, error) {
 	url := params.Host + ONVIF_USER_ENDPOINT + "/" + fmt.Sprint(params.Id)
 	resp, err := sendDeleteMethod(client, url, nil)
 
-	if err != nil && resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,42 @@
+package isapi
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	FIRMWARE_UPGRADE_ENDPOINT = "/ISAPI/System/updateFirmware"
+)
+
+// STATUS_REBOOT_REQUIRED is the statusCode returned once a firmware image has been written.
+const STATUS_REBOOT_REQUIRED = 7
+
+type FirmwareUpgradeParams struct {
+	HostParams
+	Firmware []byte
+}
+
+// UpgradeFirmware uploads a firmware image and returns once the camera has written it.
+// The camera does not reboot by itself: the new firmware is applied by the next reboot,
+// which the caller must request. A successful upgrade is reported with STATUS_REBOOT_REQUIRED.
+func UpgradeFirmware(params FirmwareUpgradeParams) (*ResponseStatus, error) {
+	client := newDigestClient(params.HostParams)
+
+	resp, err := sendPutMethod(client, params.Host+FIRMWARE_UPGRADE_ENDPOINT, params.Firmware)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply ResponseStatus
+	err = ReadAndParse(resp, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &reply, fmt.Errorf("bad status code: %d (%s)", resp.StatusCode, reply.SubStatusCode)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,75 @@
+package isapi
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	VIDEO_OVERLAY_ENDPOINT = "/ISAPI/System/Video/inputs/channels/%d/overlays"
+)
+
+type TextOverlay struct {
+	Id          int    `xml:"id" json:"id"`
+	Enabled     bool   `xml:"enabled" json:"enabled"`
+	PositionX   int    `xml:"positionX" json:"positionX"`
+	PositionY   int    `xml:"positionY" json:"positionY"`
+	DisplayText string `xml:"displayText" json:"displayText"`
+}
+
+type DateTimeOverlay struct {
+	Enabled     bool   `xml:"enabled" json:"enabled"`
+	PositionX   int    `xml:"positionX" json:"positionX"`
+	PositionY   int    `xml:"positionY" json:"positionY"`
+	DateStyle   string `xml:"dateStyle,omitempty" json:"dateStyle,omitempty"`
+	TimeStyle   string `xml:"timeStyle,omitempty" json:"timeStyle,omitempty"`
+	DisplayWeek bool   `xml:"displayWeek" json:"displayWeek"`
+}
+
+type ChannelNameOverlay struct {
+	Enabled   bool `xml:"enabled" json:"enabled"`
+	PositionX int  `xml:"positionX" json:"positionX"`
+	PositionY int  `xml:"positionY" json:"positionY"`
+}
+
+type VideoOverlay struct {
+	XMLName              xml.Name              `xml:"VideoOverlay" json:"-"`
+	Version              string                `xml:"version,attr,omitempty" json:"-"`
+	NormalizedScreenSize *NormalizedScreenSize `xml:"normalizedScreenSize,omitempty" json:"normalizedScreenSize,omitempty"`
+	FontSize             string                `xml:"fontSize,omitempty" json:"fontSize,omitempty"`
+	TextOverlayList      []TextOverlay         `xml:"TextOverlayList>TextOverlay" json:"textOverlays"`
+	DateTimeOverlay      *DateTimeOverlay      `xml:"DateTimeOverlay,omitempty" json:"dateTimeOverlay,omitempty"`
+	ChannelNameOverlay   *ChannelNameOverlay   `xml:"channelNameOverlay,omitempty" json:"channelNameOverlay,omitempty"`
+}
+
+type VideoOverlayParams struct {
+	ChannelParams
+	VideoOverlay VideoOverlay
+}
+
+// TextOverlay returns the text overlay with the given id.
+func (v *VideoOverlay) TextOverlay(id int) *TextOverlay {
+	for i := range v.TextOverlayList {
+		if v.TextOverlayList[i].Id == id {
+			return &v.TextOverlayList[i]
+		}
+	}
+	return nil
+}
+
+func GetVideoOverlay(params ChannelParams) (*VideoOverlay, error) {
+	var overlay VideoOverlay
+	err := getXML(params.HostParams, fmt.Sprintf(VIDEO_OVERLAY_ENDPOINT, params.Channel), &overlay)
+	if err != nil {
+		return nil, err
+	}
+
+	return &overlay, nil
+}
+
+func SetVideoOverlay(params VideoOverlayParams) (*ResponseStatus, error) {
+	form := params.VideoOverlay
+	form.Version = "2.0"
+
+	return putXML(params.HostParams, fmt.Sprintf(VIDEO_OVERLAY_ENDPOINT, params.Channel), form)
+}
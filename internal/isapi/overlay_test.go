@@ -0,0 +1,88 @@
+package isapi_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/stretchr/testify/require"
+)
+
+const videoOverlayXML = `<?xml version="1.0" encoding="UTF-8"?>
+<VideoOverlay version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<normalizedScreenSize>
+<normalizedScreenWidth>704</normalizedScreenWidth>
+<normalizedScreenHeight>576</normalizedScreenHeight>
+</normalizedScreenSize>
+<fontSize>adaptive</fontSize>
+<TextOverlayList size="8">
+<TextOverlay>
+<id>1</id>
+<enabled>true</enabled>
+<positionX>16</positionX>
+<positionY>64</positionY>
+<displayText>Site A - entrance</displayText>
+</TextOverlay>
+</TextOverlayList>
+<DateTimeOverlay>
+<enabled>true</enabled>
+<positionX>0</positionX>
+<positionY>544</positionY>
+<dateStyle>YYYY-MM-DD</dateStyle>
+<timeStyle>24hour</timeStyle>
+<displayWeek>false</displayWeek>
+</DateTimeOverlay>
+<channelNameOverlay version="2.0">
+<enabled>false</enabled>
+<positionX>512</positionX>
+<positionY>64</positionY>
+</channelNameOverlay>
+</VideoOverlay>`
+
+func TestVideoOverlay(t *testing.T) {
+	var received isapi.VideoOverlay
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ISAPI/System/Video/inputs/channels/1/overlays", r.URL.Path)
+
+		if r.Method == http.MethodPut {
+			byts, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, xml.Unmarshal(byts, &received))
+
+			w.Write([]byte(responseStatusXML)) //nolint:errcheck
+			return
+		}
+
+		w.Write([]byte(videoOverlayXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	params := isapi.ChannelParams{
+		HostParams: isapi.HostParams{Host: srv.URL},
+		Channel:    1,
+	}
+
+	overlay, err := isapi.GetVideoOverlay(params)
+	require.NoError(t, err)
+
+	text := overlay.TextOverlay(1)
+	require.NotNil(t, text)
+	require.Equal(t, "Site A - entrance", text.DisplayText)
+	require.Nil(t, overlay.TextOverlay(2))
+	require.Equal(t, "YYYY-MM-DD", overlay.DateTimeOverlay.DateStyle)
+
+	text.DisplayText = "Site B - entrance"
+
+	_, err = isapi.SetVideoOverlay(isapi.VideoOverlayParams{
+		ChannelParams: params,
+		VideoOverlay:  *overlay,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2.0", received.Version)
+	require.Equal(t, "Site B - entrance", received.TextOverlay(1).DisplayText)
+	require.Equal(t, 704, received.NormalizedScreenSize.NormalizedScreenWidth)
+}
@@ -0,0 +1,57 @@
+package isapi
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+const (
+	PRIVACY_MASK_ENDPOINT = "/ISAPI/System/Video/inputs/channels/%d/privacyMask"
+)
+
+type PrivacyMaskRegion struct {
+	Id                    int           `xml:"id" json:"id"`
+	Enabled               bool          `xml:"enabled" json:"enabled"`
+	RegionCoordinatesList []Coordinates `xml:"RegionCoordinatesList>RegionCoordinates" json:"regionCoordinates"`
+	MaskType              string        `xml:"maskType,omitempty" json:"maskType,omitempty"`
+}
+
+type PrivacyMask struct {
+	XMLName               xml.Name              `xml:"PrivacyMask" json:"-"`
+	Version               string                `xml:"version,attr,omitempty" json:"-"`
+	Enabled               bool                  `xml:"enabled" json:"enabled"`
+	NormalizedScreenSize  *NormalizedScreenSize `xml:"normalizedScreenSize,omitempty" json:"normalizedScreenSize,omitempty"`
+	PrivacyMaskRegionList []PrivacyMaskRegion   `xml:"PrivacyMaskRegionList>PrivacyMaskRegion" json:"regions"`
+}
+
+type PrivacyMaskParams struct {
+	ChannelParams
+	PrivacyMask PrivacyMask
+}
+
+// Region returns the region with the given id.
+func (m *PrivacyMask) Region(id int) *PrivacyMaskRegion {
+	for i := range m.PrivacyMaskRegionList {
+		if m.PrivacyMaskRegionList[i].Id == id {
+			return &m.PrivacyMaskRegionList[i]
+		}
+	}
+	return nil
+}
+
+func GetPrivacyMask(params ChannelParams) (*PrivacyMask, error) {
+	var mask PrivacyMask
+	err := getXML(params.HostParams, fmt.Sprintf(PRIVACY_MASK_ENDPOINT, params.Channel), &mask)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mask, nil
+}
+
+func SetPrivacyMask(params PrivacyMaskParams) (*ResponseStatus, error) {
+	form := params.PrivacyMask
+	form.Version = "2.0"
+
+	return putXML(params.HostParams, fmt.Sprintf(PRIVACY_MASK_ENDPOINT, params.Channel), form)
+}
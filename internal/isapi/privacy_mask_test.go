@@ -0,0 +1,84 @@
+package isapi_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/stretchr/testify/require"
+)
+
+const privacyMaskXML = `<?xml version="1.0" encoding="UTF-8"?>
+<PrivacyMask version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<enabled>true</enabled>
+<normalizedScreenSize>
+<normalizedScreenWidth>704</normalizedScreenWidth>
+<normalizedScreenHeight>576</normalizedScreenHeight>
+</normalizedScreenSize>
+<PrivacyMaskRegionList size="4">
+<PrivacyMaskRegion>
+<id>1</id>
+<enabled>true</enabled>
+<RegionCoordinatesList>
+<RegionCoordinates><positionX>0</positionX><positionY>576</positionY></RegionCoordinates>
+<RegionCoordinates><positionX>176</positionX><positionY>576</positionY></RegionCoordinates>
+<RegionCoordinates><positionX>176</positionX><positionY>432</positionY></RegionCoordinates>
+<RegionCoordinates><positionX>0</positionX><positionY>432</positionY></RegionCoordinates>
+</RegionCoordinatesList>
+<maskType>gray</maskType>
+</PrivacyMaskRegion>
+</PrivacyMaskRegionList>
+</PrivacyMask>`
+
+func TestPrivacyMask(t *testing.T) {
+	var received isapi.PrivacyMask
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ISAPI/System/Video/inputs/channels/1/privacyMask", r.URL.Path)
+
+		if r.Method == http.MethodPut {
+			byts, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, xml.Unmarshal(byts, &received))
+
+			w.Write([]byte(responseStatusXML)) //nolint:errcheck
+			return
+		}
+
+		w.Write([]byte(privacyMaskXML)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	params := isapi.ChannelParams{
+		HostParams: isapi.HostParams{Host: srv.URL},
+		Channel:    1,
+	}
+
+	mask, err := isapi.GetPrivacyMask(params)
+	require.NoError(t, err)
+	require.True(t, mask.Enabled)
+
+	region := mask.Region(1)
+	require.NotNil(t, region)
+	require.Equal(t, []isapi.Coordinates{
+		{PositionX: 0, PositionY: 576},
+		{PositionX: 176, PositionY: 576},
+		{PositionX: 176, PositionY: 432},
+		{PositionX: 0, PositionY: 432},
+	}, region.RegionCoordinatesList)
+	require.Nil(t, mask.Region(2))
+
+	region.Enabled = false
+
+	_, err = isapi.SetPrivacyMask(isapi.PrivacyMaskParams{
+		ChannelParams: params,
+		PrivacyMask:   *mask,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2.0", received.Version)
+	require.False(t, received.Region(1).Enabled)
+	require.Len(t, received.Region(1).RegionCoordinatesList, 4)
+}
@@ -0,0 +1,108 @@
+package isapi
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	DEVICE_USER_ENDPOINT = "/ISAPI/Security/users"
+)
+
+// UserLevel is the level of a device user.
+type UserLevel string
+
+const (
+	LevelAdministrator UserLevel = "Administrator"
+	LevelOperator      UserLevel = "Operator"
+	LevelViewer        UserLevel = "Viewer"
+)
+
+// DeviceUser is a user of the device itself.
+// Unlike ONVIF users, device users are the ones accepted by the RTSP server of the camera.
+type DeviceUser struct {
+	Id        int       `xml:"id"`
+	UserName  string    `xml:"userName"`
+	UserLevel UserLevel `xml:"userLevel"`
+}
+
+type DeviceUserList struct {
+	XMLName xml.Name     `xml:"UserList"`
+	User    []DeviceUser `xml:"User"`
+}
+
+type DeviceUserForm struct {
+	XMLName xml.Name `xml:"User"`
+	DeviceUser
+	Password string `xml:"password"`
+}
+
+// UserLevelOf returns the device user level matching an ONVIF user type.
+func UserLevelOf(t OnvifUserType) UserLevel {
+	switch t {
+	case Admin:
+		return LevelAdministrator
+	case MediaUser:
+		return LevelViewer
+	}
+	return LevelOperator
+}
+
+func GetDeviceUserList(params HostParams) (*DeviceUserList, error) {
+	var users DeviceUserList
+	err := getXML(params, DEVICE_USER_ENDPOINT, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func CreateDeviceUser(params HostParams, user DeviceUserForm) (*ResponseStatus, error) {
+	client := newDigestClient(params)
+
+	data, err := xml.Marshal(user)
+	if err != nil {
+		return nil, errors.New("xml marshal error")
+	}
+
+	resp, err := sendPostMethod(client, params.Host+DEVICE_USER_ENDPOINT, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply ResponseStatus
+	err = ReadAndParse(resp, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &reply, fmt.Errorf("bad status code: %d (%s)", resp.StatusCode, reply.SubStatusCode)
+	}
+
+	return &reply, nil
+}
+
+func DeleteDeviceUser(params HostParams, id int) (*ResponseStatus, error) {
+	client := newDigestClient(params)
+
+	resp, err := sendDeleteMethod(client, params.Host+DEVICE_USER_ENDPOINT+"/"+fmt.Sprint(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply ResponseStatus
+	err = ReadAndParse(resp, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &reply, fmt.Errorf("bad status code: %d (%s)", resp.StatusCode, reply.SubStatusCode)
+	}
+
+	return &reply, nil
+}
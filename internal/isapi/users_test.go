@@ -0,0 +1,69 @@
+package isapi_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ctenhank/mediamtx/internal/isapi"
+	"github.com/stretchr/testify/require"
+)
+
+const deviceUserListXML = `<?xml version="1.0" encoding="UTF-8"?>
+<UserList version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<User><id>1</id><userName>admin</userName><userLevel>Administrator</userLevel></User>
+<User><id>2</id><userName>nvr</userName><userLevel>Operator</userLevel></User>
+</UserList>`
+
+func TestDeviceUsers(t *testing.T) {
+	var created isapi.DeviceUserForm
+	var deleted string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			require.Equal(t, "/ISAPI/Security/users", r.URL.Path)
+			w.Write([]byte(deviceUserListXML)) //nolint:errcheck
+
+		case http.MethodPost:
+			require.Equal(t, "/ISAPI/Security/users", r.URL.Path)
+			byts, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, xml.Unmarshal(byts, &created))
+			w.Write([]byte(responseStatusXML)) //nolint:errcheck
+
+		case http.MethodDelete:
+			deleted = r.URL.Path
+			w.Write([]byte(responseStatusXML)) //nolint:errcheck
+		}
+	}))
+	defer srv.Close()
+
+	params := isapi.HostParams{Host: srv.URL}
+
+	users, err := isapi.GetDeviceUserList(params)
+	require.NoError(t, err)
+	require.Equal(t, []isapi.DeviceUser{
+		{Id: 1, UserName: "admin", UserLevel: isapi.LevelAdministrator},
+		{Id: 2, UserName: "nvr", UserLevel: isapi.LevelOperator},
+	}, users.User)
+
+	_, err = isapi.CreateDeviceUser(params, isapi.DeviceUserForm{
+		DeviceUser: isapi.DeviceUser{
+			Id:        3,
+			UserName:  "nvr2",
+			UserLevel: isapi.UserLevelOf(isapi.MediaUser),
+		},
+		Password: "secret",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "nvr2", created.UserName)
+	require.Equal(t, isapi.LevelViewer, created.UserLevel)
+	require.Equal(t, "secret", created.Password)
+
+	_, err = isapi.DeleteDeviceUser(params, 2)
+	require.NoError(t, err)
+	require.Equal(t, "/ISAPI/Security/users/2", deleted)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/ctenhank/mediamtx/internal/api"
 	"github.com/ctenhank/mediamtx/internal/auth"
 	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/ctenhank/mediamtx/internal/protocols/httpp"
 	"github.com/ctenhank/mediamtx/internal/restrictnetwork"
@@ -36,6 +37,10 @@ type metricsAuthManager interface {
 	Authenticate(req *auth.Request) error
 }
 
+type metricsRecordCleaner interface {
+	Stats() *defs.RecordCleanerStats
+}
+
 type metricsParent interface {
 	logger.Writer
 }
@@ -52,16 +57,17 @@ type Metrics struct {
 	AuthManager    metricsAuthManager
 	Parent         metricsParent
 
-	httpServer   *httpp.WrappedServer
-	mutex        sync.Mutex
-	pathManager  api.PathManager
-	rtspServer   api.RTSPServer
-	rtspsServer  api.RTSPServer
-	rtmpServer   api.RTMPServer
-	rtmpsServer  api.RTMPServer
-	srtServer    api.SRTServer
-	hlsManager   api.HLSServer
-	webRTCServer api.WebRTCServer
+	httpServer    *httpp.WrappedServer
+	mutex         sync.Mutex
+	pathManager   api.PathManager
+	rtspServer    api.RTSPServer
+	rtspsServer   api.RTSPServer
+	rtmpServer    api.RTMPServer
+	rtmpsServer   api.RTMPServer
+	srtServer     api.SRTServer
+	hlsManager    api.HLSServer
+	webRTCServer  api.WebRTCServer
+	recordCleaner metricsRecordCleaner
 }
 
 // Initialize initializes metrics.
@@ -159,6 +165,24 @@ func (m *Metrics) onRequest(ctx *gin.Context) {
 			out += metric("paths", tags, 1)
 			out += metric("paths_bytes_received", tags, int64(i.BytesReceived))
 			out += metric("paths_bytes_sent", tags, int64(i.BytesSent))
+
+			if d := i.SourceDiagnostics; d != nil {
+				tags := "{name=\"" + i.Name + "\"}"
+				out += metric("paths_source_reconnects", tags, int64(d.Reconnects))
+				out += metric("paths_source_rtp_packets_received", tags, int64(d.RTPPacketsReceived))
+				out += metric("paths_source_rtp_packets_lost", tags, int64(d.RTPPacketsLost))
+				out += metricFloat("paths_source_rtp_jitter_seconds", tags, d.RTPJitter)
+
+				if d.LastPacketTime != nil {
+					out += metricFloat("paths_source_last_packet_timestamp_seconds", tags,
+						float64(d.LastPacketTime.UnixNano())/float64(time.Second))
+				}
+
+				if d.LastErrorCategory != nil {
+					out += metric("paths_source_last_error",
+						"{name=\""+i.Name+"\",category=\""+string(*d.LastErrorCategory)+"\"}", 1)
+				}
+			}
 		}
 	} else {
 		out += metric("paths", "", 0)
@@ -359,6 +383,17 @@ func (m *Metrics) onRequest(ctx *gin.Context) {
 		}
 	}
 
+	if !interfaceIsEmpty(m.recordCleaner) {
+		stats := m.recordCleaner.Stats()
+		out += metric("record_disk_usage_bytes", "", int64(stats.DiskUsage))
+
+		for _, e := range stats.Evictions {
+			tags := "{name=\"" + e.Path + "\",reason=\"" + string(e.Reason) + "\"}"
+			out += metric("record_evictions", tags, int64(e.Count))
+			out += metric("record_evicted_bytes", tags, int64(e.Bytes))
+		}
+	}
+
 	ctx.Writer.WriteHeader(http.StatusOK)
 	io.WriteString(ctx.Writer, out) //nolint:errcheck
 }
@@ -418,3 +453,10 @@ func (m *Metrics) SetWebRTCServer(s api.WebRTCServer) {
 	defer m.mutex.Unlock()
 	m.webRTCServer = s
 }
+
+// SetRecordCleaner is called by core.
+func (m *Metrics) SetRecordCleaner(s metricsRecordCleaner) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recordCleaner = s
+}
@@ -0,0 +1,555 @@
+package playback
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	exportQueueSize       = 64
+	exportCleanupInterval = 1 * time.Minute
+	exportJobFile         = "job.json"
+)
+
+var errExportQueueFull = errors.New("too many pending exports")
+
+type exportStatus string
+
+const (
+	exportStatusPending   exportStatus = "pending"
+	exportStatusRunning   exportStatus = "running"
+	exportStatusCompleted exportStatus = "completed"
+	exportStatusFailed    exportStatus = "failed"
+)
+
+func exportExtension(format string) string {
+	if format == "mpegts" {
+		return "ts"
+	}
+	return "mp4"
+}
+
+func exportFileName(pathName string, start time.Time, ext string) string {
+	return strings.ReplaceAll(pathName, "/", "_") + "_" + start.Format("2006-01-02_15-04-05") + "." + ext
+}
+
+type exportFile struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type exportJob struct {
+	ID        uuid.UUID         `json:"id"`
+	Paths     []string          `json:"paths"`
+	Start     time.Time         `json:"start"`
+	Duration  listEntryDuration `json:"duration"`
+	Format    string            `json:"format"`
+	Status    exportStatus      `json:"status"`
+	Progress  float64           `json:"progress"`
+	Error     string            `json:"error,omitempty"`
+	Created   time.Time         `json:"created"`
+	Completed *time.Time        `json:"completed,omitempty"`
+	FileName  string            `json:"fileName,omitempty"`
+	Size      int64             `json:"size"`
+	SHA256    string            `json:"sha256,omitempty"`
+	Files     []*exportFile     `json:"files"`
+
+	ctx       context.Context
+	ctxCancel func()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// muxerProgress reports the progress of a muxer and stops it when the context is canceled.
+type muxerProgress struct {
+	muxer
+	ctx        context.Context
+	duration   time.Duration
+	onProgress func(float64)
+
+	timeScales map[int]uint32
+	timeScale  uint32
+}
+
+func (m *muxerProgress) writeInit(init *fmp4.Init) {
+	m.timeScales = make(map[int]uint32)
+	for _, track := range init.Tracks {
+		m.timeScales[track.ID] = track.TimeScale
+	}
+	m.muxer.writeInit(init)
+}
+
+func (m *muxerProgress) setTrack(trackID int) {
+	m.timeScale = m.timeScales[trackID]
+	m.muxer.setTrack(trackID)
+}
+
+func (m *muxerProgress) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	err := m.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	if dts > 0 && m.timeScale != 0 && m.duration > 0 {
+		p := float64(durationMp4ToGo(dts, m.timeScale)) / float64(m.duration)
+		if p > 1 {
+			p = 1
+		}
+		m.onProgress(p)
+	}
+
+	return m.muxer.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
+
+// exportManager runs export jobs in background.
+type exportManager struct {
+	directory string
+	retention time.Duration
+	parent    *Server
+
+	ctx       context.Context
+	ctxCancel func()
+	mutex     sync.Mutex
+	jobs      map[uuid.UUID]*exportJob
+	queue     chan *exportJob
+
+	done chan struct{}
+}
+
+func (em *exportManager) initialize() {
+	em.ctx, em.ctxCancel = context.WithCancel(context.Background())
+	em.jobs = make(map[uuid.UUID]*exportJob)
+	em.queue = make(chan *exportJob, exportQueueSize)
+	em.done = make(chan struct{})
+
+	em.load()
+
+	go em.run()
+}
+
+func (em *exportManager) close() {
+	em.ctxCancel()
+	<-em.done
+}
+
+// load reads jobs of previous executions.
+func (em *exportManager) load() {
+	entries, err := os.ReadDir(em.directory)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		byts, err := os.ReadFile(filepath.Join(em.directory, entry.Name(), exportJobFile))
+		if err != nil {
+			continue
+		}
+
+		var job exportJob
+		err = json.Unmarshal(byts, &job)
+		if err != nil || job.ID.String() != entry.Name() {
+			continue
+		}
+
+		// the server was stopped while the job was running
+		if job.Status == exportStatusPending || job.Status == exportStatusRunning {
+			now := time.Now()
+			job.Status = exportStatusFailed
+			job.Error = "export interrupted"
+			job.Completed = &now
+			em.save(&job) //nolint:errcheck
+		}
+
+		job.ctx, job.ctxCancel = context.WithCancel(em.ctx)
+		em.jobs[job.ID] = &job
+	}
+}
+
+func (em *exportManager) jobDir(job *exportJob) string {
+	return filepath.Join(em.directory, job.ID.String())
+}
+
+// save writes a job to disk. It must be called with the mutex locked, or before the job is shared.
+func (em *exportManager) save(job *exportJob) error {
+	err := os.MkdirAll(em.jobDir(job), 0o755)
+	if err != nil {
+		return err
+	}
+
+	byts, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(em.jobDir(job), exportJobFile+".tmp")
+
+	err = os.WriteFile(tmpPath, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(em.jobDir(job), exportJobFile))
+}
+
+func (em *exportManager) add(paths []string, start time.Time, duration time.Duration, format string) (*exportJob, error) {
+	job := &exportJob{
+		ID:       uuid.New(),
+		Paths:    paths,
+		Start:    start,
+		Duration: listEntryDuration(duration),
+		Format:   format,
+		Status:   exportStatusPending,
+		Created:  time.Now(),
+		Files:    []*exportFile{},
+	}
+	job.ctx, job.ctxCancel = context.WithCancel(em.ctx)
+
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+
+	err := em.save(job)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case em.queue <- job:
+	default:
+		os.RemoveAll(em.jobDir(job)) //nolint:errcheck
+		return nil, errExportQueueFull
+	}
+
+	em.jobs[job.ID] = job
+
+	return em.snapshot(job), nil
+}
+
+// snapshot returns a copy of a job. It must be called with the mutex locked.
+func (em *exportManager) snapshot(job *exportJob) *exportJob {
+	cp := *job
+	cp.Files = append([]*exportFile{}, job.Files...)
+	return &cp
+}
+
+func (em *exportManager) get(id uuid.UUID) (*exportJob, bool) {
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+
+	job, ok := em.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	return em.snapshot(job), true
+}
+
+func (em *exportManager) filePath(job *exportJob) string {
+	return filepath.Join(em.jobDir(job), job.FileName)
+}
+
+func (em *exportManager) remove(id uuid.UUID) bool {
+	em.mutex.Lock()
+	job, ok := em.jobs[id]
+	if ok {
+		delete(em.jobs, id)
+
+		// stop the job if it is running; the worker ignores canceled jobs
+		job.ctxCancel()
+	}
+	em.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	err := os.RemoveAll(em.jobDir(job))
+	if err != nil {
+		em.parent.Log(logger.Warn, "unable to remove export %s: %v", job.ID, err)
+	}
+
+	return true
+}
+
+func (em *exportManager) run() {
+	defer close(em.done)
+
+	t := time.NewTicker(exportCleanupInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case job := <-em.queue:
+			em.runJob(job)
+
+		case <-t.C:
+			em.cleanup()
+
+		case <-em.ctx.Done():
+			return
+		}
+	}
+}
+
+// cleanup removes jobs that are older than the retention.
+func (em *exportManager) cleanup() {
+	if em.retention <= 0 {
+		return
+	}
+
+	var expired []uuid.UUID
+
+	em.mutex.Lock()
+	for id, job := range em.jobs {
+		if job.Completed != nil && time.Since(*job.Completed) > em.retention {
+			expired = append(expired, id)
+		}
+	}
+	em.mutex.Unlock()
+
+	for _, id := range expired {
+		em.remove(id)
+	}
+}
+
+func (em *exportManager) runJob(job *exportJob) {
+	em.mutex.Lock()
+
+	// job has been deleted while pending
+	if job.ctx.Err() != nil {
+		em.mutex.Unlock()
+		return
+	}
+
+	job.Status = exportStatusRunning
+	em.save(job) //nolint:errcheck
+	em.mutex.Unlock()
+
+	em.parent.Log(logger.Info, "export %s started", job.ID)
+
+	err := em.process(job)
+
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+
+	// job has been deleted while running
+	if job.ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	job.Completed = &now
+
+	if err != nil {
+		em.parent.Log(logger.Error, "export %s failed: %v", job.ID, err)
+		job.Status = exportStatusFailed
+		job.Error = err.Error()
+		job.Files = []*exportFile{}
+	} else {
+		em.parent.Log(logger.Info, "export %s completed", job.ID)
+		job.Status = exportStatusCompleted
+		job.Progress = 1
+	}
+
+	err = em.save(job)
+	if err != nil {
+		em.parent.Log(logger.Warn, "unable to save export %s: %v", job.ID, err)
+	}
+}
+
+func (em *exportManager) setProgress(job *exportJob, v float64) {
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+	job.Progress = v
+}
+
+func (em *exportManager) exportPath(job *exportJob, i int, w io.Writer) error {
+	pathName := job.Paths[i]
+
+	pathConf, err := em.parent.safeFindPathConf(pathName)
+	if err != nil {
+		return err
+	}
+
+	duration := time.Duration(job.Duration)
+
+	segments, err := em.parent.Index.FindSegmentsInTimespan(pathConf, pathName, job.Start, duration)
+	if err != nil {
+		return fmt.Errorf("%s: %w", pathName, err)
+	}
+
+	var m muxer
+	switch job.Format {
+	case "fmp4":
+		m = &muxerFMP4{w: w}
+
+	case "mpegts":
+		m = &muxerMPEGTS{w: w}
+
+	default:
+		m = &muxerMP4{w: w}
+	}
+
+	n := float64(len(job.Paths))
+
+	return seekAndMux(pathConf, segments, job.Start, duration, &muxerProgress{
+		muxer:    m,
+		ctx:      job.ctx,
+		duration: duration,
+		onProgress: func(p float64) {
+			em.setProgress(job, (float64(i)+p)/n)
+		},
+	})
+}
+
+func (em *exportManager) process(job *exportJob) error {
+	err := os.MkdirAll(em.jobDir(job), 0o755)
+	if err != nil {
+		return err
+	}
+
+	ext := exportExtension(job.Format)
+
+	var fileName string
+	if len(job.Paths) == 1 {
+		fileName = exportFileName(job.Paths[0], job.Start, ext)
+	} else {
+		fileName = exportFileName("export", job.Start, "zip")
+	}
+
+	fpath := filepath.Join(em.jobDir(job), fileName)
+
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	cw := &countingWriter{}
+
+	var files []*exportFile
+
+	if len(job.Paths) == 1 {
+		err = em.exportPath(job, 0, io.MultiWriter(f, h, cw))
+		if err == nil {
+			files = []*exportFile{{
+				Path:   job.Paths[0],
+				Name:   fileName,
+				Size:   cw.n,
+				SHA256: hex.EncodeToString(h.Sum(nil)),
+			}}
+		}
+	} else {
+		files, err = em.exportBundle(job, io.MultiWriter(f, h, cw), ext)
+	}
+
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		os.Remove(fpath) //nolint:errcheck
+		return err
+	}
+
+	em.mutex.Lock()
+	defer em.mutex.Unlock()
+
+	job.FileName = fileName
+	job.Size = cw.n
+	job.SHA256 = hex.EncodeToString(h.Sum(nil))
+	job.Files = files
+
+	return nil
+}
+
+// exportBundle writes recordings of multiple paths into a ZIP archive,
+// together with their checksums.
+func (em *exportManager) exportBundle(job *exportJob, w io.Writer, ext string) ([]*exportFile, error) {
+	zw := zip.NewWriter(w)
+	files := make([]*exportFile, len(job.Paths))
+	var sums strings.Builder
+
+	for i, pathName := range job.Paths {
+		name := exportFileName(pathName, job.Start, ext)
+
+		// media files are already compressed
+		ew, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var h hash.Hash = sha256.New()
+		cw := &countingWriter{}
+
+		err = em.exportPath(job, i, io.MultiWriter(ew, h, cw))
+		if err != nil {
+			return nil, err
+		}
+
+		files[i] = &exportFile{
+			Path:   pathName,
+			Name:   name,
+			Size:   cw.n,
+			SHA256: hex.EncodeToString(h.Sum(nil)),
+		}
+
+		sums.WriteString(files[i].SHA256 + "  " + name + "\n")
+	}
+
+	ew, err := zw.Create("SHA256SUMS")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(ew, sums.String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -32,6 +32,11 @@ func findTrack(tracks []*muxerFMP4Track, id int) *muxerFMP4Track {
 type muxerFMP4 struct {
 	w io.Writer
 
+	// do not write the initialization segment
+	skipInit bool
+	// offset added to the base time of parts
+	baseTime time.Duration
+
 	init               *fmp4.Init
 	nextSequenceNumber uint32
 	tracks             []*muxerFMP4Track
@@ -40,7 +45,9 @@ type muxerFMP4 struct {
 }
 
 func (w *muxerFMP4) writeInit(init *fmp4.Init) {
-	w.init = init
+	if !w.skipInit {
+		w.init = init
+	}
 
 	w.tracks = make([]*muxerFMP4Track, len(init.Tracks))
 
@@ -145,7 +152,7 @@ func (w *muxerFMP4) innerFlush(final bool) error {
 
 			part.Tracks = append(part.Tracks, &fmp4.PartTrack{
 				ID:       track.id,
-				BaseTime: uint64(track.firstDTS),
+				BaseTime: uint64(track.firstDTS + durationGoToMp4(w.baseTime, track.timeScale)),
 				Samples:  samples,
 			})
 
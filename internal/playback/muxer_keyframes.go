@@ -0,0 +1,47 @@
+package playback
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+)
+
+// muxerKeyframes is a muxer that collects timestamps of keyframes of the first video track.
+type muxerKeyframes struct {
+	videoTrack *fmp4.InitTrack
+	curTrackID int
+	keyframes  []time.Duration
+}
+
+func (w *muxerKeyframes) writeInit(init *fmp4.Init) {
+	for _, track := range init.Tracks {
+		if track.Codec.IsVideo() {
+			w.videoTrack = track
+			break
+		}
+	}
+}
+
+func (w *muxerKeyframes) setTrack(trackID int) {
+	w.curTrackID = trackID
+}
+
+func (w *muxerKeyframes) writeSample(
+	dts int64,
+	_ int32,
+	isNonSyncSample bool,
+	_ uint32,
+	_ func() ([]byte, error),
+) error {
+	if w.videoTrack != nil && w.curTrackID == w.videoTrack.ID && !isNonSyncSample && dts >= 0 {
+		w.keyframes = append(w.keyframes, durationMp4ToGo(dts, w.videoTrack.TimeScale))
+	}
+	return nil
+}
+
+func (w *muxerKeyframes) writeFinalDTS(_ int64) {
+}
+
+func (w *muxerKeyframes) flush() error {
+	return nil
+}
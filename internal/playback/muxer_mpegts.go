@@ -0,0 +1,259 @@
+package playback
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+)
+
+// timestamps are shifted by this value,
+// since PCR precedes DTS and can't be negative.
+const muxerMPEGTSBaseTime = 90000
+
+type muxerMPEGTSSample struct {
+	dts             int64
+	ptsOffset       int32
+	isNonSyncSample bool
+	getPayload      func() ([]byte, error)
+}
+
+type muxerMPEGTSTrack struct {
+	id        int
+	timeScale uint32
+	codec     fmp4.Codec
+	track     *mpegts.Track
+	samples   []*muxerMPEGTSSample
+	lastDTS   int64
+}
+
+func (t *muxerMPEGTSTrack) toMPEGTS(v int64) int64 {
+	return durationGoToMp4(durationMp4ToGo(v, t.timeScale), 90000)
+}
+
+func fmp4ToMPEGTSCodec(codec fmp4.Codec) mpegts.Codec {
+	switch codec := codec.(type) {
+	case *fmp4.CodecH264:
+		return &mpegts.CodecH264{}
+
+	case *fmp4.CodecH265:
+		return &mpegts.CodecH265{}
+
+	case *fmp4.CodecMPEG4Video:
+		return &mpegts.CodecMPEG4Video{}
+
+	case *fmp4.CodecMPEG1Video:
+		return &mpegts.CodecMPEG1Video{}
+
+	case *fmp4.CodecOpus:
+		return &mpegts.CodecOpus{
+			ChannelCount: codec.ChannelCount,
+		}
+
+	case *fmp4.CodecMPEG4Audio:
+		return &mpegts.CodecMPEG4Audio{
+			Config: codec.Config,
+		}
+
+	case *fmp4.CodecMPEG1Audio:
+		return &mpegts.CodecMPEG1Audio{}
+
+	case *fmp4.CodecAC3:
+		return &mpegts.CodecAC3{
+			SampleRate:   codec.SampleRate,
+			ChannelCount: codec.ChannelCount,
+		}
+	}
+
+	return nil
+}
+
+// muxerMPEGTS converts samples into a MPEG-TS stream.
+// Samples are buffered until flush(), in order to interleave tracks.
+type muxerMPEGTS struct {
+	w io.Writer
+
+	tracks   []*muxerMPEGTSTrack
+	curTrack *muxerMPEGTSTrack
+}
+
+func (w *muxerMPEGTS) writeInit(init *fmp4.Init) {
+	w.tracks = nil
+
+	for _, track := range init.Tracks {
+		codec := fmp4ToMPEGTSCodec(track.Codec)
+		if codec == nil {
+			continue
+		}
+
+		w.tracks = append(w.tracks, &muxerMPEGTSTrack{
+			id:        track.ID,
+			timeScale: track.TimeScale,
+			codec:     track.Codec,
+			track:     &mpegts.Track{Codec: codec},
+		})
+	}
+}
+
+func (w *muxerMPEGTS) setTrack(trackID int) {
+	w.curTrack = nil
+
+	for _, track := range w.tracks {
+		if track.id == trackID {
+			w.curTrack = track
+			break
+		}
+	}
+}
+
+func (w *muxerMPEGTS) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	_ uint32,
+	getPayload func() ([]byte, error),
+) error {
+	// track is not supported
+	if w.curTrack == nil {
+		return nil
+	}
+
+	// remove GOPs before the GOP of the first frame
+	if (dts < 0 || (dts >= 0 && w.curTrack.lastDTS < 0)) && !isNonSyncSample {
+		w.curTrack.samples = nil
+	}
+
+	// the first sample must be a random access point
+	if w.curTrack.samples == nil && isNonSyncSample {
+		return nil
+	}
+
+	w.curTrack.samples = append(w.curTrack.samples, &muxerMPEGTSSample{
+		dts:             dts,
+		ptsOffset:       ptsOffset,
+		isNonSyncSample: isNonSyncSample,
+		getPayload:      getPayload,
+	})
+	w.curTrack.lastDTS = dts
+
+	return nil
+}
+
+func (w *muxerMPEGTS) writeFinalDTS(_ int64) {
+}
+
+func (w *muxerMPEGTS) writeTrackSample(
+	mw *mpegts.Writer,
+	track *muxerMPEGTSTrack,
+	sample *muxerMPEGTSSample,
+	dts int64,
+) error {
+	payload, err := sample.getPayload()
+	if err != nil {
+		return err
+	}
+
+	pts := dts + track.toMPEGTS(int64(sample.ptsOffset))
+	randomAccess := !sample.isNonSyncSample
+
+	switch codec := track.codec.(type) {
+	case *fmp4.CodecH264:
+		au, err := h264.AVCCUnmarshal(payload)
+		if err != nil {
+			return err
+		}
+
+		// parameters are stored into the initialization segment
+		if randomAccess {
+			au = append([][]byte{codec.SPS, codec.PPS}, au...)
+		}
+
+		return mw.WriteH264(track.track, pts, dts, randomAccess, au)
+
+	case *fmp4.CodecH265:
+		au, err := h264.AVCCUnmarshal(payload)
+		if err != nil {
+			return err
+		}
+
+		if randomAccess {
+			au = append([][]byte{codec.VPS, codec.SPS, codec.PPS}, au...)
+		}
+
+		return mw.WriteH265(track.track, pts, dts, randomAccess, au)
+
+	case *fmp4.CodecMPEG4Video:
+		return mw.WriteMPEG4Video(track.track, pts, payload)
+
+	case *fmp4.CodecMPEG1Video:
+		return mw.WriteMPEG1Video(track.track, pts, payload)
+
+	case *fmp4.CodecOpus:
+		return mw.WriteOpus(track.track, pts, [][]byte{payload})
+
+	case *fmp4.CodecMPEG4Audio:
+		return mw.WriteMPEG4Audio(track.track, pts, [][]byte{payload})
+
+	case *fmp4.CodecMPEG1Audio:
+		return mw.WriteMPEG1Audio(track.track, pts, [][]byte{payload})
+
+	case *fmp4.CodecAC3:
+		return mw.WriteAC3(track.track, pts, payload)
+	}
+
+	return fmt.Errorf("unsupported codec: %T", track.codec)
+}
+
+func (w *muxerMPEGTS) flush() error {
+	if len(w.tracks) == 0 {
+		return fmt.Errorf("none of the tracks can be converted to MPEG-TS")
+	}
+
+	type entry struct {
+		track  *muxerMPEGTSTrack
+		sample *muxerMPEGTSSample
+		dts    int64
+	}
+
+	var entries []*entry
+	var minDTS int64
+
+	for _, track := range w.tracks {
+		for _, sample := range track.samples {
+			e := &entry{
+				track:  track,
+				sample: sample,
+				dts:    track.toMPEGTS(sample.dts),
+			}
+			if len(entries) == 0 || e.dts < minDTS {
+				minDTS = e.dts
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].dts < entries[j].dts
+	})
+
+	tracks := make([]*mpegts.Track, len(w.tracks))
+	for i, track := range w.tracks {
+		tracks[i] = track.track
+	}
+
+	bw := bufio.NewWriter(w.w)
+	mw := mpegts.NewWriter(bw, tracks)
+
+	for _, e := range entries {
+		err := w.writeTrackSample(mw, e.track, e.sample, e.dts-minDTS+muxerMPEGTSBaseTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,190 @@
+package playback
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errExportsDisabled = errors.New("exports are disabled")
+
+type exportRequest struct {
+	Paths    []string          `json:"paths"`
+	Start    time.Time         `json:"start"`
+	Duration listEntryDuration `json:"duration"`
+	Format   string            `json:"format"`
+}
+
+func (s *Server) exportsEnabled(ctx *gin.Context) bool {
+	if s.exports == nil {
+		s.writeError(ctx, http.StatusBadRequest, errExportsDisabled)
+		return false
+	}
+	return true
+}
+
+// exportsFindJob returns the job of a request.
+// Access to a job requires access to all its paths.
+func (s *Server) exportsFindJob(ctx *gin.Context) (*exportJob, bool) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err))
+		return nil, false
+	}
+
+	job, ok := s.exports.get(id)
+	if !ok {
+		s.writeError(ctx, http.StatusNotFound, fmt.Errorf("export not found"))
+		return nil, false
+	}
+
+	for _, pathName := range job.Paths {
+		if !s.doAuth(ctx, pathName) {
+			return nil, false
+		}
+	}
+
+	return job, true
+}
+
+func (s *Server) onExportsAdd(ctx *gin.Context) {
+	if !s.exportsEnabled(ctx) {
+		return
+	}
+
+	var req exportRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	if len(req.Paths) == 0 {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("no paths provided"))
+		return
+	}
+
+	for _, pathName := range req.Paths {
+		if !s.doAuth(ctx, pathName) {
+			return
+		}
+	}
+
+	if req.Start.IsZero() {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start"))
+		return
+	}
+
+	if req.Duration <= 0 {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration"))
+		return
+	}
+
+	switch req.Format {
+	case "":
+		req.Format = "mp4"
+
+	case "mp4", "fmp4", "mpegts":
+
+	default:
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", req.Format))
+		return
+	}
+
+	seen := make(map[string]struct{})
+
+	for _, pathName := range req.Paths {
+		if _, ok := seen[pathName]; ok {
+			s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("duplicate path: %s", pathName))
+			return
+		}
+		seen[pathName] = struct{}{}
+
+		pathConf, err := s.safeFindPathConf(pathName)
+		if err != nil {
+			s.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		_, err = s.Index.FindSegmentsInTimespan(pathConf, pathName, req.Start, time.Duration(req.Duration))
+		if err != nil {
+			if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+				s.writeError(ctx, http.StatusNotFound, fmt.Errorf("%s: %w", pathName, err))
+			} else {
+				s.writeError(ctx, http.StatusBadRequest, err)
+			}
+			return
+		}
+	}
+
+	job, err := s.exports.add(req.Paths, req.Start, time.Duration(req.Duration), req.Format)
+	if err != nil {
+		if errors.Is(err, errExportQueueFull) {
+			s.writeError(ctx, http.StatusServiceUnavailable, err)
+		} else {
+			s.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+func (s *Server) onExportsGet(ctx *gin.Context) {
+	if !s.exportsEnabled(ctx) {
+		return
+	}
+
+	job, ok := s.exportsFindJob(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+func (s *Server) onExportsDownload(ctx *gin.Context) {
+	if !s.exportsEnabled(ctx) {
+		return
+	}
+
+	job, ok := s.exportsFindJob(ctx)
+	if !ok {
+		return
+	}
+
+	if job.Status != exportStatusCompleted {
+		s.writeError(ctx, http.StatusConflict, fmt.Errorf("export is %s", job.Status))
+		return
+	}
+
+	// allow clients to verify the integrity of the file (RFC 9530)
+	sum, err := hex.DecodeString(job.SHA256)
+	if err == nil {
+		ctx.Header("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+	}
+
+	ctx.FileAttachment(s.exports.filePath(job), job.FileName)
+}
+
+func (s *Server) onExportsDelete(ctx *gin.Context) {
+	if !s.exportsEnabled(ctx) {
+		return
+	}
+
+	job, ok := s.exportsFindJob(ctx)
+	if !ok {
+		return
+	}
+
+	s.exports.remove(job.ID)
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,190 @@
+package playback
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnExports(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = os.Mkdir(filepath.Join(dir, "tspath"), 0o755)
+	require.NoError(t, err)
+
+	writeSegment1(t, filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4"))
+	writeSegmentMPEGTS1(t, filepath.Join(dir, "tspath", "2008-11-07_11-22-00-500000.ts"))
+
+	s := &Server{
+		Address:         "127.0.0.1:9996",
+		ReadTimeout:     conf.StringDuration(10 * time.Second),
+		ExportPath:      filepath.Join(dir, "exports"),
+		ExportRetention: conf.StringDuration(24 * time.Hour),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:       "mypath",
+				RecordPath: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			},
+			"tspath": {
+				Name:         "tspath",
+				RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat: conf.RecordFormatMPEGTS,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	export := func(t *testing.T, paths []string, format string) (*exportJob, []byte) {
+		byts, err2 := json.Marshal(map[string]interface{}{
+			"paths":    paths,
+			"start":    time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local),
+			"duration": 35,
+			"format":   format,
+		})
+		require.NoError(t, err2)
+
+		res, err2 := http.Post("http://localhost:9996/playback/exports", "application/json", bytes.NewReader(byts))
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+
+		var job exportJob
+		err2 = json.NewDecoder(res.Body).Decode(&job)
+		require.NoError(t, err2)
+
+		jobURL := "http://localhost:9996/playback/exports/" + job.ID.String()
+
+		for i := 0; ; i++ {
+			require.Less(t, i, 100)
+
+			func() {
+				res2, err3 := http.Get(jobURL)
+				require.NoError(t, err3)
+				defer res2.Body.Close()
+
+				require.Equal(t, http.StatusOK, res2.StatusCode)
+
+				err3 = json.NewDecoder(res2.Body).Decode(&job)
+				require.NoError(t, err3)
+			}()
+
+			if job.Status == exportStatusCompleted || job.Status == exportStatusFailed {
+				break
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		require.Equal(t, exportStatusCompleted, job.Status)
+		require.Equal(t, float64(1), job.Progress)
+
+		res, err2 = http.Get(jobURL + "/download")
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		buf, err2 := io.ReadAll(res.Body)
+		require.NoError(t, err2)
+
+		sum := sha256.Sum256(buf)
+		require.Equal(t, hex.EncodeToString(sum[:]), job.SHA256)
+		require.Equal(t, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":", res.Header.Get("Repr-Digest"))
+		require.Equal(t, int64(len(buf)), job.Size)
+
+		return &job, buf
+	}
+
+	remove := func(t *testing.T, job *exportJob) {
+		req, err2 := http.NewRequest(http.MethodDelete,
+			"http://localhost:9996/playback/exports/"+job.ID.String(), nil)
+		require.NoError(t, err2)
+
+		res, err2 := http.DefaultClient.Do(req)
+		require.NoError(t, err2)
+		res.Body.Close()
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		res, err2 = http.Get("http://localhost:9996/playback/exports/" + job.ID.String())
+		require.NoError(t, err2)
+		res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+		_, err2 = os.Stat(filepath.Join(dir, "exports", job.ID.String()))
+		require.True(t, os.IsNotExist(err2))
+	}
+
+	t.Run("mp4", func(t *testing.T) {
+		job, buf := export(t, []string{"mypath"}, "")
+		require.Equal(t, "mp4", job.Format)
+		require.Equal(t, "mypath_2008-11-07_11-22-00.mp4", job.FileName)
+		require.Equal(t, []byte("ftyp"), buf[4:8])
+		require.Len(t, job.Files, 1)
+		require.Equal(t, job.SHA256, job.Files[0].SHA256)
+		remove(t, job)
+	})
+
+	t.Run("mpegts", func(t *testing.T) {
+		job, buf := export(t, []string{"tspath"}, "mpegts")
+		require.Equal(t, "tspath_2008-11-07_11-22-00.ts", job.FileName)
+		require.Equal(t, 0, len(buf)%188)
+		require.Equal(t, byte(0x47), buf[0])
+		remove(t, job)
+	})
+
+	t.Run("bundle", func(t *testing.T) {
+		job, buf := export(t, []string{"mypath", "tspath"}, "mp4")
+		require.Len(t, job.Files, 2)
+
+		zr, err2 := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+		require.NoError(t, err2)
+		require.Len(t, zr.File, 3)
+
+		for i, f := range job.Files {
+			require.Equal(t, f.Name, zr.File[i].Name)
+
+			r, err3 := zr.File[i].Open()
+			require.NoError(t, err3)
+			content, err3 := io.ReadAll(r)
+			require.NoError(t, err3)
+			r.Close()
+
+			sum := sha256.Sum256(content)
+			require.Equal(t, hex.EncodeToString(sum[:]), f.SHA256)
+		}
+
+		require.Equal(t, "SHA256SUMS", zr.File[2].Name)
+		remove(t, job)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		res, err2 := http.Post("http://localhost:9996/playback/exports", "application/json",
+			bytes.NewReader([]byte(`{"paths":["mypath"],"start":"2005-01-01T00:00:00Z","duration":3}`)))
+		require.NoError(t, err2)
+		res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
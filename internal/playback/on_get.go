@@ -3,9 +3,9 @@ package playback
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
@@ -17,15 +17,16 @@ import (
 )
 
 type writerWrapper struct {
-	ctx     *gin.Context
-	written bool
+	ctx         *gin.Context
+	contentType string
+	written     bool
 }
 
 func (w *writerWrapper) Write(p []byte) (int, error) {
 	if !w.written {
 		w.written = true
 		w.ctx.Header("Accept-Ranges", "none")
-		w.ctx.Header("Content-Type", "video/mp4")
+		w.ctx.Header("Content-Type", w.contentType)
 	}
 	return w.ctx.Writer.Write(p)
 }
@@ -41,23 +42,28 @@ func parseDuration(raw string) (time.Duration, error) {
 }
 
 func seekAndMux(
-	recordFormat conf.RecordFormat,
+	pathConf *conf.Path,
 	segments []*recordstore.Segment,
 	start time.Time,
 	duration time.Duration,
 	m muxer,
 ) error {
-	if recordFormat == conf.RecordFormatFMP4 {
+	if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
 		var firstInit *fmp4.Init
 		var segmentEnd time.Time
 
-		f, err := os.Open(segments[0].Fpath)
+		f, err := recordstore.OpenSegment(pathConf, segments[0].Fpath)
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
-		firstInit, err = segmentFMP4ReadInit(f)
+		firstInit, err = segmentMPEGTSReadInit(f)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.Seek(0, io.SeekStart)
 		if err != nil {
 			return err
 		}
@@ -66,7 +72,7 @@ func seekAndMux(
 
 		segmentStartOffset := start.Sub(segments[0].Start)
 
-		segmentMaxElapsed, err := segmentFMP4SeekAndMuxParts(f, segmentStartOffset, duration, firstInit, m)
+		segmentMaxElapsed, err := segmentMPEGTSSeekAndMux(f, segmentStartOffset, duration, m)
 		if err != nil {
 			return err
 		}
@@ -74,26 +80,31 @@ func seekAndMux(
 		segmentEnd = start.Add(segmentMaxElapsed)
 
 		for _, seg := range segments[1:] {
-			f, err = os.Open(seg.Fpath)
+			f, err = recordstore.OpenSegment(pathConf, seg.Fpath)
 			if err != nil {
 				return err
 			}
 			defer f.Close()
 
 			var init *fmp4.Init
-			init, err = segmentFMP4ReadInit(f)
+			init, err = segmentMPEGTSReadInit(f)
 			if err != nil {
 				return err
 			}
 
-			if !segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
+			if !segmentMPEGTSCanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
 				break
 			}
 
+			_, err = f.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+
 			segmentStartOffset := seg.Start.Sub(start)
 
 			var segmentMaxElapsed time.Duration
-			segmentMaxElapsed, err = segmentFMP4MuxParts(f, segmentStartOffset, duration, firstInit, m)
+			segmentMaxElapsed, err = segmentMPEGTSMux(f, segmentStartOffset, duration, m)
 			if err != nil {
 				return err
 			}
@@ -101,15 +112,68 @@ func seekAndMux(
 			segmentEnd = start.Add(segmentMaxElapsed)
 		}
 
-		err = m.flush()
+		return m.flush()
+	}
+
+	var firstInit *fmp4.Init
+	var segmentEnd time.Time
+
+	f, err := recordstore.OpenSegment(pathConf, segments[0].Fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	firstInit, err = segmentFMP4ReadInit(f)
+	if err != nil {
+		return err
+	}
+
+	m.writeInit(firstInit)
+
+	segmentStartOffset := start.Sub(segments[0].Start)
+
+	segmentMaxElapsed, err := segmentFMP4SeekAndMuxParts(f, segmentStartOffset, duration, firstInit, m)
+	if err != nil {
+		return err
+	}
+
+	segmentEnd = start.Add(segmentMaxElapsed)
+
+	for _, seg := range segments[1:] {
+		f, err = recordstore.OpenSegment(pathConf, seg.Fpath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var init *fmp4.Init
+		init, err = segmentFMP4ReadInit(f)
+		if err != nil {
+			return err
+		}
+
+		if !segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
+			break
+		}
+
+		segmentStartOffset := seg.Start.Sub(start)
+
+		var segmentMaxElapsed time.Duration
+		segmentMaxElapsed, err = segmentFMP4MuxParts(f, segmentStartOffset, duration, firstInit, m)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		segmentEnd = start.Add(segmentMaxElapsed)
 	}
 
-	return fmt.Errorf("MPEG-TS format is not supported yet")
+	err = m.flush()
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func (s *Server) onGet(ctx *gin.Context) {
@@ -131,7 +195,7 @@ func (s *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	ww := &writerWrapper{ctx: ctx}
+	ww := &writerWrapper{ctx: ctx, contentType: "video/mp4"}
 	var m muxer
 
 	format := ctx.Query("format")
@@ -142,6 +206,10 @@ func (s *Server) onGet(ctx *gin.Context) {
 	case "mp4":
 		m = &muxerMP4{w: ww}
 
+	case "mpegts":
+		ww.contentType = "video/mp2t"
+		m = &muxerMPEGTS{w: ww}
+
 	default:
 		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
 		return
@@ -153,7 +221,7 @@ func (s *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	segments, err := recordstore.FindSegmentsInTimespan(pathConf, pathName, start, duration)
+	segments, err := s.Index.FindSegmentsInTimespan(pathConf, pathName, start, duration)
 	if err != nil {
 		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
 			s.writeError(ctx, http.StatusNotFound, err)
@@ -163,26 +231,30 @@ func (s *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	err = seekAndMux(pathConf.RecordFormat, segments, start, duration, m)
+	err = seekAndMux(pathConf, segments, start, duration, m)
 	if err != nil {
-		// user aborted the download
-		var neterr *net.OpError
-		if errors.As(err, &neterr) {
-			return
-		}
+		s.writeMuxError(ctx, ww, err)
+		return
+	}
+}
 
-		// nothing has been written yet; send back JSON
-		if !ww.written {
-			if errors.Is(err, recordstore.ErrNoSegmentsFound) {
-				s.writeError(ctx, http.StatusNotFound, err)
-			} else {
-				s.writeError(ctx, http.StatusBadRequest, err)
-			}
-			return
-		}
+func (s *Server) writeMuxError(ctx *gin.Context, ww *writerWrapper, err error) {
+	// user aborted the download
+	var neterr *net.OpError
+	if errors.As(err, &neterr) {
+		return
+	}
 
-		// something has already been written: abort and write logs only
-		s.Log(logger.Error, err.Error())
+	// nothing has been written yet; send back JSON
+	if !ww.written {
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			s.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			s.writeError(ctx, http.StatusBadRequest, err)
+		}
 		return
 	}
+
+	// something has already been written: abort and write logs only
+	s.Log(logger.Error, err.Error())
 }
@@ -0,0 +1,373 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gohlslib/pkg/playlist"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// minimum duration of HLS parts.
+	// Parts are cut at keyframes, therefore they can be longer than this.
+	hlsMinPartDuration = 2 * time.Second
+
+	hlsPlaylistFile = "index.m3u8"
+	hlsInitFile     = "init.mp4"
+	hlsPartFile     = "part.mp4"
+)
+
+type hlsPart struct {
+	start    time.Time
+	duration time.Duration
+}
+
+func segmentReadInit(recordFormat conf.RecordFormat, r io.ReadSeeker) (*fmp4.Init, error) {
+	if recordFormat == conf.RecordFormatMPEGTS {
+		return segmentMPEGTSReadInit(r)
+	}
+	return segmentFMP4ReadInit(r)
+}
+
+// hlsReadSegment returns initialization, duration and keyframes of a segment.
+// Keyframes are taken from the index when available, otherwise they are read from the segment.
+func (s *Server) hlsReadSegment(
+	pathConf *conf.Path,
+	seg *recordstore.Segment,
+) (*fmp4.Init, time.Duration, []time.Duration, error) {
+	f, err := recordstore.OpenSegment(pathConf, seg.Fpath)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer f.Close()
+
+	init, err := segmentReadInit(pathConf.RecordFormat, f)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if indexed, ok := s.Index.Get(seg.Fpath); ok && indexed.Complete && indexed.Duration != 0 {
+		keyframes := make([]time.Duration, len(indexed.Keyframes))
+		for i, keyframe := range indexed.Keyframes {
+			keyframes[i] = keyframe.Offset
+		}
+		return init, indexed.Duration, keyframes, nil
+	}
+
+	m := &muxerKeyframes{}
+	m.writeInit(init)
+
+	var maxElapsed time.Duration
+
+	if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+
+		maxElapsed, err = segmentMPEGTSMux(f, 0, time.Duration(math.MaxInt64), m)
+	} else {
+		maxElapsed, err = segmentFMP4MuxParts(f, 0, time.Duration(math.MaxInt64), init, m)
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	return init, maxElapsed, m.keyframes, nil
+}
+
+// hlsComputeParts splits the requested timespan into parts that start with a keyframe.
+// Segments that cannot be concatenated to the first one are excluded, as in /get.
+func (s *Server) hlsComputeParts(
+	pathConf *conf.Path,
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+) ([]*hlsPart, error) {
+	var firstInit *fmp4.Init
+	var segmentEnd time.Time
+	var keyframes []time.Time
+
+	for _, seg := range segments {
+		init, segDuration, segKeyframes, err := s.hlsReadSegment(pathConf, seg)
+		if err != nil {
+			return nil, err
+		}
+
+		if firstInit == nil {
+			firstInit = init
+		} else {
+			var canBeConcatenated bool
+			if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
+				canBeConcatenated = segmentMPEGTSCanBeConcatenated(firstInit, segmentEnd, init, seg.Start)
+			} else {
+				canBeConcatenated = segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start)
+			}
+			if !canBeConcatenated {
+				break
+			}
+		}
+
+		for _, keyframe := range segKeyframes {
+			keyframes = append(keyframes, seg.Start.Add(keyframe))
+		}
+
+		segmentEnd = seg.Start.Add(segDuration)
+	}
+
+	if segments[0].Start.After(start) {
+		start = segments[0].Start
+	}
+
+	end := start.Add(duration)
+	if segmentEnd.Before(end) {
+		end = segmentEnd
+	}
+
+	if !end.After(start) {
+		return nil, recordstore.ErrNoSegmentsFound
+	}
+
+	hasVideo := false
+	for _, track := range firstInit.Tracks {
+		if track.Codec.IsVideo() {
+			hasVideo = true
+			break
+		}
+	}
+
+	var parts []*hlsPart
+	partStart := start
+
+	addPart := func(partEnd time.Time) {
+		parts = append(parts, &hlsPart{
+			start:    partStart,
+			duration: partEnd.Sub(partStart),
+		})
+		partStart = partEnd
+	}
+
+	if hasVideo {
+		for _, keyframe := range keyframes {
+			if !keyframe.Before(end) {
+				break
+			}
+
+			if keyframe.Sub(partStart) >= hlsMinPartDuration {
+				addPart(keyframe)
+			}
+		}
+	} else {
+		// all audio samples are random access points
+		for end.Sub(partStart) > hlsMinPartDuration {
+			addPart(partStart.Add(hlsMinPartDuration))
+		}
+	}
+
+	addPart(end)
+
+	return parts, nil
+}
+
+func hlsQuery(ctx *gin.Context, start time.Time, duration *time.Duration) string {
+	// keep additional parameters, like credentials
+	v := ctx.Request.URL.Query()
+	v.Set("start", start.Format(time.RFC3339Nano))
+	if duration != nil {
+		v.Set("duration", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64))
+	} else {
+		v.Del("duration")
+	}
+	return v.Encode()
+}
+
+func (s *Server) onHLS(ctx *gin.Context) {
+	rest := strings.TrimPrefix(ctx.Param("rest"), "/")
+
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 {
+		s.writeError(ctx, http.StatusNotFound, fmt.Errorf("invalid path"))
+		return
+	}
+
+	pathName := rest[:i]
+	file := rest[i+1:]
+
+	switch file {
+	case hlsPlaylistFile, hlsInitFile, hlsPartFile:
+	default:
+		s.writeError(ctx, http.StatusNotFound, fmt.Errorf("invalid file: %s", file))
+		return
+	}
+
+	if !s.doAuth(ctx, pathName) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	var duration time.Duration
+
+	if file != hlsInitFile {
+		duration, err = parseDuration(ctx.Query("duration"))
+		if err != nil {
+			s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+			return
+		}
+	}
+
+	pathConf, err := s.safeFindPathConf(pathName)
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	segments, err := s.Index.FindSegmentsInTimespan(pathConf, pathName, start, duration)
+	if err != nil {
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			s.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			s.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	switch file {
+	case hlsPlaylistFile:
+		s.onHLSPlaylist(ctx, pathConf, segments, start, duration)
+
+	case hlsInitFile:
+		s.onHLSInit(ctx, pathConf, segments)
+
+	case hlsPartFile:
+		s.onHLSPart(ctx, pathConf, segments, start, duration)
+	}
+}
+
+func (s *Server) onHLSPlaylist(
+	ctx *gin.Context,
+	pathConf *conf.Path,
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+) {
+	parts, err := s.hlsComputeParts(pathConf, segments, start, duration)
+	if err != nil {
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			s.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			s.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	playlistType := playlist.MediaPlaylistType(playlist.MediaPlaylistTypeVOD)
+	targetDuration := 0
+
+	pl := &playlist.Media{
+		Version:             7,
+		IndependentSegments: true,
+		PlaylistType:        &playlistType,
+		Map: &playlist.MediaMap{
+			URI: hlsInitFile + "?" + hlsQuery(ctx, parts[0].start, nil),
+		},
+		Endlist: true,
+	}
+
+	for _, part := range parts {
+		partStart := part.start
+		partDuration := part.duration
+
+		pl.Segments = append(pl.Segments, &playlist.MediaSegment{
+			DateTime: &partStart,
+			Duration: partDuration,
+			URI:      hlsPartFile + "?" + hlsQuery(ctx, partStart, &partDuration),
+		})
+
+		if v := int(math.Ceil(partDuration.Seconds())); v > targetDuration {
+			targetDuration = v
+		}
+	}
+
+	pl.TargetDuration = targetDuration
+
+	buf, err := pl.Marshal()
+	if err != nil {
+		s.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/vnd.apple.mpegurl")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(buf) //nolint:errcheck
+}
+
+func (s *Server) onHLSInit(
+	ctx *gin.Context,
+	pathConf *conf.Path,
+	segments []*recordstore.Segment,
+) {
+	init, err := func() (*fmp4.Init, error) {
+		f, err := recordstore.OpenSegment(pathConf, segments[0].Fpath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return segmentReadInit(pathConf.RecordFormat, f)
+	}()
+	if err != nil {
+		s.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	var buf seekablebuffer.Buffer
+	err = init.Marshal(&buf)
+	if err != nil {
+		s.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Header("Content-Type", "video/mp4")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(buf.Bytes()) //nolint:errcheck
+}
+
+func (s *Server) onHLSPart(
+	ctx *gin.Context,
+	pathConf *conf.Path,
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+) {
+	ww := &writerWrapper{ctx: ctx}
+
+	// timestamps are relative to the UNIX epoch,
+	// in order to keep them continuous between parts.
+	m := &muxerFMP4{
+		w:        ww,
+		skipInit: true,
+		baseTime: start.Sub(time.Unix(0, 0)),
+	}
+
+	err := seekAndMux(pathConf, segments, start, duration, m)
+	if err != nil {
+		s.writeMuxError(ctx, ww, err)
+		return
+	}
+}
@@ -3,11 +3,9 @@ package playback
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"time"
 
@@ -23,6 +21,17 @@ func (d listEntryDuration) MarshalJSON() ([]byte, error) {
 	return json.Marshal(time.Duration(d).Seconds())
 }
 
+func (d *listEntryDuration) UnmarshalJSON(b []byte) error {
+	var secs float64
+	err := json.Unmarshal(b, &secs)
+	if err != nil {
+		return err
+	}
+
+	*d = listEntryDuration(secs * float64(time.Second))
+	return nil
+}
+
 type listEntry struct {
 	Start    time.Time         `json:"start"`
 	Duration listEntryDuration `json:"duration"`
@@ -30,64 +39,83 @@ type listEntry struct {
 }
 
 func computeDurationAndConcatenate(
-	recordFormat conf.RecordFormat,
+	pathConf *conf.Path,
 	segments []*recordstore.Segment,
 ) ([]listEntry, error) {
-	if recordFormat == conf.RecordFormatFMP4 {
-		out := []listEntry{}
-		var prevInit *fmp4.Init
+	out := []listEntry{}
+	var prevInit *fmp4.Init
 
-		for _, seg := range segments {
-			err := func() error {
-				f, err := os.Open(seg.Fpath)
-				if err != nil {
-					return err
-				}
-				defer f.Close()
+	for _, seg := range segments {
+		err := func() error {
+			f, err := recordstore.OpenSegment(pathConf, seg.Fpath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
 
-				init, err := segmentFMP4ReadInit(f)
-				if err != nil {
-					return err
-				}
+			var init *fmp4.Init
+			if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
+				init, err = segmentMPEGTSReadInit(f)
+			} else {
+				init, err = segmentFMP4ReadInit(f)
+			}
+			if err != nil {
+				return err
+			}
 
+			// use the duration stored into the index, if available
+			maxDuration := seg.Duration
+
+			if maxDuration == 0 {
 				_, err = f.Seek(0, io.SeekStart)
 				if err != nil {
 					return err
 				}
 
-				maxDuration, err := segmentFMP4ReadMaxDuration(f, init)
+				if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
+					maxDuration, err = segmentMPEGTSReadMaxDuration(f)
+				} else {
+					maxDuration, err = segmentFMP4ReadMaxDuration(f, init)
+				}
 				if err != nil {
 					return err
 				}
+			}
+
+			prevEnd := func() time.Time {
+				return out[len(out)-1].Start.Add(time.Duration(out[len(out)-1].Duration))
+			}
 
-				if len(out) != 0 && segmentFMP4CanBeConcatenated(
-					prevInit,
-					out[len(out)-1].Start.Add(time.Duration(out[len(out)-1].Duration)),
-					init,
-					seg.Start) {
-					prevStart := out[len(out)-1].Start
-					curEnd := seg.Start.Add(maxDuration)
-					out[len(out)-1].Duration = listEntryDuration(curEnd.Sub(prevStart))
+			var canBeConcatenated bool
+			if len(out) != 0 {
+				if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
+					canBeConcatenated = segmentMPEGTSCanBeConcatenated(prevInit, prevEnd(), init, seg.Start)
 				} else {
-					out = append(out, listEntry{
-						Start:    seg.Start,
-						Duration: listEntryDuration(maxDuration),
-					})
+					canBeConcatenated = segmentFMP4CanBeConcatenated(prevInit, prevEnd(), init, seg.Start)
 				}
+			}
 
-				prevInit = init
-
-				return nil
-			}()
-			if err != nil {
-				return nil, err
+			if canBeConcatenated {
+				prevStart := out[len(out)-1].Start
+				curEnd := seg.Start.Add(maxDuration)
+				out[len(out)-1].Duration = listEntryDuration(curEnd.Sub(prevStart))
+			} else {
+				out = append(out, listEntry{
+					Start:    seg.Start,
+					Duration: listEntryDuration(maxDuration),
+				})
 			}
-		}
 
-		return out, nil
+			prevInit = init
+
+			return nil
+		}()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return nil, fmt.Errorf("MPEG-TS format is not supported yet")
+	return out, nil
 }
 
 func (s *Server) onList(ctx *gin.Context) {
@@ -103,7 +131,7 @@ func (s *Server) onList(ctx *gin.Context) {
 		return
 	}
 
-	segments, err := recordstore.FindSegments(pathConf, pathName)
+	segments, err := s.Index.FindSegments(pathConf, pathName)
 	if err != nil {
 		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
 			s.writeError(ctx, http.StatusNotFound, err)
@@ -113,7 +141,7 @@ func (s *Server) onList(ctx *gin.Context) {
 		return
 	}
 
-	entries, err := computeDurationAndConcatenate(pathConf.RecordFormat, segments)
+	entries, err := computeDurationAndConcatenate(pathConf, segments)
 	if err != nil {
 		s.writeError(ctx, http.StatusInternalServerError, err)
 		return
@@ -0,0 +1,152 @@
+package playback
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	"github.com/gin-gonic/gin"
+)
+
+// duration of the frame of single-frame MP4 thumbnails.
+const thumbnailFrameDuration = 100 * time.Millisecond
+
+var errNoThumbnailsFound = errors.New("no thumbnails found")
+
+// findThumbnail returns the last thumbnail that precedes a timestamp,
+// together with the track it has been extracted from.
+func findThumbnail(
+	pathConf *conf.Path,
+	seg *recordstore.Segment,
+	t time.Time,
+) (*fmp4.InitTrack, *recordstore.Thumbnail, error) {
+	thumbnails, err := recordstore.ReadThumbnails(pathConf, seg.Fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, errNoThumbnailsFound
+		}
+		return nil, nil, err
+	}
+
+	if len(thumbnails) == 0 {
+		return nil, nil, errNoThumbnailsFound
+	}
+
+	offset := t.Sub(seg.Start)
+	thumbnail := thumbnails[0]
+
+	for _, th := range thumbnails[1:] {
+		if th.Offset > offset {
+			break
+		}
+		thumbnail = th
+	}
+
+	f, err := recordstore.OpenSegment(pathConf, seg.Fpath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	init, err := segmentReadInit(pathConf.RecordFormat, f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	track := recordstore.ThumbnailTrack(init.Tracks)
+	if track == nil {
+		return nil, nil, errNoThumbnailsFound
+	}
+
+	return track, thumbnail, nil
+}
+
+// marshalThumbnailMP4 wraps a keyframe into a MP4 file with a single frame.
+func marshalThumbnailMP4(track *fmp4.InitTrack, payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	m := &muxerMP4{w: &buf}
+	m.writeInit(&fmp4.Init{Tracks: []*fmp4.InitTrack{track}})
+	m.setTrack(track.ID)
+
+	err := m.writeSample(0, 0, false, uint32(len(payload)), func() ([]byte, error) {
+		return payload, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.writeFinalDTS(durationGoToMp4(thumbnailFrameDuration, track.TimeScale))
+
+	err = m.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Server) onThumbnails(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !s.doAuth(ctx, pathName) {
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, ctx.Query("time"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid time: %w", err))
+		return
+	}
+
+	pathConf, err := s.safeFindPathConf(pathName)
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	segments, err := s.Index.FindSegmentsInTimespan(pathConf, pathName, t, 0)
+	if err != nil {
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			s.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			s.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	track, thumbnail, err := findThumbnail(pathConf, segments[0], t)
+	if err != nil {
+		if errors.Is(err, errNoThumbnailsFound) {
+			s.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			s.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	var contentType string
+	var buf []byte
+
+	if _, ok := track.Codec.(*fmp4.CodecMJPEG); ok {
+		contentType = "image/jpeg"
+		buf = thumbnail.Payload
+	} else {
+		contentType = "video/mp4"
+		buf, err = marshalThumbnailMP4(track, thumbnail.Payload)
+		if err != nil {
+			s.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	ctx.Header("Content-Type", contentType)
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(buf) //nolint:errcheck
+}
@@ -0,0 +1,150 @@
+package playback
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
+	"github.com/ctenhank/mediamtx/internal/auth"
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	"github.com/ctenhank/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func writeThumbnails(t *testing.T, segmentPath string, thumbnails []*recordstore.Thumbnail) {
+	w, err := recordstore.CreateThumbnails(recordstore.ThumbnailsPath(segmentPath), nil)
+	require.NoError(t, err)
+	defer w.Close()
+
+	for _, th := range thumbnails {
+		err = w.Write(th)
+		require.NoError(t, err)
+	}
+}
+
+func writeSegmentMJPEG(t *testing.T, fpath string) {
+	init := fmp4.Init{
+		Tracks: []*fmp4.InitTrack{{
+			ID:        1,
+			TimeScale: 90000,
+			Codec: &fmp4.CodecMJPEG{
+				Width:  640,
+				Height: 480,
+			},
+		}},
+	}
+
+	var buf1 seekablebuffer.Buffer
+	err := init.Marshal(&buf1)
+	require.NoError(t, err)
+
+	var buf2 seekablebuffer.Buffer
+	parts := fmp4.Parts{{
+		SequenceNumber: 1,
+		Tracks: []*fmp4.PartTrack{{
+			ID: 1,
+			Samples: []*fmp4.PartSample{{
+				Duration: 90000,
+				Payload:  []byte{0xFF, 0xD8, 1, 2, 0xFF, 0xD9},
+			}},
+		}},
+	}}
+	err = parts.Marshal(&buf2)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, append(buf1.Bytes(), buf2.Bytes()...), 0o644)
+	require.NoError(t, err)
+}
+
+func TestOnThumbnails(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	err = os.Mkdir(filepath.Join(dir, "mjpegpath"), 0o755)
+	require.NoError(t, err)
+
+	fpath := filepath.Join(dir, "mypath", "2008-11-07_11-22-00-500000.mp4")
+	writeSegment1(t, fpath)
+	writeThumbnails(t, fpath, []*recordstore.Thumbnail{
+		{Offset: 30 * time.Second, Payload: []byte{1, 2}},
+		{Offset: 60 * time.Second, Payload: []byte{3, 4}},
+	})
+
+	fpath = filepath.Join(dir, "mjpegpath", "2008-11-07_11-22-00-500000.mp4")
+	writeSegmentMJPEG(t, fpath)
+	writeThumbnails(t, fpath, []*recordstore.Thumbnail{
+		{Offset: 0, Payload: []byte{0xFF, 0xD8, 1, 2, 0xFF, 0xD9}},
+	})
+
+	s := &Server{
+		Address:     "127.0.0.1:9996",
+		ReadTimeout: conf.StringDuration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:       "mypath",
+				RecordPath: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			},
+			"mjpegpath": {
+				Name:       "mjpegpath",
+				RecordPath: filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			},
+		},
+		AuthManager: &test.AuthManager{
+			Func: func(_ *auth.Request) error {
+				return nil
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	get := func(pathName string, ts time.Time) (string, []byte) {
+		u, err2 := url.Parse("http://localhost:9996/playback/thumbnails")
+		require.NoError(t, err2)
+
+		v := url.Values{}
+		v.Set("path", pathName)
+		v.Set("time", ts.Format(time.RFC3339Nano))
+		u.RawQuery = v.Encode()
+
+		res, err2 := http.Get(u.String())
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		buf, err2 := io.ReadAll(res.Body)
+		require.NoError(t, err2)
+
+		return res.Header.Get("Content-Type"), buf
+	}
+
+	t.Run("h264", func(t *testing.T) {
+		contentType, buf := get("mypath", time.Date(2008, 11, 0o7, 11, 22, 45, 0, time.Local))
+		require.Equal(t, "video/mp4", contentType)
+		require.Equal(t, []byte("ftyp"), buf[4:8])
+		require.Contains(t, string(buf), "avc1")
+
+		// the mdat box contains the thumbnail that precedes the requested time
+		require.Equal(t, []byte{0, 0, 0, 10, 'm', 'd', 'a', 't', 1, 2}, buf[len(buf)-10:])
+	})
+
+	t.Run("mjpeg", func(t *testing.T) {
+		contentType, buf := get("mjpegpath", time.Date(2008, 11, 0o7, 11, 22, 0, 600000000, time.Local))
+		require.Equal(t, "image/jpeg", contentType)
+		require.Equal(t, []byte{0xFF, 0xD8, 1, 2, 0xFF, 0xD9}, buf)
+	})
+}
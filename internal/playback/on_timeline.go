@@ -0,0 +1,307 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	timelineDefaultResolution = 1 * time.Hour
+	timelineMaxBuckets        = 10000
+)
+
+type timelineInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type timelineBucket struct {
+	Start       time.Time         `json:"start"`
+	Recorded    listEntryDuration `json:"recorded"`
+	NotRecorded listEntryDuration `json:"notRecorded"`
+	Coverage    float64           `json:"coverage"`
+}
+
+type timelineMarker struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Label string    `json:"label,omitempty"`
+}
+
+type timelineDay struct {
+	Date     string            `json:"date"`
+	Recorded listEntryDuration `json:"recorded"`
+	Coverage float64           `json:"coverage"`
+	Markers  int               `json:"markers"`
+}
+
+type timeline struct {
+	Start      time.Time           `json:"start"`
+	End        time.Time           `json:"end"`
+	Resolution listEntryDuration   `json:"resolution"`
+	Recorded   listEntryDuration   `json:"recorded"`
+	Coverage   float64             `json:"coverage"`
+	Buckets    []*timelineBucket   `json:"buckets"`
+	Gaps       []*timelineInterval `json:"gaps"`
+	Markers    []*timelineMarker   `json:"markers"`
+	Days       []*timelineDay      `json:"days"`
+}
+
+// segmentsInRange returns segments that may overlap with a range.
+// Segments without a known duration are assumed to last until the next one.
+func segmentsInRange(segments []*recordstore.Segment, start time.Time, end time.Time) []*recordstore.Segment {
+	var ret []*recordstore.Segment
+
+	for i, seg := range segments {
+		if !seg.Start.Before(end) {
+			break
+		}
+
+		var overlaps bool
+		if seg.Duration != 0 {
+			overlaps = seg.Start.Add(seg.Duration).After(start)
+		} else {
+			overlaps = i == len(segments)-1 || segments[i+1].Start.After(start)
+		}
+
+		if overlaps {
+			ret = append(ret, seg)
+		}
+	}
+
+	return ret
+}
+
+// recordedIntervals converts entries into sorted, non-overlapping intervals inside a range.
+func recordedIntervals(entries []listEntry, start time.Time, end time.Time) []*timelineInterval {
+	var ret []*timelineInterval
+
+	for _, entry := range entries {
+		iv := &timelineInterval{
+			Start: entry.Start,
+			End:   entry.Start.Add(time.Duration(entry.Duration)),
+		}
+
+		if iv.Start.Before(start) {
+			iv.Start = start
+		}
+		if iv.End.After(end) {
+			iv.End = end
+		}
+		if !iv.End.After(iv.Start) {
+			continue
+		}
+
+		if len(ret) != 0 && !iv.Start.After(ret[len(ret)-1].End) {
+			if iv.End.After(ret[len(ret)-1].End) {
+				ret[len(ret)-1].End = iv.End
+			}
+			continue
+		}
+
+		ret = append(ret, iv)
+	}
+
+	return ret
+}
+
+func recordedDuration(intervals []*timelineInterval, start time.Time, end time.Time) time.Duration {
+	var ret time.Duration
+
+	for _, iv := range intervals {
+		ivStart := iv.Start
+		if ivStart.Before(start) {
+			ivStart = start
+		}
+
+		ivEnd := iv.End
+		if ivEnd.After(end) {
+			ivEnd = end
+		}
+
+		if ivEnd.After(ivStart) {
+			ret += ivEnd.Sub(ivStart)
+		}
+	}
+
+	return ret
+}
+
+func coveragePercentage(recorded time.Duration, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(float64(recorded)*10000/float64(total)) / 100
+}
+
+func computeTimeline(
+	intervals []*timelineInterval,
+	markers []*recordstore.Marker,
+	start time.Time,
+	end time.Time,
+	resolution time.Duration,
+) *timeline {
+	recorded := recordedDuration(intervals, start, end)
+
+	tl := &timeline{
+		Start:      start,
+		End:        end,
+		Resolution: listEntryDuration(resolution),
+		Recorded:   listEntryDuration(recorded),
+		Coverage:   coveragePercentage(recorded, end.Sub(start)),
+		Buckets:    []*timelineBucket{},
+		Gaps:       []*timelineInterval{},
+		Markers:    []*timelineMarker{},
+		Days:       []*timelineDay{},
+	}
+
+	for bucketStart := start; bucketStart.Before(end); bucketStart = bucketStart.Add(resolution) {
+		bucketEnd := bucketStart.Add(resolution)
+		if bucketEnd.After(end) {
+			bucketEnd = end
+		}
+
+		bucketRecorded := recordedDuration(intervals, bucketStart, bucketEnd)
+
+		tl.Buckets = append(tl.Buckets, &timelineBucket{
+			Start:       bucketStart,
+			Recorded:    listEntryDuration(bucketRecorded),
+			NotRecorded: listEntryDuration(bucketEnd.Sub(bucketStart) - bucketRecorded),
+			Coverage:    coveragePercentage(bucketRecorded, bucketEnd.Sub(bucketStart)),
+		})
+	}
+
+	gapStart := start
+	for _, iv := range intervals {
+		if iv.Start.After(gapStart) {
+			tl.Gaps = append(tl.Gaps, &timelineInterval{Start: gapStart, End: iv.Start})
+		}
+		gapStart = iv.End
+	}
+	if end.After(gapStart) {
+		tl.Gaps = append(tl.Gaps, &timelineInterval{Start: gapStart, End: end})
+	}
+
+	for _, m := range markers {
+		tl.Markers = append(tl.Markers, &timelineMarker{
+			Time:  m.Time,
+			Type:  string(m.Type),
+			Label: m.Label,
+		})
+	}
+
+	// days are computed in the time zone of the request
+	loc := start.Location()
+	y, mo, d := start.Date()
+
+	for dayStart := time.Date(y, mo, d, 0, 0, 0, 0, loc); dayStart.Before(end); dayStart = dayStart.AddDate(0, 0, 1) {
+		dayEnd := dayStart.AddDate(0, 0, 1)
+
+		windowStart := dayStart
+		if windowStart.Before(start) {
+			windowStart = start
+		}
+
+		windowEnd := dayEnd
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		dayRecorded := recordedDuration(intervals, windowStart, windowEnd)
+
+		day := &timelineDay{
+			Date:     dayStart.Format(time.DateOnly),
+			Recorded: listEntryDuration(dayRecorded),
+			Coverage: coveragePercentage(dayRecorded, windowEnd.Sub(windowStart)),
+		}
+
+		for _, m := range markers {
+			if !m.Time.Before(windowStart) && m.Time.Before(windowEnd) {
+				day.Markers++
+			}
+		}
+
+		tl.Days = append(tl.Days, day)
+	}
+
+	return tl
+}
+
+func (s *Server) onTimeline(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	if !s.doAuth(ctx, pathName) {
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	end, err := time.Parse(time.RFC3339, ctx.Query("end"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid end: %w", err))
+		return
+	}
+
+	if !end.After(start) {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("end must be after start"))
+		return
+	}
+
+	resolution := timelineDefaultResolution
+
+	if str := ctx.Query("resolution"); str != "" {
+		var secs float64
+		secs, err = strconv.ParseFloat(str, 64)
+		if err != nil || secs <= 0 {
+			s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid resolution: '%s'", str))
+			return
+		}
+		resolution = time.Duration(secs * float64(time.Second))
+	}
+
+	if end.Sub(start)/resolution >= timelineMaxBuckets {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("resolution is too small for the requested timespan"))
+		return
+	}
+
+	pathConf, err := s.safeFindPathConf(pathName)
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var entries []listEntry
+
+	segments, err := s.Index.FindSegments(pathConf, pathName)
+	if err != nil {
+		if !errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			s.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		entries, err = computeDurationAndConcatenate(pathConf, segmentsInRange(segments, start, end))
+		if err != nil {
+			s.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, computeTimeline(
+		recordedIntervals(entries, start, end),
+		s.Index.FindMarkers(pathName, start, end),
+		start,
+		end,
+		resolution,
+	))
+}
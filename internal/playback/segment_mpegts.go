@@ -0,0 +1,685 @@
+package playback
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/ac3"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg1audio"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4video"
+	"github.com/bluenviron/mediacommon/pkg/codecs/opus"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+	"github.com/ctenhank/mediamtx/internal/formatprocessor"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+)
+
+const (
+	// MPEG-TS timestamps are expressed in 90kHz units;
+	// the same time scale is used for all tracks, in order to avoid conversions.
+	mpegtsTimeScale     = 90000
+	mpegtsTimestampMask = 0x1FFFFFFFF
+)
+
+func mpeg1audioChannelCount(cm mpeg1audio.ChannelMode) int {
+	switch cm {
+	case mpeg1audio.ChannelModeStereo,
+		mpeg1audio.ChannelModeJointStereo,
+		mpeg1audio.ChannelModeDualChannel:
+		return 2
+
+	default:
+		return 1
+	}
+}
+
+// mpegtsTimeDecoder converts 33-bit MPEG-TS timestamps into timestamps
+// relative to the first one, handling wrap-arounds.
+type mpegtsTimeDecoder struct {
+	initialized bool
+	prev        int64
+	overall     int64
+}
+
+func (d *mpegtsTimeDecoder) decode(ts int64) int64 {
+	if !d.initialized {
+		d.initialized = true
+		d.prev = ts
+		return 0
+	}
+
+	diff := (ts - d.prev) & mpegtsTimestampMask
+	if diff > mpegtsTimestampMask/2 {
+		diff -= mpegtsTimestampMask + 1
+	}
+
+	d.prev = ts
+	d.overall += diff
+	return d.overall
+}
+
+type segmentMPEGTSSample struct {
+	trackID         int
+	dts             int64
+	ptsOffset       int32
+	duration        int64 // zero when unknown
+	isNonSyncSample bool
+	payload         []byte
+}
+
+// segmentMPEGTSReader reads a MPEG-TS segment and converts its content into fMP4 tracks and samples.
+// Sample timestamps are relative to the first PES of the segment.
+type segmentMPEGTSReader struct {
+	r        io.Reader
+	onSample func(*segmentMPEGTSSample) error
+
+	init        *fmp4.Init
+	paramsFound map[int]struct{}
+	td          mpegtsTimeDecoder
+	mr          *mpegts.Reader
+	err         error
+}
+
+func (sr *segmentMPEGTSReader) initialize() error {
+	var err error
+	sr.mr, err = mpegts.NewReader(bufio.NewReader(sr.r))
+	if err != nil {
+		return err
+	}
+
+	sr.init = &fmp4.Init{}
+	sr.paramsFound = make(map[int]struct{})
+
+	for _, track := range sr.mr.Tracks() {
+		initTrack := &fmp4.InitTrack{
+			ID:        len(sr.init.Tracks) + 1,
+			TimeScale: mpegtsTimeScale,
+		}
+
+		switch codec := track.Codec.(type) {
+		case *mpegts.CodecH265:
+			initTrack.Codec = sr.setupH265(track, initTrack)
+
+		case *mpegts.CodecH264:
+			initTrack.Codec = sr.setupH264(track, initTrack)
+
+		case *mpegts.CodecMPEG4Video:
+			initTrack.Codec = sr.setupMPEG4Video(track, initTrack)
+
+		case *mpegts.CodecMPEG1Video:
+			initTrack.Codec = sr.setupMPEG1Video(track, initTrack)
+
+		case *mpegts.CodecOpus:
+			initTrack.Codec = &fmp4.CodecOpus{
+				ChannelCount: codec.ChannelCount,
+			}
+			sr.setupOpus(track, initTrack)
+
+		case *mpegts.CodecMPEG4Audio:
+			initTrack.Codec = &fmp4.CodecMPEG4Audio{
+				Config: codec.Config,
+			}
+			sr.setupMPEG4Audio(track, initTrack, codec.Config.SampleRate)
+
+		case *mpegts.CodecMPEG1Audio:
+			initTrack.Codec = sr.setupMPEG1Audio(track, initTrack)
+
+		case *mpegts.CodecAC3:
+			initTrack.Codec = sr.setupAC3(track, initTrack)
+
+		default:
+			continue
+		}
+
+		sr.init.Tracks = append(sr.init.Tracks, initTrack)
+	}
+
+	if len(sr.init.Tracks) == 0 {
+		return fmt.Errorf("no supported tracks found")
+	}
+
+	return nil
+}
+
+// read reads the segment until its end or until an error is returned by onSample.
+func (sr *segmentMPEGTSReader) read() error {
+	for {
+		err := sr.mr.Read()
+		if err != nil {
+			// errors that do not come from callbacks are caused by the end of the file,
+			// that may be truncated if the segment is still being written.
+			if sr.err != nil {
+				return sr.err
+			}
+			return nil
+		}
+	}
+}
+
+func (sr *segmentMPEGTSReader) writeSample(
+	initTrack *fmp4.InitTrack,
+	dts int64,
+	ptsOffset int64,
+	duration int64,
+	randomAccess bool,
+	payload []byte,
+) error {
+	if randomAccess {
+		sr.paramsFound[initTrack.ID] = struct{}{}
+	}
+
+	err := sr.onSample(&segmentMPEGTSSample{
+		trackID:         initTrack.ID,
+		dts:             dts,
+		ptsOffset:       int32(ptsOffset),
+		duration:        duration,
+		isNonSyncSample: !randomAccess,
+		payload:         payload,
+	})
+	if err != nil {
+		sr.err = err
+	}
+	return err
+}
+
+func (sr *segmentMPEGTSReader) mustExtractParams(initTrack *fmp4.InitTrack) bool {
+	_, ok := sr.paramsFound[initTrack.ID]
+	return !ok
+}
+
+func (sr *segmentMPEGTSReader) decodePTSAndDTS(pts int64, dts int64) (int64, int64) {
+	ptsOffset := (pts - dts) & mpegtsTimestampMask
+	if ptsOffset > mpegtsTimestampMask/2 {
+		ptsOffset -= mpegtsTimestampMask + 1
+	}
+	return sr.td.decode(dts), ptsOffset
+}
+
+func (sr *segmentMPEGTSReader) setupH265(track *mpegts.Track, initTrack *fmp4.InitTrack) fmp4.Codec {
+	codec := &fmp4.CodecH265{
+		VPS: formatprocessor.H265DefaultVPS,
+		SPS: formatprocessor.H265DefaultSPS,
+		PPS: formatprocessor.H265DefaultPPS,
+	}
+
+	sr.mr.OnDataH265(track, func(pts int64, dts int64, au [][]byte) error {
+		randomAccess := h265.IsRandomAccess(au)
+
+		if randomAccess && sr.mustExtractParams(initTrack) {
+			for _, nalu := range au {
+				typ := h265.NALUType((nalu[0] >> 1) & 0b111111)
+
+				switch typ {
+				case h265.NALUType_VPS_NUT:
+					codec.VPS = nalu
+
+				case h265.NALUType_SPS_NUT:
+					codec.SPS = nalu
+
+				case h265.NALUType_PPS_NUT:
+					codec.PPS = nalu
+				}
+			}
+		}
+
+		payload, err := h264.AVCCMarshal(au)
+		if err != nil {
+			return err
+		}
+
+		dtsDec, ptsOffset := sr.decodePTSAndDTS(pts, dts)
+
+		return sr.writeSample(initTrack, dtsDec, ptsOffset, 0, randomAccess, payload)
+	})
+
+	return codec
+}
+
+func (sr *segmentMPEGTSReader) setupH264(track *mpegts.Track, initTrack *fmp4.InitTrack) fmp4.Codec {
+	codec := &fmp4.CodecH264{
+		SPS: formatprocessor.H264DefaultSPS,
+		PPS: formatprocessor.H264DefaultPPS,
+	}
+
+	sr.mr.OnDataH264(track, func(pts int64, dts int64, au [][]byte) error {
+		randomAccess := h264.IDRPresent(au)
+
+		if randomAccess && sr.mustExtractParams(initTrack) {
+			for _, nalu := range au {
+				typ := h264.NALUType(nalu[0] & 0x1F)
+
+				switch typ {
+				case h264.NALUTypeSPS:
+					codec.SPS = nalu
+
+				case h264.NALUTypePPS:
+					codec.PPS = nalu
+				}
+			}
+		}
+
+		payload, err := h264.AVCCMarshal(au)
+		if err != nil {
+			return err
+		}
+
+		dtsDec, ptsOffset := sr.decodePTSAndDTS(pts, dts)
+
+		return sr.writeSample(initTrack, dtsDec, ptsOffset, 0, randomAccess, payload)
+	})
+
+	return codec
+}
+
+func (sr *segmentMPEGTSReader) setupMPEG4Video(track *mpegts.Track, initTrack *fmp4.InitTrack) fmp4.Codec {
+	codec := &fmp4.CodecMPEG4Video{
+		Config: formatprocessor.MPEG4VideoDefaultConfig,
+	}
+
+	sr.mr.OnDataMPEGxVideo(track, func(pts int64, frame []byte) error {
+		randomAccess := bytes.Contains(frame, []byte{0, 0, 1, byte(mpeg4video.GroupOfVOPStartCode)})
+
+		if randomAccess && sr.mustExtractParams(initTrack) &&
+			bytes.HasPrefix(frame, []byte{0, 0, 1, byte(mpeg4video.VisualObjectSequenceStartCode)}) {
+			end := bytes.Index(frame[4:], []byte{0, 0, 1, byte(mpeg4video.GroupOfVOPStartCode)})
+			if end >= 0 {
+				codec.Config = frame[:end+4]
+			}
+		}
+
+		return sr.writeSample(initTrack, sr.td.decode(pts), 0, 0, randomAccess, frame)
+	})
+
+	return codec
+}
+
+func (sr *segmentMPEGTSReader) setupMPEG1Video(track *mpegts.Track, initTrack *fmp4.InitTrack) fmp4.Codec {
+	codec := &fmp4.CodecMPEG1Video{
+		Config: formatprocessor.MPEG1VideoDefaultConfig,
+	}
+
+	sr.mr.OnDataMPEGxVideo(track, func(pts int64, frame []byte) error {
+		randomAccess := bytes.Contains(frame, []byte{0, 0, 1, 0xB8})
+
+		if randomAccess && sr.mustExtractParams(initTrack) &&
+			bytes.HasPrefix(frame, []byte{0, 0, 1, 0xB3}) {
+			end := bytes.Index(frame[4:], []byte{0, 0, 1, 0xB8})
+			if end >= 0 {
+				codec.Config = frame[:end+4]
+			}
+		}
+
+		return sr.writeSample(initTrack, sr.td.decode(pts), 0, 0, randomAccess, frame)
+	})
+
+	return codec
+}
+
+func (sr *segmentMPEGTSReader) setupOpus(track *mpegts.Track, initTrack *fmp4.InitTrack) {
+	sr.mr.OnDataOpus(track, func(pts int64, packets [][]byte) error {
+		dts := sr.td.decode(pts)
+
+		for _, packet := range packets {
+			duration := durationGoToMp4(opus.PacketDuration(packet), mpegtsTimeScale)
+
+			err := sr.writeSample(initTrack, dts, 0, duration, true, packet)
+			if err != nil {
+				return err
+			}
+
+			dts += duration
+		}
+
+		return nil
+	})
+}
+
+func (sr *segmentMPEGTSReader) setupMPEG4Audio(track *mpegts.Track, initTrack *fmp4.InitTrack, sampleRate int) {
+	sr.mr.OnDataMPEG4Audio(track, func(pts int64, aus [][]byte) error {
+		dts := sr.td.decode(pts)
+
+		duration := int64(mpeg4audio.SamplesPerAccessUnit) * mpegtsTimeScale / int64(sampleRate)
+
+		for i, au := range aus {
+			err := sr.writeSample(initTrack, dts+int64(i)*duration, 0, duration, true, au)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (sr *segmentMPEGTSReader) setupMPEG1Audio(track *mpegts.Track, initTrack *fmp4.InitTrack) fmp4.Codec {
+	codec := &fmp4.CodecMPEG1Audio{
+		SampleRate:   32000,
+		ChannelCount: 2,
+	}
+
+	sr.mr.OnDataMPEG1Audio(track, func(pts int64, frames [][]byte) error {
+		dts := sr.td.decode(pts)
+
+		for _, frame := range frames {
+			var h mpeg1audio.FrameHeader
+			err := h.Unmarshal(frame)
+			if err != nil {
+				return err
+			}
+
+			if sr.mustExtractParams(initTrack) {
+				codec.SampleRate = h.SampleRate
+				codec.ChannelCount = mpeg1audioChannelCount(h.ChannelMode)
+			}
+
+			duration := int64(h.SampleCount()) * mpegtsTimeScale / int64(h.SampleRate)
+
+			err = sr.writeSample(initTrack, dts, 0, duration, true, frame)
+			if err != nil {
+				return err
+			}
+
+			dts += duration
+		}
+
+		return nil
+	})
+
+	return codec
+}
+
+func (sr *segmentMPEGTSReader) setupAC3(track *mpegts.Track, initTrack *fmp4.InitTrack) fmp4.Codec {
+	codec := &fmp4.CodecAC3{
+		SampleRate:   48000,
+		ChannelCount: 6,
+		Fscod:        0,
+		Bsid:         8,
+		Bsmod:        0,
+		Acmod:        7,
+		LfeOn:        true,
+		BitRateCode:  7,
+	}
+
+	sr.mr.OnDataAC3(track, func(pts int64, frame []byte) error {
+		if sr.mustExtractParams(initTrack) {
+			var syncInfo ac3.SyncInfo
+			err := syncInfo.Unmarshal(frame)
+			if err != nil {
+				return fmt.Errorf("invalid AC-3 frame: %w", err)
+			}
+
+			var bsi ac3.BSI
+			err = bsi.Unmarshal(frame[5:])
+			if err != nil {
+				return fmt.Errorf("invalid AC-3 frame: %w", err)
+			}
+
+			codec.SampleRate = syncInfo.SampleRate()
+			codec.ChannelCount = bsi.ChannelCount()
+			codec.Fscod = syncInfo.Fscod
+			codec.Bsid = bsi.Bsid
+			codec.Bsmod = bsi.Bsmod
+			codec.Acmod = bsi.Acmod
+			codec.LfeOn = bsi.LfeOn
+			codec.BitRateCode = syncInfo.Frmsizecod >> 1
+		}
+
+		duration := int64(ac3.SamplesPerFrame) * mpegtsTimeScale / int64(codec.SampleRate)
+
+		return sr.writeSample(initTrack, sr.td.decode(pts), 0, duration, true, frame)
+	})
+
+	return codec
+}
+
+func segmentMPEGTSReadInit(r io.Reader) (*fmp4.Init, error) {
+	var sr *segmentMPEGTSReader
+	sr = &segmentMPEGTSReader{
+		r: r,
+		onSample: func(*segmentMPEGTSSample) error {
+			// stop as soon as codec parameters of all tracks have been found
+			if len(sr.paramsFound) == len(sr.init.Tracks) {
+				return errTerminated
+			}
+			return nil
+		},
+	}
+
+	err := sr.initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sr.read()
+	if err != nil && !errors.Is(err, errTerminated) {
+		return nil, err
+	}
+
+	return sr.init, nil
+}
+
+// segmentMPEGTSTrackEnd keeps track of the end of a track.
+type segmentMPEGTSTrackEnd struct {
+	lastDTS      int64
+	lastDuration int64
+	written      bool
+}
+
+// update sets the timestamp of the last sample.
+// When the sample duration is unknown, the duration of the previous sample is used as estimate.
+func (e *segmentMPEGTSTrackEnd) update(dts int64, duration int64) {
+	if e.written {
+		e.setNext(dts)
+	}
+	if duration != 0 {
+		e.lastDuration = duration
+	}
+	e.lastDTS = dts
+	e.written = true
+}
+
+// setNext sets the duration of the last sample by using the timestamp of the next one.
+func (e *segmentMPEGTSTrackEnd) setNext(dts int64) {
+	e.lastDuration = dts - e.lastDTS
+	if e.lastDuration < 0 {
+		e.lastDuration = 0
+	}
+}
+
+func (e *segmentMPEGTSTrackEnd) end() int64 {
+	return e.lastDTS + e.lastDuration
+}
+
+func segmentMPEGTSReadMaxDuration(r io.Reader) (time.Duration, error) {
+	ends := make(map[int]*segmentMPEGTSTrackEnd)
+
+	sr := &segmentMPEGTSReader{
+		r: r,
+		onSample: func(sample *segmentMPEGTSSample) error {
+			e, ok := ends[sample.trackID]
+			if !ok {
+				e = &segmentMPEGTSTrackEnd{}
+				ends[sample.trackID] = e
+			}
+			e.update(sample.dts, sample.duration)
+			return nil
+		},
+	}
+
+	err := sr.initialize()
+	if err != nil {
+		return 0, err
+	}
+
+	err = sr.read()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ends) == 0 {
+		return 0, fmt.Errorf("no samples found")
+	}
+
+	var maxElapsed int64
+	for _, e := range ends {
+		if e.end() > maxElapsed {
+			maxElapsed = e.end()
+		}
+	}
+
+	return durationMp4ToGo(maxElapsed, mpegtsTimeScale), nil
+}
+
+func segmentMPEGTSCanBeConcatenated(
+	prevInit *fmp4.Init,
+	prevEnd time.Time,
+	curInit *fmp4.Init,
+	curStart time.Time,
+) bool {
+	// MPEG-TS tracks are converted into fMP4 tracks, therefore the same checks apply.
+	return segmentFMP4CanBeConcatenated(prevInit, prevEnd, curInit, curStart)
+}
+
+// segmentMPEGTSMuxSamples writes samples of a MPEG-TS segment into the muxer.
+// Sample timestamps are shifted by muxerOffset.
+// Samples with a timestamp lower than zero are written in order to allow the muxer to store
+// the GOP preceding the first frame.
+func segmentMPEGTSMuxSamples(
+	r io.Reader,
+	muxerOffset int64,
+	duration time.Duration,
+	m muxer,
+) (int64, bool, error) {
+	durationMP4 := durationGoToMp4(duration, mpegtsTimeScale)
+	ends := make(map[int]*segmentMPEGTSTrackEnd)
+	ended := make(map[int]struct{})
+	atLeastOneSampleWritten := false
+
+	var sr *segmentMPEGTSReader
+	sr = &segmentMPEGTSReader{
+		r: r,
+		onSample: func(sample *segmentMPEGTSSample) error {
+			if _, ok := ended[sample.trackID]; ok {
+				return nil
+			}
+
+			muxerDTS := sample.dts + muxerOffset
+
+			e, ok := ends[sample.trackID]
+			if !ok {
+				e = &segmentMPEGTSTrackEnd{}
+				ends[sample.trackID] = e
+			}
+
+			if muxerDTS >= durationMP4 {
+				ended[sample.trackID] = struct{}{}
+
+				// the first sample after the end of the timespan sets the duration of the last written one
+				if e.written {
+					e.setNext(muxerDTS)
+				}
+
+				// stop reading when all tracks have reached the end of the requested timespan
+				if len(ended) == len(sr.init.Tracks) {
+					return errTerminated
+				}
+				return nil
+			}
+
+			if muxerDTS >= 0 {
+				atLeastOneSampleWritten = true
+			}
+
+			e.update(muxerDTS, sample.duration)
+
+			payload := sample.payload
+
+			m.setTrack(sample.trackID)
+
+			return m.writeSample(
+				muxerDTS,
+				sample.ptsOffset,
+				sample.isNonSyncSample,
+				uint32(len(payload)),
+				func() ([]byte, error) {
+					return payload, nil
+				},
+			)
+		},
+	}
+
+	err := sr.initialize()
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = sr.read()
+	if err != nil && !errors.Is(err, errTerminated) {
+		return 0, false, err
+	}
+
+	var maxMuxerDTS int64
+
+	for _, track := range sr.init.Tracks {
+		e, ok := ends[track.ID]
+		if !ok || !e.written {
+			continue
+		}
+
+		m.setTrack(track.ID)
+		m.writeFinalDTS(e.end())
+
+		if e.end() > maxMuxerDTS {
+			maxMuxerDTS = e.end()
+		}
+	}
+
+	return maxMuxerDTS, atLeastOneSampleWritten, nil
+}
+
+func segmentMPEGTSSeekAndMux(
+	r io.Reader,
+	segmentStartOffset time.Duration,
+	duration time.Duration,
+	m muxer,
+) (time.Duration, error) {
+	maxMuxerDTS, atLeastOneSampleWritten, err := segmentMPEGTSMuxSamples(
+		r,
+		-durationGoToMp4(segmentStartOffset, mpegtsTimeScale),
+		duration,
+		m)
+	if err != nil {
+		return 0, err
+	}
+
+	if !atLeastOneSampleWritten {
+		return 0, recordstore.ErrNoSegmentsFound
+	}
+
+	return durationMp4ToGo(maxMuxerDTS, mpegtsTimeScale), nil
+}
+
+func segmentMPEGTSMux(
+	r io.Reader,
+	segmentStartOffset time.Duration,
+	duration time.Duration,
+	m muxer,
+) (time.Duration, error) {
+	maxMuxerDTS, _, err := segmentMPEGTSMuxSamples(
+		r,
+		durationGoToMp4(segmentStartOffset, mpegtsTimeScale),
+		duration,
+		m)
+	if err != nil {
+		return 0, err
+	}
+
+	return durationMp4ToGo(maxMuxerDTS, mpegtsTimeScale), nil
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/ctenhank/mediamtx/internal/conf"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/ctenhank/mediamtx/internal/protocols/httpp"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 	"github.com/ctenhank/mediamtx/internal/restrictnetwork"
 	"github.com/gin-gonic/gin"
 )
@@ -22,18 +23,22 @@ type serverAuthManager interface {
 
 // Server is the playback server.
 type Server struct {
-	Address        string
-	Encryption     bool
-	ServerKey      string
-	ServerCert     string
-	AllowOrigin    string
-	TrustedProxies conf.IPNetworks
-	ReadTimeout    conf.StringDuration
-	PathConfs      map[string]*conf.Path
-	AuthManager    serverAuthManager
-	Parent         logger.Writer
+	Address         string
+	Encryption      bool
+	ServerKey       string
+	ServerCert      string
+	AllowOrigin     string
+	TrustedProxies  conf.IPNetworks
+	ExportPath      string
+	ExportRetention conf.StringDuration
+	ReadTimeout     conf.StringDuration
+	PathConfs       map[string]*conf.Path
+	Index           *recordstore.Index
+	AuthManager     serverAuthManager
+	Parent          logger.Writer
 
 	httpServer *httpp.WrappedServer
+	exports    *exportManager
 	mutex      sync.RWMutex
 }
 
@@ -47,6 +52,22 @@ func (s *Server) Initialize() error {
 
 	group.GET("/list", s.onList)
 	group.GET("/get", s.onGet)
+	group.GET("/playback/hls/*rest", s.onHLS)
+	group.GET("/playback/timeline", s.onTimeline)
+	group.GET("/playback/thumbnails", s.onThumbnails)
+	group.POST("/playback/exports", s.onExportsAdd)
+	group.GET("/playback/exports/:id", s.onExportsGet)
+	group.GET("/playback/exports/:id/download", s.onExportsDownload)
+	group.DELETE("/playback/exports/:id", s.onExportsDelete)
+
+	if s.ExportPath != "" {
+		s.exports = &exportManager{
+			directory: s.ExportPath,
+			retention: time.Duration(s.ExportRetention),
+			parent:    s,
+		}
+		s.exports.initialize()
+	}
 
 	network, address := restrictnetwork.Restrict("tcp", s.Address)
 
@@ -62,6 +83,9 @@ func (s *Server) Initialize() error {
 	}
 	err := s.httpServer.Initialize()
 	if err != nil {
+		if s.exports != nil {
+			s.exports.close()
+		}
 		return err
 	}
 
@@ -74,6 +98,10 @@ func (s *Server) Initialize() error {
 func (s *Server) Close() {
 	s.Log(logger.Info, "listener is closing")
 	s.httpServer.Close()
+
+	if s.exports != nil {
+		s.exports.close()
+	}
 }
 
 // Log implements logger.Writer.
@@ -111,8 +139,8 @@ func (s *Server) middlewareOrigin(ctx *gin.Context) {
 	// preflight requests
 	if ctx.Request.Method == http.MethodOptions &&
 		ctx.Request.Header.Get("Access-Control-Request-Method") != "" {
-		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET")
-		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, DELETE")
+		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
 		ctx.AbortWithStatus(http.StatusNoContent)
 		return
 	}
@@ -3,24 +3,58 @@ package recordcleaner
 
 import (
 	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/logger"
 	"github.com/ctenhank/mediamtx/internal/recordstore"
 )
 
+const quotaCleanInterval = 30 * time.Second
+
 var timeNow = time.Now
 
+type evictionKey struct {
+	path   string
+	reason defs.RecordEvictionReason
+}
+
+type evictionStats struct {
+	count uint64
+	bytes uint64
+}
+
+// quotaSegment is a segment that can be evicted to enforce quotas.
+type quotaSegment struct {
+	*recordstore.Segment
+	pathName string
+	priority int
+	size     uint64
+	newest   bool
+}
+
 // Cleaner removes expired recording segments from disk.
+// It also evicts the oldest segments when disk quotas are exceeded.
 type Cleaner struct {
-	PathConfs map[string]*conf.Path
-	Parent    logger.Writer
+	PathConfs    map[string]*conf.Path
+	MaxDiskUsage conf.StringSize
+	MinFreeSpace conf.StringSize
+	Index        *recordstore.Index
+	Parent       logger.Writer
 
 	ctx       context.Context
 	ctxCancel func()
 
+	mutex     sync.Mutex
+	diskUsage uint64
+	evictions map[evictionKey]*evictionStats
+
 	chReloadConf chan map[string]*conf.Path
 	done         chan struct{}
 }
@@ -30,6 +64,7 @@ func (c *Cleaner) Initialize() {
 	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
 	c.chReloadConf = make(chan map[string]*conf.Path)
 	c.done = make(chan struct{})
+	c.evictions = make(map[evictionKey]*evictionStats)
 
 	go c.run()
 }
@@ -53,6 +88,35 @@ func (c *Cleaner) ReloadPathConfs(pathConfs map[string]*conf.Path) {
 	}
 }
 
+// Stats returns statistics about disk usage and evictions.
+func (c *Cleaner) Stats() *defs.RecordCleanerStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ret := &defs.RecordCleanerStats{
+		DiskUsage: c.diskUsage,
+		Evictions: make([]*defs.RecordEvictions, 0, len(c.evictions)),
+	}
+
+	for k, v := range c.evictions {
+		ret.Evictions = append(ret.Evictions, &defs.RecordEvictions{
+			Path:   k.path,
+			Reason: k.reason,
+			Count:  v.count,
+			Bytes:  v.bytes,
+		})
+	}
+
+	sort.Slice(ret.Evictions, func(i, j int) bool {
+		if ret.Evictions[i].Path != ret.Evictions[j].Path {
+			return ret.Evictions[i].Path < ret.Evictions[j].Path
+		}
+		return ret.Evictions[i].Reason < ret.Evictions[j].Reason
+	})
+
+	return ret
+}
+
 func (c *Cleaner) run() {
 	defer close(c.done)
 
@@ -81,31 +145,50 @@ func (c *Cleaner) atLeastOneRecordDeleteAfter() bool {
 	return false
 }
 
-func (c *Cleaner) cleanInterval() time.Duration {
-	if !c.atLeastOneRecordDeleteAfter() {
-		return 365 * 24 * time.Hour
+func (c *Cleaner) hasQuotas() bool {
+	if c.MaxDiskUsage != 0 || c.MinFreeSpace != 0 {
+		return true
 	}
 
-	interval := 30 * 60 * time.Second
-
 	for _, e := range c.PathConfs {
-		if e.RecordDeleteAfter != 0 &&
-			interval > (time.Duration(e.RecordDeleteAfter)/2) {
-			interval = time.Duration(e.RecordDeleteAfter) / 2
+		if e.RecordMaxSize != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cleaner) cleanInterval() time.Duration {
+	interval := 365 * 24 * time.Hour
+
+	if c.atLeastOneRecordDeleteAfter() {
+		interval = 30 * 60 * time.Second
+
+		for _, e := range c.PathConfs {
+			if e.RecordDeleteAfter != 0 &&
+				interval > (time.Duration(e.RecordDeleteAfter)/2) {
+				interval = time.Duration(e.RecordDeleteAfter) / 2
+			}
 		}
 	}
 
+	if c.hasQuotas() {
+		interval = min(interval, quotaCleanInterval)
+	}
+
 	return interval
 }
 
 func (c *Cleaner) doRun() {
 	now := timeNow()
 
-	pathNames := recordstore.FindAllPathsWithSegments(c.PathConfs)
+	pathNames := c.Index.FindAllPathsWithSegments(c.PathConfs)
 
 	for _, pathName := range pathNames {
 		c.processPath(now, pathName) //nolint:errcheck
 	}
+
+	c.enforceQuotas(pathNames)
 }
 
 func (c *Cleaner) processPath(now time.Time, pathName string) error {
@@ -118,17 +201,213 @@ func (c *Cleaner) processPath(now time.Time, pathName string) error {
 		return nil
 	}
 
-	segments, err := recordstore.FindSegments(pathConf, pathName)
+	segments, err := c.Index.FindSegments(pathConf, pathName)
 	if err != nil {
 		return err
 	}
 
 	for _, seg := range segments {
 		if now.Sub(seg.Start) > time.Duration(pathConf.RecordDeleteAfter) {
-			c.Log(logger.Debug, "removing %s", seg.Fpath)
-			os.Remove(seg.Fpath)
+			c.evict(pathName, seg.Fpath, segmentSize(pathConf, seg), defs.RecordEvictionReasonAge)
 		}
 	}
 
 	return nil
 }
+
+// findQuotaSegments returns the segments of a path, with their size.
+// The most recent segment is excluded since it may still be being written.
+func (c *Cleaner) findQuotaSegments(pathName string) ([]*quotaSegment, error) {
+	pathConf, _, err := conf.FindPathConf(c.PathConfs, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := c.Index.FindSegments(pathConf, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*quotaSegment, 0, len(segments))
+
+	for i, seg := range segments {
+		// segments in object storages don't use local space
+		if recordstore.IsRemoteSegment(seg.Fpath) {
+			continue
+		}
+
+		ret = append(ret, &quotaSegment{
+			Segment:  seg,
+			pathName: pathName,
+			priority: pathConf.RecordPriority,
+			size:     segmentSize(pathConf, seg),
+			newest:   i == len(segments)-1,
+		})
+	}
+
+	return ret, nil
+}
+
+// segmentSize returns the size of a segment, from the index or from the storage.
+func segmentSize(pathConf *conf.Path, seg *recordstore.Segment) uint64 {
+	if seg.Size != 0 {
+		return uint64(seg.Size)
+	}
+
+	size, err := recordstore.StatSegment(pathConf, seg.Fpath)
+	if err != nil {
+		return 0
+	}
+	return uint64(size)
+}
+
+func (c *Cleaner) enforceQuotas(pathNames []string) {
+	var candidates []*quotaSegment
+	var diskUsage uint64
+
+	for _, pathName := range pathNames {
+		segments, err := c.findQuotaSegments(pathName)
+		if err != nil {
+			continue
+		}
+
+		var pathUsage uint64
+		for _, seg := range segments {
+			pathUsage += seg.size
+		}
+
+		pathConf, _, _ := conf.FindPathConf(c.PathConfs, pathName)
+
+		for _, seg := range segments {
+			// the most recent segment cannot be evicted
+			if seg.newest {
+				diskUsage += seg.size
+				continue
+			}
+
+			if pathConf.RecordMaxSize != 0 && pathUsage > uint64(pathConf.RecordMaxSize) {
+				if c.evict(pathName, seg.Fpath, seg.size, defs.RecordEvictionReasonPathSize) {
+					pathUsage -= seg.size
+				} else {
+					diskUsage += seg.size
+				}
+				continue
+			}
+
+			diskUsage += seg.size
+			candidates = append(candidates, seg)
+		}
+	}
+
+	// evict segments with lower priority first, then older segments first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].Start.Before(candidates[j].Start)
+	})
+
+	// free space is tracked per disk, since directories of different paths may share the same disk
+	volumes := make(map[string]string)
+	freeSpaces := make(map[string]uint64)
+
+	// volume returns the disk of a segment. Free space is read the first time a disk is found,
+	// then it is updated with evictions.
+	volume := func(seg *quotaSegment) (string, bool) {
+		dir := filepath.Dir(seg.Fpath)
+
+		vol, ok := volumes[dir]
+		if ok {
+			return vol, true
+		}
+
+		vol, free, err := freeSpace(dir)
+		if err != nil {
+			c.Log(logger.Warn, "unable to get free space of %s: %v", dir, err)
+			return "", false
+		}
+		volumes[dir] = vol
+
+		if _, ok := freeSpaces[vol]; !ok {
+			freeSpaces[vol] = free
+		}
+
+		return vol, true
+	}
+
+	for _, seg := range candidates {
+		if c.MaxDiskUsage != 0 && diskUsage > uint64(c.MaxDiskUsage) {
+			var vol string
+			var volOK bool
+			if c.MinFreeSpace != 0 {
+				vol, volOK = volume(seg)
+			}
+
+			if c.evict(seg.pathName, seg.Fpath, seg.size, defs.RecordEvictionReasonDiskUsage) {
+				diskUsage -= seg.size
+				if volOK {
+					freeSpaces[vol] += seg.size
+				}
+			}
+			continue
+		}
+
+		if c.MinFreeSpace != 0 {
+			vol, ok := volume(seg)
+			if !ok {
+				continue
+			}
+
+			if freeSpaces[vol] < uint64(c.MinFreeSpace) &&
+				c.evict(seg.pathName, seg.Fpath, seg.size, defs.RecordEvictionReasonFreeSpace) {
+				diskUsage -= seg.size
+				freeSpaces[vol] += seg.size
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	c.diskUsage = diskUsage
+	c.mutex.Unlock()
+}
+
+// evict removes a segment. It returns whether the segment does not use disk space anymore.
+func (c *Cleaner) evict(pathName string, fpath string, size uint64, reason defs.RecordEvictionReason) bool {
+	pathConf, _, err := conf.FindPathConf(c.PathConfs, pathName)
+	if err != nil {
+		return false
+	}
+
+	err = recordstore.RemoveSegment(pathConf, fpath)
+	if err != nil {
+		// the segment has been removed by someone else
+		if errors.Is(err, os.ErrNotExist) {
+			c.Index.Delete(fpath) //nolint:errcheck
+			return true
+		}
+
+		c.Log(logger.Warn, "unable to remove %s: %v", fpath, err)
+		return false
+	}
+
+	err = c.Index.Delete(fpath)
+	if err != nil {
+		c.Log(logger.Warn, "unable to update the segment index: %v", err)
+	}
+
+	c.Log(logger.Info, "evicted %s (path %s, %d bytes, reason: %s)", fpath, pathName, size, reason)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	k := evictionKey{path: pathName, reason: reason}
+	st, ok := c.evictions[k]
+	if !ok {
+		st = &evictionStats{}
+		c.evictions[k] = st
+	}
+	st.count++
+	st.bytes += size
+
+	return true
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -105,3 +106,279 @@ func TestCleanerMultipleEntriesSamePath(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dir, "path2", "2009-05-19_22-15-25-000427.mp4"))
 	require.NoError(t, err)
 }
+
+func TestCleanerPathMaxSize(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2009-05-20_22-15-25-000001.mp4",
+		"2009-05-20_22-16-25-000001.mp4",
+		"2009-05-20_22-17-25-000001.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), make([]byte, 100), 0o644)
+		require.NoError(t, err)
+	}
+
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:          "mypath",
+				RecordPath:    filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat:  conf.RecordFormatFMP4,
+				RecordMaxSize: 150,
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-15-25-000001.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-16-25-000001.mp4"))
+	require.Error(t, err)
+
+	// the most recent segment is always kept
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-17-25-000001.mp4"))
+	require.NoError(t, err)
+
+	require.Equal(t, &defs.RecordCleanerStats{
+		DiskUsage: 100,
+		Evictions: []*defs.RecordEvictions{{
+			Path:   "mypath",
+			Reason: defs.RecordEvictionReasonPathSize,
+			Count:  2,
+			Bytes:  200,
+		}},
+	}, c.Stats())
+}
+
+func TestCleanerMaxDiskUsagePriority(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, pathName := range []string{"low", "high"} {
+		err = os.Mkdir(filepath.Join(dir, pathName), 0o755)
+		require.NoError(t, err)
+
+		for _, name := range []string{
+			"2009-05-20_22-15-25-000001.mp4",
+			"2009-05-20_22-16-25-000001.mp4",
+		} {
+			err = os.WriteFile(filepath.Join(dir, pathName, name), make([]byte, 100), 0o644)
+			require.NoError(t, err)
+		}
+	}
+
+	// the high priority path has the oldest segment
+	err = os.WriteFile(filepath.Join(dir, "high", "2009-05-20_22-10-25-000001.mp4"), make([]byte, 100), 0o644)
+	require.NoError(t, err)
+
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"low": {
+				Name:         "low",
+				RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat: conf.RecordFormatFMP4,
+			},
+			"high": {
+				Name:           "high",
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat:   conf.RecordFormatFMP4,
+				RecordPriority: 1,
+			},
+		},
+		MaxDiskUsage: 350,
+		Parent:       test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "low", "2009-05-20_22-15-25-000001.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "low", "2009-05-20_22-16-25-000001.mp4"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "high", "2009-05-20_22-10-25-000001.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "high", "2009-05-20_22-15-25-000001.mp4"))
+	require.NoError(t, err)
+
+	stats := c.Stats()
+	require.Equal(t, uint64(300), stats.DiskUsage)
+	require.Equal(t, []*defs.RecordEvictions{
+		{
+			Path:   "high",
+			Reason: defs.RecordEvictionReasonDiskUsage,
+			Count:  1,
+			Bytes:  100,
+		},
+		{
+			Path:   "low",
+			Reason: defs.RecordEvictionReasonDiskUsage,
+			Count:  1,
+			Bytes:  100,
+		},
+	}, stats.Evictions)
+}
+
+func TestCleanerMinFreeSpaceSameDisk(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, pathName := range []string{"path1", "path2"} {
+		err = os.Mkdir(filepath.Join(dir, pathName), 0o755)
+		require.NoError(t, err)
+
+		for _, name := range []string{
+			"2009-05-20_22-15-25-000001.mp4",
+			"2009-05-20_22-16-25-000001.mp4",
+		} {
+			err = os.WriteFile(filepath.Join(dir, pathName, name), make([]byte, 100000), 0o644)
+			require.NoError(t, err)
+		}
+	}
+
+	_, free, err := freeSpace(dir)
+	require.NoError(t, err)
+
+	pathConfs := map[string]*conf.Path{}
+	for _, pathName := range []string{"path1", "path2"} {
+		pathConfs[pathName] = &conf.Path{
+			Name:         pathName,
+			RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			RecordFormat: conf.RecordFormatFMP4,
+		}
+	}
+
+	// removing a single segment is enough, since both paths are on the same disk
+	c := &Cleaner{
+		PathConfs:    pathConfs,
+		MinFreeSpace: conf.StringSize(free + 1000),
+		Parent:       test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	var evicted uint64
+	for _, e := range c.Stats().Evictions {
+		require.Equal(t, defs.RecordEvictionReasonFreeSpace, e.Reason)
+		evicted += e.Count
+	}
+	require.Equal(t, uint64(1), evicted)
+}
+
+func TestCleanerCleanInterval(t *testing.T) {
+	for _, ca := range []struct {
+		name         string
+		deleteAfter  time.Duration
+		maxDiskUsage conf.StringSize
+		expected     time.Duration
+	}{
+		{
+			"none",
+			0,
+			0,
+			365 * 24 * time.Hour,
+		},
+		{
+			"delete after",
+			2 * time.Hour,
+			0,
+			30 * time.Minute,
+		},
+		{
+			"quotas",
+			0,
+			1000,
+			quotaCleanInterval,
+		},
+		{
+			"quotas and short delete after",
+			10 * time.Second,
+			1000,
+			5 * time.Second,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			c := &Cleaner{
+				PathConfs: map[string]*conf.Path{
+					"mypath": {
+						Name:              "mypath",
+						RecordDeleteAfter: conf.StringDuration(ca.deleteAfter),
+					},
+				},
+				MaxDiskUsage: ca.maxDiskUsage,
+			}
+			require.Equal(t, ca.expected, c.cleanInterval())
+		})
+	}
+}
+
+func TestCleanerMaxDiskUsageAndMinFreeSpace(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2009-05-20_22-15-25-000001.mp4",
+		"2009-05-20_22-16-25-000001.mp4",
+		"2009-05-20_22-17-25-000001.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), make([]byte, 100000), 0o644)
+		require.NoError(t, err)
+	}
+
+	_, free, err := freeSpace(dir)
+	require.NoError(t, err)
+
+	// the segment evicted because of disk usage frees enough space
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:         "mypath",
+				RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat: conf.RecordFormatFMP4,
+			},
+		},
+		MaxDiskUsage: 250000,
+		MinFreeSpace: conf.StringSize(free + 50000),
+		Parent:       test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-15-25-000001.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-16-25-000001.mp4"))
+	require.NoError(t, err)
+
+	require.Equal(t, []*defs.RecordEvictions{{
+		Path:   "mypath",
+		Reason: defs.RecordEvictionReasonDiskUsage,
+		Count:  1,
+		Bytes:  100000,
+	}}, c.Stats().Evictions)
+}
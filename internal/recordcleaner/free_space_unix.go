@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package recordcleaner
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// freeSpace returns the free space of the disk that contains a directory,
+// together with an identifier of the disk.
+func freeSpace(dir string) (string, uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var fi syscall.Stat_t
+	err = syscall.Stat(dir, &fi)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return strconv.FormatUint(uint64(fi.Dev), 10), st.Bavail * uint64(st.Bsize), nil //nolint:unconvert
+}
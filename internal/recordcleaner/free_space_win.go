@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package recordcleaner
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns the free space of the disk that contains a directory,
+// together with an identifier of the disk.
+func freeSpace(dir string) (string, uint64, error) {
+	dirPtr, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return "", 0, err
+	}
+
+	volume := make([]uint16, windows.MAX_PATH+1)
+	err = windows.GetVolumePathName(dirPtr, &volume[0], uint32(len(volume)))
+	if err != nil {
+		return "", 0, err
+	}
+
+	var free uint64
+	err = windows.GetDiskFreeSpaceEx(dirPtr, &free, nil, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return windows.UTF16ToString(volume), free, nil
+}
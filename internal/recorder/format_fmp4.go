@@ -22,6 +22,7 @@ import (
 	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/formatprocessor"
 	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 	"github.com/ctenhank/mediamtx/internal/unit"
 )
 
@@ -103,6 +104,7 @@ type formatFMP4 struct {
 	ai *agentInstance
 
 	tracks             []*formatFMP4Track
+	thumbnailTrack     *formatFMP4Track
 	hasVideo           bool
 	currentSegment     *formatFMP4Segment
 	nextSequenceNumber uint32
@@ -820,6 +822,17 @@ func (f *formatFMP4) initialize() {
 		f.ai.Log(logger.Warn, "skipping track with codec %s", forma.Codec())
 	}
 
+	for _, forma := range formats {
+		f.ai.codecs = append(f.ai.codecs, forma.Codec())
+	}
+
+	for _, track := range f.tracks {
+		if recordstore.ThumbnailCodecSupported(track.initTrack.Codec) {
+			f.thumbnailTrack = track
+			break
+		}
+	}
+
 	f.ai.Log(logger.Info, "recording %s",
 		defs.FormatsInfo(formats))
 }
@@ -1,9 +1,6 @@
 package recorder
 
 import (
-	"io"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
@@ -14,7 +11,7 @@ import (
 )
 
 func writePart(
-	f io.Writer,
+	f *segmentFile,
 	sequenceNumber uint32,
 	partTracks map[*formatFMP4Track]*fmp4.PartTrack,
 ) error {
@@ -36,7 +33,7 @@ func writePart(
 		return err
 	}
 
-	_, err = f.Write(buf.Bytes())
+	_, err = f.write(buf.Bytes(), true)
 	return err
 }
 
@@ -47,6 +44,7 @@ type formatFMP4Part struct {
 
 	partTracks map[*formatFMP4Track]*fmp4.PartTrack
 	endDTS     time.Duration
+	keyframe   *time.Duration
 }
 
 func (p *formatFMP4Part) initialize() {
@@ -58,27 +56,29 @@ func (p *formatFMP4Part) close() error {
 		p.s.path = recordstore.Path{Start: p.s.startNTP}.Encode(p.s.f.ai.pathFormat)
 		p.s.f.ai.Log(logger.Debug, "creating segment %s", p.s.path)
 
-		err := os.MkdirAll(filepath.Dir(p.s.path), 0o755)
+		fi, err := createSegmentFile(p.s.path, p.s.f.ai.agent.EncryptionKeys, p.s.manifest)
 		if err != nil {
 			return err
 		}
 
-		fi, err := os.Create(p.s.path)
-		if err != nil {
-			return err
-		}
-
-		p.s.f.ai.agent.OnSegmentCreate(p.s.path)
+		p.s.f.ai.onSegmentCreate(p.s.path, p.s.startNTP)
 
 		err = writeInit(fi, p.s.f.tracks)
 		if err != nil {
-			fi.Close()
+			fi.close() //nolint:errcheck
 			return err
 		}
 
 		p.s.fi = fi
 	}
 
+	if p.keyframe != nil {
+		p.s.keyframes = append(p.s.keyframes, recordstore.IndexKeyframe{
+			Offset:   *p.keyframe,
+			Position: p.s.fi.size,
+		})
+	}
+
 	return writePart(p.s.fi, p.sequenceNumber, p.partTracks)
 }
 
@@ -92,6 +92,15 @@ func (p *formatFMP4Part) write(track *formatFMP4Track, sample *sample) error {
 		p.partTracks[track] = partTrack
 	}
 
+	if p.keyframe == nil && track.initTrack.Codec.IsVideo() && !sample.IsNonSyncSample {
+		v := sample.dts - p.s.startDTS
+		p.keyframe = &v
+	}
+
+	if track == p.s.f.thumbnailTrack && !sample.IsNonSyncSample {
+		p.s.thumbnails.write(sample.dts-p.s.startDTS, sample.Payload)
+	}
+
 	partTrack.Samples = append(partTrack.Samples, sample.PartSample)
 	p.endDTS = sample.dts
 
@@ -1,17 +1,16 @@
 package recorder
 
 import (
-	"io"
-	"os"
 	"time"
 
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
 	"github.com/bluenviron/mediacommon/pkg/formats/fmp4/seekablebuffer"
 
 	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 )
 
-func writeInit(f io.Writer, tracks []*formatFMP4Track) error {
+func writeInit(f *segmentFile, tracks []*formatFMP4Track) error {
 	fmp4Tracks := make([]*fmp4.InitTrack, len(tracks))
 	for i, track := range tracks {
 		fmp4Tracks[i] = track.initTrack
@@ -27,7 +26,7 @@ func writeInit(f io.Writer, tracks []*formatFMP4Track) error {
 		return err
 	}
 
-	_, err = f.Write(buf.Bytes())
+	_, err = f.write(buf.Bytes(), false)
 	return err
 }
 
@@ -36,14 +35,26 @@ type formatFMP4Segment struct {
 	startDTS time.Duration
 	startNTP time.Time
 
-	path    string
-	fi      *os.File
-	curPart *formatFMP4Part
-	lastDTS time.Duration
+	path      string
+	fi        *segmentFile
+	curPart   *formatFMP4Part
+	lastDTS   time.Duration
+	keyframes []recordstore.IndexKeyframe
+
+	thumbnails *thumbnailWriter
+	manifest   *recordstore.ManifestBuilder
 }
 
 func (s *formatFMP4Segment) initialize() {
 	s.lastDTS = s.startDTS
+	s.thumbnails = &thumbnailWriter{
+		ai:       s.f.ai,
+		startNTP: s.startNTP,
+	}
+
+	if s.f.ai.agent.Manifest {
+		s.manifest = recordstore.NewManifestBuilder()
+	}
 }
 
 func (s *formatFMP4Segment) close() error {
@@ -53,16 +64,18 @@ func (s *formatFMP4Segment) close() error {
 		err = s.curPart.close()
 	}
 
+	s.thumbnails.close()
+
 	if s.fi != nil {
 		s.f.ai.Log(logger.Debug, "closing segment %s", s.path)
-		err2 := s.fi.Close()
+		err2 := s.fi.close()
 		if err == nil {
 			err = err2
 		}
 
 		if err2 == nil {
 			duration := s.lastDTS - s.startDTS
-			s.f.ai.agent.OnSegmentComplete(s.path, duration)
+			s.f.ai.onSegmentComplete(s.path, s.startNTP, duration, s.keyframes, s.manifest)
 		}
 	}
 
@@ -16,6 +16,7 @@ import (
 
 	"github.com/ctenhank/mediamtx/internal/defs"
 	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 	"github.com/ctenhank/mediamtx/internal/unit"
 )
 
@@ -46,6 +47,7 @@ type formatMPEGTS struct {
 	bw             *bufio.Writer
 	mw             *mpegts.Writer
 	hasVideo       bool
+	thumbnailTrack *mpegts.Track
 	currentSegment *formatMPEGTSSegment
 }
 
@@ -70,6 +72,10 @@ func (f *formatMPEGTS) initialize() {
 			case *rtspformat.H265: //nolint:dupl
 				track := addTrack(forma, &mpegts.CodecH265{})
 
+				if f.thumbnailTrack == nil {
+					f.thumbnailTrack = track
+				}
+
 				var dtsExtractor *h265.DTSExtractor
 
 				f.ai.agent.Stream.AddReader(f.ai.writer, media, forma, func(u unit.Unit) error {
@@ -92,7 +98,7 @@ func (f *formatMPEGTS) initialize() {
 						return err
 					}
 
-					return f.write(
+					err = f.write(
 						dts,
 						tunit.NTP,
 						true,
@@ -101,11 +107,24 @@ func (f *formatMPEGTS) initialize() {
 							return f.mw.WriteH265(track, durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
 						},
 					)
+					if err != nil {
+						return err
+					}
+
+					if randomAccess && track == f.thumbnailTrack {
+						f.writeThumbnail(dts, tunit.AU)
+					}
+
+					return nil
 				})
 
 			case *rtspformat.H264: //nolint:dupl
 				track := addTrack(forma, &mpegts.CodecH264{})
 
+				if f.thumbnailTrack == nil {
+					f.thumbnailTrack = track
+				}
+
 				var dtsExtractor *h264.DTSExtractor
 
 				f.ai.agent.Stream.AddReader(f.ai.writer, media, forma, func(u unit.Unit) error {
@@ -128,7 +147,7 @@ func (f *formatMPEGTS) initialize() {
 						return err
 					}
 
-					return f.write(
+					err = f.write(
 						dts,
 						tunit.NTP,
 						true,
@@ -137,6 +156,15 @@ func (f *formatMPEGTS) initialize() {
 							return f.mw.WriteH264(track, durationGoToMPEGTS(tunit.PTS), durationGoToMPEGTS(dts), randomAccess, tunit.AU)
 						},
 					)
+					if err != nil {
+						return err
+					}
+
+					if randomAccess && track == f.thumbnailTrack {
+						f.writeThumbnail(dts, tunit.AU)
+					}
+
+					return nil
 				})
 
 			case *rtspformat.MPEG4Video:
@@ -323,6 +351,10 @@ func (f *formatMPEGTS) initialize() {
 	f.bw = bufio.NewWriterSize(f.dw, mpegtsMaxBufferSize)
 	f.mw = mpegts.NewWriter(f.bw, tracks)
 
+	for _, forma := range formats {
+		f.ai.codecs = append(f.ai.codecs, forma.Codec())
+	}
+
 	f.ai.Log(logger.Info, "recording %s",
 		defs.FormatsInfo(formats))
 }
@@ -333,6 +365,15 @@ func (f *formatMPEGTS) close() {
 	}
 }
 
+func (f *formatMPEGTS) writeThumbnail(dts time.Duration, au [][]byte) {
+	payload, err := h264.AVCCMarshal(au)
+	if err != nil {
+		return
+	}
+
+	f.currentSegment.thumbnails.write(dts-f.currentSegment.startDTS, payload)
+}
+
 func (f *formatMPEGTS) write(
 	dts time.Duration,
 	ntp time.Time,
@@ -379,5 +420,12 @@ func (f *formatMPEGTS) write(
 
 	f.currentSegment.lastDTS = dts
 
+	if isVideo && randomAccess {
+		f.currentSegment.keyframes = append(f.currentSegment.keyframes, recordstore.IndexKeyframe{
+			Offset:   dts - f.currentSegment.startDTS,
+			Position: f.currentSegment.size + int64(f.bw.Buffered()),
+		})
+	}
+
 	return writeCB()
 }
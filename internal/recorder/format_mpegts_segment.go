@@ -1,8 +1,6 @@
 package recorder
 
 import (
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/logger"
@@ -15,30 +13,46 @@ type formatMPEGTSSegment struct {
 	startNTP time.Time
 
 	path      string
-	fi        *os.File
+	fi        *segmentFile
 	lastFlush time.Duration
 	lastDTS   time.Duration
+	size      int64
+	keyframes []recordstore.IndexKeyframe
+
+	thumbnails *thumbnailWriter
+	manifest   *recordstore.ManifestBuilder
 }
 
 func (s *formatMPEGTSSegment) initialize() {
 	s.lastFlush = s.startDTS
 	s.lastDTS = s.startDTS
+	s.thumbnails = &thumbnailWriter{
+		ai:       s.f.ai,
+		startNTP: s.startNTP,
+	}
+
+	if s.f.ai.agent.Manifest {
+		s.manifest = recordstore.NewManifestBuilder()
+	}
+
 	s.f.dw.setTarget(s)
 }
 
 func (s *formatMPEGTSSegment) close() error {
 	err := s.f.bw.Flush()
 
+	s.thumbnails.close()
+
 	if s.fi != nil {
 		s.f.ai.Log(logger.Debug, "closing segment %s", s.path)
-		err2 := s.fi.Close()
+		err2 := s.fi.close()
 		if err == nil {
 			err = err2
 		}
 
 		if err2 == nil {
 			duration := s.lastDTS - s.startDTS
-			s.f.ai.agent.OnSegmentComplete(s.path, duration)
+			s.f.ai.onSegmentComplete(s.path, s.startNTP, duration, s.keyframes, s.manifest)
 		}
 	}
 
@@ -50,20 +64,17 @@ func (s *formatMPEGTSSegment) Write(p []byte) (int, error) {
 		s.path = recordstore.Path{Start: s.startNTP}.Encode(s.f.ai.pathFormat)
 		s.f.ai.Log(logger.Debug, "creating segment %s", s.path)
 
-		err := os.MkdirAll(filepath.Dir(s.path), 0o755)
-		if err != nil {
-			return 0, err
-		}
-
-		fi, err := os.Create(s.path)
+		fi, err := createSegmentFile(s.path, s.f.ai.agent.EncryptionKeys, s.manifest)
 		if err != nil {
 			return 0, err
 		}
 
-		s.f.ai.agent.OnSegmentCreate(s.path)
+		s.f.ai.onSegmentCreate(s.path, s.startNTP)
 
 		s.fi = fi
 	}
 
-	return s.fi.Write(p)
+	n, err := s.fi.write(p, false)
+	s.size += int64(n)
+	return n, err
 }
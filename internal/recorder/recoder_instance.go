@@ -1,6 +1,7 @@
 package recorder
 
 import (
+	"os"
 	"strings"
 	"time"
 
@@ -19,12 +20,16 @@ type sample struct {
 }
 
 type agentInstance struct {
-	agent *Recorder
+	agent       *Recorder
+	startReason string
 
 	pathFormat string
+	codecs     []string
 	writer     *asyncwriter.Writer
 	format     format
 
+	startMarked bool
+
 	terminate chan struct{}
 	done      chan struct{}
 }
@@ -64,6 +69,87 @@ func (ai *agentInstance) initialize() {
 	go ai.run()
 }
 
+func (ai *agentInstance) onSegmentCreate(path string, start time.Time) {
+	ai.agent.OnSegmentCreate(path)
+
+	err := ai.agent.Index.Put(&recordstore.IndexSegment{
+		PathName: ai.agent.PathName,
+		Fpath:    path,
+		Start:    start,
+		Codecs:   ai.codecs,
+	})
+	if err != nil {
+		ai.Log(logger.Warn, "unable to update the segment index: %v", err)
+	}
+
+	if !ai.startMarked {
+		ai.startMarked = true
+
+		err = ai.agent.Index.AddMarker(&recordstore.Marker{
+			PathName: ai.agent.PathName,
+			Time:     start,
+			Type:     recordstore.MarkerTypeRecordingStart,
+			Label:    ai.startReason,
+		})
+		if err != nil {
+			ai.Log(logger.Warn, "unable to update the segment index: %v", err)
+		}
+	}
+}
+
+func (ai *agentInstance) onSegmentComplete(
+	path string,
+	start time.Time,
+	duration time.Duration,
+	keyframes []recordstore.IndexKeyframe,
+	manifest *recordstore.ManifestBuilder,
+) {
+	// the manifest is written before notifying the segment,
+	// in order to allow external commands to process it.
+	if manifest != nil {
+		ai.writeManifest(path, start, manifest)
+	}
+
+	ai.agent.OnSegmentComplete(path, duration)
+
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		size = fi.Size()
+	}
+
+	err := ai.agent.Index.Put(&recordstore.IndexSegment{
+		PathName:  ai.agent.PathName,
+		Fpath:     path,
+		Start:     start,
+		Duration:  duration,
+		Size:      size,
+		Codecs:    ai.codecs,
+		Keyframes: keyframes,
+		Complete:  true,
+	})
+	if err != nil {
+		ai.Log(logger.Warn, "unable to update the segment index: %v", err)
+	}
+}
+
+func (ai *agentInstance) writeManifest(path string, start time.Time, b *recordstore.ManifestBuilder) {
+	m := b.Manifest(ai.agent.PathName, path, start)
+	m.Sequence = ai.agent.manifestSequence + 1
+	m.Previous = ai.agent.manifestPrevious
+
+	err := m.Seal(ai.agent.SigningKey)
+	if err == nil {
+		err = recordstore.WriteManifest(path, m)
+	}
+	if err != nil {
+		ai.Log(logger.Warn, "unable to write manifest: %v", err)
+		return
+	}
+
+	ai.agent.manifestSequence = m.Sequence
+	ai.agent.manifestPrevious = m.Hash
+}
+
 func (ai *agentInstance) close() {
 	close(ai.terminate)
 	<-ai.done
@@ -2,10 +2,12 @@
 package recorder
 
 import (
+	"crypto/ed25519"
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
 	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 	"github.com/ctenhank/mediamtx/internal/stream"
 )
 
@@ -15,6 +17,14 @@ type OnSegmentCreateFunc = func(path string)
 // OnSegmentCompleteFunc is the prototype of the function passed as OnSegmentComplete
 type OnSegmentCompleteFunc = func(path string, duration time.Duration)
 
+// reasons attached to recording start markers.
+const (
+	// the stream became available
+	startReasonStart = "start"
+	// recording was restarted after an error
+	startReasonRestart = "restart"
+)
+
 // Recorder writes recordings to disk.
 type Recorder struct {
 	WriteQueueSize    int
@@ -22,14 +32,23 @@ type Recorder struct {
 	Format            conf.RecordFormat
 	PartDuration      time.Duration
 	SegmentDuration   time.Duration
+	ThumbnailInterval time.Duration
+	Manifest          bool
+	SigningKey        ed25519.PrivateKey
+	EncryptionKeys    recordstore.KeyProvider
 	PathName          string
 	Stream            *stream.Stream
 	OnSegmentCreate   OnSegmentCreateFunc
 	OnSegmentComplete OnSegmentCompleteFunc
+	Index             *recordstore.Index
 	Parent            logger.Writer
 
 	restartPause time.Duration
 
+	// last manifest of the chain
+	manifestSequence uint64
+	manifestPrevious string
+
 	currentInstance *agentInstance
 
 	terminate chan struct{}
@@ -50,11 +69,16 @@ func (w *Recorder) Initialize() {
 		w.restartPause = 2 * time.Second
 	}
 
+	if w.Manifest {
+		w.loadLastManifest()
+	}
+
 	w.terminate = make(chan struct{})
 	w.done = make(chan struct{})
 
 	w.currentInstance = &agentInstance{
-		agent: w,
+		agent:       w,
+		startReason: startReasonStart,
 	}
 	w.currentInstance.initialize()
 
@@ -73,6 +97,28 @@ func (w *Recorder) Close() {
 	<-w.done
 }
 
+// loadLastManifest continues the chain of manifests of previous executions.
+func (w *Recorder) loadLastManifest() {
+	pathConf := &conf.Path{
+		RecordPath:   w.PathFormat,
+		RecordFormat: w.Format,
+	}
+
+	segments, err := w.Index.FindSegments(pathConf, w.PathName)
+	if err != nil {
+		return
+	}
+
+	for i := len(segments) - 1; i >= 0; i-- {
+		m, err := recordstore.ReadManifest(pathConf, segments[i].Fpath)
+		if err == nil {
+			w.manifestSequence = m.Sequence
+			w.manifestPrevious = m.Hash
+			return
+		}
+	}
+}
+
 func (w *Recorder) run() {
 	defer close(w.done)
 
@@ -92,7 +138,8 @@ func (w *Recorder) run() {
 		}
 
 		w.currentInstance = &agentInstance{
-			agent: w,
+			agent:       w,
+			startReason: startReasonRestart,
 		}
 		w.currentInstance.initialize()
 	}
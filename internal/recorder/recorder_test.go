@@ -1,6 +1,9 @@
 package recorder
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -14,6 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
 	"github.com/ctenhank/mediamtx/internal/stream"
 	"github.com/ctenhank/mediamtx/internal/test"
 	"github.com/ctenhank/mediamtx/internal/unit"
@@ -407,3 +411,351 @@ func TestRecorderFMP4NegativeDTS(t *testing.T) {
 
 	require.Equal(t, true, found)
 }
+
+var testH264Desc = &description.Session{Medias: []*description.Media{
+	{
+		Type: description.MediaTypeVideo,
+		Formats: []rtspformat.Format{&rtspformat.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	},
+}}
+
+// recordTestSegment records a H264 segment that starts at given time.
+func recordTestSegment(t *testing.T, w *Recorder, start time.Time) {
+	stream, err := stream.New(
+		1460,
+		testH264Desc,
+		true,
+		test.NilLogger,
+	)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	w.Stream = stream
+	w.Parent = test.NilLogger
+	w.Initialize()
+
+	for i := 0; i < 3; i++ {
+		stream.WriteUnit(testH264Desc.Medias[0], testH264Desc.Medias[0].Formats[0], &unit.H264{
+			Base: unit.Base{
+				PTS: time.Duration(i) * 200 * time.Millisecond,
+				NTP: start,
+			},
+			AU: [][]byte{
+				test.FormatH264.SPS,
+				test.FormatH264.PPS,
+				{5}, // IDR
+			},
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	w.Close()
+}
+
+func TestRecorderIndex(t *testing.T) {
+	for _, ca := range []string{"fmp4", "mpegts"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+
+			var f conf.RecordFormat
+			var ext string
+			if ca == "fmp4" {
+				f = conf.RecordFormatFMP4
+				ext = "mp4"
+			} else {
+				f = conf.RecordFormatMPEGTS
+				ext = "ts"
+			}
+
+			pathConfs := map[string]*conf.Path{
+				"mypath": {
+					Name:         "mypath",
+					RecordPath:   recordPath,
+					RecordFormat: f,
+				},
+			}
+
+			index := &recordstore.Index{
+				FilePath:  filepath.Join(dir, "index.jsonl"),
+				PathConfs: pathConfs,
+			}
+			err = index.Initialize()
+			require.NoError(t, err)
+			defer index.Close()
+
+			for _, start := range []time.Time{
+				time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC),
+				time.Date(2008, 5, 20, 22, 16, 25, 0, time.UTC),
+			} {
+				recordTestSegment(t, &Recorder{
+					WriteQueueSize:  1024,
+					PathFormat:      recordPath,
+					Format:          f,
+					PartDuration:    100 * time.Millisecond,
+					SegmentDuration: 1 * time.Second,
+					PathName:        "mypath",
+					Index:           index,
+				}, start)
+			}
+
+			seg, ok := index.Get(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000."+ext))
+			require.True(t, ok)
+			require.True(t, seg.Complete)
+			require.Equal(t, []string{"H264"}, seg.Codecs)
+			require.NotEmpty(t, seg.Keyframes)
+			require.Equal(t, time.Duration(0), seg.Keyframes[0].Offset)
+
+			fi, err := os.Stat(seg.Fpath)
+			require.NoError(t, err)
+			require.Equal(t, fi.Size(), seg.Size)
+
+			segments, err := index.FindSegments(pathConfs["mypath"], "mypath")
+			require.NoError(t, err)
+			require.Len(t, segments, 2)
+
+			// the index persists across restarts
+			index.Close()
+
+			index2 := &recordstore.Index{
+				FilePath:  filepath.Join(dir, "index.jsonl"),
+				PathConfs: pathConfs,
+			}
+			err = index2.Initialize()
+			require.NoError(t, err)
+			defer index2.Close()
+
+			seg2, ok := index2.Get(seg.Fpath)
+			require.True(t, ok)
+			require.Equal(t, seg, seg2)
+
+			// the index can be rebuilt from disk
+			err = index2.Rebuild()
+			require.NoError(t, err)
+
+			seg2, ok = index2.Get(seg.Fpath)
+			require.True(t, ok)
+			require.Equal(t, seg.Size, seg2.Size)
+			if ca == "fmp4" {
+				require.Equal(t, seg.Keyframes, seg2.Keyframes)
+			}
+
+			res, err := index2.Verify()
+			require.NoError(t, err)
+			require.Equal(t, &recordstore.IndexVerifyResult{
+				Segments:     2,
+				Missing:      []string{},
+				Unindexed:    []string{},
+				SizeMismatch: []string{},
+				Truncated:    []string{},
+			}, res)
+		})
+	}
+}
+
+func TestRecorderThumbnails(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pathConf := &conf.Path{
+		Name:         "mypath",
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+	}
+
+	recordTestSegment(t, &Recorder{
+		WriteQueueSize:    1024,
+		PathFormat:        pathConf.RecordPath,
+		Format:            pathConf.RecordFormat,
+		PartDuration:      100 * time.Millisecond,
+		SegmentDuration:   1 * time.Second,
+		ThumbnailInterval: 10 * time.Second,
+		PathName:          "mypath",
+	}, time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC))
+
+	// keyframes are closer than the thumbnail interval
+	thumbnails, err := recordstore.ReadThumbnails(pathConf,
+		filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4"))
+	require.NoError(t, err)
+	require.Len(t, thumbnails, 1)
+	require.Equal(t, time.Duration(0), thumbnails[0].Offset)
+	require.NotEmpty(t, thumbnails[0].Payload)
+}
+
+func TestRecorderManifest(t *testing.T) {
+	for _, ca := range []string{"fmp4", "mpegts"} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			var f conf.RecordFormat
+			var ext string
+			if ca == "fmp4" {
+				f = conf.RecordFormatFMP4
+				ext = "mp4"
+			} else {
+				f = conf.RecordFormatMPEGTS
+				ext = "ts"
+			}
+
+			pathConf := &conf.Path{
+				Name:         "mypath",
+				RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat: f,
+			}
+
+			pub, priv, err := ed25519.GenerateKey(nil)
+			require.NoError(t, err)
+
+			// the chain of manifests continues across restarts of the recorder
+			for _, start := range []time.Time{
+				time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC),
+				time.Date(2008, 5, 20, 22, 16, 25, 0, time.UTC),
+			} {
+				recordTestSegment(t, &Recorder{
+					WriteQueueSize:  1024,
+					PathFormat:      pathConf.RecordPath,
+					Format:          f,
+					PartDuration:    100 * time.Millisecond,
+					SegmentDuration: 1 * time.Second,
+					Manifest:        true,
+					SigningKey:      priv,
+					PathName:        "mypath",
+				}, start)
+			}
+
+			segments, err := recordstore.FindSegments(pathConf, "mypath")
+			require.NoError(t, err)
+			require.Len(t, segments, 2)
+
+			require.Equal(t, &recordstore.ManifestVerifyResult{
+				Segments: 2,
+				Issues:   []*recordstore.ManifestIssue{},
+			}, recordstore.VerifyManifests(pathConf, segments, pub))
+
+			fpath := filepath.Join(dir, "mypath", "2008-05-20_22-16-25-000000."+ext)
+
+			m, err := recordstore.ReadManifest(pathConf, fpath)
+			require.NoError(t, err)
+			require.Equal(t, uint64(2), m.Sequence)
+
+			fi, err := os.Stat(fpath)
+			require.NoError(t, err)
+			require.Equal(t, fi.Size(), m.Size)
+			if ca == "fmp4" {
+				require.NotEmpty(t, m.Parts)
+			}
+		})
+	}
+}
+
+func TestRecorderEncryption(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "keys")
+	err = os.WriteFile(keyPath,
+		[]byte("key1 000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f\n"), 0o644)
+	require.NoError(t, err)
+
+	recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+
+	pathConf := &conf.Path{
+		Name:                "mypath",
+		RecordPath:          recordPath,
+		RecordFormat:        conf.RecordFormatFMP4,
+		RecordEncryption:    conf.RecordEncryptionAESGCM,
+		RecordEncryptionKey: keyPath,
+	}
+
+	keys, err := recordstore.PathKeyProvider(pathConf)
+	require.NoError(t, err)
+
+	index := &recordstore.Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: map[string]*conf.Path{"mypath": pathConf},
+	}
+	err = index.Initialize()
+	require.NoError(t, err)
+	defer index.Close()
+
+	recordTestSegment(t, &Recorder{
+		WriteQueueSize:    1024,
+		PathFormat:        recordPath,
+		Format:            conf.RecordFormatFMP4,
+		PartDuration:      100 * time.Millisecond,
+		SegmentDuration:   1 * time.Second,
+		ThumbnailInterval: 10 * time.Second,
+		Manifest:          true,
+		EncryptionKeys:    keys,
+		PathName:          "mypath",
+		Index:             index,
+	}, time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC))
+
+	segPath := filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4")
+
+	// data is not readable without keys
+	byts, err := os.ReadFile(segPath)
+	require.NoError(t, err)
+
+	var init fmp4.Init
+	err = init.Unmarshal(bytes.NewReader(byts))
+	require.Error(t, err)
+
+	_, err = recordstore.OpenFile(segPath, nil)
+	require.ErrorIs(t, err, recordstore.ErrEncryptionKeyMissing)
+
+	f, err := recordstore.OpenFile(segPath, keys)
+	require.NoError(t, err)
+	defer f.Close()
+
+	plain, err := io.ReadAll(f)
+	require.NoError(t, err)
+
+	// segments are closed with an end-of-stream record
+	require.NoError(t, recordstore.CheckComplete(f))
+
+	err = init.Unmarshal(bytes.NewReader(plain))
+	require.NoError(t, err)
+
+	var parts fmp4.Parts
+	err = parts.Unmarshal(plain)
+	require.NoError(t, err)
+	require.NotEmpty(t, parts)
+
+	// keyframe positions refer to decrypted data
+	seg, ok := index.Get(segPath)
+	require.True(t, ok)
+	require.Equal(t, int64(len(byts)), seg.Size)
+	require.NotEmpty(t, seg.Keyframes)
+	require.Equal(t, "moof", string(plain[seg.Keyframes[0].Position+4:seg.Keyframes[0].Position+8]))
+
+	err = index.Rebuild()
+	require.NoError(t, err)
+
+	seg2, ok := index.Get(segPath)
+	require.True(t, ok)
+	require.Equal(t, seg.Keyframes, seg2.Keyframes)
+
+	thumbnails, err := recordstore.ReadThumbnails(pathConf, segPath)
+	require.NoError(t, err)
+	require.Len(t, thumbnails, 1)
+
+	// manifests cover encrypted data and can be verified without keys
+	segments, err := recordstore.FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, &recordstore.ManifestVerifyResult{
+		Segments: 1,
+		Issues:   []*recordstore.ManifestIssue{},
+	}, recordstore.VerifyManifests(pathConf, segments, nil))
+}
@@ -0,0 +1,114 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+)
+
+// segmentFile is the file of a segment.
+// Data is encrypted when keys are configured, and hashed into the manifest as it is stored on disk.
+type segmentFile struct {
+	f         *os.File
+	encrypter *recordstore.Encrypter
+	manifest  *recordstore.ManifestBuilder
+
+	// size of written data, before encryption
+	size int64
+}
+
+func createSegmentFile(
+	path string,
+	keys recordstore.KeyProvider,
+	manifest *recordstore.ManifestBuilder,
+) (*segmentFile, error) {
+	var encrypter *recordstore.Encrypter
+
+	if keys != nil {
+		var err error
+		encrypter, err = recordstore.NewEncrypter(keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sf := &segmentFile{
+		f:         f,
+		encrypter: encrypter,
+		manifest:  manifest,
+	}
+
+	if encrypter != nil {
+		_, err = f.Write(encrypter.Header())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if manifest != nil {
+			manifest.Write(encrypter.Header()) //nolint:errcheck
+		}
+	}
+
+	return sf, nil
+}
+
+// write writes data. Parts are tracked separately by the manifest.
+func (sf *segmentFile) write(p []byte, part bool) (int, error) {
+	buf := p
+	if sf.encrypter != nil {
+		buf = sf.encrypter.Seal(p)
+	}
+
+	n, err := sf.f.Write(buf)
+
+	if sf.manifest != nil {
+		if part && n == len(buf) {
+			sf.manifest.WritePart(buf)
+		} else {
+			sf.manifest.Write(buf[:n]) //nolint:errcheck
+		}
+	}
+
+	if err != nil {
+		// a partially written record can't be decrypted
+		if sf.encrypter != nil {
+			return 0, err
+		}
+		sf.size += int64(n)
+		return n, err
+	}
+
+	sf.size += int64(len(p))
+	return len(p), nil
+}
+
+func (sf *segmentFile) close() error {
+	if sf.encrypter != nil {
+		buf := sf.encrypter.Final()
+
+		n, err := sf.f.Write(buf)
+
+		if sf.manifest != nil {
+			sf.manifest.Write(buf[:n]) //nolint:errcheck
+		}
+
+		if err != nil {
+			sf.f.Close()
+			return err
+		}
+	}
+
+	return sf.f.Close()
+}
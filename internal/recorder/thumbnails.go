@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+)
+
+// thumbnailWriter stores periodic keyframes of a segment into a sidecar file.
+type thumbnailWriter struct {
+	ai       *agentInstance
+	startNTP time.Time
+
+	w      *recordstore.ThumbnailsWriter
+	last   time.Duration
+	failed bool
+}
+
+func (t *thumbnailWriter) write(offset time.Duration, payload []byte) {
+	interval := t.ai.agent.ThumbnailInterval
+
+	if interval <= 0 || t.failed || (t.w != nil && (offset-t.last) < interval) {
+		return
+	}
+
+	if t.w == nil {
+		segmentPath := recordstore.Path{Start: t.startNTP}.Encode(t.ai.pathFormat)
+
+		var err error
+		t.w, err = recordstore.CreateThumbnails(recordstore.ThumbnailsPath(segmentPath), t.ai.agent.EncryptionKeys)
+		if err != nil {
+			t.ai.Log(logger.Warn, "unable to create thumbnails: %v", err)
+			t.failed = true
+			return
+		}
+	}
+
+	t.last = offset
+
+	err := t.w.Write(&recordstore.Thumbnail{
+		Offset:  offset,
+		Payload: payload,
+	})
+	if err != nil {
+		t.ai.Log(logger.Warn, "unable to write thumbnails: %v", err)
+		t.failed = true
+	}
+}
+
+func (t *thumbnailWriter) close() {
+	if t.w != nil {
+		t.w.Close() //nolint:errcheck
+		t.w = nil
+	}
+}
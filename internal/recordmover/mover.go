@@ -0,0 +1,196 @@
+// Package recordmover contains the recording mover.
+package recordmover
+
+import (
+	"context"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+)
+
+var timeNow = time.Now
+
+// Mover moves recording segments into record tiers when they reach a certain age.
+type Mover struct {
+	PathConfs map[string]*conf.Path
+	Index     *recordstore.Index
+	Parent    logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	chReloadConf chan map[string]*conf.Path
+	done         chan struct{}
+}
+
+// Initialize initializes a Mover.
+func (m *Mover) Initialize() {
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	m.chReloadConf = make(chan map[string]*conf.Path)
+	m.done = make(chan struct{})
+
+	go m.run()
+}
+
+// Close closes the Mover.
+func (m *Mover) Close() {
+	m.ctxCancel()
+	<-m.done
+}
+
+// Log implements logger.Writer.
+func (m *Mover) Log(level logger.Level, format string, args ...interface{}) {
+	m.Parent.Log(level, "[record mover]"+format, args...)
+}
+
+// ReloadPathConfs is called by core.Core.
+func (m *Mover) ReloadPathConfs(pathConfs map[string]*conf.Path) {
+	select {
+	case m.chReloadConf <- pathConfs:
+	case <-m.ctx.Done():
+	}
+}
+
+func (m *Mover) run() {
+	defer close(m.done)
+
+	m.doRun()
+
+	for {
+		select {
+		case <-time.After(m.moveInterval()):
+			m.doRun()
+
+		case cnf := <-m.chReloadConf:
+			m.PathConfs = cnf
+
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Mover) moveInterval() time.Duration {
+	interval := time.Duration(0)
+
+	for _, e := range m.PathConfs {
+		for _, tier := range e.RecordTiers {
+			if interval == 0 || interval > (time.Duration(tier.After)/2) {
+				interval = time.Duration(tier.After) / 2
+			}
+		}
+	}
+
+	if interval == 0 {
+		return 365 * 24 * time.Hour
+	}
+
+	return min(interval, 30*60*time.Second)
+}
+
+func (m *Mover) doRun() {
+	now := timeNow()
+
+	for _, pathName := range m.Index.FindAllPathsWithSegments(m.PathConfs) {
+		err := m.processPath(now, pathName)
+		if err != nil && m.ctx.Err() == nil {
+			m.Log(logger.Warn, "%v", err)
+		}
+	}
+}
+
+func (m *Mover) processPath(now time.Time, pathName string) error {
+	pathConf, _, err := conf.FindPathConf(m.PathConfs, pathName)
+	if err != nil {
+		return nil
+	}
+
+	if len(pathConf.RecordTiers) == 0 {
+		return nil
+	}
+
+	segments, err := m.Index.FindSegments(pathConf, pathName)
+	if err != nil {
+		return nil
+	}
+
+	// the most recent segment is excluded since it may still be being written
+	segments = segments[:len(segments)-1]
+
+	for _, seg := range segments {
+		if m.ctx.Err() != nil {
+			return nil
+		}
+
+		age := now.Sub(seg.Start)
+
+		// the segment is going to be removed by the record cleaner
+		if pathConf.RecordDeleteAfter != 0 && age > time.Duration(pathConf.RecordDeleteAfter) {
+			continue
+		}
+
+		target := 0
+		for _, tier := range pathConf.RecordTiers {
+			if age > time.Duration(tier.After) {
+				target++
+			}
+		}
+
+		if target == 0 {
+			continue
+		}
+
+		cur, err := recordstore.SegmentTier(pathConf, pathName, seg.Fpath)
+		if err != nil || cur >= target {
+			continue
+		}
+
+		err = m.move(pathConf, pathName, seg.Fpath, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// move copies a segment into a tier, updates the index, then removes the source.
+// If the process is interrupted, the source and the copy coexist and the source is preferred.
+// The copy is canceled when the mover is closed.
+func (m *Mover) move(pathConf *conf.Path, pathName string, fpath string, tier int) error {
+	indexSeg, indexed := m.Index.Get(fpath)
+	if indexed && !indexSeg.Complete {
+		return nil
+	}
+
+	dstPath, err := recordstore.CopySegment(m.ctx, pathConf, pathName, fpath, tier)
+	if err != nil {
+		return err
+	}
+
+	if indexed {
+		newSeg := *indexSeg
+		newSeg.Fpath = dstPath
+
+		err = m.Index.Put(&newSeg)
+		if err != nil {
+			return err
+		}
+
+		err = m.Index.Delete(fpath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordstore.RemoveSegment(pathConf, fpath)
+	if err != nil {
+		return err
+	}
+
+	m.Log(logger.Info, "moved %s to %s", fpath, dstPath)
+
+	return nil
+}
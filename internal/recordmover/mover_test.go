@@ -0,0 +1,137 @@
+package recordmover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/recordstore"
+	"github.com/ctenhank/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMover(t *testing.T) {
+	now := time.Date(2009, 5, 20, 22, 15, 25, 427000, time.Local)
+	timeNow = func() time.Time {
+		return now
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-mover")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s3 := &test.S3Server{AccessKeyID: "myuser"}
+	s3.Initialize()
+	defer s3.Close()
+
+	pathConf := &conf.Path{
+		Name:         "mypath",
+		RecordPath:   filepath.Join(dir, "hot", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+		RecordTiers: conf.RecordTiers{
+			{
+				After: conf.StringDuration(48 * time.Hour),
+				Path:  filepath.Join(dir, "warm", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			},
+			{
+				After:             conf.StringDuration(720 * time.Hour),
+				Path:              "s3://mybucket/%path/%Y-%m-%d_%H-%M-%S-%f",
+				S3Endpoint:        s3.URL(),
+				S3AccessKeyID:     "myuser",
+				S3SecretAccessKey: "mypass",
+			},
+		},
+	}
+	pathConfs := map[string]*conf.Path{"mypath": pathConf}
+
+	index := &recordstore.Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: pathConfs,
+	}
+	err = index.Initialize()
+	require.NoError(t, err)
+	defer index.Close()
+
+	err = os.MkdirAll(filepath.Join(dir, "hot", "mypath"), 0o755)
+	require.NoError(t, err)
+
+	starts := []time.Time{
+		now.Add(-100 * 24 * time.Hour),
+		now.Add(-3 * 24 * time.Hour),
+		now.Add(-time.Hour),
+		now.Add(-time.Minute), // still being recorded
+	}
+
+	for i, start := range starts {
+		fpath := recordstore.Path{Start: start}.Encode(filepath.Join(dir, "hot", "mypath", "%Y-%m-%d_%H-%M-%S-%f.mp4"))
+
+		err = os.WriteFile(fpath, []byte{byte(i), 1, 2, 3}, 0o644)
+		require.NoError(t, err)
+
+		err = os.WriteFile(recordstore.ManifestPath(fpath), []byte{byte(i)}, 0o644)
+		require.NoError(t, err)
+
+		err = index.Put(&recordstore.IndexSegment{
+			PathName: "mypath",
+			Fpath:    fpath,
+			Start:    start,
+			Duration: time.Minute,
+			Size:     4,
+			Complete: i != 3,
+		})
+		require.NoError(t, err)
+	}
+
+	m := &Mover{
+		PathConfs: pathConfs,
+		Index:     index,
+		Parent:    test.NilLogger,
+	}
+	m.Initialize()
+	defer m.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	segments, err := index.FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Len(t, segments, 4)
+
+	require.Equal(t, "s3://mybucket/mypath/"+filepath.Base(segments[0].Fpath), segments[0].Fpath)
+	require.Equal(t, filepath.Join(dir, "warm", "mypath", filepath.Base(segments[1].Fpath)), segments[1].Fpath)
+	require.Equal(t, filepath.Join(dir, "hot", "mypath", filepath.Base(segments[2].Fpath)), segments[2].Fpath)
+	require.Equal(t, filepath.Join(dir, "hot", "mypath", filepath.Base(segments[3].Fpath)), segments[3].Fpath)
+
+	// indexed metadata is preserved
+	seg, ok := index.Get(segments[0].Fpath)
+	require.True(t, ok)
+	require.Equal(t, int64(4), seg.Size)
+	require.True(t, seg.Complete)
+
+	byts, ok := s3.Object("mybucket", "mypath/"+filepath.Base(segments[0].Fpath))
+	require.True(t, ok)
+	require.Equal(t, []byte{0, 1, 2, 3}, byts)
+
+	_, ok = s3.Object("mybucket", "mypath/"+filepath.Base(recordstore.ManifestPath(segments[0].Fpath)))
+	require.True(t, ok)
+
+	byts, err = os.ReadFile(segments[1].Fpath)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 1, 2, 3}, byts)
+
+	_, err = os.Stat(recordstore.ManifestPath(segments[1].Fpath))
+	require.NoError(t, err)
+
+	// sources have been removed
+	entries, err := os.ReadDir(filepath.Join(dir, "hot", "mypath"))
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	// the index matches the storage
+	res, err := index.Verify()
+	require.NoError(t, err)
+	require.Empty(t, res.Missing)
+	require.Empty(t, res.Unindexed)
+	require.Empty(t, res.SizeMismatch)
+}
@@ -0,0 +1,635 @@
+package recordstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+const (
+	encryptionDataKeySize     = 32
+	encryptionNoncePrefixSize = 4
+	encryptionMaxRecordSize   = 64 * 1024 * 1024
+)
+
+// encryptionMagic is placed at the beginning of encrypted files.
+var encryptionMagic = []byte{'M', 'T', 'X', 'E', 'N', 'C', 0, 1}
+
+// ErrEncryptionKeyMissing is returned when an encrypted file is opened without a key.
+var ErrEncryptionKeyMissing = errors.New("file is encrypted, but no encryption key is configured")
+
+// ErrEncryptedFileTruncated is returned by CheckComplete when an encrypted file
+// does not end with an end-of-stream record.
+var ErrEncryptedFileTruncated = errors.New("encrypted file is truncated")
+
+// KeyProvider protects the keys used to encrypt segments.
+// Each file is encrypted with a random data key,
+// that is wrapped by the provider and stored into the file header.
+type KeyProvider interface {
+	// WrapKey encrypts a data key with the current key encryption key.
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts a data key with the key encryption key with given ID.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KeyProviderFactory allocates a KeyProvider from the parameters in recordEncryptionKey.
+type KeyProviderFactory func(params string) (KeyProvider, error)
+
+var (
+	keyProvidersMutex sync.RWMutex
+	keyProviders      = map[string]KeyProviderFactory{}
+)
+
+// RegisterKeyProvider makes a key provider available with the
+// '<name>:<parameters>' syntax of recordEncryptionKey.
+// It is meant to be called by init() functions of external key management systems.
+func RegisterKeyProvider(name string, factory KeyProviderFactory) {
+	keyProvidersMutex.Lock()
+	defer keyProvidersMutex.Unlock()
+	keyProviders[name] = factory
+}
+
+// NewKeyProvider allocates the KeyProvider described by the recordEncryptionKey parameter.
+func NewKeyProvider(key string) (KeyProvider, error) {
+	if name, params, ok := strings.Cut(key, ":"); ok {
+		keyProvidersMutex.RLock()
+		factory, ok := keyProviders[name]
+		keyProvidersMutex.RUnlock()
+
+		if ok {
+			return factory(params)
+		}
+	}
+
+	return loadFileKeyProvider(key)
+}
+
+type cachedKeyProvider struct {
+	provider KeyProvider
+	modTime  time.Time
+	size     int64
+}
+
+var (
+	keyProviderCacheMutex sync.Mutex
+	keyProviderCache      = map[string]*cachedKeyProvider{}
+)
+
+// ResetKeyProviders drops the cached key providers.
+// It is called when the configuration changes.
+func ResetKeyProviders() {
+	keyProviderCacheMutex.Lock()
+	defer keyProviderCacheMutex.Unlock()
+	keyProviderCache = map[string]*cachedKeyProvider{}
+}
+
+// PathKeyProvider returns the KeyProvider of a path, or nil if no key is configured.
+// Providers are cached. Key files are read again when they change.
+func PathKeyProvider(pathConf *conf.Path) (KeyProvider, error) {
+	if pathConf.RecordEncryptionKey == "" {
+		return nil, nil
+	}
+
+	key := pathConf.RecordEncryptionKey
+
+	// registered providers do not have a file to check
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(key); err == nil {
+		modTime = fi.ModTime()
+		size = fi.Size()
+	}
+
+	keyProviderCacheMutex.Lock()
+	defer keyProviderCacheMutex.Unlock()
+
+	if c, ok := keyProviderCache[key]; ok && c.modTime.Equal(modTime) && c.size == size {
+		return c.provider, nil
+	}
+
+	provider, err := NewKeyProvider(key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyProviderCache[key] = &cachedKeyProvider{
+		provider: provider,
+		modTime:  modTime,
+		size:     size,
+	}
+
+	return provider, nil
+}
+
+// fileKeyProvider reads key encryption keys from a file.
+type fileKeyProvider struct {
+	ids  []string
+	keys map[string][]byte
+}
+
+func loadFileKeyProvider(fpath string) (*fileKeyProvider, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &fileKeyProvider{
+		keys: make(map[string][]byte),
+	}
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: invalid line '%s'", fpath, line)
+		}
+
+		key, err := hex.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s: key '%s' is not a 32-byte hex string", fpath, fields[0])
+		}
+
+		if _, ok := p.keys[fields[0]]; ok {
+			return nil, fmt.Errorf("%s: duplicate key ID '%s'", fpath, fields[0])
+		}
+
+		p.ids = append(p.ids, fields[0])
+		p.keys[fields[0]] = key
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.ids) == 0 {
+		return nil, fmt.Errorf("%s: no keys found", fpath)
+	}
+
+	return p, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (p *fileKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	id := p.ids[len(p.ids)-1]
+
+	aead, err := newGCM(p.keys[id])
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, aead.Seal(nonce, nonce, dataKey, []byte(id)), nil
+}
+
+func (p *fileKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key '%s' not found", keyID)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped key")
+	}
+
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+// Encrypter encrypts a file with AES-GCM.
+// Data is split into records, each authenticated separately,
+// in order to allow random access and reading files that are being written.
+// Files end with an empty end-of-stream record, in order to detect whether trailing records were removed.
+type Encrypter struct {
+	aead        cipher.AEAD
+	noncePrefix []byte
+	header      []byte
+	count       uint64
+}
+
+// NewEncrypter allocates an Encrypter with a new data key.
+func NewEncrypter(keys KeyProvider) (*Encrypter, error) {
+	dataKey := make([]byte, encryptionDataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyID) > 0xFFFF || len(wrapped) > 0xFFFF {
+		return nil, fmt.Errorf("wrapped key is too big")
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	noncePrefix := make([]byte, encryptionNoncePrefixSize)
+	_, err = rand.Read(noncePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.Write(encryptionMagic)
+	binary.Write(&header, binary.BigEndian, uint16(len(keyID))) //nolint:errcheck
+	header.WriteString(keyID)
+	binary.Write(&header, binary.BigEndian, uint16(len(wrapped))) //nolint:errcheck
+	header.Write(wrapped)
+	header.Write(noncePrefix)
+
+	return &Encrypter{
+		aead:        aead,
+		noncePrefix: noncePrefix,
+		header:      header.Bytes(),
+	}, nil
+}
+
+func encryptionNonce(prefix []byte, index uint64) []byte {
+	nonce := make([]byte, len(prefix)+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[len(prefix):], index)
+	return nonce
+}
+
+func encryptionAdditionalData(index uint64) []byte {
+	ad := make([]byte, 8)
+	binary.BigEndian.PutUint64(ad, index)
+	return ad
+}
+
+// the end-of-stream record is authenticated with a flag after the index,
+// therefore it can't be confused with a data record.
+func encryptionFinalAdditionalData(index uint64) []byte {
+	return append(encryptionAdditionalData(index), 1)
+}
+
+// Header returns the file header, that must be written before any record.
+func (e *Encrypter) Header() []byte {
+	return e.header
+}
+
+// Seal encrypts data into a record.
+func (e *Encrypter) Seal(p []byte) []byte {
+	buf := make([]byte, 4, 4+len(p)+e.aead.Overhead())
+	buf = e.aead.Seal(buf, encryptionNonce(e.noncePrefix, e.count), p, encryptionAdditionalData(e.count))
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	e.count++
+	return buf
+}
+
+// Final returns the end-of-stream record, that must be written after all other records.
+func (e *Encrypter) Final() []byte {
+	buf := make([]byte, 4, 4+e.aead.Overhead())
+	buf = e.aead.Seal(buf, encryptionNonce(e.noncePrefix, e.count), nil, encryptionFinalAdditionalData(e.count))
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	e.count++
+	return buf
+}
+
+type encryptedRecord struct {
+	fileOffset  int64
+	plainOffset int64
+	size        int64
+}
+
+// encryptedFile decrypts a file written with Encrypter.
+type encryptedFile struct {
+	f           FileReader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	records     []encryptedRecord
+	size        int64
+	complete    bool
+
+	pos    int64
+	cur    int
+	curBuf []byte
+}
+
+func (ef *encryptedFile) initialize(keys KeyProvider) error {
+	fileSize, err := ef.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(ef.f, 0, fileSize))
+
+	readField := func() ([]byte, error) {
+		var le uint16
+		err := binary.Read(br, binary.BigEndian, &le)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, le)
+		_, err = io.ReadFull(br, buf)
+		return buf, err
+	}
+
+	_, err = br.Discard(len(encryptionMagic))
+	if err != nil {
+		return err
+	}
+
+	keyID, err := readField()
+	if err != nil {
+		return err
+	}
+
+	wrapped, err := readField()
+	if err != nil {
+		return err
+	}
+
+	ef.noncePrefix = make([]byte, encryptionNoncePrefixSize)
+	_, err = io.ReadFull(br, ef.noncePrefix)
+	if err != nil {
+		return err
+	}
+
+	dataKey, err := keys.UnwrapKey(string(keyID), wrapped)
+	if err != nil {
+		return fmt.Errorf("unable to decrypt data key: %w", err)
+	}
+
+	ef.aead, err = newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	// scan record headers
+	fileOffset := int64(len(encryptionMagic) + 2 + len(keyID) + 2 + len(wrapped) + encryptionNoncePrefixSize)
+	header := make([]byte, 4)
+
+	for fileOffset+4 <= fileSize {
+		_, err = ef.f.ReadAt(header, fileOffset)
+		if err != nil {
+			return err
+		}
+
+		le := int64(binary.BigEndian.Uint32(header))
+
+		if le < int64(ef.aead.Overhead()) || le > encryptionMaxRecordSize {
+			return fmt.Errorf("invalid record at offset %d", fileOffset)
+		}
+
+		// the last record may have been written partially
+		if fileOffset+4+le > fileSize {
+			break
+		}
+
+		size := le - int64(ef.aead.Overhead())
+
+		ef.records = append(ef.records, encryptedRecord{
+			fileOffset:  fileOffset + 4,
+			plainOffset: ef.size,
+			size:        size,
+		})
+
+		ef.size += size
+		fileOffset += 4 + le
+	}
+
+	if len(ef.records) != 0 && ef.records[len(ef.records)-1].size == 0 {
+		i := len(ef.records) - 1
+		buf := make([]byte, ef.aead.Overhead())
+
+		_, err = ef.f.ReadAt(buf, ef.records[i].fileOffset)
+		if err != nil {
+			return err
+		}
+
+		_, err = ef.aead.Open(nil, encryptionNonce(ef.noncePrefix, uint64(i)), buf, encryptionFinalAdditionalData(uint64(i)))
+		if err == nil {
+			ef.records = ef.records[:i]
+			ef.complete = true
+		}
+	}
+
+	ef.cur = -1
+
+	return nil
+}
+
+func (ef *encryptedFile) load(i int) error {
+	if i == ef.cur {
+		return nil
+	}
+
+	rec := ef.records[i]
+	buf := make([]byte, rec.size+int64(ef.aead.Overhead()))
+
+	_, err := ef.f.ReadAt(buf, rec.fileOffset)
+	if err != nil {
+		return err
+	}
+
+	ef.curBuf, err = ef.aead.Open(buf[:0], encryptionNonce(ef.noncePrefix, uint64(i)),
+		buf, encryptionAdditionalData(uint64(i)))
+	if err != nil {
+		ef.cur = -1
+		return fmt.Errorf("unable to decrypt record at offset %d: %w", rec.fileOffset, err)
+	}
+
+	ef.cur = i
+	return nil
+}
+
+// readRecord reads from the record that contains given position.
+func (ef *encryptedFile) readRecord(p []byte, pos int64) (int, error) {
+	i := sort.Search(len(ef.records), func(i int) bool {
+		return ef.records[i].plainOffset+ef.records[i].size > pos
+	})
+
+	err := ef.load(i)
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(p, ef.curBuf[pos-ef.records[i].plainOffset:]), nil
+}
+
+// Read implements io.Reader.
+func (ef *encryptedFile) Read(p []byte) (int, error) {
+	if ef.pos >= ef.size {
+		return 0, io.EOF
+	}
+
+	n, err := ef.readRecord(p, ef.pos)
+	ef.pos += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (ef *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+
+	for n < len(p) {
+		if off >= ef.size {
+			return n, io.EOF
+		}
+
+		c, err := ef.readRecord(p[n:], off)
+		n += c
+		off += int64(c)
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// Seek implements io.Seeker.
+func (ef *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+
+	case io.SeekCurrent:
+		pos = ef.pos + offset
+
+	case io.SeekEnd:
+		pos = ef.size + offset
+
+	default:
+		return 0, fmt.Errorf("invalid whence")
+	}
+
+	if pos < 0 {
+		return 0, fmt.Errorf("negative position")
+	}
+
+	ef.pos = pos
+	return pos, nil
+}
+
+// Close implements io.Closer.
+func (ef *encryptedFile) Close() error {
+	return ef.f.Close()
+}
+
+// FileReader is a file opened with OpenFile.
+type FileReader interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+// CheckComplete checks whether a file opened with OpenFile or OpenSegment
+// ends with an end-of-stream record. Files that are still being written,
+// or that were not closed properly, don't have it.
+// Files that are not encrypted are always complete.
+func CheckComplete(f FileReader) error {
+	if ef, ok := f.(*encryptedFile); ok && !ef.complete {
+		return ErrEncryptedFileTruncated
+	}
+	return nil
+}
+
+// OpenFile opens a local segment or one of its sidecar files, decrypting it when needed.
+// Files that are not encrypted are returned as they are.
+func OpenFile(fpath string, keys KeyProvider) (FileReader, error) {
+	return openFile(localStorage{}, fpath, keys)
+}
+
+func openFile(st storage, fpath string, keys KeyProvider) (FileReader, error) {
+	f, err := st.open(context.Background(), fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(encryptionMagic))
+	_, err = f.ReadAt(magic, 0)
+
+	if err != nil || !bytes.Equal(magic, encryptionMagic) {
+		return f, nil
+	}
+
+	if keys == nil {
+		f.Close()
+		return nil, ErrEncryptionKeyMissing
+	}
+
+	ef := &encryptedFile{f: f}
+	err = ef.initialize(keys)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+
+	return ef, nil
+}
+
+func segmentFileComplete(pathConf *conf.Path, fpath string) bool {
+	f, err := OpenSegment(pathConf, fpath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	return CheckComplete(f) == nil
+}
+
+// OpenSegment opens a segment of a path, or one of its sidecar files,
+// in any tier, decrypting it when needed.
+func OpenSegment(pathConf *conf.Path, fpath string) (FileReader, error) {
+	st, err := storageForPath(pathConf, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := PathKeyProvider(pathConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return openFile(st, fpath, keys)
+}
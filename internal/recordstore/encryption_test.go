@@ -0,0 +1,264 @@
+package recordstore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+const (
+	testEncryptionKey1 = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	testEncryptionKey2 = "1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100"
+)
+
+func writeEncryptedFile(t *testing.T, fpath string, keys KeyProvider, records [][]byte) {
+	e, err := NewEncrypter(keys)
+	require.NoError(t, err)
+
+	content := e.Header()
+	for _, rec := range records {
+		content = append(content, e.Seal(rec)...)
+	}
+	content = append(content, e.Final()...)
+
+	err = os.WriteFile(fpath, content, 0o644)
+	require.NoError(t, err)
+}
+
+func TestEncryption(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "keys")
+	err = os.WriteFile(keyPath, []byte("# keys\nkey1 "+testEncryptionKey1+"\n"), 0o644)
+	require.NoError(t, err)
+
+	keys, err := NewKeyProvider(keyPath)
+	require.NoError(t, err)
+
+	fpath := filepath.Join(dir, "segment.mp4")
+	writeEncryptedFile(t, fpath, keys, [][]byte{
+		[]byte("0123456789"),
+		[]byte("abcde"),
+		[]byte("fghij"),
+	})
+
+	byts, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	require.NotContains(t, string(byts), "0123456789")
+
+	t.Run("read", func(t *testing.T) {
+		f, err := OpenFile(fpath, keys)
+		require.NoError(t, err)
+		defer f.Close()
+
+		plain, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "0123456789abcdefghij", string(plain))
+
+		require.NoError(t, CheckComplete(f))
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		f, err := OpenFile(fpath, keys)
+		require.NoError(t, err)
+		defer f.Close()
+
+		_, err = f.Seek(8, io.SeekStart)
+		require.NoError(t, err)
+
+		buf := make([]byte, 9)
+		_, err = io.ReadFull(f, buf)
+		require.NoError(t, err)
+		require.Equal(t, "89abcdefg", string(buf))
+
+		buf = make([]byte, 3)
+		_, err = f.ReadAt(buf, 17)
+		require.NoError(t, err)
+		require.Equal(t, "hij", string(buf))
+
+		_, err = f.ReadAt(buf, 18)
+		require.Equal(t, io.EOF, err)
+	})
+
+	// end-of-stream record is 20 bytes long, the last record is 25 bytes long.
+	for _, ca := range []struct {
+		name string
+		size int
+	}{
+		{
+			"partial record",
+			len(byts) - 23,
+		},
+		{
+			"removed records",
+			len(byts) - 45,
+		},
+	} {
+		t.Run("truncated "+ca.name, func(t *testing.T) {
+			tpath := filepath.Join(dir, "truncated.mp4")
+			err := os.WriteFile(tpath, byts[:ca.size], 0o644)
+			require.NoError(t, err)
+
+			f, err := OpenFile(tpath, keys)
+			require.NoError(t, err)
+			defer f.Close()
+
+			plain, err := io.ReadAll(f)
+			require.NoError(t, err)
+			require.Equal(t, "0123456789abcde", string(plain))
+
+			require.ErrorIs(t, CheckComplete(f), ErrEncryptedFileTruncated)
+		})
+	}
+
+	t.Run("altered", func(t *testing.T) {
+		apath := filepath.Join(dir, "altered.mp4")
+		altered := append([]byte(nil), byts...)
+		altered[len(altered)-21] ^= 0xFF
+		err := os.WriteFile(apath, altered, 0o644)
+		require.NoError(t, err)
+
+		f, err := OpenFile(apath, keys)
+		require.NoError(t, err)
+		defer f.Close()
+
+		_, err = io.ReadAll(f)
+		require.Error(t, err)
+	})
+
+	t.Run("altered end of stream", func(t *testing.T) {
+		apath := filepath.Join(dir, "altered.mp4")
+		altered := append([]byte(nil), byts...)
+		altered[len(altered)-1] ^= 0xFF
+		err := os.WriteFile(apath, altered, 0o644)
+		require.NoError(t, err)
+
+		f, err := OpenFile(apath, keys)
+		require.NoError(t, err)
+		defer f.Close()
+
+		require.ErrorIs(t, CheckComplete(f), ErrEncryptedFileTruncated)
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		err := os.WriteFile(keyPath, []byte("key1 "+testEncryptionKey1+"\nkey2 "+testEncryptionKey2+"\n"), 0o644)
+		require.NoError(t, err)
+
+		keys2, err := NewKeyProvider(keyPath)
+		require.NoError(t, err)
+
+		id, _, err := keys2.WrapKey(make([]byte, 32))
+		require.NoError(t, err)
+		require.Equal(t, "key2", id)
+
+		f, err := OpenFile(fpath, keys2)
+		require.NoError(t, err)
+		defer f.Close()
+
+		plain, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "0123456789abcdefghij", string(plain))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		wpath := filepath.Join(dir, "wrongkeys")
+		err := os.WriteFile(wpath, []byte("key1 "+testEncryptionKey2+"\n"), 0o644)
+		require.NoError(t, err)
+
+		wrongKeys, err := NewKeyProvider(wpath)
+		require.NoError(t, err)
+
+		_, err = OpenFile(fpath, wrongKeys)
+		require.Error(t, err)
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		_, err := OpenFile(fpath, nil)
+		require.ErrorIs(t, err, ErrEncryptionKeyMissing)
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		ppath := filepath.Join(dir, "plain.mp4")
+		err := os.WriteFile(ppath, []byte("plain content"), 0o644)
+		require.NoError(t, err)
+
+		f, err := OpenFile(ppath, keys)
+		require.NoError(t, err)
+		defer f.Close()
+
+		plain, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.Equal(t, "plain content", string(plain))
+
+		require.NoError(t, CheckComplete(f))
+	})
+}
+
+func TestEncryptionPathKeyProvider(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-encryption")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyPath := filepath.Join(dir, "keys")
+	err = os.WriteFile(keyPath, []byte("key1 "+testEncryptionKey1+"\n"), 0o644)
+	require.NoError(t, err)
+
+	pathConf := &conf.Path{RecordEncryptionKey: keyPath}
+
+	keys1, err := PathKeyProvider(pathConf)
+	require.NoError(t, err)
+
+	keys2, err := PathKeyProvider(pathConf)
+	require.NoError(t, err)
+	require.Same(t, keys1, keys2)
+
+	// a key is added
+	err = os.WriteFile(keyPath, []byte("key1 "+testEncryptionKey1+"\nkey2 "+testEncryptionKey2+"\n"), 0o644)
+	require.NoError(t, err)
+
+	keys3, err := PathKeyProvider(pathConf)
+	require.NoError(t, err)
+	require.NotSame(t, keys1, keys3)
+
+	id, _, err := keys3.WrapKey(make([]byte, 32))
+	require.NoError(t, err)
+	require.Equal(t, "key2", id)
+
+	ResetKeyProviders()
+
+	keys4, err := PathKeyProvider(pathConf)
+	require.NoError(t, err)
+	require.NotSame(t, keys3, keys4)
+}
+
+type testKeyProvider struct {
+	params string
+}
+
+func (p *testKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	return p.params, append([]byte(nil), dataKey...), nil
+}
+
+func (p *testKeyProvider) UnwrapKey(_ string, wrapped []byte) ([]byte, error) {
+	return wrapped, nil
+}
+
+func TestEncryptionKeyProviderRegistry(t *testing.T) {
+	RegisterKeyProvider("test", func(params string) (KeyProvider, error) {
+		return &testKeyProvider{params: params}, nil
+	})
+
+	keys, err := NewKeyProvider("test:mykey")
+	require.NoError(t, err)
+	require.Equal(t, &testKeyProvider{params: "mykey"}, keys)
+
+	_, err = NewKeyProvider("unknown:mykey")
+	require.Error(t, err)
+}
@@ -0,0 +1,730 @@
+package recordstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+// IndexKeyframe is a keyframe of an indexed segment.
+type IndexKeyframe struct {
+	// offset from the start of the segment
+	Offset time.Duration `json:"offset"`
+	// position, in bytes, of the part (fMP4) or of the packet (MPEG-TS) that contains the keyframe
+	Position int64 `json:"position"`
+}
+
+// IndexSegment is an indexed segment.
+type IndexSegment struct {
+	PathName  string          `json:"path"`
+	Fpath     string          `json:"file"`
+	Start     time.Time       `json:"start"`
+	Duration  time.Duration   `json:"duration"`
+	Size      int64           `json:"size"`
+	Codecs    []string        `json:"codecs"`
+	Keyframes []IndexKeyframe `json:"keyframes"`
+	Complete  bool            `json:"complete"`
+}
+
+type indexOp string
+
+const (
+	indexOpPut    indexOp = "put"
+	indexOpDelete indexOp = "delete"
+	indexOpMark   indexOp = "mark"
+)
+
+// indexEntry is an entry of the index journal.
+type indexEntry struct {
+	Op      indexOp       `json:"op"`
+	Segment *IndexSegment `json:"segment,omitempty"`
+	Fpath   string        `json:"file,omitempty"`
+	Marker  *Marker       `json:"marker,omitempty"`
+}
+
+const (
+	// the journal is compacted when it contains more than indexCompactRatio times
+	// the entries of a compacted one, and at least indexCompactMinEntries.
+	indexCompactRatio      = 2
+	indexCompactMinEntries = 1000
+)
+
+// indexPath contains the segments of a path.
+type indexPath struct {
+	// sorted by start
+	segments []*IndexSegment
+
+	// segments that match the record path of decodedConf
+	decodedConf *conf.Path
+	decoded     []Segment
+}
+
+func (ip *indexPath) add(seg *IndexSegment) {
+	n := sort.Search(len(ip.segments), func(j int) bool {
+		return ip.segments[j].Start.After(seg.Start)
+	})
+	ip.segments = append(ip.segments, nil)
+	copy(ip.segments[n+1:], ip.segments[n:])
+	ip.segments[n] = seg
+	ip.decodedConf = nil
+}
+
+func (ip *indexPath) remove(seg *IndexSegment) {
+	n := sort.Search(len(ip.segments), func(j int) bool {
+		return !ip.segments[j].Start.Before(seg.Start)
+	})
+
+	for ; n < len(ip.segments); n++ {
+		if ip.segments[n].Fpath == seg.Fpath {
+			ip.segments = append(ip.segments[:n], ip.segments[n+1:]...)
+			ip.decodedConf = nil
+			return
+		}
+	}
+}
+
+// IndexVerifyResult is the result of an index verification.
+type IndexVerifyResult struct {
+	Segments     int
+	Missing      []string
+	Unindexed    []string
+	SizeMismatch []string
+	Truncated    []string
+}
+
+func absPath(fpath string) string {
+	if isS3Path(fpath) {
+		return fpath
+	}
+
+	ret, err := filepath.Abs(fpath)
+	if err != nil {
+		return fpath
+	}
+	return ret
+}
+
+func decodeSegmentPath(pathConf *conf.Path, pathName string, fpath string) (*Path, bool) {
+	locations, err := recordLocations(pathConf, pathName)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, loc := range locations {
+		var pa Path
+		if pa.Decode(loc.recordPath, fpath) {
+			return &pa, true
+		}
+	}
+
+	return nil, false
+}
+
+// Index is a persistent index of recording segments.
+// It is stored on disk as a journal of JSON entries,
+// that is compacted when the index is loaded or rebuilt, or when it grows too much.
+//
+// Methods of a nil Index walk the filesystem.
+type Index struct {
+	FilePath  string
+	PathConfs map[string]*conf.Path
+
+	mutex    sync.RWMutex
+	segments map[string]*IndexSegment
+	paths    map[string]*indexPath
+	markers  []*Marker
+	f        *os.File
+
+	// entries of the journal
+	entries int
+}
+
+// Initialize initializes an Index.
+// If the index file does not exist, the index is rebuilt from the filesystem.
+func (i *Index) Initialize() error {
+	i.segments = make(map[string]*IndexSegment)
+
+	_, err := os.Stat(i.FilePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return i.Rebuild()
+	}
+
+	err = i.load()
+	if err != nil {
+		return err
+	}
+
+	// segments that were being recorded when the index was closed
+	for fpath, seg := range i.segments {
+		if !seg.Complete {
+			pathConf, _, err := conf.FindPathConf(i.PathConfs, seg.PathName)
+			if err != nil {
+				delete(i.segments, fpath)
+				continue
+			}
+
+			err = readSegmentInfo(seg, pathConf)
+			if err != nil {
+				delete(i.segments, fpath)
+				continue
+			}
+
+			seg.Complete = true
+		}
+	}
+
+	i.fillPaths()
+
+	return i.compact()
+}
+
+// Close closes the Index.
+func (i *Index) Close() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.f != nil {
+		i.f.Close()
+		i.f = nil
+	}
+}
+
+// ReloadPathConfs is called by core.Core.
+func (i *Index) ReloadPathConfs(pathConfs map[string]*conf.Path) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.PathConfs = pathConfs
+}
+
+func (i *Index) load() error {
+	f, err := os.Open(i.FilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		i.entries++
+
+		var entry indexEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// the last entry may have been written partially
+			continue
+		}
+
+		switch entry.Op {
+		case indexOpPut:
+			if entry.Segment != nil {
+				i.segments[entry.Segment.Fpath] = entry.Segment
+			}
+
+		case indexOpDelete:
+			delete(i.segments, entry.Fpath)
+
+		case indexOpMark:
+			if entry.Marker != nil {
+				i.markers = append(i.markers, entry.Marker)
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+// fillPaths fills paths from segments.
+func (i *Index) fillPaths() {
+	i.paths = make(map[string]*indexPath)
+
+	for _, seg := range i.segments {
+		ip, ok := i.paths[seg.PathName]
+		if !ok {
+			ip = &indexPath{}
+			i.paths[seg.PathName] = ip
+		}
+		ip.segments = append(ip.segments, seg)
+	}
+
+	for _, ip := range i.paths {
+		sort.Slice(ip.segments, func(a, b int) bool {
+			return ip.segments[a].Start.Before(ip.segments[b].Start)
+		})
+	}
+}
+
+func (i *Index) addSegment(seg *IndexSegment) {
+	if cur, ok := i.segments[seg.Fpath]; ok {
+		i.removeSegment(cur)
+	}
+
+	i.segments[seg.Fpath] = seg
+
+	ip, ok := i.paths[seg.PathName]
+	if !ok {
+		ip = &indexPath{}
+		i.paths[seg.PathName] = ip
+	}
+	ip.add(seg)
+}
+
+func (i *Index) removeSegment(seg *IndexSegment) {
+	delete(i.segments, seg.Fpath)
+
+	if ip, ok := i.paths[seg.PathName]; ok {
+		ip.remove(seg)
+		if len(ip.segments) == 0 {
+			delete(i.paths, seg.PathName)
+		}
+	}
+}
+
+// compact writes all segments into a new index file, then replaces the existing one.
+func (i *Index) compact() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return i.compactUnlocked()
+}
+
+func (i *Index) compactUnlocked() error {
+	if i.f != nil {
+		i.f.Close()
+		i.f = nil
+	}
+
+	i.markers = i.retainedMarkers()
+	i.entries = len(i.segments) + len(i.markers)
+
+	if len(i.segments) == 0 {
+		err := os.Remove(i.FilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(i.FilePath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := i.FilePath + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+
+	for _, seg := range i.sortedSegments() {
+		err = enc.Encode(&indexEntry{Op: indexOpPut, Segment: seg})
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	for _, m := range i.markers {
+		err = enc.Encode(&indexEntry{Op: indexOpMark, Marker: m})
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, i.FilePath)
+}
+
+func (i *Index) sortedSegments() []*IndexSegment {
+	ret := make([]*IndexSegment, 0, len(i.segments))
+	for _, seg := range i.segments {
+		ret = append(ret, seg)
+	}
+
+	sort.Slice(ret, func(a, b int) bool {
+		if ret[a].PathName != ret[b].PathName {
+			return ret[a].PathName < ret[b].PathName
+		}
+		return ret[a].Start.Before(ret[b].Start)
+	})
+
+	return ret
+}
+
+func (i *Index) write(entry *indexEntry) error {
+	if i.f == nil {
+		err := os.MkdirAll(filepath.Dir(i.FilePath), 0o755)
+		if err != nil {
+			return err
+		}
+
+		i.f, err = os.OpenFile(i.FilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+
+	byts, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = i.f.Write(append(byts, '\n'))
+	if err != nil {
+		return err
+	}
+
+	i.entries++
+
+	if i.entries >= indexCompactMinEntries &&
+		i.entries > indexCompactRatio*(len(i.segments)+len(i.markers)) {
+		return i.compactUnlocked()
+	}
+
+	return nil
+}
+
+// Put adds or replaces a segment.
+func (i *Index) Put(seg *IndexSegment) error {
+	if i == nil {
+		return nil
+	}
+
+	seg.Fpath = absPath(seg.Fpath)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.addSegment(seg)
+	return i.write(&indexEntry{Op: indexOpPut, Segment: seg})
+}
+
+// Delete removes a segment.
+func (i *Index) Delete(fpath string) error {
+	if i == nil {
+		return nil
+	}
+
+	fpath = absPath(fpath)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	seg, ok := i.segments[fpath]
+	if !ok {
+		return nil
+	}
+
+	i.removeSegment(seg)
+	return i.write(&indexEntry{Op: indexOpDelete, Fpath: fpath})
+}
+
+// Get returns an indexed segment.
+func (i *Index) Get(fpath string) (*IndexSegment, bool) {
+	if i == nil {
+		return nil, false
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	seg, ok := i.segments[absPath(fpath)]
+	return seg, ok
+}
+
+// scanFilesystem returns all segments on disk.
+func scanFilesystem(pathConfs map[string]*conf.Path) map[string]*IndexSegment {
+	ret := make(map[string]*IndexSegment)
+
+	for _, pathName := range FindAllPathsWithSegments(pathConfs) {
+		pathConf, _, err := conf.FindPathConf(pathConfs, pathName)
+		if err != nil {
+			continue
+		}
+
+		segments, err := FindSegments(pathConf, pathName)
+		if err != nil {
+			continue
+		}
+
+		for _, seg := range segments {
+			ret[seg.Fpath] = &IndexSegment{
+				PathName: pathName,
+				Fpath:    seg.Fpath,
+				Start:    seg.Start,
+			}
+		}
+	}
+
+	return ret
+}
+
+// Rebuild rebuilds the index from the filesystem.
+func (i *Index) Rebuild() error {
+	i.mutex.RLock()
+	pathConfs := i.PathConfs
+	i.mutex.RUnlock()
+
+	segments := scanFilesystem(pathConfs)
+
+	for fpath, seg := range segments {
+		pathConf, _, err := conf.FindPathConf(pathConfs, seg.PathName)
+		if err != nil {
+			delete(segments, fpath)
+			continue
+		}
+
+		err = readSegmentInfo(seg, pathConf)
+		if err != nil {
+			// a segment that is still being created may not contain any part yet
+			if seg.Size == 0 {
+				delete(segments, fpath)
+			}
+			continue
+		}
+
+		seg.Complete = true
+	}
+
+	i.mutex.Lock()
+
+	// keep segments that are being recorded
+	for fpath, seg := range i.segments {
+		if !seg.Complete {
+			segments[fpath] = seg
+		}
+	}
+
+	i.segments = segments
+	i.fillPaths()
+
+	i.mutex.Unlock()
+
+	return i.compact()
+}
+
+// Verify compares the index with the filesystem.
+func (i *Index) Verify() (*IndexVerifyResult, error) {
+	i.mutex.RLock()
+	pathConfs := i.PathConfs
+	i.mutex.RUnlock()
+
+	onDisk := scanFilesystem(pathConfs)
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	ret := &IndexVerifyResult{
+		Segments:     len(i.segments),
+		Missing:      []string{},
+		Unindexed:    []string{},
+		SizeMismatch: []string{},
+		Truncated:    []string{},
+	}
+
+	for fpath, seg := range i.segments {
+		if _, ok := onDisk[fpath]; !ok {
+			ret.Missing = append(ret.Missing, fpath)
+			continue
+		}
+
+		if seg.Complete {
+			pathConf, _, err := conf.FindPathConf(pathConfs, seg.PathName)
+			if err != nil {
+				continue
+			}
+
+			size, err := StatSegment(pathConf, fpath)
+			if err != nil || size != seg.Size {
+				ret.SizeMismatch = append(ret.SizeMismatch, fpath)
+			}
+
+			// trailing records of encrypted segments can be removed without altering other records
+			if pathConf.RecordEncryption != conf.RecordEncryptionNone && !segmentFileComplete(pathConf, fpath) {
+				ret.Truncated = append(ret.Truncated, fpath)
+			}
+		}
+	}
+
+	for fpath := range onDisk {
+		if _, ok := i.segments[fpath]; !ok {
+			ret.Unindexed = append(ret.Unindexed, fpath)
+		}
+	}
+
+	sort.Strings(ret.Missing)
+	sort.Strings(ret.Unindexed)
+	sort.Strings(ret.SizeMismatch)
+	sort.Strings(ret.Truncated)
+
+	return ret, nil
+}
+
+// FindAllPathsWithSegments returns all paths that do have segments.
+func (i *Index) FindAllPathsWithSegments(pathConfs map[string]*conf.Path) []string {
+	if i == nil {
+		return FindAllPathsWithSegments(pathConfs)
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	var out []string
+
+	for pathName, ip := range i.paths {
+		pathConf, _, err := conf.FindPathConf(pathConfs, pathName)
+		if err != nil {
+			continue
+		}
+
+		for _, seg := range ip.segments {
+			if _, ok := decodeSegmentPath(pathConf, pathName, seg.Fpath); ok {
+				out = append(out, pathName)
+				break
+			}
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// FindSegments returns all segments of a path.
+func (i *Index) FindSegments(
+	pathConf *conf.Path,
+	pathName string,
+) ([]*Segment, error) {
+	if i == nil {
+		return FindSegments(pathConf, pathName)
+	}
+
+	i.mutex.RLock()
+	ip, ok := i.paths[pathName]
+	if ok && ip.decodedConf == pathConf {
+		defer i.mutex.RUnlock()
+		return copyDecodedSegments(ip.decoded)
+	}
+	i.mutex.RUnlock()
+
+	// segments are decoded once, until they change
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	ip, ok = i.paths[pathName]
+	if !ok {
+		return nil, ErrNoSegmentsFound
+	}
+
+	if ip.decodedConf != pathConf {
+		ip.decoded = ip.decoded[:0]
+
+		for _, seg := range ip.segments {
+			pa, ok := decodeSegmentPath(pathConf, pathName, seg.Fpath)
+			if !ok {
+				continue
+			}
+
+			ip.decoded = append(ip.decoded, Segment{
+				Fpath:    seg.Fpath,
+				Start:    pa.Start,
+				Duration: seg.Duration,
+				Size:     seg.Size,
+			})
+		}
+
+		// the start encoded in the path may be less precise
+		sort.SliceStable(ip.decoded, func(a, b int) bool {
+			return ip.decoded[a].Start.Before(ip.decoded[b].Start)
+		})
+
+		ip.decodedConf = pathConf
+	}
+
+	return copyDecodedSegments(ip.decoded)
+}
+
+func copyDecodedSegments(decoded []Segment) ([]*Segment, error) {
+	if len(decoded) == 0 {
+		return nil, ErrNoSegmentsFound
+	}
+
+	segments := make([]*Segment, len(decoded))
+	for j := range decoded {
+		seg := decoded[j]
+		segments[j] = &seg
+	}
+
+	return segments, nil
+}
+
+// FindSegmentsInTimespan returns all segments in a certain timestamp.
+func (i *Index) FindSegmentsInTimespan(
+	pathConf *conf.Path,
+	pathName string,
+	start time.Time,
+	duration time.Duration,
+) ([]*Segment, error) {
+	if i == nil {
+		return FindSegmentsInTimespan(pathConf, pathName, start, duration)
+	}
+
+	segments, err := i.FindSegments(pathConf, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	// gather all segments that starts before the end of the playback
+	end := start.Add(duration)
+	n := 0
+	for _, seg := range segments {
+		if !end.Before(seg.Start) {
+			segments[n] = seg
+			n++
+		}
+	}
+	segments = segments[:n]
+
+	if len(segments) == 0 {
+		return nil, ErrNoSegmentsFound
+	}
+
+	segments, err = segmentsStartingFrom(segments, start)
+	if err != nil {
+		return nil, err
+	}
+
+	// the last segment ends before the start of the playback
+	last := segments[len(segments)-1]
+	if len(segments) == 1 && last.Duration != 0 && last.Start.Add(last.Duration).Before(start) {
+		return nil, ErrNoSegmentsFound
+	}
+
+	return segments, nil
+}
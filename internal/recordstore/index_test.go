@@ -0,0 +1,197 @@
+package recordstore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+func TestIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pathConf := &conf.Path{
+		Name:         "mypath",
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+	}
+
+	i := &Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: map[string]*conf.Path{"mypath": pathConf},
+	}
+	err = i.Initialize()
+	require.NoError(t, err)
+
+	// the index is created when the first segment is added
+	_, err = os.Stat(i.FilePath)
+	require.Error(t, err)
+
+	for _, name := range []string{
+		"2008-05-20_22-15-25-000000.mp4",
+		"2008-05-20_22-16-25-000000.mp4",
+		"2008-05-20_22-17-25-000000.mp4",
+	} {
+		err = i.Put(&IndexSegment{
+			PathName: "mypath",
+			Fpath:    filepath.Join(dir, "mypath", name),
+			Start:    time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local),
+			Duration: time.Minute,
+			Size:     100,
+			Complete: true,
+		})
+		require.NoError(t, err)
+	}
+
+	err = i.Delete(filepath.Join(dir, "mypath", "2008-05-20_22-16-25-000000.mp4"))
+	require.NoError(t, err)
+
+	err = i.AddMarker(&Marker{
+		PathName: "mypath",
+		Time:     time.Date(2008, 5, 20, 22, 15, 30, 0, time.Local),
+		Type:     MarkerTypeBookmark,
+		Label:    "mylabel",
+	})
+	require.NoError(t, err)
+
+	// older than the first segment
+	err = i.AddMarker(&Marker{
+		PathName: "mypath",
+		Time:     time.Date(2008, 5, 19, 22, 15, 30, 0, time.Local),
+		Type:     MarkerTypeMotion,
+	})
+	require.NoError(t, err)
+
+	i.Close()
+
+	i = &Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: map[string]*conf.Path{"mypath": pathConf},
+	}
+	err = i.Initialize()
+	require.NoError(t, err)
+	defer i.Close()
+
+	require.Equal(t, []string{"mypath"}, i.FindAllPathsWithSegments(i.PathConfs))
+
+	segments, err := i.FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath:    filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4"),
+			Start:    time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local),
+			Duration: time.Minute,
+			Size:     100,
+		},
+		{
+			Fpath:    filepath.Join(dir, "mypath", "2008-05-20_22-17-25-000000.mp4"),
+			Start:    time.Date(2008, 5, 20, 22, 17, 25, 0, time.Local),
+			Duration: time.Minute,
+			Size:     100,
+		},
+	}, segments)
+
+	segments, err = i.FindSegmentsInTimespan(pathConf, "mypath",
+		time.Date(2008, 5, 20, 22, 17, 30, 0, time.Local), time.Second)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	_, err = i.FindSegmentsInTimespan(pathConf, "mypath",
+		time.Date(2008, 5, 20, 22, 19, 30, 0, time.Local), time.Second)
+	require.ErrorIs(t, err, ErrNoSegmentsFound)
+
+	markers := i.FindMarkers("mypath",
+		time.Date(2008, 5, 19, 0, 0, 0, 0, time.Local), time.Date(2008, 5, 21, 0, 0, 0, 0, time.Local))
+	require.Len(t, markers, 1)
+	require.Equal(t, MarkerTypeBookmark, markers[0].Type)
+	require.Equal(t, "mylabel", markers[0].Label)
+	require.True(t, markers[0].Time.Equal(time.Date(2008, 5, 20, 22, 15, 30, 0, time.Local)))
+
+	// files do not exist on disk
+	res, err := i.Verify()
+	require.NoError(t, err)
+	require.Len(t, res.Missing, 2)
+}
+
+func TestIndexCompaction(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pathConf := &conf.Path{
+		Name:         "~^.*$",
+		Regexp:       regexp.MustCompile("^.*$"),
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+	}
+
+	i := &Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: map[string]*conf.Path{"~^.*$": pathConf},
+	}
+	err = i.Initialize()
+	require.NoError(t, err)
+	defer i.Close()
+
+	put := func(pathName string, n int) {
+		start := time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local).Add(time.Duration(n) * time.Minute)
+		err2 := i.Put(&IndexSegment{
+			PathName: pathName,
+			Fpath:    Path{Path: pathName, Start: start}.Encode(pathConf.RecordPath) + ".mp4",
+			Start:    start,
+			Duration: time.Minute,
+			Size:     100,
+			Complete: true,
+		})
+		require.NoError(t, err2)
+	}
+
+	// segments are added in reverse order
+	for n := 9; n >= 0; n-- {
+		put("path1", n)
+		put("path2", n)
+	}
+
+	// segments are replaced many times
+	for range indexCompactMinEntries {
+		put("path1", 3)
+	}
+
+	byts, err := os.ReadFile(i.FilePath)
+	require.NoError(t, err)
+	require.Less(t, bytes.Count(byts, []byte("\n")), indexCompactMinEntries)
+
+	err = i.Delete(Path{Path: "path2", Start: time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local)}.
+		Encode(pathConf.RecordPath) + ".mp4")
+	require.NoError(t, err)
+
+	for _, ca := range []struct {
+		pathName string
+		count    int
+	}{
+		{"path1", 10},
+		{"path2", 9},
+	} {
+		segments, err := i.FindSegments(pathConf, ca.pathName)
+		require.NoError(t, err)
+		require.Len(t, segments, ca.count)
+
+		for j, seg := range segments {
+			require.Equal(t, filepath.Join(dir, ca.pathName), filepath.Dir(seg.Fpath))
+			if j != 0 {
+				require.True(t, seg.Start.After(segments[j-1].Start))
+			}
+		}
+	}
+
+	_, err = i.FindSegments(pathConf, "path3")
+	require.Equal(t, ErrNoSegmentsFound, err)
+}
@@ -0,0 +1,440 @@
+package recordstore
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+// ManifestPart is a fMP4 part of a segment.
+type ManifestPart struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes the content of a segment.
+// Manifests of a path are chained together through the hash of the previous one,
+// in order to detect removed or reordered segments.
+type Manifest struct {
+	PathName  string          `json:"path"`
+	Segment   string          `json:"segment"`
+	Sequence  uint64          `json:"sequence"`
+	Start     time.Time       `json:"start"`
+	Size      int64           `json:"size"`
+	SHA256    string          `json:"sha256"`
+	Parts     []*ManifestPart `json:"parts"`
+	Previous  string          `json:"previous"`
+	Hash      string          `json:"hash"`
+	Signature string          `json:"signature,omitempty"`
+}
+
+// payload returns the content covered by hash and signature.
+func (m *Manifest) payload() ([]byte, error) {
+	cp := *m
+	cp.Hash = ""
+	cp.Signature = ""
+	return json.Marshal(cp)
+}
+
+// Seal fills hash and, if a key is provided, signature of the manifest.
+func (m *Manifest) Seal(key ed25519.PrivateKey) error {
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	m.Hash = hex.EncodeToString(sum[:])
+
+	if key != nil {
+		m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	} else {
+		m.Signature = ""
+	}
+
+	return nil
+}
+
+// verifySeal checks hash and, if a key is provided, signature of the manifest.
+func (m *Manifest) verifySeal(key ed25519.PublicKey) error {
+	payload, err := m.payload()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != m.Hash {
+		return fmt.Errorf("manifest hash mismatch")
+	}
+
+	if key != nil {
+		if m.Signature == "" {
+			return fmt.Errorf("manifest is not signed")
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(m.Signature)
+		if err != nil || !ed25519.Verify(key, payload, sig) {
+			return fmt.Errorf("invalid manifest signature")
+		}
+	}
+
+	return nil
+}
+
+// ManifestPath returns the path of the manifest of a segment.
+// The extension of the segment is replaced,
+// otherwise the file would be decoded as a segment.
+func ManifestPath(segmentPath string) string {
+	return strings.TrimSuffix(segmentPath, filepath.Ext(segmentPath)) + ".manifest"
+}
+
+// WriteManifest writes the manifest of a segment.
+func WriteManifest(segmentPath string, m *Manifest) error {
+	byts, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fpath := ManifestPath(segmentPath)
+	tmpPath := fpath + ".tmp"
+
+	err = os.WriteFile(tmpPath, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, fpath)
+}
+
+// ReadManifest reads the manifest of a segment of a path, in any tier.
+func ReadManifest(pathConf *conf.Path, segmentPath string) (*Manifest, error) {
+	st, err := storageForPath(pathConf, segmentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := st.open(context.Background(), ManifestPath(segmentPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	byts, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	err = json.Unmarshal(byts, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func readPEM(fpath string) (*pem.Block, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(byts)
+	if block == nil {
+		return nil, fmt.Errorf("%s: PEM data not found", fpath)
+	}
+
+	return block, nil
+}
+
+// LoadSigningKey loads a Ed25519 private key in PKCS #8, PEM form.
+func LoadSigningKey(fpath string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a Ed25519 key", fpath)
+	}
+
+	return priv, nil
+}
+
+// LoadVerificationKey loads a Ed25519 public key in PEM form.
+// Private keys are accepted too.
+func LoadVerificationKey(fpath string) (ed25519.PublicKey, error) {
+	block, err := readPEM(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "PRIVATE KEY" {
+		var priv ed25519.PrivateKey
+		priv, err = LoadSigningKey(fpath)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a Ed25519 key", fpath)
+	}
+
+	return pub, nil
+}
+
+// ManifestBuilder computes hashes of a segment while it is written.
+type ManifestBuilder struct {
+	h     hash.Hash
+	size  int64
+	parts []*ManifestPart
+}
+
+// NewManifestBuilder allocates a ManifestBuilder.
+func NewManifestBuilder() *ManifestBuilder {
+	return &ManifestBuilder{
+		h:     sha256.New(),
+		parts: []*ManifestPart{},
+	}
+}
+
+// Write implements io.Writer.
+func (b *ManifestBuilder) Write(p []byte) (int, error) {
+	b.h.Write(p)
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+// WritePart writes a fMP4 part.
+func (b *ManifestBuilder) WritePart(p []byte) {
+	sum := sha256.Sum256(p)
+
+	b.parts = append(b.parts, &ManifestPart{
+		Offset: b.size,
+		Size:   int64(len(p)),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+
+	b.Write(p) //nolint:errcheck
+}
+
+// Manifest returns the manifest of the segment.
+// Sequence and Previous must be filled by the caller.
+func (b *ManifestBuilder) Manifest(pathName string, segmentPath string, start time.Time) *Manifest {
+	return &Manifest{
+		PathName: pathName,
+		Segment:  filepath.Base(segmentPath),
+		Start:    start,
+		Size:     b.size,
+		SHA256:   hex.EncodeToString(b.h.Sum(nil)),
+		Parts:    b.parts,
+	}
+}
+
+// types of issues found by VerifyManifests.
+const (
+	ManifestIssueAltered   = "altered"
+	ManifestIssueMissing   = "missing"
+	ManifestIssueReordered = "reordered"
+)
+
+// ManifestIssue is an issue found by VerifyManifests.
+type ManifestIssue struct {
+	Segment string
+	Type    string
+	Reason  string
+}
+
+// ManifestVerifyResult is the result of VerifyManifests.
+type ManifestVerifyResult struct {
+	Segments int
+	Issues   []*ManifestIssue
+}
+
+// verifySegmentContent compares a segment with its manifest.
+func verifySegmentContent(pathConf *conf.Path, fpath string, m *Manifest) error {
+	st, err := storageForPath(pathConf, fpath)
+	if err != nil {
+		return err
+	}
+
+	size, err := st.stat(context.Background(), fpath)
+	if err != nil {
+		return err
+	}
+
+	if size != m.Size {
+		return fmt.Errorf("size is %d, expected %d", size, m.Size)
+	}
+
+	rf, err := st.open(context.Background(), fpath)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	f := io.NewSectionReader(rf, 0, size)
+
+	h := sha256.New()
+	var pos int64
+
+	for _, part := range m.Parts {
+		if part.Offset < pos || part.Offset+part.Size > m.Size {
+			return fmt.Errorf("invalid part at offset %d", part.Offset)
+		}
+
+		_, err = io.CopyN(h, f, part.Offset-pos)
+		if err != nil {
+			return err
+		}
+
+		ph := sha256.New()
+		_, err = io.CopyN(io.MultiWriter(h, ph), f, part.Size)
+		if err != nil {
+			return err
+		}
+
+		if hex.EncodeToString(ph.Sum(nil)) != part.SHA256 {
+			return fmt.Errorf("part at offset %d has been modified", part.Offset)
+		}
+
+		pos = part.Offset + part.Size
+	}
+
+	_, err = io.CopyN(h, f, m.Size-pos)
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != m.SHA256 {
+		return fmt.Errorf("content has been modified")
+	}
+
+	return nil
+}
+
+// manifestMatchesSegment checks whether a manifest belongs to a segment.
+// Segments moved into a tier with a different layout have a different name,
+// therefore the start time of the manifest is encoded with the layout of the tier that contains the segment.
+func manifestMatchesSegment(pathConf *conf.Path, fpath string, m *Manifest) bool {
+	if m.Segment == filepath.Base(fpath) {
+		return true
+	}
+
+	locations, err := recordLocations(pathConf, m.PathName)
+	if err != nil {
+		return false
+	}
+
+	for _, loc := range locations {
+		var pa Path
+		if pa.Decode(loc.recordPath, fpath) && (Path{Start: m.Start.Local()}).Encode(loc.recordPath) == fpath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyManifests checks sorted segments of a path against their manifests.
+// Signatures are checked only when a key is provided.
+func VerifyManifests(pathConf *conf.Path, segments []*Segment, key ed25519.PublicKey) *ManifestVerifyResult {
+	ret := &ManifestVerifyResult{
+		Segments: len(segments),
+		Issues:   []*ManifestIssue{},
+	}
+
+	addIssue := func(seg *Segment, typ string, reason string) {
+		ret.Issues = append(ret.Issues, &ManifestIssue{
+			Segment: seg.Fpath,
+			Type:    typ,
+			Reason:  reason,
+		})
+	}
+
+	var prev *Manifest
+
+	for i, seg := range segments {
+		m, err := ReadManifest(pathConf, seg.Fpath)
+		if err != nil {
+			// the last segment may still be recording
+			if i == len(segments)-1 && errors.Is(err, os.ErrNotExist) {
+				ret.Segments--
+				break
+			}
+
+			addIssue(seg, ManifestIssueMissing, fmt.Sprintf("unable to read manifest: %v", err))
+			prev = nil
+			continue
+		}
+
+		// the chain can't be checked across untrusted manifests
+		err = m.verifySeal(key)
+		if err != nil {
+			addIssue(seg, ManifestIssueAltered, err.Error())
+			prev = nil
+			continue
+		}
+
+		// segment and manifest have been renamed
+		if !manifestMatchesSegment(pathConf, seg.Fpath, m) {
+			addIssue(seg, ManifestIssueReordered, fmt.Sprintf("manifest belongs to segment %s", m.Segment))
+			prev = nil
+			continue
+		}
+
+		err = verifySegmentContent(pathConf, seg.Fpath, m)
+		if err != nil {
+			addIssue(seg, ManifestIssueAltered, err.Error())
+		}
+
+		if prev != nil {
+			switch {
+			case m.Sequence <= prev.Sequence:
+				addIssue(seg, ManifestIssueReordered,
+					fmt.Sprintf("sequence number is %d, previous is %d", m.Sequence, prev.Sequence))
+
+			case m.Sequence > prev.Sequence+1:
+				addIssue(seg, ManifestIssueMissing,
+					fmt.Sprintf("%d segments are missing before this one", m.Sequence-prev.Sequence-1))
+
+			case m.Previous != prev.Hash:
+				addIssue(seg, ManifestIssueAltered, "previous manifest hash mismatch")
+			}
+		}
+
+		prev = m
+	}
+
+	return ret
+}
@@ -0,0 +1,260 @@
+package recordstore
+
+import (
+	"context"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func writeManifestSegments(t *testing.T, dir string, key ed25519.PrivateKey) []*Segment {
+	var segments []*Segment
+	var sequence uint64
+	var previous string
+
+	for i := 0; i < 3; i++ {
+		start := time.Date(2015, 5, 19, 22, 15, 25+i, 0, time.UTC)
+		fpath := filepath.Join(dir, start.Format("2006-01-02_15-04-05")+".mp4")
+
+		b := NewManifestBuilder()
+		init := []byte{'i', 'n', 'i', 't'}
+		b.Write(init) //nolint:errcheck
+		content := init
+
+		for j := 0; j < 2; j++ {
+			part := []byte{byte(i), byte(j), 1, 2, 3}
+			b.WritePart(part)
+			content = append(content, part...)
+		}
+
+		err := os.WriteFile(fpath, content, 0o644)
+		require.NoError(t, err)
+
+		m := b.Manifest("mypath", fpath, start)
+		sequence++
+		m.Sequence = sequence
+		m.Previous = previous
+
+		err = m.Seal(key)
+		require.NoError(t, err)
+
+		err = WriteManifest(fpath, m)
+		require.NoError(t, err)
+
+		previous = m.Hash
+		segments = append(segments, &Segment{Fpath: fpath, Start: start})
+	}
+
+	return segments
+}
+
+func TestVerifyManifests(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	for _, ca := range []string{
+		"valid",
+		"altered part",
+		"altered manifest",
+		"other key",
+		"missing",
+		"reordered",
+		"recording",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			segments := writeManifestSegments(t, dir, priv)
+			key := pub
+
+			var expected []*ManifestIssue
+			expectedSegments := 3
+
+			switch ca {
+			case "altered part":
+				f, err2 := os.OpenFile(segments[1].Fpath, os.O_WRONLY, 0o644)
+				require.NoError(t, err2)
+				_, err2 = f.WriteAt([]byte{9}, 11)
+				require.NoError(t, err2)
+				f.Close()
+
+				expected = []*ManifestIssue{{
+					Segment: segments[1].Fpath,
+					Type:    ManifestIssueAltered,
+					Reason:  "part at offset 9 has been modified",
+				}}
+
+			case "altered manifest":
+				m, err2 := ReadManifest(&conf.Path{}, segments[1].Fpath)
+				require.NoError(t, err2)
+				m.Size++
+				err2 = WriteManifest(segments[1].Fpath, m)
+				require.NoError(t, err2)
+
+				expected = []*ManifestIssue{{
+					Segment: segments[1].Fpath,
+					Type:    ManifestIssueAltered,
+					Reason:  "manifest hash mismatch",
+				}}
+
+			case "other key":
+				key, _, err = ed25519.GenerateKey(nil)
+				require.NoError(t, err)
+
+				for _, seg := range segments {
+					expected = append(expected, &ManifestIssue{
+						Segment: seg.Fpath,
+						Type:    ManifestIssueAltered,
+						Reason:  "invalid manifest signature",
+					})
+				}
+
+			case "missing":
+				segments = []*Segment{segments[0], segments[2]}
+				expectedSegments = 2
+
+				expected = []*ManifestIssue{{
+					Segment: segments[1].Fpath,
+					Type:    ManifestIssueMissing,
+					Reason:  "1 segments are missing before this one",
+				}}
+
+			case "reordered":
+				// content of the first and second segments are swapped
+				for _, suffix := range []func(string) string{
+					func(s string) string { return s },
+					ManifestPath,
+				} {
+					p0, p1 := suffix(segments[0].Fpath), suffix(segments[1].Fpath)
+					err = os.Rename(p0, p0+".tmp")
+					require.NoError(t, err)
+					err = os.Rename(p1, p0)
+					require.NoError(t, err)
+					err = os.Rename(p0+".tmp", p1)
+					require.NoError(t, err)
+				}
+
+				expected = []*ManifestIssue{
+					{
+						Segment: segments[0].Fpath,
+						Type:    ManifestIssueReordered,
+						Reason:  "manifest belongs to segment " + filepath.Base(segments[1].Fpath),
+					},
+					{
+						Segment: segments[1].Fpath,
+						Type:    ManifestIssueReordered,
+						Reason:  "manifest belongs to segment " + filepath.Base(segments[0].Fpath),
+					},
+				}
+
+			case "recording":
+				// the manifest of the last segment is written when the segment is complete
+				err = os.Remove(ManifestPath(segments[2].Fpath))
+				require.NoError(t, err)
+				expectedSegments = 2
+			}
+
+			if expected == nil {
+				expected = []*ManifestIssue{}
+			}
+
+			require.Equal(t, &ManifestVerifyResult{
+				Segments: expectedSegments,
+				Issues:   expected,
+			}, VerifyManifests(&conf.Path{}, segments, key))
+		})
+	}
+}
+
+func TestVerifyManifestsMovedSegment(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s3 := &test.S3Server{}
+	s3.Initialize()
+	defer s3.Close()
+
+	pathConf := &conf.Path{
+		RecordPath:   filepath.Join(dir, "hot", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+		RecordTiers: conf.RecordTiers{
+			{
+				After: conf.StringDuration(time.Hour),
+				Path:  filepath.Join(dir, "warm", "%path/%Y/%m/%d/%H-%M-%S-%f"),
+			},
+			{
+				After:      conf.StringDuration(2 * time.Hour),
+				Path:       "s3://mybucket/%path/%Y%m%d/%H%M%S%f",
+				S3Endpoint: s3.URL(),
+			},
+		},
+	}
+
+	hot := filepath.Join(dir, "hot", "mypath")
+	err = os.MkdirAll(hot, 0o755)
+	require.NoError(t, err)
+
+	var sequence uint64
+	var previous string
+
+	for i := 0; i < 2; i++ {
+		start := time.Date(2015, 5, 19, 22, 15, 25+i, 427000, time.Local)
+		fpath := Path{Start: start}.Encode(PathAddExtension(pathConf.RecordPath, pathConf.RecordFormat))
+		fpath = filepath.Join(hot, filepath.Base(fpath))
+
+		b := NewManifestBuilder()
+		b.WritePart([]byte{byte(i), 1, 2, 3})
+
+		err = os.WriteFile(fpath, []byte{byte(i), 1, 2, 3}, 0o644)
+		require.NoError(t, err)
+
+		m := b.Manifest("mypath", fpath, start)
+		sequence++
+		m.Sequence = sequence
+		m.Previous = previous
+
+		err = m.Seal(priv)
+		require.NoError(t, err)
+
+		err = WriteManifest(fpath, m)
+		require.NoError(t, err)
+
+		previous = m.Hash
+	}
+
+	segments, err := FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+
+	// segments are moved into tiers with different layouts
+	for i, seg := range segments {
+		dst, err2 := CopySegment(context.Background(), pathConf, "mypath", seg.Fpath, i+1)
+		require.NoError(t, err2)
+		require.NotEqual(t, filepath.Base(seg.Fpath), filepath.Base(dst))
+
+		err2 = RemoveSegment(pathConf, seg.Fpath)
+		require.NoError(t, err2)
+	}
+
+	segments, err = FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	require.True(t, IsRemoteSegment(segments[1].Fpath))
+
+	require.Equal(t, &ManifestVerifyResult{
+		Segments: 2,
+		Issues:   []*ManifestIssue{},
+	}, VerifyManifests(pathConf, segments, pub))
+}
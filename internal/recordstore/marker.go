@@ -0,0 +1,78 @@
+package recordstore
+
+import (
+	"sort"
+	"time"
+)
+
+// MarkerType is the type of a marker.
+type MarkerType string
+
+// marker types.
+// Recording start markers are added by the recorder.
+// Motion and bookmark markers are added through the API only:
+// events of cameras are not subscribed, therefore whoever receives them
+// (for instance a VMS or an ISAPI alert stream consumer) must forward them.
+const (
+	MarkerTypeMotion         MarkerType = "motion"
+	MarkerTypeBookmark       MarkerType = "bookmark"
+	MarkerTypeRecordingStart MarkerType = "recordingStart"
+)
+
+// Marker is an event attached to the recordings of a path.
+type Marker struct {
+	PathName string     `json:"path"`
+	Time     time.Time  `json:"time"`
+	Type     MarkerType `json:"type"`
+	Label    string     `json:"label,omitempty"`
+}
+
+// AddMarker adds a marker.
+func (i *Index) AddMarker(m *Marker) error {
+	if i == nil {
+		return nil
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.markers = append(i.markers, m)
+	return i.write(&indexEntry{Op: indexOpMark, Marker: m})
+}
+
+// FindMarkers returns markers of a path in a certain timespan, sorted by time.
+func (i *Index) FindMarkers(pathName string, start time.Time, end time.Time) []*Marker {
+	if i == nil {
+		return nil
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	var ret []*Marker
+
+	for _, m := range i.markers {
+		if m.PathName == pathName && !m.Time.Before(start) && m.Time.Before(end) {
+			ret = append(ret, m)
+		}
+	}
+
+	sort.SliceStable(ret, func(a, b int) bool {
+		return ret[a].Time.Before(ret[b].Time)
+	})
+
+	return ret
+}
+
+// retainedMarkers returns markers that are not older than the first segment of their path.
+func (i *Index) retainedMarkers() []*Marker {
+	var ret []*Marker
+
+	for _, m := range i.markers {
+		if ip, ok := i.paths[m.PathName]; ok && !m.Time.Before(ip.segments[0].Start) {
+			ret = append(ret, m)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,401 @@
+package recordstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3BlockSize     = 1024 * 1024
+
+	// requests have no total timeout, since uploads of large segments take time;
+	// stalled connections are detected by these timeouts and requests are canceled with their context.
+	s3DialTimeout     = 10 * time.Second
+	s3ResponseTimeout = 60 * time.Second
+)
+
+// s3Escape encodes a string as required by AWS Signature Version 4.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~':
+			b.WriteByte(c)
+
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type s3ErrorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// s3Client is a client of a bucket of a S3-compatible object storage.
+// Requests use path-style addressing and are signed with AWS Signature Version 4.
+type s3Client struct {
+	endpoint        *url.URL
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	bucket          string
+	httpClient      *http.Client
+}
+
+func newS3Client(tier conf.RecordTier) (*s3Client, error) {
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(tier.Path, "s3://"), "/")
+
+	region := tier.S3Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	endpoint := tier.S3Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid S3 endpoint: '%s'", endpoint)
+	}
+
+	return &s3Client{
+		endpoint:        u,
+		region:          region,
+		accessKeyID:     tier.S3AccessKeyID,
+		secretAccessKey: tier.S3SecretAccessKey,
+		bucket:          bucket,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   s3DialTimeout,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   s3DialTimeout,
+				ResponseHeaderTimeout: s3ResponseTimeout,
+				ExpectContinueTimeout: time.Second,
+				IdleConnTimeout:       90 * time.Second,
+				MaxIdleConnsPerHost:   4,
+			},
+		},
+	}, nil
+}
+
+func (c *s3Client) sign(req *http.Request, payloadHash string) {
+	amzDate := time.Now().UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if c.accessKeyID == "" {
+		return
+	}
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	queryParts := make([]string, len(keys))
+	for i, k := range keys {
+		queryParts[i] = s3Escape(k, true) + "=" + s3Escape(query.Get(k), true)
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(queryParts, "&"),
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+
+	stringToSign := "AWS4-HMAC-SHA256\n" +
+		amzDate + "\n" +
+		scope + "\n" +
+		s3Hash([]byte(canonicalRequest))
+
+	key := s3HMAC([]byte("AWS4"+c.secretAccessKey), date)
+	key = s3HMAC(key, c.region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+hex.EncodeToString(s3HMAC(key, stringToSign)))
+}
+
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	base := strings.TrimSuffix(c.endpoint.Path, "/")
+
+	objectPath := c.bucket
+	if key != "" {
+		objectPath += "/" + key
+	}
+
+	u := *c.endpoint
+	u.Path = base + "/" + objectPath
+	u.RawPath = s3Escape(base, false) + "/" + s3Escape(objectPath, false)
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+func (c *s3Client) do(
+	ctx context.Context,
+	method string,
+	key string,
+	query url.Values,
+	header http.Header,
+	body io.Reader,
+	size int64,
+	payloadHash string,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	c.sign(req, payloadHash)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("s3://%s/%s: %w", c.bucket, key, os.ErrNotExist)
+	}
+
+	var e s3ErrorResponse
+	byts, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if xml.Unmarshal(byts, &e) == nil && e.Code != "" {
+		return nil, fmt.Errorf("S3 error: %s (%s)", e.Code, e.Message)
+	}
+
+	return nil, fmt.Errorf("S3 error: bad status code: %d", res.StatusCode)
+}
+
+func (c *s3Client) putObject(ctx context.Context, key string, r io.ReaderAt, size int64) error {
+	h := sha256.New()
+	_, err := io.Copy(h, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if size != 0 {
+		body = io.NewSectionReader(r, 0, size)
+	}
+
+	res, err := c.do(ctx, http.MethodPut, key, nil, nil, body, size, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+func (c *s3Client) getObject(ctx context.Context, key string, off int64, size int64) ([]byte, error) {
+	header := http.Header{}
+	header.Set("Range", "bytes="+strconv.FormatInt(off, 10)+"-"+strconv.FormatInt(off+size-1, 10))
+
+	res, err := c.do(ctx, http.MethodGet, key, nil, header, nil, 0, s3Hash(nil))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	buf := make([]byte, size)
+	_, err = io.ReadFull(res.Body, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (c *s3Client) headObject(ctx context.Context, key string) (int64, error) {
+	res, err := c.do(ctx, http.MethodHead, key, nil, nil, nil, 0, s3Hash(nil))
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	return res.ContentLength, nil
+}
+
+func (c *s3Client) deleteObject(ctx context.Context, key string) error {
+	res, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil, 0, s3Hash(nil))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+func (c *s3Client) listObjects(ctx context.Context, prefix string, cb func(key string) error) error {
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := c.do(ctx, http.MethodGet, "", query, nil, nil, 0, s3Hash(nil))
+		if err != nil {
+			return err
+		}
+
+		var out s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&out)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range out.Contents {
+			err = cb(obj.Key)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !out.IsTruncated {
+			return nil
+		}
+
+		token = out.NextContinuationToken
+	}
+}
+
+// s3Object reads an object with range requests.
+// The last block is cached, since segments are mostly read sequentially.
+type s3Object struct {
+	ctx  context.Context
+	c    *s3Client
+	key  string
+	size int64
+
+	blockStart int64
+	block      []byte
+}
+
+// ReadAt implements io.ReaderAt.
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+
+	for n < len(p) {
+		if off >= o.size {
+			return n, io.EOF
+		}
+
+		if o.block == nil || off < o.blockStart || off >= o.blockStart+int64(len(o.block)) {
+			start := off - off%s3BlockSize
+			size := min(int64(s3BlockSize), o.size-start)
+
+			block, err := o.c.getObject(o.ctx, o.key, start, size)
+			if err != nil {
+				return n, err
+			}
+
+			o.blockStart = start
+			o.block = block
+		}
+
+		c := copy(p[n:], o.block[off-o.blockStart:])
+		n += c
+		off += int64(c)
+	}
+
+	return n, nil
+}
+
+// s3File is an object opened for reading.
+type s3File struct {
+	*io.SectionReader
+}
+
+// Close implements io.Closer.
+func (s3File) Close() error {
+	return nil
+}
@@ -2,10 +2,8 @@ package recordstore
 
 import (
 	"errors"
-	"io/fs"
-	"path/filepath"
+	"os"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/ctenhank/mediamtx/internal/conf"
@@ -17,74 +15,48 @@ var ErrNoSegmentsFound = errors.New("no recording segments found")
 var errFound = errors.New("found")
 
 // Segment is a recording segment.
+// Duration and Size are filled only when segments are read from the index.
 type Segment struct {
-	Fpath string
-	Start time.Time
+	Fpath    string
+	Start    time.Time
+	Duration time.Duration
+	Size     int64
 }
 
 func fixedPathHasSegments(pathConf *conf.Path) bool {
-	recordPath := PathAddExtension(
-		strings.ReplaceAll(pathConf.RecordPath, "%path", pathConf.Name),
-		pathConf.RecordFormat,
-	)
-
-	// we have to convert to absolute paths
-	// otherwise, recordPath and fpath inside Walk() won't have common elements
-	recordPath, _ = filepath.Abs(recordPath)
-
-	commonPath := CommonPath(recordPath)
-
-	err := filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	locations, err := recordLocations(pathConf, pathConf.Name)
+	if err != nil {
+		return false
+	}
 
-		if !info.IsDir() {
-			var pa Path
-			ok := pa.Decode(recordPath, fpath)
-			if ok {
-				return errFound
-			}
+	for _, loc := range locations {
+		err = loc.walk(func(_ string, _ Path) error {
+			return errFound
+		})
+		if errors.Is(err, errFound) {
+			return true
 		}
-
-		return nil
-	})
-	if err != nil && !errors.Is(err, errFound) {
-		return false
 	}
 
-	return errors.Is(err, errFound)
+	return false
 }
 
 func regexpPathFindPathsWithSegments(pathConf *conf.Path) map[string]struct{} {
-	recordPath := PathAddExtension(
-		pathConf.RecordPath,
-		pathConf.RecordFormat,
-	)
-
-	// we have to convert to absolute paths
-	// otherwise, recordPath and fpath inside Walk() won't have common elements
-	recordPath, _ = filepath.Abs(recordPath)
-
-	commonPath := CommonPath(recordPath)
-
 	ret := make(map[string]struct{})
 
-	filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error { //nolint:errcheck
-		if err != nil {
-			return err
-		}
+	locations, err := recordLocations(pathConf, "")
+	if err != nil {
+		return ret
+	}
 
-		if !info.IsDir() {
-			var pa Path
-			ok := pa.Decode(recordPath, fpath)
-			if ok && pathConf.Regexp.FindStringSubmatch(pa.Path) != nil {
+	for _, loc := range locations {
+		loc.walk(func(_ string, pa Path) error { //nolint:errcheck
+			if pathConf.Regexp.FindStringSubmatch(pa.Path) != nil {
 				ret[pa.Path] = struct{}{}
 			}
-		}
-
-		return nil
-	})
+			return nil
+		})
+	}
 
 	return ret
 }
@@ -116,56 +88,68 @@ func FindAllPathsWithSegments(pathConfs map[string]*conf.Path) []string {
 	return out
 }
 
-// FindSegments returns all segments of a path.
-func FindSegments(
+// findSegments returns sorted segments of a path, in all tiers.
+func findSegments(
 	pathConf *conf.Path,
 	pathName string,
+	filter func(pa Path) bool,
 ) ([]*Segment, error) {
-	recordPath := PathAddExtension(
-		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
-		pathConf.RecordFormat,
-	)
-
-	// we have to convert to absolute paths
-	// otherwise, recordPath and fpath inside Walk() won't have common elements
-	recordPath, _ = filepath.Abs(recordPath)
+	locations, err := recordLocations(pathConf, pathName)
+	if err != nil {
+		return nil, err
+	}
 
-	commonPath := CommonPath(recordPath)
 	var segments []*Segment
 
-	err := filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			var pa Path
-			ok := pa.Decode(recordPath, fpath)
-			if ok {
+	for _, loc := range locations {
+		err = loc.walk(func(fpath string, pa Path) error {
+			if filter == nil || filter(pa) {
 				segments = append(segments, &Segment{
 					Fpath: fpath,
 					Start: pa.Start,
 				})
 			}
+			return nil
+		})
+		if err != nil {
+			// when tiers are in use, any location may not exist yet
+			if len(locations) > 1 && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
 		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
 
 	if segments == nil {
 		return nil, ErrNoSegmentsFound
 	}
 
-	sort.Slice(segments, func(i, j int) bool {
+	sort.SliceStable(segments, func(i, j int) bool {
 		return segments[i].Start.Before(segments[j].Start)
 	})
 
+	// a segment is in two tiers while it is being moved.
+	// Keep the source, since it is removed only after the copy is complete.
+	n := 1
+	for _, seg := range segments[1:] {
+		if !seg.Start.Equal(segments[n-1].Start) {
+			segments[n] = seg
+			n++
+		}
+	}
+	segments = segments[:n]
+
 	return segments, nil
 }
 
+// FindSegments returns all segments of a path.
+func FindSegments(
+	pathConf *conf.Path,
+	pathName string,
+) ([]*Segment, error) {
+	return findSegments(pathConf, pathName, nil)
+}
+
 // FindSegmentsInTimespan returns all segments in a certain timestamp.
 func FindSegmentsInTimespan(
 	pathConf *conf.Path,
@@ -173,51 +157,21 @@ func FindSegmentsInTimespan(
 	start time.Time,
 	duration time.Duration,
 ) ([]*Segment, error) {
-	recordPath := PathAddExtension(
-		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
-		pathConf.RecordFormat,
-	)
-
-	// we have to convert to absolute paths
-	// otherwise, recordPath and fpath inside Walk() won't have common elements
-	recordPath, _ = filepath.Abs(recordPath)
-
-	commonPath := CommonPath(recordPath)
 	end := start.Add(duration)
-	var segments []*Segment
-
-	err := filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			var pa Path
-			ok := pa.Decode(recordPath, fpath)
 
-			// gather all segments that starts before the end of the playback
-			if ok && !end.Before(pa.Start) {
-				segments = append(segments, &Segment{
-					Fpath: fpath,
-					Start: pa.Start,
-				})
-			}
-		}
-
-		return nil
+	// gather all segments that starts before the end of the playback
+	segments, err := findSegments(pathConf, pathName, func(pa Path) bool {
+		return !end.Before(pa.Start)
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if segments == nil {
-		return nil, ErrNoSegmentsFound
-	}
-
-	sort.Slice(segments, func(i, j int) bool {
-		return segments[i].Start.Before(segments[j].Start)
-	})
+	return segmentsStartingFrom(segments, start)
+}
 
+// segmentsStartingFrom removes segments that end before start from a sorted list of segments.
+func segmentsStartingFrom(segments []*Segment, start time.Time) ([]*Segment, error) {
 	// find the segment that may contain the start of the playback and remove all previous ones
 	found := false
 	for i := 0; i < len(segments)-1; i++ {
@@ -0,0 +1,337 @@
+package recordstore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/pkg/formats/mpegts"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+const (
+	trunFlagSampleDurationPresent = 0x100
+	trunFlagSampleFlagsPresent    = 0x400
+	trunFlagFirstSampleFlags      = 0x004
+	tfhdFlagDefaultSampleDuration = 0x008
+	tfhdFlagDefaultSampleFlags    = 0x020
+	sampleFlagIsNonSyncSample     = 1 << 16
+)
+
+// FMP4CodecName returns the name of a fMP4 codec.
+func FMP4CodecName(codec fmp4.Codec) string {
+	switch codec.(type) {
+	case *fmp4.CodecAV1:
+		return "AV1"
+	case *fmp4.CodecVP9:
+		return "VP9"
+	case *fmp4.CodecH265:
+		return "H265"
+	case *fmp4.CodecH264:
+		return "H264"
+	case *fmp4.CodecMPEG4Video:
+		return "MPEG-4 Video"
+	case *fmp4.CodecMPEG1Video:
+		return "MPEG-1/2 Video"
+	case *fmp4.CodecMJPEG:
+		return "M-JPEG"
+	case *fmp4.CodecOpus:
+		return "Opus"
+	case *fmp4.CodecMPEG4Audio:
+		return "MPEG-4 Audio"
+	case *fmp4.CodecMPEG1Audio:
+		return "MPEG-1/2 Audio"
+	case *fmp4.CodecAC3:
+		return "AC-3"
+	case *fmp4.CodecLPCM:
+		return "LPCM"
+	}
+	return "unknown"
+}
+
+func mpegtsCodecName(codec mpegts.Codec) string {
+	switch codec.(type) {
+	case *mpegts.CodecH265:
+		return "H265"
+	case *mpegts.CodecH264:
+		return "H264"
+	case *mpegts.CodecMPEG4Video:
+		return "MPEG-4 Video"
+	case *mpegts.CodecMPEG1Video:
+		return "MPEG-1/2 Video"
+	case *mpegts.CodecOpus:
+		return "Opus"
+	case *mpegts.CodecMPEG4Audio:
+		return "MPEG-4 Audio"
+	case *mpegts.CodecMPEG1Audio:
+		return "MPEG-1/2 Audio"
+	case *mpegts.CodecAC3:
+		return "AC-3"
+	}
+	return "unknown"
+}
+
+func durationMp4ToGo(v int64, timeScale uint32) time.Duration {
+	timeScale64 := int64(timeScale)
+	secs := v / timeScale64
+	dec := v % timeScale64
+	return time.Duration(secs)*time.Second + time.Duration(dec)*time.Second/time.Duration(timeScale64)
+}
+
+func readBoxHeader(r io.Reader) (uint32, string, error) {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return 0, "", err
+	}
+
+	size := uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	if size < 8 {
+		return 0, "", fmt.Errorf("invalid box size")
+	}
+
+	return size, string(buf[4:]), nil
+}
+
+// fmp4Moof contains the informations of a moof box.
+type fmp4Moof struct {
+	maxElapsed time.Duration
+	keyframe   *time.Duration
+}
+
+func parseFMP4Moof(buf []byte, init *fmp4.Init) (*fmp4Moof, error) {
+	ret := &fmp4Moof{}
+
+	var track *fmp4.InitTrack
+	var tfhd *mp4.Tfhd
+	var baseTime int64
+
+	_, err := mp4.ReadBoxStructure(bytes.NewReader(buf), func(h *mp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moof", "traf":
+			return h.Expand()
+
+		case "tfhd":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfhd = box.(*mp4.Tfhd)
+
+			track = nil
+			for _, tr := range init.Tracks {
+				if tr.ID == int(tfhd.TrackID) {
+					track = tr
+				}
+			}
+			if track == nil {
+				return nil, fmt.Errorf("invalid track ID: %v", tfhd.TrackID)
+			}
+
+		case "tfdt":
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			tfdt := box.(*mp4.Tfdt)
+			if tfdt.GetVersion() == 0 {
+				baseTime = int64(tfdt.BaseMediaDecodeTimeV0)
+			} else {
+				baseTime = int64(tfdt.BaseMediaDecodeTimeV1)
+			}
+
+		case "trun":
+			if track == nil {
+				return nil, fmt.Errorf("trun box before tfhd")
+			}
+
+			box, _, err := h.ReadPayload()
+			if err != nil {
+				return nil, err
+			}
+			trun := box.(*mp4.Trun)
+
+			elapsed := baseTime
+
+			for i, entry := range trun.Entries {
+				if track.Codec.IsVideo() && ret.keyframe == nil {
+					var flags uint32
+					switch {
+					case trun.CheckFlag(trunFlagSampleFlagsPresent):
+						flags = entry.SampleFlags
+					case i == 0 && trun.CheckFlag(trunFlagFirstSampleFlags):
+						flags = trun.FirstSampleFlags
+					case tfhd.CheckFlag(tfhdFlagDefaultSampleFlags):
+						flags = tfhd.DefaultSampleFlags
+					}
+
+					if (flags & sampleFlagIsNonSyncSample) == 0 {
+						v := durationMp4ToGo(elapsed, track.TimeScale)
+						ret.keyframe = &v
+					}
+				}
+
+				if trun.CheckFlag(trunFlagSampleDurationPresent) {
+					elapsed += int64(entry.SampleDuration)
+				} else if tfhd.CheckFlag(tfhdFlagDefaultSampleDuration) {
+					elapsed += int64(tfhd.DefaultSampleDuration)
+				}
+			}
+
+			elapsedGo := durationMp4ToGo(elapsed, track.TimeScale)
+			if elapsedGo > ret.maxElapsed {
+				ret.maxElapsed = elapsedGo
+			}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func readFMP4SegmentInfo(r io.ReadSeeker, seg *IndexSegment) error {
+	ftypSize, typ, err := readBoxHeader(r)
+	if err != nil {
+		return err
+	}
+	if typ != "ftyp" {
+		return fmt.Errorf("ftyp box not found")
+	}
+
+	_, err = r.Seek(int64(ftypSize), io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	moovSize, typ, err := readBoxHeader(r)
+	if err != nil {
+		return err
+	}
+	if typ != "moov" {
+		return fmt.Errorf("moov box not found")
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, ftypSize+moovSize)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return err
+	}
+
+	var init fmp4.Init
+	err = init.Unmarshal(bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+
+	for _, track := range init.Tracks {
+		seg.Codecs = append(seg.Codecs, FMP4CodecName(track.Codec))
+	}
+
+	pos := int64(ftypSize + moovSize)
+
+	for {
+		moofSize, typ, err := readBoxHeader(r)
+		if err != nil {
+			break
+		}
+		if typ != "moof" {
+			return fmt.Errorf("moof box not found")
+		}
+
+		buf := make([]byte, moofSize)
+		_, err = r.Seek(pos, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			break
+		}
+
+		mdatSize, typ, err := readBoxHeader(r)
+		if err != nil {
+			break
+		}
+		if typ != "mdat" {
+			return fmt.Errorf("mdat box not found")
+		}
+
+		moof, err := parseFMP4Moof(buf, &init)
+		if err != nil {
+			return err
+		}
+
+		if moof.maxElapsed > seg.Duration {
+			seg.Duration = moof.maxElapsed
+		}
+
+		if moof.keyframe != nil {
+			seg.Keyframes = append(seg.Keyframes, IndexKeyframe{
+				Offset:   *moof.keyframe,
+				Position: pos,
+			})
+		}
+
+		pos += int64(moofSize) + int64(mdatSize)
+
+		_, err = r.Seek(pos, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readMPEGTSSegmentInfo(r io.Reader, seg *IndexSegment) error {
+	mr, err := mpegts.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+
+	for _, track := range mr.Tracks() {
+		seg.Codecs = append(seg.Codecs, mpegtsCodecName(track.Codec))
+	}
+
+	return nil
+}
+
+// readSegmentInfo fills size, codecs, duration and keyframes of a segment, by reading its file.
+// Duration and keyframes of MPEG-TS segments are not read.
+func readSegmentInfo(seg *IndexSegment, pathConf *conf.Path) error {
+	size, err := StatSegment(pathConf, seg.Fpath)
+	if err != nil {
+		return err
+	}
+
+	f, err := OpenSegment(pathConf, seg.Fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	seg.Size = size
+	seg.Codecs = nil
+	seg.Duration = 0
+	seg.Keyframes = nil
+
+	if pathConf.RecordFormat == conf.RecordFormatMPEGTS {
+		return readMPEGTSSegmentInfo(f, seg)
+	}
+
+	return readFMP4SegmentInfo(f, seg)
+}
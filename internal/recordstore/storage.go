@@ -0,0 +1,386 @@
+package recordstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+// storage is a place where segments and their sidecar files are stored.
+// Requests to remote storages are canceled with the context.
+type storage interface {
+	open(ctx context.Context, fpath string) (FileReader, error)
+	stat(ctx context.Context, fpath string) (int64, error)
+	put(ctx context.Context, fpath string, r io.ReaderAt, size int64) error
+	remove(ctx context.Context, fpath string) error
+	walk(ctx context.Context, commonPath string, cb func(fpath string) error) error
+}
+
+type localStorage struct{}
+
+func (localStorage) open(_ context.Context, fpath string) (FileReader, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (localStorage) stat(_ context.Context, fpath string) (int64, error) {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (localStorage) put(ctx context.Context, fpath string, r io.ReaderAt, size int64) error {
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// the extension is replaced, otherwise the temporary file would be decoded as a segment
+	tmpPath := strings.TrimSuffix(fpath, filepath.Ext(fpath)) + ".moving"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, io.NewSectionReader(&contextReaderAt{ctx: ctx, r: r}, 0, size))
+	if err == nil {
+		err = f.Sync()
+	}
+
+	err2 := f.Close()
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		os.Remove(tmpPath) //nolint:errcheck
+		return err
+	}
+
+	return os.Rename(tmpPath, fpath)
+}
+
+func (localStorage) remove(_ context.Context, fpath string) error {
+	return os.Remove(fpath)
+}
+
+func (localStorage) walk(_ context.Context, commonPath string, cb func(fpath string) error) error {
+	return filepath.Walk(commonPath, func(fpath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return cb(fpath)
+		}
+
+		return nil
+	})
+}
+
+type s3Storage struct {
+	c *s3Client
+}
+
+func (s *s3Storage) prefix() string {
+	return "s3://" + s.c.bucket + "/"
+}
+
+func (s *s3Storage) key(fpath string) string {
+	return strings.TrimPrefix(fpath, s.prefix())
+}
+
+func (s *s3Storage) open(ctx context.Context, fpath string) (FileReader, error) {
+	size, err := s.stat(ctx, fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3File{io.NewSectionReader(&s3Object{
+		ctx:  ctx,
+		c:    s.c,
+		key:  s.key(fpath),
+		size: size,
+	}, 0, size)}, nil
+}
+
+func (s *s3Storage) stat(ctx context.Context, fpath string) (int64, error) {
+	return s.c.headObject(ctx, s.key(fpath))
+}
+
+func (s *s3Storage) put(ctx context.Context, fpath string, r io.ReaderAt, size int64) error {
+	return s.c.putObject(ctx, s.key(fpath), r, size)
+}
+
+func (s *s3Storage) remove(ctx context.Context, fpath string) error {
+	return s.c.deleteObject(ctx, s.key(fpath))
+}
+
+func (s *s3Storage) walk(ctx context.Context, commonPath string, cb func(fpath string) error) error {
+	prefix := strings.TrimPrefix(strings.TrimPrefix(commonPath, "s3://"+s.c.bucket), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return s.c.listObjects(ctx, prefix, func(key string) error {
+		return cb(s.prefix() + key)
+	})
+}
+
+func isS3Path(fpath string) bool {
+	return strings.HasPrefix(fpath, "s3://")
+}
+
+func newStorage(tier conf.RecordTier) (storage, error) {
+	if !tier.IsS3() {
+		return localStorage{}, nil
+	}
+
+	c, err := newS3Client(tier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Storage{c: c}, nil
+}
+
+// storageForPath returns the storage that contains a file of a path.
+func storageForPath(pathConf *conf.Path, fpath string) (storage, error) {
+	if !isS3Path(fpath) {
+		return localStorage{}, nil
+	}
+
+	for _, tier := range pathConf.RecordTiers {
+		if tier.IsS3() {
+			bucket, _, _ := strings.Cut(strings.TrimPrefix(tier.Path, "s3://"), "/")
+			if strings.HasPrefix(fpath, "s3://"+bucket+"/") {
+				return newStorage(tier)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no record tier contains '%s'", fpath)
+}
+
+// recordLocation is a place where segments of a path are stored.
+type recordLocation struct {
+	recordPath string
+	storage    storage
+}
+
+// walk calls cb for every segment in the location.
+func (l *recordLocation) walk(cb func(fpath string, pa Path) error) error {
+	return l.storage.walk(context.Background(), CommonPath(l.recordPath), func(fpath string) error {
+		var pa Path
+		if pa.Decode(l.recordPath, fpath) {
+			return cb(fpath, pa)
+		}
+		return nil
+	})
+}
+
+// recordLocations returns the locations of the segments of a path:
+// the record path, followed by record tiers.
+// %path is replaced only when a path name is provided.
+func recordLocations(pathConf *conf.Path, pathName string) ([]*recordLocation, error) {
+	tiers := append([]conf.RecordTier{{Path: pathConf.RecordPath}}, pathConf.RecordTiers...)
+	ret := make([]*recordLocation, len(tiers))
+
+	for i, tier := range tiers {
+		recordPath := tier.Path
+		if pathName != "" {
+			recordPath = strings.ReplaceAll(recordPath, "%path", pathName)
+		}
+
+		st, err := newStorage(tier)
+		if err != nil {
+			return nil, err
+		}
+
+		ret[i] = &recordLocation{
+			// we have to convert to absolute paths
+			// otherwise, recordPath and fpath won't have common elements
+			recordPath: absPath(PathAddExtension(recordPath, pathConf.RecordFormat)),
+			storage:    st,
+		}
+	}
+
+	return ret, nil
+}
+
+// SegmentTier returns the tier that contains a segment.
+// 0 is the record path, 1 is the first record tier.
+func SegmentTier(pathConf *conf.Path, pathName string, fpath string) (int, error) {
+	locations, err := recordLocations(pathConf, pathName)
+	if err != nil {
+		return 0, err
+	}
+
+	// tiers are checked first, since the record path may match their files too
+	for i := len(locations) - 1; i >= 0; i-- {
+		var pa Path
+		if pa.Decode(locations[i].recordPath, fpath) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("'%s' is not a segment of path '%s'", fpath, pathName)
+}
+
+// FindSegmentPath returns the path of the segment that starts at given time, in any tier.
+func FindSegmentPath(pathConf *conf.Path, pathName string, start time.Time) (string, error) {
+	locations, err := recordLocations(pathConf, pathName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, loc := range locations {
+		fpath := Path{Start: start}.Encode(loc.recordPath)
+
+		_, err = loc.storage.stat(context.Background(), fpath)
+		if err == nil {
+			return fpath, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("segment not found: %w", os.ErrNotExist)
+}
+
+// StatSegment returns the size of a segment, as stored.
+func StatSegment(pathConf *conf.Path, fpath string) (int64, error) {
+	st, err := storageForPath(pathConf, fpath)
+	if err != nil {
+		return 0, err
+	}
+
+	return st.stat(context.Background(), fpath)
+}
+
+// IsRemoteSegment checks whether a segment is stored into an object storage.
+func IsRemoteSegment(fpath string) bool {
+	return isS3Path(fpath)
+}
+
+// CopySegment copies a segment and its sidecar files into a tier.
+// It returns the path of the copy.
+func CopySegment(ctx context.Context, pathConf *conf.Path, pathName string, fpath string, tier int) (string, error) {
+	locations, err := recordLocations(pathConf, pathName)
+	if err != nil {
+		return "", err
+	}
+
+	if tier <= 0 || tier >= len(locations) {
+		return "", fmt.Errorf("invalid tier: %d", tier)
+	}
+
+	src, err := storageForPath(pathConf, fpath)
+	if err != nil {
+		return "", err
+	}
+
+	cur, err := SegmentTier(pathConf, pathName, fpath)
+	if err != nil {
+		return "", err
+	}
+
+	var pa Path
+	pa.Decode(locations[cur].recordPath, fpath)
+
+	dst := locations[tier]
+	dstPath := Path{Start: pa.Start}.Encode(dst.recordPath)
+
+	// sidecar files are copied first, so that they're available when the segment is found
+	for _, sidecar := range []func(string) string{ThumbnailsPath, ManifestPath} {
+		err = copyFile(ctx, src, sidecar(fpath), dst.storage, sidecar(dstPath))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	err = copyFile(ctx, src, fpath, dst.storage, dstPath)
+	if err != nil {
+		return "", err
+	}
+
+	return dstPath, nil
+}
+
+func copyFile(ctx context.Context, src storage, srcPath string, dst storage, dstPath string) error {
+	size, err := src.stat(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := src.open(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = dst.put(ctx, dstPath, f, size)
+	if err != nil {
+		return err
+	}
+
+	dstSize, err := dst.stat(ctx, dstPath)
+	if err != nil {
+		return err
+	}
+
+	if dstSize != size {
+		return fmt.Errorf("size of '%s' is %d, expected %d", dstPath, dstSize, size)
+	}
+
+	return nil
+}
+
+// RemoveSegment removes a segment and its sidecar files.
+// Sidecar files are removed first, so that a failure leaves the segment untouched.
+func RemoveSegment(pathConf *conf.Path, fpath string) error {
+	st, err := storageForPath(pathConf, fpath)
+	if err != nil {
+		return err
+	}
+
+	for _, sidecar := range []string{ThumbnailsPath(fpath), ManifestPath(fpath)} {
+		err = st.remove(context.Background(), sidecar)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return st.remove(context.Background(), fpath)
+}
+
+// contextReaderAt stops reading when the context is canceled.
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return r.r.ReadAt(p, off)
+}
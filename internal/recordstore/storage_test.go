@@ -0,0 +1,211 @@
+package recordstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTiers(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s3 := &test.S3Server{
+		AccessKeyID: "myuser",
+		MaxKeys:     1,
+	}
+	s3.Initialize()
+	defer s3.Close()
+
+	keyPath := filepath.Join(dir, "keys")
+	err = os.WriteFile(keyPath, []byte("key1 "+testEncryptionKey1+"\n"), 0o644)
+	require.NoError(t, err)
+
+	pathConf := &conf.Path{
+		Name:                "~^.*$",
+		Regexp:              regexp.MustCompile("^.*$"),
+		RecordPath:          filepath.Join(dir, "hot", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat:        conf.RecordFormatFMP4,
+		RecordEncryption:    conf.RecordEncryptionAESGCM,
+		RecordEncryptionKey: keyPath,
+		RecordTiers: conf.RecordTiers{
+			{
+				After: conf.StringDuration(48 * time.Hour),
+				Path:  filepath.Join(dir, "warm", "%path/%Y-%m-%d_%H-%M-%S-%f"),
+			},
+			{
+				After:             conf.StringDuration(720 * time.Hour),
+				Path:              "s3://mybucket/%path/%Y-%m-%d_%H-%M-%S-%f",
+				S3Endpoint:        s3.URL(),
+				S3AccessKeyID:     "myuser",
+				S3SecretAccessKey: "mypass",
+			},
+		},
+	}
+
+	keys, err := PathKeyProvider(pathConf)
+	require.NoError(t, err)
+
+	err = os.MkdirAll(filepath.Join(dir, "hot", "mypath"), 0o755)
+	require.NoError(t, err)
+
+	seg1 := filepath.Join(dir, "hot", "mypath", "2015-05-19_22-15-25-000427.mp4")
+	seg2 := filepath.Join(dir, "hot", "mypath", "2016-05-19_22-15-25-000427.mp4")
+
+	writeEncryptedFile(t, seg1, keys, [][]byte{[]byte("0123456789")})
+	writeEncryptedFile(t, seg2, keys, [][]byte{[]byte("abcdefghij")})
+
+	err = os.WriteFile(ManifestPath(seg1), []byte("manifest"), 0o644)
+	require.NoError(t, err)
+
+	warm1, err := CopySegment(context.Background(), pathConf, "mypath", seg1, 1)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "warm", "mypath", "2015-05-19_22-15-25-000427.mp4"), warm1)
+
+	// the source is preferred until it is removed
+	segments, err := FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	require.Equal(t, seg1, segments[0].Fpath)
+
+	err = RemoveSegment(pathConf, seg1)
+	require.NoError(t, err)
+
+	_, err = os.Stat(ManifestPath(seg1))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	cold1, err := CopySegment(context.Background(), pathConf, "mypath", warm1, 2)
+	require.NoError(t, err)
+	require.Equal(t, "s3://mybucket/mypath/2015-05-19_22-15-25-000427.mp4", cold1)
+
+	err = RemoveSegment(pathConf, warm1)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"mypath/2015-05-19_22-15-25-000427.manifest",
+		"mypath/2015-05-19_22-15-25-000427.mp4",
+	}, s3.Keys("mybucket"))
+
+	// data is still encrypted in the object storage
+	byts, ok := s3.Object("mybucket", "mypath/2015-05-19_22-15-25-000427.mp4")
+	require.True(t, ok)
+	require.NotContains(t, string(byts), "0123456789")
+
+	require.Equal(t, []string{"mypath"}, FindAllPathsWithSegments(map[string]*conf.Path{"~^.*$": pathConf}))
+
+	segments, err = FindSegments(pathConf, "mypath")
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath: cold1,
+			Start: time.Date(2015, 5, 19, 22, 15, 25, 427000, time.Local),
+		},
+		{
+			Fpath: seg2,
+			Start: time.Date(2016, 5, 19, 22, 15, 25, 427000, time.Local),
+		},
+	}, segments)
+
+	tier, err := SegmentTier(pathConf, "mypath", cold1)
+	require.NoError(t, err)
+	require.Equal(t, 2, tier)
+
+	fpath, err := FindSegmentPath(pathConf, "mypath", segments[0].Start)
+	require.NoError(t, err)
+	require.Equal(t, cold1, fpath)
+
+	size, err := StatSegment(pathConf, cold1)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(byts)), size)
+
+	f, err := OpenSegment(pathConf, cold1)
+	require.NoError(t, err)
+	defer f.Close()
+
+	plain, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(plain))
+
+	err = RemoveSegment(pathConf, cold1)
+	require.NoError(t, err)
+	require.Empty(t, s3.Keys("mybucket"))
+
+	_, err = FindSegmentPath(pathConf, "mypath", segments[0].Start)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRecordTiersS3AccessDenied(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s3 := &test.S3Server{AccessKeyID: "myuser"}
+	s3.Initialize()
+	defer s3.Close()
+
+	pathConf := &conf.Path{
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+		RecordTiers: conf.RecordTiers{{
+			After:             conf.StringDuration(time.Hour),
+			Path:              "s3://mybucket/%path/%Y-%m-%d_%H-%M-%S-%f",
+			S3Endpoint:        s3.URL(),
+			S3AccessKeyID:     "otheruser",
+			S3SecretAccessKey: "mypass",
+		}},
+	}
+
+	_, err = FindSegments(pathConf, "mypath")
+	require.EqualError(t, err, "S3 error: AccessDenied (AccessDenied)")
+}
+
+func TestCopySegmentCanceled(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the object storage never replies
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	pathConf := &conf.Path{
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+		RecordTiers: conf.RecordTiers{{
+			After:      conf.StringDuration(time.Hour),
+			Path:       "s3://mybucket/%path/%Y-%m-%d_%H-%M-%S-%f",
+			S3Endpoint: srv.URL,
+		}},
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	seg := filepath.Join(dir, "mypath", "2015-05-19_22-15-25-000427.mp4")
+	err = os.WriteFile(seg, []byte{1, 2, 3, 4}, 0o644)
+	require.NoError(t, err)
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, ctxCancel)
+
+	_, err = CopySegment(ctx, pathConf, "mypath", seg, 1)
+	require.ErrorIs(t, err, context.Canceled)
+}
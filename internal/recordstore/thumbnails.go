@@ -0,0 +1,160 @@
+package recordstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/formats/fmp4"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+)
+
+// Thumbnail is a keyframe extracted from a segment.
+type Thumbnail struct {
+	// offset from the start of the segment
+	Offset time.Duration
+	// JPEG image (MJPEG) or access unit in AVCC format (H264, H265)
+	Payload []byte
+}
+
+// ThumbnailCodecSupported returns whether thumbnails can be extracted from a codec.
+func ThumbnailCodecSupported(codec fmp4.Codec) bool {
+	switch codec.(type) {
+	case *fmp4.CodecH264, *fmp4.CodecH265, *fmp4.CodecMJPEG:
+		return true
+	}
+	return false
+}
+
+// ThumbnailTrack returns the track thumbnails are extracted from.
+func ThumbnailTrack(tracks []*fmp4.InitTrack) *fmp4.InitTrack {
+	for _, track := range tracks {
+		if ThumbnailCodecSupported(track.Codec) {
+			return track
+		}
+	}
+	return nil
+}
+
+// ThumbnailsPath returns the path of the thumbnails of a segment.
+// The extension of the segment is replaced,
+// otherwise the file would be decoded as a segment.
+func ThumbnailsPath(segmentPath string) string {
+	return strings.TrimSuffix(segmentPath, filepath.Ext(segmentPath)) + ".thumbs"
+}
+
+// ThumbnailsWriter appends thumbnails to a file.
+type ThumbnailsWriter struct {
+	f         *os.File
+	encrypter *Encrypter
+}
+
+// CreateThumbnails creates a thumbnails file.
+// When keys are provided, the file is encrypted.
+func CreateThumbnails(fpath string, keys KeyProvider) (*ThumbnailsWriter, error) {
+	var encrypter *Encrypter
+
+	if keys != nil {
+		var err error
+		encrypter, err = NewEncrypter(keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypter != nil {
+		_, err = f.Write(encrypter.Header())
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return &ThumbnailsWriter{
+		f:         f,
+		encrypter: encrypter,
+	}, nil
+}
+
+// Write writes a thumbnail.
+func (w *ThumbnailsWriter) Write(th *Thumbnail) error {
+	buf := make([]byte, 12+len(th.Payload))
+	binary.BigEndian.PutUint64(buf, uint64(th.Offset))
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(th.Payload)))
+	copy(buf[12:], th.Payload)
+
+	if w.encrypter != nil {
+		buf = w.encrypter.Seal(buf)
+	}
+
+	_, err := w.f.Write(buf)
+	return err
+}
+
+// Close closes the file.
+func (w *ThumbnailsWriter) Close() error {
+	if w.encrypter != nil {
+		_, err := w.f.Write(w.encrypter.Final())
+		if err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+
+	return w.f.Close()
+}
+
+// ReadThumbnails reads all thumbnails of a segment of a path, in any tier.
+func ReadThumbnails(pathConf *conf.Path, segmentPath string) ([]*Thumbnail, error) {
+	f, err := OpenSegment(pathConf, ThumbnailsPath(segmentPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var ret []*Thumbnail
+	header := make([]byte, 12)
+
+	for {
+		_, err = io.ReadFull(br, header)
+		if err != nil {
+			break
+		}
+
+		th := &Thumbnail{
+			Offset:  time.Duration(binary.BigEndian.Uint64(header)),
+			Payload: make([]byte, binary.BigEndian.Uint32(header[8:])),
+		}
+
+		_, err = io.ReadFull(br, th.Payload)
+		if err != nil {
+			break
+		}
+
+		ret = append(ret, th)
+	}
+
+	// the last thumbnail may have been written partially
+	if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	return ret, nil
+}
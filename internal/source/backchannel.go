@@ -0,0 +1,244 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+
+	"github.com/ctenhank/mediamtx/internal/asyncwriter"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/stream"
+	"github.com/ctenhank/mediamtx/internal/unit"
+)
+
+const (
+	backChannelRetryPause = 2 * time.Second
+)
+
+// BackChannelPathSuffix is appended to the path name to obtain the path
+// whose audio is forwarded to the back channel.
+const BackChannelPathSuffix = "/talk"
+
+// PathManager is the path manager used by the RTSP source to read the back channel path.
+type PathManager interface {
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+func findBackChannel(desc *description.Session) *description.Media {
+	for _, medi := range desc.Medias {
+		if medi.IsBackChannel {
+			return medi
+		}
+	}
+	return nil
+}
+
+func withoutBackChannels(desc *description.Session) *description.Session {
+	medias := make([]*description.Media, 0, len(desc.Medias))
+	for _, medi := range desc.Medias {
+		if !medi.IsBackChannel {
+			medias = append(medias, medi)
+		}
+	}
+
+	ret := *desc
+	ret.Medias = medias
+	return &ret
+}
+
+// formatsCompatible checks whether RTP packets of a can be forwarded as b without transcoding.
+func formatsCompatible(a format.Format, b format.Format) bool {
+	switch ta := a.(type) {
+	case *format.G711:
+		tb, ok := b.(*format.G711)
+		return ok && ta.MULaw == tb.MULaw && ta.ClockRate() == tb.ClockRate() &&
+			ta.ChannelCount == tb.ChannelCount
+
+	case *format.MPEG4Audio:
+		tb, ok := b.(*format.MPEG4Audio)
+		return ok && ta.LATM == tb.LATM && ta.ClockRate() == tb.ClockRate()
+
+	default:
+		return a.Codec() == b.Codec() && a.ClockRate() == b.ClockRate()
+	}
+}
+
+// findCompatibleFormat returns the first track of desc that can be forwarded
+// as one of the formats offered by the back channel, and the matching offered format.
+func findCompatibleFormat(
+	desc *description.Session,
+	targets []format.Format,
+) (*description.Media, format.Format, format.Format) {
+	for _, medi := range desc.Medias {
+		for _, forma := range medi.Formats {
+			for _, target := range targets {
+				if formatsCompatible(forma, target) {
+					return medi, forma, target
+				}
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func pathFormats(desc *description.Session) []format.Format {
+	var ret []format.Format
+	for _, medi := range desc.Medias {
+		ret = append(ret, medi.Formats...)
+	}
+	return ret
+}
+
+func formatCodecs(formats []format.Format) string {
+	codecs := make([]string, len(formats))
+	for i, forma := range formats {
+		codecs[i] = forma.Codec()
+	}
+	return strings.Join(codecs, ", ")
+}
+
+// backChannel forwards audio published to the back channel path to the camera.
+type backChannel struct {
+	pathName       string
+	writeQueueSize int
+	client         *gortsplib.Client
+	media          *description.Media
+	pathManager    PathManager
+	parent         logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+
+	// in
+	chReaderClose chan struct{}
+
+	// out
+	done chan struct{}
+}
+
+func (b *backChannel) initialize() {
+	b.ctx, b.ctxCancel = context.WithCancel(context.Background())
+	b.chReaderClose = make(chan struct{}, 1)
+	b.done = make(chan struct{})
+
+	go b.run()
+}
+
+func (b *backChannel) close() {
+	b.ctxCancel()
+	<-b.done
+}
+
+// Log implements logger.Writer.
+func (b *backChannel) Log(level logger.Level, format string, args ...interface{}) {
+	b.parent.Log(level, "[back channel] "+format, args...)
+}
+
+// Close implements defs.Reader.
+// It is called by the path when the talk publisher goes away.
+func (b *backChannel) Close() {
+	select {
+	case b.chReaderClose <- struct{}{}:
+	default:
+	}
+}
+
+// APIReaderDescribe implements defs.Reader.
+func (*backChannel) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "rtspSourceBackChannel",
+		ID:   "",
+	}
+}
+
+func (b *backChannel) run() {
+	defer close(b.done)
+
+	for {
+		err := b.runSession()
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		b.Log(logger.Debug, "%v", err)
+
+		select {
+		case <-time.After(backChannelRetryPause):
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *backChannel) runSession() error {
+	// drain a stale close request of the previous session
+	select {
+	case <-b.chReaderClose:
+	default:
+	}
+
+	path, strm, err := b.pathManager.AddReader(defs.PathAddReaderReq{
+		Author: b,
+		AccessRequest: defs.PathAccessRequest{
+			Name:     b.pathName,
+			SkipAuth: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: b})
+
+	medi, forma, target := findCompatibleFormat(strm.Desc(), b.media.Formats)
+	if medi == nil {
+		err = fmt.Errorf("path '%s' does not contain a track compatible with the back channel "+
+			"(offered formats: %s, published formats: %s)",
+			b.pathName, formatCodecs(b.media.Formats), formatCodecs(pathFormats(strm.Desc())))
+		b.Log(logger.Warn, err.Error())
+
+		select {
+		case <-b.chReaderClose:
+		case <-b.ctx.Done():
+		}
+		return err
+	}
+
+	w := asyncwriter.New(b.writeQueueSize, b)
+
+	strm.AddReader(w, medi, forma, func(u unit.Unit) error {
+		for _, pkt := range u.GetRTPPackets() {
+			pkt2 := *pkt
+			pkt2.PayloadType = target.PayloadType()
+
+			err := b.client.WritePacketRTP(b.media, &pkt2)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	defer strm.RemoveReader(w)
+
+	b.Log(logger.Info, "forwarding %s from path '%s' to the camera (payload type %d)",
+		forma.Codec(), b.pathName, target.PayloadType())
+
+	w.Start()
+	defer w.Stop()
+
+	select {
+	case err := <-w.Error():
+		return err
+
+	case <-b.chReaderClose:
+		return fmt.Errorf("path '%s' is not published anymore", b.pathName)
+
+	case <-b.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
@@ -0,0 +1,95 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackChannelFormatsCompatible(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		a    format.Format
+		b    format.Format
+		ok   bool
+	}{
+		{
+			"g711 same",
+			&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1},
+			&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1},
+			true,
+		},
+		{
+			"g711 different law",
+			&format.G711{PayloadTyp: 8, MULaw: false, SampleRate: 8000, ChannelCount: 1},
+			&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1},
+			false,
+		},
+		{
+			"opus to g711",
+			&format.Opus{PayloadTyp: 111, ChannelCount: 1},
+			&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1},
+			false,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.ok, formatsCompatible(ca.a, ca.b))
+		})
+	}
+}
+
+func TestBackChannelWithoutBackChannels(t *testing.T) {
+	desc := &description.Session{
+		Medias: []*description.Media{
+			{
+				Type:    description.MediaTypeVideo,
+				Formats: []format.Format{&format.H264{PayloadTyp: 96, PacketizationMode: 1}},
+			},
+			{
+				Type:          description.MediaTypeAudio,
+				IsBackChannel: true,
+				Formats:       []format.Format{&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}},
+			},
+		},
+	}
+
+	require.Equal(t, desc.Medias[1], findBackChannel(desc))
+
+	stripped := withoutBackChannels(desc)
+	require.Equal(t, []*description.Media{desc.Medias[0]}, stripped.Medias)
+	require.Len(t, desc.Medias, 2)
+	require.Nil(t, findBackChannel(stripped))
+}
+
+func TestBackChannelFindCompatibleFormat(t *testing.T) {
+	pcmu := &format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}
+	pcma := &format.G711{PayloadTyp: 8, MULaw: false, SampleRate: 8000, ChannelCount: 1}
+
+	published := &description.Session{
+		Medias: []*description.Media{
+			{
+				Type:    description.MediaTypeVideo,
+				Formats: []format.Format{&format.H264{PayloadTyp: 96, PacketizationMode: 1}},
+			},
+			{
+				Type:    description.MediaTypeAudio,
+				Formats: []format.Format{&format.G711{PayloadTyp: 8, MULaw: false, SampleRate: 8000, ChannelCount: 1}},
+			},
+		},
+	}
+
+	// the published track matches a format that is not the first offered one
+	medi, forma, target := findCompatibleFormat(published, []format.Format{pcmu, pcma})
+	require.Equal(t, published.Medias[1], medi)
+	require.Equal(t, published.Medias[1].Formats[0], forma)
+	require.Equal(t, pcma, target)
+
+	medi, forma, target = findCompatibleFormat(published, []format.Format{pcmu})
+	require.Nil(t, medi)
+	require.Nil(t, forma)
+	require.Nil(t, target)
+
+	require.Equal(t, "H264, G711", formatCodecs(pathFormats(published)))
+}
@@ -0,0 +1,266 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+	"github.com/pion/rtp"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+)
+
+// ErrUnsupportedCodecs is returned when the source does not contain any supported codec.
+type ErrUnsupportedCodecs struct {
+	Codecs []string
+}
+
+// Error implements the error interface.
+func (e ErrUnsupportedCodecs) Error() string {
+	return fmt.Sprintf("the source does not contain any supported codec (%s)", strings.Join(e.Codecs, ", "))
+}
+
+func checkCodecs(desc *description.Session) error {
+	var codecs []string
+
+	for _, medi := range desc.Medias {
+		for _, forma := range medi.Formats {
+			if _, ok := forma.(*format.Generic); !ok {
+				return nil
+			}
+			codecs = append(codecs, forma.Codec())
+		}
+	}
+
+	return ErrUnsupportedCodecs{Codecs: codecs}
+}
+
+func errorCategory(err error) defs.APIPathSourceErrorCategory {
+	var errStatus liberrors.ErrClientBadStatusCode
+	if errors.As(err, &errStatus) {
+		switch errStatus.Code {
+		case base.StatusUnauthorized, base.StatusForbidden:
+			return defs.APIPathSourceErrorCategoryAuth
+
+		case base.StatusNotFound:
+			return defs.APIPathSourceErrorCategoryNotFound
+
+		case base.StatusUnsupportedMediaType:
+			return defs.APIPathSourceErrorCategoryUnsupportedCodec
+		}
+		return defs.APIPathSourceErrorCategoryOther
+	}
+
+	var errCodecs ErrUnsupportedCodecs
+	if errors.As(err, &errCodecs) {
+		return defs.APIPathSourceErrorCategoryUnsupportedCodec
+	}
+
+	var errUDPTimeout liberrors.ErrClientUDPTimeout
+	var errTCPTimeout liberrors.ErrClientTCPTimeout
+	var errNet net.Error
+	if errors.As(err, &errUDPTimeout) || errors.As(err, &errTCPTimeout) ||
+		(errors.As(err, &errNet) && errNet.Timeout()) {
+		return defs.APIPathSourceErrorCategoryTimeout
+	}
+
+	return defs.APIPathSourceErrorCategoryOther
+}
+
+// transportFromResponse returns the transport negotiated by a SETUP response,
+// with the names used by the rtspTransport setting.
+func transportFromResponse(res *base.Response) (string, bool) {
+	v, ok := res.Header["Transport"]
+	if !ok {
+		return "", false
+	}
+
+	var th headers.Transport
+	err := th.Unmarshal(v)
+	if err != nil {
+		return "", false
+	}
+
+	if th.Protocol == headers.TransportProtocolTCP {
+		return "tcp", true
+	}
+
+	if th.Delivery != nil && *th.Delivery == headers.TransportDeliveryMulticast {
+		return "multicast", true
+	}
+
+	return "udp", true
+}
+
+// rtpJitter computes the interarrival jitter of a RTP stream, as described in RFC3550.
+type rtpJitter struct {
+	clockRate   float64
+	initialized bool
+	lastTransit float64
+	jitter      float64
+}
+
+// update processes a packet and returns the jitter in seconds.
+func (j *rtpJitter) update(pkt *rtp.Packet, arrival time.Time) float64 {
+	if j.clockRate <= 0 {
+		return 0
+	}
+
+	transit := float64(arrival.UnixNano())*j.clockRate/float64(time.Second) - float64(pkt.Timestamp)
+
+	if j.initialized {
+		d := transit - j.lastTransit
+
+		// timestamp wrap around
+		if d > math.MaxUint32/2 {
+			d -= math.MaxUint32 + 1
+		} else if d < -math.MaxUint32/2 {
+			d += math.MaxUint32 + 1
+		}
+
+		j.jitter += (math.Abs(d) - j.jitter) / 16
+	}
+
+	j.initialized = true
+	j.lastTransit = transit
+
+	return j.jitter / j.clockRate
+}
+
+// diagnostics contains diagnostics of the source, across reconnections.
+type diagnostics struct {
+	mutex             sync.Mutex
+	started           bool
+	failed            bool
+	lastError         string
+	lastErrorCategory defs.APIPathSourceErrorCategory
+	lastErrorTime     time.Time
+	reconnects        uint64
+	transport         string
+	sdp               string
+	packetsReceived   uint64
+	packetsLost       uint64
+	jitters           []float64
+	lastPacketTime    time.Time
+}
+
+func (d *diagnostics) onRunStart() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.started && d.failed {
+		d.reconnects++
+	}
+
+	d.started = true
+	d.transport = ""
+	d.sdp = ""
+	d.jitters = nil
+}
+
+func (d *diagnostics) onRunEnd(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.failed = err != nil
+
+	if err != nil {
+		d.lastError = err.Error()
+		d.lastErrorCategory = errorCategory(err)
+		d.lastErrorTime = time.Now()
+	}
+}
+
+func (d *diagnostics) setTransport(transport string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.transport = transport
+}
+
+func (d *diagnostics) setDesc(desc *description.Session) {
+	byts, err := desc.Marshal(false)
+	if err != nil {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.sdp = string(byts)
+	d.jitters = make([]float64, len(desc.Medias))
+}
+
+func (d *diagnostics) onPacket(mediaIndex int, jitter float64, now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.packetsReceived++
+	d.lastPacketTime = now
+
+	if mediaIndex < len(d.jitters) {
+		d.jitters[mediaIndex] = jitter
+	}
+}
+
+func (d *diagnostics) onPacketLost(err error) {
+	var errLost liberrors.ErrClientRTPPacketsLost
+	if !errors.As(err, &errLost) {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.packetsLost += uint64(errLost.Lost)
+}
+
+func (d *diagnostics) describe() *defs.APIPathSourceDiagnostics {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ret := &defs.APIPathSourceDiagnostics{
+		Reconnects:         d.reconnects,
+		RTPPacketsReceived: d.packetsReceived,
+		RTPPacketsLost:     d.packetsLost,
+	}
+
+	if d.lastError != "" {
+		v1 := d.lastError
+		v2 := d.lastErrorCategory
+		v3 := d.lastErrorTime
+		ret.LastError = &v1
+		ret.LastErrorCategory = &v2
+		ret.LastErrorTime = &v3
+	}
+
+	if d.transport != "" {
+		v := d.transport
+		ret.Transport = &v
+	}
+
+	if d.sdp != "" {
+		v := d.sdp
+		ret.SDP = &v
+	}
+
+	for _, j := range d.jitters {
+		ret.RTPJitter = math.Max(ret.RTPJitter, j)
+	}
+
+	if !d.lastPacketTime.IsZero() {
+		v := d.lastPacketTime
+		ret.LastPacketTime = &v
+	}
+
+	return ret
+}
@@ -0,0 +1,178 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/conf"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/test"
+)
+
+func TestDiagnosticsErrorCategory(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		err  error
+		cat  defs.APIPathSourceErrorCategory
+	}{
+		{
+			"auth",
+			liberrors.ErrClientBadStatusCode{Code: base.StatusUnauthorized},
+			defs.APIPathSourceErrorCategoryAuth,
+		},
+		{
+			"not found",
+			fmt.Errorf("wrapped: %w", liberrors.ErrClientBadStatusCode{Code: base.StatusNotFound}),
+			defs.APIPathSourceErrorCategoryNotFound,
+		},
+		{
+			"timeout",
+			liberrors.ErrClientTCPTimeout{},
+			defs.APIPathSourceErrorCategoryTimeout,
+		},
+		{
+			"unsupported codec",
+			ErrUnsupportedCodecs{Codecs: []string{"Generic"}},
+			defs.APIPathSourceErrorCategoryUnsupportedCodec,
+		},
+		{
+			"other",
+			fmt.Errorf("connection refused"),
+			defs.APIPathSourceErrorCategoryOther,
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.cat, errorCategory(ca.err))
+		})
+	}
+}
+
+func TestDiagnosticsJitter(t *testing.T) {
+	j := &rtpJitter{clockRate: 90000}
+	now := time.Now()
+
+	// packets spaced exactly as their timestamps
+	for i := 0; i < 10; i++ {
+		v := j.update(&rtp.Packet{Header: rtp.Header{Timestamp: uint32(i * 3000)}},
+			now.Add(time.Duration(i)*time.Second/30))
+		require.InDelta(t, 0, v, 0.0001)
+	}
+
+	// a packet that arrives 16ms late
+	v := j.update(&rtp.Packet{Header: rtp.Header{Timestamp: 30000}},
+		now.Add(time.Second/3+16*time.Millisecond))
+	require.InDelta(t, 0.001, v, 0.0001)
+}
+
+func TestRTSPSourceDiagnostics(t *testing.T) {
+	var stream *gortsplib.ServerStream
+	var found atomic.Bool
+
+	media0 := test.UniqueMediaH264()
+
+	s := gortsplib.Server{
+		Handler: &testServer{
+			onDescribe: func(_ *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				if !found.Load() {
+					return &base.Response{
+						StatusCode: base.StatusNotFound,
+					}, nil, nil
+				}
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(_ *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					err := stream.WritePacketRTP(media0, &rtp.Packet{
+						Header: rtp.Header{
+							Version:        0x02,
+							PayloadType:    96,
+							SequenceNumber: 57899,
+							Timestamp:      345234345,
+							SSRC:           978651231,
+							Marker:         true,
+						},
+						Payload: []byte{5, 1, 2, 3, 4},
+					})
+					require.NoError(t, err)
+				}()
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "127.0.0.1:8555",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	stream = gortsplib.NewServerStream(&s, &description.Session{Medias: []*description.Media{media0}})
+	defer stream.Close()
+
+	var sp conf.RTSPTransport
+	sp.UnmarshalJSON([]byte(`"tcp"`)) //nolint:errcheck
+
+	var src *Source
+
+	te := test.NewSourceTester(
+		func(p defs.StaticSourceParent) defs.StaticSource {
+			src = &Source{
+				ReadTimeout:    conf.StringDuration(10 * time.Second),
+				WriteTimeout:   conf.StringDuration(10 * time.Second),
+				WriteQueueSize: 2048,
+				Parent:         p,
+			}
+
+			err = src.Run(defs.StaticSourceRunParams{
+				Context:        context.Background(),
+				ResolvedSource: "rtsp://127.0.0.1:8555/teststream",
+				Conf:           &conf.Path{RTSPTransport: sp},
+			})
+			require.Error(t, err)
+
+			d := src.APISourceDiagnostics()
+			require.Equal(t, defs.APIPathSourceErrorCategoryNotFound, *d.LastErrorCategory)
+			require.Equal(t, uint64(0), d.Reconnects)
+			require.Nil(t, d.SDP)
+
+			found.Store(true)
+			return src
+		},
+		"rtsp://127.0.0.1:8555/teststream",
+		&conf.Path{
+			RTSPTransport: sp,
+		},
+	)
+	defer te.Close()
+
+	<-te.Unit
+
+	d := src.APISourceDiagnostics()
+	require.Equal(t, uint64(1), d.Reconnects)
+	require.Equal(t, "tcp", *d.Transport)
+	require.NotNil(t, d.SDP)
+	require.Equal(t, uint64(1), d.RTPPacketsReceived)
+	require.NotNil(t, d.LastPacketTime)
+	require.Equal(t, defs.APIPathSourceErrorCategoryNotFound, *d.LastErrorCategory)
+}
@@ -0,0 +1,316 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+)
+
+// ErrSessionLimit is returned when a camera reached its maximum number of RTSP sessions.
+type ErrSessionLimit struct {
+	Camera      string
+	MaxSessions int
+}
+
+// Error implements the error interface.
+func (e ErrSessionLimit) Error() string {
+	return fmt.Sprintf("camera '%s' reached its limit of %d RTSP sessions", e.Camera, e.MaxSessions)
+}
+
+// SessionLimiterCamera contains the session settings of a camera.
+type SessionLimiterCamera struct {
+	Name        string
+	MaxSessions int
+	Share       bool
+	Paths       []string
+}
+
+// SessionTicket is a session granted by the SessionLimiter.
+type SessionTicket struct {
+	// name of the path whose session is shared, empty when the session is owned.
+	SharedFrom string
+
+	cam     *limitedCamera
+	path    string
+	source  string
+	revoked chan struct{}
+}
+
+// Revoked is closed when the session is not usable anymore and must be released,
+// that is when the session is shared and its owner released it.
+func (t *SessionTicket) Revoked() <-chan struct{} {
+	return t.revoked
+}
+
+type limitedCamera struct {
+	conf     SessionLimiterCamera
+	sessions map[string]*limitedSession
+	queue    []*sessionWaiter
+}
+
+type limitedSession struct {
+	ticket     *SessionTicket
+	source     string
+	sharedFrom string
+	since      time.Time
+}
+
+type sessionWaiter struct {
+	path   string
+	source string
+	since  time.Time
+	ticket *SessionTicket
+	ready  chan struct{}
+}
+
+// SessionLimiter limits the concurrent upstream RTSP sessions of cameras.
+// Paths of a camera that read the same source can share a single session.
+type SessionLimiter struct {
+	mutex   sync.Mutex
+	cameras map[string]*limitedCamera
+	paths   map[string]*limitedCamera
+}
+
+// SetCameras sets the cameras and the paths that belong to them.
+// Sessions in progress are kept.
+func (l *SessionLimiter) SetCameras(cameras []SessionLimiterCamera) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	oldCameras := l.cameras
+	l.cameras = make(map[string]*limitedCamera)
+	l.paths = make(map[string]*limitedCamera)
+
+	for _, c := range cameras {
+		cam, ok := oldCameras[c.Name]
+		if !ok {
+			cam = &limitedCamera{
+				sessions: make(map[string]*limitedSession),
+			}
+		}
+		cam.conf = c
+
+		l.cameras[c.Name] = cam
+		for _, p := range c.Paths {
+			l.paths[p] = cam
+		}
+
+		cam.grant()
+	}
+}
+
+// Acquire obtains a session for a path.
+// When the camera reached its limit, it waits until a session is released or ctx is canceled;
+// onWait is called before waiting.
+func (l *SessionLimiter) Acquire(
+	ctx context.Context,
+	path string,
+	source string,
+	share bool,
+	onWait func(error),
+) (*SessionTicket, error) {
+	l.mutex.Lock()
+
+	cam, ok := l.paths[path]
+	if !ok || (cam.conf.MaxSessions <= 0 && !cam.conf.Share) {
+		l.mutex.Unlock()
+		return &SessionTicket{}, nil
+	}
+
+	w := &sessionWaiter{
+		path:   path,
+		source: source,
+		since:  time.Now(),
+		ready:  make(chan struct{}),
+	}
+
+	if !share {
+		w.source = ""
+	}
+
+	cam.queue = append(cam.queue, w)
+	cam.grant()
+
+	if w.ticket != nil {
+		l.mutex.Unlock()
+		return w.ticket, nil
+	}
+
+	l.mutex.Unlock()
+
+	onWait(ErrSessionLimit{Camera: cam.conf.Name, MaxSessions: cam.conf.MaxSessions})
+
+	select {
+	case <-w.ready:
+		return w.ticket, nil
+
+	case <-ctx.Done():
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		// the session may have been granted in the meantime
+		if w.ticket != nil {
+			cam.release(w.ticket)
+		} else {
+			cam.removeWaiter(w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Release releases a session.
+func (l *SessionLimiter) Release(t *SessionTicket) {
+	if t.cam == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	t.cam.release(t)
+}
+
+// Status returns the sessions of a camera.
+func (l *SessionLimiter) Status(camera string) (*defs.ControlCameraSessions, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	cam, ok := l.cameras[camera]
+	if !ok {
+		return nil, false
+	}
+
+	ret := &defs.ControlCameraSessions{
+		Camera:      camera,
+		MaxSessions: cam.conf.MaxSessions,
+		Share:       cam.conf.Share,
+		Sessions:    []defs.ControlCameraSession{},
+	}
+
+	paths := make([]string, 0, len(cam.sessions))
+	for p := range cam.sessions {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		s := cam.sessions[p]
+		if s.sharedFrom != "" {
+			ret.Sessions = append(ret.Sessions, defs.ControlCameraSession{
+				Path:       p,
+				State:      defs.ControlCameraSessionShared,
+				SharedFrom: s.sharedFrom,
+				Since:      s.since,
+			})
+		} else {
+			ret.Active++
+			ret.Sessions = append(ret.Sessions, defs.ControlCameraSession{
+				Path:  p,
+				State: defs.ControlCameraSessionActive,
+				Since: s.since,
+			})
+		}
+	}
+
+	errLimit := ErrSessionLimit{Camera: camera, MaxSessions: cam.conf.MaxSessions}
+	for _, w := range cam.queue {
+		ret.Sessions = append(ret.Sessions, defs.ControlCameraSession{
+			Path:  w.path,
+			State: defs.ControlCameraSessionQueued,
+			Since: w.since,
+			Error: errLimit.Error(),
+		})
+	}
+
+	ret.LimitReached = cam.conf.MaxSessions > 0 && ret.Active >= cam.conf.MaxSessions
+
+	return ret, true
+}
+
+// owned returns the number of sessions opened with the camera.
+func (c *limitedCamera) owned() int {
+	n := 0
+	for _, s := range c.sessions {
+		if s.sharedFrom == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// sharable returns the path whose session reads the given source.
+func (c *limitedCamera) sharable(source string) string {
+	if !c.conf.Share || source == "" {
+		return ""
+	}
+
+	for p, s := range c.sessions {
+		if s.sharedFrom == "" && s.source == source {
+			return p
+		}
+	}
+	return ""
+}
+
+// grant assigns sessions to waiters, in order.
+func (c *limitedCamera) grant() {
+	remaining := c.queue[:0]
+
+	for _, w := range c.queue {
+		t := &SessionTicket{
+			cam:     c,
+			path:    w.path,
+			source:  w.source,
+			revoked: make(chan struct{}),
+		}
+
+		if owner := c.sharable(w.source); owner != "" {
+			t.SharedFrom = owner
+		} else if c.conf.MaxSessions > 0 && c.owned() >= c.conf.MaxSessions {
+			remaining = append(remaining, w)
+			continue
+		}
+
+		c.sessions[w.path] = &limitedSession{
+			ticket:     t,
+			source:     w.source,
+			sharedFrom: t.SharedFrom,
+			since:      time.Now(),
+		}
+		w.ticket = t
+		close(w.ready)
+	}
+
+	c.queue = remaining
+}
+
+func (c *limitedCamera) release(t *SessionTicket) {
+	if s, ok := c.sessions[t.path]; ok && s.ticket == t {
+		delete(c.sessions, t.path)
+
+		// sharers can't read from the owner anymore: their sessions are removed
+		// and they are asked to release their tickets and acquire new ones.
+		if s.sharedFrom == "" {
+			for p, s2 := range c.sessions {
+				if s2.sharedFrom == t.path {
+					delete(c.sessions, p)
+					close(s2.ticket.revoked)
+				}
+			}
+		}
+	}
+	c.grant()
+}
+
+func (c *limitedCamera) removeWaiter(w *sessionWaiter) {
+	for i, w2 := range c.queue {
+		if w2 == w {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return
+		}
+	}
+}
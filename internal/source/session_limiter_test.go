@@ -0,0 +1,210 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ctenhank/mediamtx/internal/defs"
+)
+
+func TestSessionLimiterQueue(t *testing.T) {
+	l := &SessionLimiter{}
+	l.SetCameras([]SessionLimiterCamera{{
+		Name:        "cam1",
+		MaxSessions: 1,
+		Paths:       []string{"cam1/main", "cam1/sub"},
+	}})
+
+	t1, err := l.Acquire(context.Background(), "cam1/main", "rtsp://cam1/main", false, nil)
+	require.NoError(t, err)
+	require.Equal(t, "", t1.SharedFrom)
+
+	waiting := make(chan error, 1)
+	acquired := make(chan *SessionTicket)
+
+	go func() {
+		t2, err2 := l.Acquire(context.Background(), "cam1/sub", "rtsp://cam1/sub", false, func(err error) {
+			waiting <- err
+		})
+		require.NoError(t, err2)
+		acquired <- t2
+	}()
+
+	err = <-waiting
+	require.EqualError(t, err, "camera 'cam1' reached its limit of 1 RTSP sessions")
+
+	status, ok := l.Status("cam1")
+	require.True(t, ok)
+	require.True(t, status.LimitReached)
+	require.Equal(t, 1, status.Active)
+	require.Len(t, status.Sessions, 2)
+	require.Equal(t, defs.ControlCameraSessionActive, status.Sessions[0].State)
+	require.Equal(t, "cam1/sub", status.Sessions[1].Path)
+	require.Equal(t, defs.ControlCameraSessionQueued, status.Sessions[1].State)
+	require.Equal(t, err.Error(), status.Sessions[1].Error)
+
+	l.Release(t1)
+
+	t2 := <-acquired
+	require.Equal(t, "", t2.SharedFrom)
+
+	status, _ = l.Status("cam1")
+	require.Len(t, status.Sessions, 1)
+	require.Equal(t, "cam1/sub", status.Sessions[0].Path)
+	require.Equal(t, defs.ControlCameraSessionActive, status.Sessions[0].State)
+}
+
+func TestSessionLimiterCancel(t *testing.T) {
+	l := &SessionLimiter{}
+	l.SetCameras([]SessionLimiterCamera{{
+		Name:        "cam1",
+		MaxSessions: 1,
+		Paths:       []string{"cam1/main", "cam1/sub"},
+	}})
+
+	_, err := l.Acquire(context.Background(), "cam1/main", "rtsp://cam1/main", false, nil)
+	require.NoError(t, err)
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer ctxCancel()
+
+	_, err = l.Acquire(ctx, "cam1/sub", "rtsp://cam1/sub", false, func(error) {})
+	require.Error(t, err)
+
+	status, _ := l.Status("cam1")
+	require.Len(t, status.Sessions, 1)
+}
+
+func TestSessionLimiterShare(t *testing.T) {
+	l := &SessionLimiter{}
+	l.SetCameras([]SessionLimiterCamera{{
+		Name:        "cam1",
+		MaxSessions: 1,
+		Share:       true,
+		Paths:       []string{"cam1/main", "cam1/copy"},
+	}})
+
+	t1, err := l.Acquire(context.Background(), "cam1/main", "rtsp://cam1/stream", true, nil)
+	require.NoError(t, err)
+
+	t2, err := l.Acquire(context.Background(), "cam1/copy", "rtsp://cam1/stream", true, nil)
+	require.NoError(t, err)
+	require.Equal(t, "cam1/main", t2.SharedFrom)
+
+	status, _ := l.Status("cam1")
+	require.Equal(t, 1, status.Active)
+	require.Equal(t, defs.ControlCameraSessionShared, status.Sessions[0].State)
+	require.Equal(t, "cam1/main", status.Sessions[0].SharedFrom)
+
+	l.Release(t2)
+	l.Release(t1)
+
+	status, _ = l.Status("cam1")
+	require.Empty(t, status.Sessions)
+}
+
+func TestSessionLimiterOwnerRelease(t *testing.T) {
+	l := &SessionLimiter{}
+	l.SetCameras([]SessionLimiterCamera{{
+		Name:        "cam1",
+		MaxSessions: 1,
+		Share:       true,
+		Paths:       []string{"cam1/main", "cam1/copy", "cam1/other"},
+	}})
+
+	t1, err := l.Acquire(context.Background(), "cam1/main", "rtsp://cam1/stream", true, nil)
+	require.NoError(t, err)
+
+	t2, err := l.Acquire(context.Background(), "cam1/copy", "rtsp://cam1/stream", true, nil)
+	require.NoError(t, err)
+	require.Equal(t, "cam1/main", t2.SharedFrom)
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+
+	waiting := make(chan struct{})
+	done := make(chan *SessionTicket)
+	go func() {
+		t3, err2 := l.Acquire(ctx, "cam1/other", "rtsp://cam1/other", true, func(error) { close(waiting) })
+		require.NoError(t, err2)
+		done <- t3
+	}()
+	<-waiting
+
+	// when the owner releases, the sharer is revoked and is not counted anymore
+	l.Release(t1)
+
+	select {
+	case <-t2.Revoked():
+	default:
+		t.Fatal("sharer was not revoked")
+	}
+
+	t3 := <-done
+	require.Empty(t, t3.SharedFrom)
+
+	status, _ := l.Status("cam1")
+	require.Equal(t, 1, status.Active)
+	require.Equal(t, []defs.ControlCameraSession{{
+		Path:  "cam1/other",
+		State: defs.ControlCameraSessionActive,
+		Since: status.Sessions[0].Since,
+	}}, status.Sessions)
+
+	// releasing the revoked ticket doesn't touch other sessions
+	l.Release(t2)
+	status, _ = l.Status("cam1")
+	require.Len(t, status.Sessions, 1)
+
+	// the sharer acquires again and waits for a free session
+	ctx2, ctx2Cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer ctx2Cancel()
+	_, err = l.Acquire(ctx2, "cam1/copy", "rtsp://cam1/stream", true, func(error) {})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	l.Release(t3)
+
+	t2, err = l.Acquire(context.Background(), "cam1/copy", "rtsp://cam1/stream", true, nil)
+	require.NoError(t, err)
+	require.Empty(t, t2.SharedFrom)
+}
+
+func TestSessionLimiterUnlimited(t *testing.T) {
+	l := &SessionLimiter{}
+	l.SetCameras([]SessionLimiterCamera{{
+		Name:  "cam1",
+		Paths: []string{"cam1/main"},
+	}})
+
+	for i := 0; i < 3; i++ {
+		_, err := l.Acquire(context.Background(), "cam1/main", "rtsp://cam1/main", false, nil)
+		require.NoError(t, err)
+	}
+
+	_, err := l.Acquire(context.Background(), "other", "rtsp://other", false, nil)
+	require.NoError(t, err)
+}
+
+func TestCloneDesc(t *testing.T) {
+	desc := &description.Session{
+		Medias: []*description.Media{{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		}},
+	}
+
+	desc2, err := cloneDesc(desc)
+	require.NoError(t, err)
+	require.Len(t, desc2.Medias, 1)
+	require.NotSame(t, desc.Medias[0], desc2.Medias[0])
+	require.NotSame(t, desc.Medias[0].Formats[0], desc2.Medias[0].Formats[0])
+	require.Equal(t, "H264", desc2.Medias[0].Formats[0].Codec())
+}
@@ -0,0 +1,176 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+
+	"github.com/ctenhank/mediamtx/internal/asyncwriter"
+	"github.com/ctenhank/mediamtx/internal/defs"
+	"github.com/ctenhank/mediamtx/internal/logger"
+	"github.com/ctenhank/mediamtx/internal/stream"
+	"github.com/ctenhank/mediamtx/internal/unit"
+)
+
+const (
+	sharedSourceRetryPause = 2 * time.Second
+)
+
+// cloneDesc returns a copy of a session description that does not share
+// medias and formats with the original one.
+func cloneDesc(desc *description.Session) (*description.Session, error) {
+	byts, err := desc.Marshal(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var sd sdp.SessionDescription
+	err = sd.Unmarshal(byts)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret description.Session
+	err = ret.Unmarshal(&sd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret.Medias) != len(desc.Medias) {
+		return nil, fmt.Errorf("unable to clone the session description")
+	}
+
+	for i, medi := range desc.Medias {
+		if len(ret.Medias[i].Formats) != len(medi.Formats) {
+			return nil, fmt.Errorf("unable to clone the session description")
+		}
+	}
+
+	return &ret, nil
+}
+
+// sharedReader reads the stream of the path that owns a shared session.
+type sharedReader struct {
+	chClose chan struct{}
+}
+
+// Close implements defs.Reader.
+// It is called by the path when its source goes away.
+func (r *sharedReader) Close() {
+	select {
+	case r.chClose <- struct{}{}:
+	default:
+	}
+}
+
+// APIReaderDescribe implements defs.Reader.
+func (*sharedReader) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "rtspSourceShared",
+		ID:   "",
+	}
+}
+
+// runShared forwards the stream of the path that owns the camera session.
+func (s *Source) runShared(params defs.StaticSourceRunParams, ticket *SessionTicket) error {
+	owner := ticket.SharedFrom
+
+	if s.PathManager == nil {
+		return fmt.Errorf("sharing sessions is not supported")
+	}
+
+	s.Log(logger.Info, "sharing the session of path '%s'", owner)
+
+	r := &sharedReader{
+		chClose: make(chan struct{}, 1),
+	}
+
+	var path defs.Path
+	var strm *stream.Stream
+
+	// the owner path may still be connecting to the camera
+	for {
+		var err error
+		path, strm, err = s.PathManager.AddReader(defs.PathAddReaderReq{
+			Author: r,
+			AccessRequest: defs.PathAccessRequest{
+				Name:     owner,
+				SkipAuth: true,
+			},
+		})
+		if err == nil {
+			break
+		}
+
+		var errNoStream defs.PathNoOnePublishingError
+		if !errors.As(err, &errNoStream) {
+			return err
+		}
+
+		select {
+		case <-time.After(sharedSourceRetryPause):
+		case <-ticket.Revoked():
+			return fmt.Errorf("path '%s' released its session", owner)
+		case <-params.Context.Done():
+			return nil
+		}
+	}
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: r})
+
+	desc, err := cloneDesc(strm.Desc())
+	if err != nil {
+		return err
+	}
+
+	res := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
+		Desc:               desc,
+		GenerateRTPPackets: false,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
+
+	w := asyncwriter.New(s.WriteQueueSize, s)
+
+	for i, medi := range strm.Desc().Medias {
+		for j, forma := range medi.Formats {
+			cmedi := desc.Medias[i]
+			cforma := desc.Medias[i].Formats[j]
+
+			strm.AddReader(w, medi, forma, func(u unit.Unit) error {
+				for _, pkt := range u.GetRTPPackets() {
+					pkt2 := *pkt
+					res.Stream.WriteRTPPacket(cmedi, cforma, &pkt2, u.GetNTP(), u.GetPTS())
+				}
+				return nil
+			})
+		}
+	}
+	defer strm.RemoveReader(w)
+
+	w.Start()
+	defer w.Stop()
+
+	for {
+		select {
+		case err := <-w.Error():
+			return err
+
+		case <-r.chClose:
+			return fmt.Errorf("path '%s' is not available anymore", owner)
+
+		case <-ticket.Revoked():
+			return fmt.Errorf("path '%s' released its session", owner)
+
+		case <-params.ReloadConf:
+
+		case <-params.Context.Done():
+			return nil
+		}
+	}
+}
@@ -2,6 +2,8 @@
 package source
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
@@ -65,7 +67,14 @@ type Source struct {
 	ReadTimeout    conf.StringDuration
 	WriteTimeout   conf.StringDuration
 	WriteQueueSize int
+	PathManager    PathManager
+	Sessions       *SessionLimiter
 	Parent         defs.StaticSourceParent
+
+	diag diagnostics
+
+	// sources where UDP did not work and TCP is used directly.
+	tcpSources sync.Map
 }
 
 // Log implements logger.Writer.
@@ -75,27 +84,96 @@ func (s *Source) Log(level logger.Level, format string, args ...interface{}) {
 
 // Run implements StaticSource.
 func (s *Source) Run(params defs.StaticSourceRunParams) error {
+	s.diag.onRunStart()
+	err := s.runLimited(params)
+	s.diag.onRunEnd(err)
+	return err
+}
+
+// runLimited obtains a session from the session limiter, if any, and reads the source.
+func (s *Source) runLimited(params defs.StaticSourceRunParams) error {
+	if s.Sessions == nil {
+		return s.runSession(params)
+	}
+
+	ticket, err := s.Sessions.Acquire(params.Context, params.Conf.Name, params.ResolvedSource,
+		s.PathManager != nil, func(err error) {
+			s.Log(logger.Warn, "%v, waiting for a free session", err)
+		})
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+	defer s.Sessions.Release(ticket)
+
+	if ticket.SharedFrom != "" {
+		return s.runShared(params, ticket)
+	}
+
+	return s.runSession(params)
+}
+
+// runSession opens a RTSP session with the source.
+func (s *Source) runSession(params defs.StaticSourceRunParams) error {
+	transport := params.Conf.RTSPTransport.Transport
+
+	if params.Conf.RTSPMulticastFallback == "" || transport == nil ||
+		*transport != gortsplib.TransportUDPMulticast {
+		return s.run(params, params.ResolvedSource, transport, nil)
+	}
+
+	var received atomic.Bool
+	err := s.run(params, params.ResolvedSource, transport, &received)
+	if err == nil || received.Load() {
+		return err
+	}
+
+	s.Log(logger.Warn, "no multicast packets received (%v), falling back to unicast", err)
+
+	return s.run(params, params.Conf.RTSPMulticastFallback, nil, nil)
+}
+
+// run reads from a source with the given transport.
+// received, when not nil, is set when the first packet arrives.
+func (s *Source) run(
+	params defs.StaticSourceRunParams,
+	source string,
+	transport *gortsplib.Transport,
+	received *atomic.Bool,
+) error {
 	s.Log(logger.Debug, "connecting")
 
+	if _, ok := s.tcpSources.Load(source); ok && transport == nil {
+		s.Log(logger.Debug, "using TCP since UDP did not work previously")
+		v := gortsplib.TransportTCP
+		transport = &v
+	}
+
 	decodeErrLogger := logger.NewLimitedLogger(s)
 
 	c := &gortsplib.Client{
-		Transport:      params.Conf.RTSPTransport.Transport,
-		TLSConfig:      tls.ConfigForFingerprint(params.Conf.SourceFingerprint),
-		ReadTimeout:    time.Duration(s.ReadTimeout),
-		WriteTimeout:   time.Duration(s.WriteTimeout),
-		WriteQueueSize: s.WriteQueueSize,
-		AnyPortEnable:  params.Conf.RTSPAnyPort,
+		Transport:           transport,
+		TLSConfig:           tls.ConfigForFingerprint(params.Conf.SourceFingerprint),
+		ReadTimeout:         time.Duration(s.ReadTimeout),
+		WriteTimeout:        time.Duration(s.WriteTimeout),
+		WriteQueueSize:      s.WriteQueueSize,
+		AnyPortEnable:       params.Conf.RTSPAnyPort,
+		RequestBackChannels: params.Conf.RTSPBackChannel && s.PathManager != nil,
 		OnRequest: func(req *base.Request) {
 			s.Log(logger.Debug, "[c->s] %v", req)
 		},
 		OnResponse: func(res *base.Response) {
 			s.Log(logger.Debug, "[s->c] %v", res)
+
+			if transport, ok := transportFromResponse(res); ok {
+				s.diag.setTransport(transport)
+			}
 		},
 		OnTransportSwitch: func(err error) {
 			s.Log(logger.Warn, err.Error())
+			s.tcpSources.Store(source, struct{}{})
 		},
 		OnPacketLost: func(err error) {
+			s.diag.onPacketLost(err)
 			decodeErrLogger.Log(logger.Warn, err.Error())
 		},
 		OnDecodeError: func(err error) {
@@ -108,7 +186,7 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 	// 	return err
 	// }
 
-	u, err := base.ParseURL(params.ResolvedSource)
+	u, err := base.ParseURL(source)
 	if err != nil {
 		return err
 	}
@@ -127,11 +205,25 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 				return err
 			}
 
+			err = checkCodecs(desc)
+			if err != nil {
+				return err
+			}
+
 			err = c.SetupAll(desc.BaseURL, desc.Medias)
 			if err != nil {
 				return err
 			}
 
+			backChannelMedia := findBackChannel(desc)
+			if backChannelMedia != nil {
+				desc = withoutBackChannels(desc)
+			} else if params.Conf.RTSPBackChannel {
+				s.Log(logger.Warn, "the source does not provide a back channel")
+			}
+
+			s.diag.setDesc(desc)
+
 			res := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
 				Desc:               desc,
 				GenerateRTPPackets: false,
@@ -142,12 +234,21 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 
 			defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
 
-			for _, medi := range desc.Medias {
+			for i, medi := range desc.Medias {
 				for _, forma := range medi.Formats {
 					cmedi := medi
 					cforma := forma
+					mediaIndex := i
+					jitter := &rtpJitter{clockRate: float64(forma.ClockRate())}
 
 					c.OnPacketRTP(cmedi, cforma, func(pkt *rtp.Packet) {
+						if received != nil {
+							received.Store(true)
+						}
+
+						now := time.Now()
+						s.diag.onPacket(mediaIndex, jitter.update(pkt, now), now)
+
 						pts, ok := c.PacketPTS(cmedi, pkt)
 						if !ok {
 							return
@@ -168,6 +269,19 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 				return err
 			}
 
+			if backChannelMedia != nil {
+				bc := &backChannel{
+					pathName:       params.Conf.Name + BackChannelPathSuffix,
+					writeQueueSize: s.WriteQueueSize,
+					client:         c,
+					media:          backChannelMedia,
+					pathManager:    s.PathManager,
+					parent:         s,
+				}
+				bc.initialize()
+				defer bc.close()
+			}
+
 			return c.Wait()
 		}()
 	}()
@@ -187,6 +301,11 @@ func (s *Source) Run(params defs.StaticSourceRunParams) error {
 	}
 }
 
+// APISourceDiagnostics implements defs.StaticSourceDiagnostics.
+func (s *Source) APISourceDiagnostics() *defs.APIPathSourceDiagnostics {
+	return s.diag.describe()
+}
+
 // APISourceDescribe implements StaticSource.
 func (*Source) APISourceDescribe() defs.APIPathSourceOrReader {
 	return defs.APIPathSourceOrReader{
@@ -353,3 +353,82 @@ func TestRTSPSourceRange(t *testing.T) {
 		})
 	}
 }
+
+func TestRTSPSourceMulticastFallback(t *testing.T) {
+	var stream *gortsplib.ServerStream
+
+	media0 := test.UniqueMediaH264()
+
+	var setupPaths []string
+
+	// the server has no multicast range, therefore multicast setups are refused.
+	s := gortsplib.Server{
+		Handler: &testServer{
+			onDescribe: func(_ *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onSetup: func(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+				setupPaths = append(setupPaths, ctx.Path)
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, stream, nil
+			},
+			onPlay: func(_ *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					err := stream.WritePacketRTP(media0, &rtp.Packet{
+						Header: rtp.Header{
+							Version:        0x02,
+							PayloadType:    96,
+							SequenceNumber: 57899,
+							Timestamp:      345234345,
+							SSRC:           978651231,
+							Marker:         true,
+						},
+						Payload: []byte{5, 1, 2, 3, 4},
+					})
+					require.NoError(t, err)
+				}()
+
+				return &base.Response{
+					StatusCode: base.StatusOK,
+				}, nil
+			},
+		},
+		RTSPAddress: "127.0.0.1:8555",
+	}
+
+	err := s.Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	stream = gortsplib.NewServerStream(&s, &description.Session{Medias: []*description.Media{media0}})
+	defer stream.Close()
+
+	var sp conf.RTSPTransport
+	sp.UnmarshalJSON([]byte(`"multicast"`)) //nolint:errcheck
+
+	te := test.NewSourceTester(
+		func(p defs.StaticSourceParent) defs.StaticSource {
+			return &Source{
+				ReadTimeout:    conf.StringDuration(10 * time.Second),
+				WriteTimeout:   conf.StringDuration(10 * time.Second),
+				WriteQueueSize: 2048,
+				Parent:         p,
+			}
+		},
+		"rtsp://127.0.0.1:8555/multicast",
+		&conf.Path{
+			RTSPTransport:         sp,
+			RTSPMulticastFallback: "rtsp://127.0.0.1:8555/unicast",
+		},
+	)
+	defer te.Close()
+
+	<-te.Unit
+
+	require.Equal(t, []string{"/unicast"}, setupPaths)
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// S3Server is a minimal in-memory S3-compatible object storage.
+// It supports PutObject, GetObject with ranges, HeadObject, DeleteObject and ListObjectsV2.
+type S3Server struct {
+	// if set, requests must be signed with this access key.
+	AccessKeyID string
+
+	// maximum number of keys returned by a list request.
+	MaxKeys int
+
+	mutex   sync.Mutex
+	objects map[string][]byte
+	srv     *httptest.Server
+}
+
+// Initialize initializes a S3Server.
+func (s *S3Server) Initialize() {
+	if s.MaxKeys == 0 {
+		s.MaxKeys = 1000
+	}
+	s.objects = make(map[string][]byte)
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+}
+
+// Close closes a S3Server.
+func (s *S3Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the endpoint of the server.
+func (s *S3Server) URL() string {
+	return s.srv.URL
+}
+
+// Object returns an object.
+func (s *S3Server) Object(bucket string, key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byts, ok := s.objects[bucket+"/"+key]
+	return byts, ok
+}
+
+// Keys returns the keys of all objects of a bucket.
+func (s *S3Server) Keys(bucket string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ret []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, bucket+"/") {
+			ret = append(ret, strings.TrimPrefix(k, bucket+"/"))
+		}
+	}
+
+	sort.Strings(ret)
+	return ret
+}
+
+func (s *S3Server) writeError(w http.ResponseWriter, statusCode int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	w.Write([]byte("<Error><Code>" + code + "</Code><Message>" + code + "</Message></Error>")) //nolint:errcheck
+}
+
+func (s *S3Server) handle(w http.ResponseWriter, r *http.Request) {
+	if s.AccessKeyID != "" &&
+		!strings.Contains(r.Header.Get("Authorization"), "Credential="+s.AccessKeyID+"/") {
+		s.writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, r, bucket)
+
+	case r.Method == http.MethodPut:
+		byts, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+
+		sum := sha256.Sum256(byts)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			s.writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+			return
+		}
+
+		s.objects[bucket+"/"+key] = byts
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		byts, ok := s.objects[bucket+"/"+key]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		statusCode := http.StatusOK
+
+		if rng := r.Header.Get("Range"); rng != "" {
+			startStr, endStr, _ := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+			start, _ := strconv.Atoi(startStr)
+			end, _ := strconv.Atoi(endStr)
+
+			if start >= len(byts) || end < start {
+				s.writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+
+			byts = byts[start:min(end+1, len(byts))]
+			statusCode = http.StatusPartialContent
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(byts)))
+		w.WriteHeader(statusCode)
+
+		if r.Method == http.MethodGet {
+			w.Write(byts) //nolint:errcheck
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(s.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+type s3ListResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+}
+
+func (s *S3Server) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	token := r.URL.Query().Get("continuation-token")
+
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, bucket+"/"+prefix) {
+			key := strings.TrimPrefix(k, bucket+"/")
+			if key > token {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var res s3ListResult
+
+	if len(keys) > s.MaxKeys {
+		keys = keys[:s.MaxKeys]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+
+	for _, k := range keys {
+		res.Contents = append(res.Contents, struct {
+			Key string `xml:"Key"`
+		}{k})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res) //nolint:errcheck
+}
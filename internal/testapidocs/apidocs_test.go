@@ -48,6 +48,10 @@ func TestAPIDocs(t *testing.T) {
 			"PathConfList",
 			defs.APIPathConfList{},
 		},
+		{
+			"CameraConfList",
+			defs.APICameraConfList{},
+		},
 		{
 			"Path",
 			defs.APIPath{},
@@ -56,6 +60,14 @@ func TestAPIDocs(t *testing.T) {
 			"PathList",
 			defs.APIPathList{},
 		},
+		{
+			"PathSourceDiagnostics",
+			defs.APIPathSourceDiagnostics{},
+		},
+		{
+			"PathSourceRetry",
+			defs.APIPathSourceRetry{},
+		},
 		{
 			"PathSource",
 			defs.APIPathSourceOrReader{},
@@ -84,6 +96,10 @@ func TestAPIDocs(t *testing.T) {
 			"RecordingSegment",
 			defs.APIRecordingSegment{},
 		},
+		{
+			"RecordIndexVerify",
+			defs.APIRecordIndexVerify{},
+		},
 		{
 			"RTMPConn",
 			defs.APIRTMPConn{},
@@ -140,7 +156,7 @@ func TestAPIDocs(t *testing.T) {
 			for i := 0; i < ty.NumField(); i++ {
 				sf := ty.Field(i)
 				js := sf.Tag.Get("json")
-				if js != "-" && js != "paths" && js != "pathDefaults" && !strings.Contains(js, ",omitempty") {
+				if js != "-" && js != "paths" && js != "pathDefaults" && js != "cameras" && !strings.Contains(js, ",omitempty") {
 					key2 = append(key2, js)
 				}
 			}